@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestListenPortConflict(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("binding a port to occupy: %v", err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	if l, err := listen("127.0.0.1", port, false); err == nil {
+		l.Close()
+		t.Fatal("binding an occupied port succeeded")
+	} else if !strings.Contains(err.Error(), "already in use") || !strings.Contains(err.Error(), "--port-fallback") {
+		t.Errorf("conflict error %q should name the problem and the fallback flag", err)
+	}
+
+	l, err := listen("127.0.0.1", port, true)
+	if err != nil {
+		t.Fatalf("fallback bind: %v", err)
+	}
+	defer l.Close()
+	if got := l.Addr().(*net.TCPAddr).Port; got == port {
+		t.Errorf("fallback bound the occupied port %d", got)
+	}
+}
+
+func TestListenDynamicPort(t *testing.T) {
+	l, err := listen("127.0.0.1", 0, false)
+	if err != nil {
+		t.Fatalf("dynamic bind: %v", err)
+	}
+	defer l.Close()
+	if l.Addr().(*net.TCPAddr).Port == 0 {
+		t.Error("dynamic bind reported port 0")
+	}
+}
@@ -0,0 +1,328 @@
+// Command sidecar runs the Copilot agent bridge: a small local HTTP server
+// the IDE plugin talks JSON-RPC to, which in turn drives the Copilot CLI.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/callback"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/server"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+func main() {
+	var (
+		host           = flag.String("host", "127.0.0.1", "interface to bind")
+		port           = flag.Int("port", 0, "port to bind (0 = dynamic)")
+		portFallback   = flag.Bool("port-fallback", false, "fall back to a dynamic port when the fixed --port is already in use")
+		portFile       = flag.String("port-file", "", "file to write the chosen port to")
+		authToken      = flag.String("auth-token", "", "bearer token required on every request")
+		configFile     = flag.String("config", "", "JSON file of hot-reloadable settings (authToken, createRateLimit, allowedPaths), applied at startup and re-read on SIGHUP")
+		oneShot        = flag.String("prompt", "", "one-shot mode: send this prompt, stream the reply to stdout, and exit without serving HTTP")
+		oneShotModel   = flag.String("model", "", "model for one-shot mode (empty = --default-model)")
+		callbackURL    = flag.String("callback", "", "plugin callback URL for tool execution")
+		mock           = flag.Bool("mock", false, "serve canned responses without the Copilot CLI")
+		cliPath        = flag.String("copilot-cli", "copilot", "path to the Copilot CLI binary")
+		recordFixture  = flag.String("record-fixture", "", "record every SDK turn to this fixture file for later replay")
+		replayFixture  = flag.String("replay-fixture", "", "serve recorded turns from this fixture file instead of the Copilot CLI")
+		skipReadiness  = flag.Bool("skip-readiness-probe", false, "do not wait for the CLI's model registry after starting it")
+		idleTimeout    = flag.Duration("idle-timeout", 30*time.Minute, "evict sessions idle longer than this (0 = never)")
+		maxSessionTTL  = flag.Duration("max-session-ttl", 24*time.Hour, "maximum per-session ttlSeconds override accepted by session.create")
+		maxTurnTime    = flag.Duration("max-turn-duration", 10*time.Minute, "hard ceiling on total turn duration including tool calls; session.create may lower but not raise this")
+		writeTimeout   = flag.Duration("stream-write-timeout", 30*time.Second, "per-write deadline on SSE streams; a client that stops reading is dropped after this")
+		noSubPause     = flag.Duration("no-subscriber-pause-after", 0, "buffer events into the ring only when no stream subscriber attaches this long after a turn starts (0 = never)")
+		noSubCancel    = flag.Duration("no-subscriber-cancel-after", 0, "cancel turns that still have no stream subscriber after this long (0 = never)")
+		coalesce       = flag.Bool("coalesce", false, "batch consecutive text frames on every session by default")
+		coalesceWindow = flag.Duration("coalesce-window", 30*time.Millisecond, "batching window for coalesced text frames")
+		paceCPS        = flag.Int("pace-chars-per-second", 0, "release text at this steady character rate instead of in SDK bursts (0 = off)")
+		maxToolIters   = flag.Int("max-tool-iterations", 32, "maximum tool calls per turn; session.send may lower but not raise this")
+		maxToolConc    = flag.Int("max-tool-concurrency", 1, "how many parallel-marked tool calls may execute through the callback at once")
+		maxConcTurns   = flag.Int("max-concurrent-turns", 0, "global cap on concurrently generating turns across all sessions (0 = unlimited)")
+		createRate     = flag.Float64("create-rate-limit", 0, "per-client cap on session.create calls per second, with an equal burst allowance (0 = unlimited)")
+		maxCtxItems    = flag.Int("max-context-items", 64, "maximum context items per send; sends may opt into truncation instead of rejection")
+		conciseTokens  = flag.Int("verbosity-concise-tokens", 256, "maxTokens applied by verbosity \"concise\" when the send gives none")
+		detailedTokens = flag.Int("verbosity-detailed-tokens", 4096, "maxTokens applied by verbosity \"detailed\" when the send gives none")
+		modelFallback  = flag.Bool("allow-model-fallback", false, "fall back to the first available model when the requested one is unavailable")
+		sumThreshold   = flag.Int("summarize-threshold", 0, "auto-summarize history past this many stored characters (0 = manual only)")
+		sumKeepTurns   = flag.Int("summarize-keep-turns", 4, "recent exchanges kept verbatim when history is summarized")
+		warmSessions   = flag.Int("warm-sessions", 0, "pre-create this many SDK sessions at startup for faster first use")
+		maxBodyBytes   = flag.Int64("max-body-bytes", 10<<20, "maximum /rpc request body size")
+		defaultModel   = flag.String("default-model", "gpt-4o", "model used when session.create omits one")
+		promptPrefix   = flag.String("prompt-prefix", "", "text prepended to every user prompt before sending; session.create may override")
+		promptSuffix   = flag.String("prompt-suffix", "", "text appended to every user prompt before sending; session.create may override")
+		transcriptDir  = flag.String("transcript-dir", "", "write per-session JSONL transcripts to this directory (contains prompts and responses)")
+		workspaceRoot  = flag.String("workspace-root", "", "confine session workingDir values to this directory (empty = anywhere)")
+		allowedPaths   = flag.String("allowed-paths", "", "comma-separated roots tool file operations are confined to (empty = no restriction)")
+		corsOrigins    = flag.String("cors-origins", "", "comma-separated origins allowed cross-origin access (empty = same-origin only)")
+		ttftWarn       = flag.Duration("ttft-warn-threshold", 0, "log a warning when a turn's time-to-first-token exceeds this (0 = never)")
+		debug          = flag.Bool("debug", false, "expose /debug/stats and pprof handlers")
+		shutdownGrace  = flag.Duration("shutdown-grace", 10*time.Second, "how long to let in-flight turns finish at shutdown")
+	)
+	callbackRoutes := make(mapFlag)
+	flag.Var(callbackRoutes, "callback-route", "route tool calls by name prefix, as prefix=url (repeatable); unmatched tools use --callback")
+	callbackHeaders := make(mapFlag)
+	flag.Var(callbackHeaders, "callback-header", "static header added to every callback request, as Name=value (repeatable)")
+	modelAliases := make(mapFlag)
+	flag.Var(modelAliases, "model-alias", "friendly model name, as alias=model (repeatable); aliases whose target vanished fall back to --default-model")
+	var redactPatterns listFlag
+	flag.Var(&redactPatterns, "redact-pattern", "regex whose matches in outgoing text frames are replaced with ***REDACTED*** (repeatable)")
+	var modelRoutes listFlag
+	flag.Var(&modelRoutes, "route-model", "route autoRoute sends whose prompt matches a regex to a model, as pattern=model (repeatable, first match wins)")
+	redactIgnoreCase := flag.Bool("redact-ignore-case", false, "make --redact-pattern matching case-insensitive")
+	flag.Parse()
+
+	cfg := server.Config{
+		AuthToken:               *authToken,
+		Mock:                    *mock,
+		MaxBodyBytes:            *maxBodyBytes,
+		DefaultModel:            *defaultModel,
+		PromptPrefix:            *promptPrefix,
+		PromptSuffix:            *promptSuffix,
+		ModelAliases:            modelAliases,
+		WorkspaceRoot:           *workspaceRoot,
+		AllowedPaths:            splitNonEmpty(*allowedPaths),
+		CORSOrigins:             splitNonEmpty(*corsOrigins),
+		TranscriptDir:           *transcriptDir,
+		MaxSessionTTL:           *maxSessionTTL,
+		MaxTurnDuration:         *maxTurnTime,
+		StreamWriteTimeout:      *writeTimeout,
+		NoSubscriberPauseAfter:  *noSubPause,
+		NoSubscriberCancelAfter: *noSubCancel,
+		Coalesce:                *coalesce,
+		CoalesceWindow:          *coalesceWindow,
+		PaceCharsPerSecond:      *paceCPS,
+		MaxToolIterations:       *maxToolIters,
+		MaxToolConcurrency:      *maxToolConc,
+		MaxConcurrentTurns:      *maxConcTurns,
+		CreateRateLimit:         *createRate,
+		MaxContextItems:         *maxCtxItems,
+		VerbosityConciseTokens:  *conciseTokens,
+		VerbosityDetailedTokens: *detailedTokens,
+		AllowModelFallback:      *modelFallback,
+		SummarizeThreshold:      *sumThreshold,
+		SummarizeKeepTurns:      *sumKeepTurns,
+		WarmSessions:            *warmSessions,
+		RedactPatterns:          redactPatterns,
+		RedactIgnoreCase:        *redactIgnoreCase,
+		ModelRoutes:             modelRoutes,
+		TTFTWarnThreshold:       *ttftWarn,
+		Debug:                   *debug,
+	}
+	if *configFile != "" {
+		rc, ignored, err := loadReloadable(*configFile, server.ReloadableConfig{
+			AuthToken:       cfg.AuthToken,
+			CreateRateLimit: cfg.CreateRateLimit,
+			AllowedPaths:    cfg.AllowedPaths,
+		})
+		if err != nil {
+			log.Fatalf("sidecar: %v", err)
+		}
+		warnIgnoredKeys(ignored)
+		cfg.AuthToken = rc.AuthToken
+		cfg.CreateRateLimit = rc.CreateRateLimit
+		cfg.AllowedPaths = rc.AllowedPaths
+	}
+	if *transcriptDir != "" {
+		if err := os.MkdirAll(*transcriptDir, 0o700); err != nil {
+			log.Fatalf("sidecar: creating transcript dir: %v", err)
+		}
+	}
+
+	if *replayFixture != "" && (*mock || *recordFixture != "") {
+		log.Fatalf("sidecar: --replay-fixture cannot be combined with --mock or --record-fixture")
+	}
+	if *recordFixture != "" && *mock {
+		log.Fatalf("sidecar: --record-fixture needs the real CLI; drop --mock")
+	}
+	var client copilot.Client
+	switch {
+	case *replayFixture != "":
+		replay, err := copilot.NewReplayClient(*replayFixture)
+		if err != nil {
+			log.Fatalf("sidecar: %v", err)
+		}
+		client = replay
+	case !*mock:
+		sdk := copilot.NewWithLazySDK(*cliPath)
+		if *skipReadiness {
+			sdk.DisableReadinessProbe()
+		}
+		client = sdk
+		if *recordFixture != "" {
+			client = copilot.NewRecordingClient(sdk, *recordFixture)
+		}
+	}
+	cb, err := callback.NewWithRoutes(*callbackURL, callbackRoutes)
+	if err != nil {
+		log.Fatalf("sidecar: %v", err)
+	}
+	if cb != nil && len(callbackHeaders) > 0 {
+		if err := cb.SetHeaders(callbackHeaders); err != nil {
+			log.Fatalf("sidecar: %v", err)
+		}
+	}
+	manager := session.NewManager(*idleTimeout)
+	srv, err := server.New(cfg, manager, client, cb)
+	if err != nil {
+		log.Fatalf("sidecar: %v", err)
+	}
+
+	if *oneShot != "" {
+		code := runOneShot(srv, cfg.AuthToken, *oneShotModel, *oneShot, os.Stdout, os.Stderr)
+		manager.CloseAll()
+		srv.Close()
+		if client != nil {
+			if err := client.Stop(); err != nil {
+				log.Printf("sidecar: stopping SDK client: %v", err)
+			}
+		}
+		os.Exit(code)
+	}
+
+	listener, err := listen(*host, *port, *portFallback)
+	if err != nil {
+		log.Fatalf("sidecar: %v", err)
+	}
+	chosenPort := listener.Addr().(*net.TCPAddr).Port
+	// The plugin parses this line from stdout to discover the port.
+	fmt.Printf("SIDECAR_PORT=%d\n", chosenPort)
+	if *portFile != "" {
+		if err := os.WriteFile(*portFile, []byte(fmt.Sprintf("%d\n", chosenPort)), 0o600); err != nil {
+			log.Fatalf("sidecar: writing port file: %v", err)
+		}
+	}
+
+	stop := make(chan struct{})
+	manager.StartEviction(stop)
+
+	httpServer := &http.Server{Handler: srv.Handler()}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("sidecar: serving: %v", err)
+		}
+	}()
+	log.Printf("sidecar: listening on %s:%d (mock=%v)", *host, chosenPort, *mock)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for got := range sig {
+		if got != syscall.SIGHUP {
+			break
+		}
+		// SIGHUP re-reads --config and applies the hot-reloadable subset to
+		// the running server. Sessions, in-flight turns and open streams
+		// survive; everything else keeps its startup value.
+		if *configFile == "" {
+			log.Printf("sidecar: SIGHUP ignored; no --config file to re-read")
+			continue
+		}
+		rc, ignored, err := loadReloadable(*configFile, srv.Reloadable())
+		if err != nil {
+			log.Printf("sidecar: reload: %v; keeping the current configuration", err)
+			continue
+		}
+		warnIgnoredKeys(ignored)
+		if err := srv.Reload(rc); err != nil {
+			log.Printf("sidecar: reload: %v; keeping the current configuration", err)
+			continue
+		}
+		log.Printf("sidecar: configuration reloaded from %s", *configFile)
+	}
+	log.Printf("sidecar: shutting down")
+	// Flip /readyz to 503 while the listener is still serving, so load
+	// balancers stop routing before in-flight turns start draining.
+	srv.BeginShutdown()
+	close(stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("sidecar: shutdown: %v", err)
+	}
+	// Drain before stopping the SDK client so in-flight generations can
+	// finish (or be cancelled cleanly) against a live SDK.
+	if !srv.Drain(*shutdownGrace) {
+		log.Printf("sidecar: shutdown grace period expired with turns in flight")
+	}
+	manager.CloseAll()
+	srv.Close()
+	if client != nil {
+		if err := client.Stop(); err != nil {
+			log.Printf("sidecar: stopping SDK client: %v", err)
+		}
+	}
+}
+
+// listen binds the serving address. A fixed port already held by another
+// process is the one bind failure the user can act on, so it is detected
+// specifically: with fallback enabled the sidecar retries on a dynamic port
+// (the chosen port is reported via stdout and --port-file as usual),
+// otherwise the error spells out the options instead of echoing EADDRINUSE.
+func listen(host string, port int, fallback bool) (net.Listener, error) {
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err == nil || port == 0 || !errors.Is(err, syscall.EADDRINUSE) {
+		if err != nil {
+			err = fmt.Errorf("listening on %s:%d: %w", host, port, err)
+		}
+		return l, err
+	}
+	if fallback {
+		log.Printf("sidecar: port %d is in use; falling back to dynamic allocation", port)
+		return net.Listen("tcp", fmt.Sprintf("%s:0", host))
+	}
+	return nil, fmt.Errorf("port %d is already in use; omit --port for dynamic allocation, pick another port, or pass --port-fallback", port)
+}
+
+// mapFlag collects repeated key=value flag occurrences into a map.
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	var parts []string
+	for k, v := range m {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m mapFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	m[key] = val
+	return nil
+}
+
+// listFlag collects repeated flag occurrences into a slice.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitNonEmpty splits a comma-separated flag value, dropping empty entries.
+func splitNonEmpty(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/server"
+)
+
+// One-shot mode: --prompt runs a single turn and exits, for scripting. It is
+// a thin wrapper over the same machinery the HTTP surface uses — the turn
+// goes through session.create and session.send exactly as a plugin send
+// would, including --mock, prompt wrapping and redaction — but the event
+// frames are read directly and written to stdout as plain text instead of
+// being served over SSE. No TCP listener is started.
+
+// runOneShot executes one prompt to completion and returns the process exit
+// code: 0 on success, 1 when the RPC or the turn itself failed. The response
+// text goes to stdout; diagnostics and the usage line go to stderr.
+func runOneShot(srv *server.Server, token, model, prompt string, stdout, stderr io.Writer) int {
+	params := map[string]any{}
+	if model != "" {
+		params["model"] = model
+	}
+	result, err := oneShotRPC(srv, token, "session.create", params)
+	if err != nil {
+		fmt.Fprintf(stderr, "sidecar: creating session: %v\n", err)
+		return 1
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		fmt.Fprintf(stderr, "sidecar: decoding create result: %v\n", err)
+		return 1
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	defer sess.AddSubscriber()()
+
+	if _, err := oneShotRPC(srv, token, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": prompt,
+	}); err != nil {
+		fmt.Fprintf(stderr, "sidecar: sending prompt: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	endedWithNewline := true
+	for raw := range sess.EventChan {
+		var f struct {
+			Type    string `json:"type"`
+			Content string `json:"content"`
+			Message string `json:"message"`
+			Stats   *struct {
+				TimeToFirstTokenMs int64   `json:"timeToFirstTokenMs"`
+				DurationMs         int64   `json:"durationMs"`
+				TokensPerSecond    float64 `json:"tokensPerSecond"`
+			} `json:"stats"`
+		}
+		if err := json.Unmarshal(raw, &f); err != nil {
+			continue
+		}
+		switch f.Type {
+		case "text":
+			fmt.Fprint(stdout, f.Content)
+			endedWithNewline = strings.HasSuffix(f.Content, "\n")
+		case "error", "timeout":
+			fmt.Fprintf(stderr, "sidecar: %s\n", f.Message)
+			code = 1
+		case "stats":
+			if f.Stats != nil {
+				fmt.Fprintf(stderr, "sidecar: first token %dms, total %dms, %.1f tokens/s\n",
+					f.Stats.TimeToFirstTokenMs, f.Stats.DurationMs, f.Stats.TokensPerSecond)
+			}
+		case "done":
+			if !endedWithNewline {
+				fmt.Fprintln(stdout)
+			}
+			if _, err := oneShotRPC(srv, token, "session.close", map[string]any{
+				"sessionId": created.SessionID,
+			}); err != nil {
+				fmt.Fprintf(stderr, "sidecar: closing session: %v\n", err)
+			}
+			return code
+		}
+	}
+	fmt.Fprintln(stderr, "sidecar: session ended before the turn completed")
+	return 1
+}
+
+// oneShotRPC drives one JSON-RPC call through the server handler in process.
+func oneShotRPC(srv *server.Server, token, method string, params any) (json.RawMessage, error) {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0", "id": 1, "method": method, "params": params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("%s: decoding response: %w", method, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("%s: %s (code %d)", method, resp.Error.Message, resp.Error.Code)
+	}
+	return resp.Result, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/server"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+func newOneShotServer(t *testing.T) *server.Server {
+	t.Helper()
+	srv, err := server.New(server.Config{Mock: true}, session.NewManager(time.Hour), nil, nil)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+	return srv
+}
+
+func TestOneShotStreamsReplyToStdout(t *testing.T) {
+	srv := newOneShotServer(t)
+	var stdout, stderr bytes.Buffer
+	if code := runOneShot(srv, "", "", "hello from a script", &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr.String())
+	}
+	if out := stdout.String(); !strings.Contains(out, "hello from a script") {
+		t.Errorf("stdout = %q, want the mock echo of the prompt", out)
+	}
+	if !strings.HasSuffix(stdout.String(), "\n") {
+		t.Error("stdout does not end with a newline")
+	}
+	if !strings.Contains(stderr.String(), "tokens/s") {
+		t.Errorf("stderr = %q, want the usage line", stderr.String())
+	}
+	// The one-shot session is closed on the way out, not leaked.
+	if n := len(srv.Manager().List()); n != 0 {
+		t.Errorf("%d sessions left behind", n)
+	}
+}
+
+func TestOneShotFailsNonZeroOnRPCError(t *testing.T) {
+	srv, err := server.New(server.Config{Mock: true, AuthToken: "secret"},
+		session.NewManager(time.Hour), nil, nil)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := runOneShot(srv, "wrong-token", "", "hi", &stdout, &stderr); code == 0 {
+		t.Fatal("exit code = 0 when every RPC is rejected")
+	}
+	if !strings.Contains(stderr.String(), "creating session") {
+		t.Errorf("stderr = %q, want the create failure", stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("stdout = %q, want nothing on failure", stdout.String())
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/server"
+)
+
+// loadReloadable reads the --config file: a JSON object holding the
+// hot-reloadable settings (authToken, createRateLimit, allowedPaths).
+// Keys the file omits keep their value from current, so a file that only
+// rotates the auth token does not silently lift the path allowlist. Keys
+// the file names but the sidecar cannot hot-reload (port, timeouts — all
+// flag-only) are returned in ignored for the caller to warn about.
+func loadReloadable(path string, current server.ReloadableConfig) (server.ReloadableConfig, []string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return current, nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return current, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	out := current
+	var ignored []string
+	for key, val := range fields {
+		var err error
+		switch key {
+		case "authToken":
+			err = json.Unmarshal(val, &out.AuthToken)
+		case "createRateLimit":
+			err = json.Unmarshal(val, &out.CreateRateLimit)
+		case "allowedPaths":
+			err = json.Unmarshal(val, &out.AllowedPaths)
+		default:
+			ignored = append(ignored, key)
+		}
+		if err != nil {
+			return current, nil, fmt.Errorf("%s: key %q: %w", path, key, err)
+		}
+	}
+	sort.Strings(ignored)
+	return out, ignored, nil
+}
+
+func warnIgnoredKeys(ignored []string) {
+	for _, key := range ignored {
+		log.Printf("sidecar: config key %q is not hot-reloadable and was ignored; set it with its command-line flag", key)
+	}
+}
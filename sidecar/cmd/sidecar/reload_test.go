@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/server"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sidecar.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	return path
+}
+
+func TestLoadReloadableMergesOverCurrent(t *testing.T) {
+	path := writeConfig(t, `{"authToken":"rotated","allowedPaths":["/srv/project"],"port":9999,"debug":true}`)
+	current := server.ReloadableConfig{AuthToken: "old", CreateRateLimit: 2}
+	rc, ignored, err := loadReloadable(path, current)
+	if err != nil {
+		t.Fatalf("loadReloadable: %v", err)
+	}
+	if rc.AuthToken != "rotated" {
+		t.Errorf("authToken = %q, want the file's value", rc.AuthToken)
+	}
+	if rc.CreateRateLimit != 2 {
+		t.Errorf("createRateLimit = %v, want the current value kept when the file omits it", rc.CreateRateLimit)
+	}
+	if !reflect.DeepEqual(rc.AllowedPaths, []string{"/srv/project"}) {
+		t.Errorf("allowedPaths = %v", rc.AllowedPaths)
+	}
+	if !reflect.DeepEqual(ignored, []string{"debug", "port"}) {
+		t.Errorf("ignored = %v, want the non-reloadable keys", ignored)
+	}
+}
+
+func TestLoadReloadableRejectsBadValues(t *testing.T) {
+	path := writeConfig(t, `{"createRateLimit":"fast"}`)
+	current := server.ReloadableConfig{AuthToken: "old"}
+	if _, _, err := loadReloadable(path, current); err == nil || !strings.Contains(err.Error(), "createRateLimit") {
+		t.Errorf("got %v, want an error naming the bad key", err)
+	}
+	if _, _, err := loadReloadable(writeConfig(t, "not json"), current); err == nil {
+		t.Error("malformed config accepted")
+	}
+	if _, _, err := loadReloadable(filepath.Join(t.TempDir(), "missing.json"), current); err == nil {
+		t.Error("missing config file accepted")
+	}
+}
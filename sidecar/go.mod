@@ -0,0 +1,5 @@
+module github.com/catatafishen/ide-agent-for-copilot/sidecar
+
+go 1.21
+
+require github.com/yuin/goldmark v1.7.4
@@ -0,0 +1,288 @@
+// Package callback implements the HTTP client the sidecar uses to call back
+// into the IDE plugin, primarily to execute tool calls in the editor.
+package callback
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTimeout bounds a single callback round trip. Tool execution in the
+// IDE (e.g. a file write plus reformat) can be slow, so this is generous.
+const defaultTimeout = 60 * time.Second
+
+// defaultStallTimeout bounds the silence between lines of a streaming tool
+// response. Each progress update resets it, so a tool that keeps reporting
+// (a test suite, a build) may run far longer than defaultTimeout; one that
+// goes quiet is cut off and reported as stalled.
+const defaultStallTimeout = defaultTimeout
+
+// ToolRequest is the payload POSTed to the plugin for a tool call. When
+// RequireApproval is true the plugin must confirm the call with the user
+// before executing it.
+type ToolRequest struct {
+	SessionID       string         `json:"sessionId"`
+	CallID          string         `json:"callId,omitempty"`
+	Tool            string         `json:"tool"`
+	Args            map[string]any `json:"args,omitempty"`
+	RequireApproval bool           `json:"requireApproval,omitempty"`
+}
+
+// ToolResponse is the plugin's reply to a tool call. A plugin that executed
+// the tool and saw it fail (e.g. a file write the OS denied) reports
+// {"success":false,"error":...}; the bridge forwards that to the model as a
+// failed tool result rather than dropping it. Success defaults to true when
+// omitted so plugins that return only result keep working.
+type ToolResponse struct {
+	Result  string `json:"result,omitempty"`
+	Success *bool  `json:"success,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Failed reports whether the plugin marked this tool call as failed, either
+// with an explicit success=false or by returning an error message.
+func (r *ToolResponse) Failed() bool {
+	if r.Success != nil {
+		return !*r.Success
+	}
+	return r.Error != ""
+}
+
+// ToolProgress is one incremental update from a plugin that streams a tool
+// execution; see ExecuteToolStream. Percent is nil when the plugin cannot
+// estimate completion.
+type ToolProgress struct {
+	Message string   `json:"message,omitempty"`
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// toolStreamLine is one line of a streaming (ndjson) tool response: a
+// progress update when Progress is set, otherwise the final ToolResponse.
+type toolStreamLine struct {
+	Progress *ToolProgress `json:"progress,omitempty"`
+	ToolResponse
+}
+
+// Client POSTs tool calls to the plugin's callback endpoints. Tools can be
+// routed to different endpoints by name prefix (e.g. file ops to the editor,
+// terminal ops to a terminal service), with the default URL as fallback.
+type Client struct {
+	url     string
+	routes  map[string]string // tool-name prefix -> URL
+	headers map[string]string // static headers added to every request
+	http    *http.Client
+	// stallTimeout is the watchdog budget per exchange: a plain JSON
+	// response must complete within it, a streaming one must emit its next
+	// line within it. Tests shorten it.
+	stallTimeout time.Duration
+}
+
+// headerNameRE matches RFC 7230 token characters, the only ones legal in a
+// header field name.
+var headerNameRE = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// SetHeaders configures static headers (e.g. Authorization for an auth
+// proxy in front of the plugin) added to every callback request. Header
+// names are validated; values are never logged.
+func (c *Client) SetHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !headerNameRE.MatchString(name) {
+			return fmt.Errorf("callback: invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("callback: header %q value contains line breaks", name)
+		}
+	}
+	c.headers = headers
+	if len(headers) > 0 {
+		names := make([]string, 0, len(headers))
+		for name := range headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Printf("callback: sending static headers: %s (values redacted)", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// New returns a Client for the given callback URL. An empty URL yields a nil
+// Client; callers treat that as "no callback configured".
+func New(pluginCallbackURL string) *Client {
+	c, err := NewWithRoutes(pluginCallbackURL, nil)
+	if err != nil {
+		// New is only reachable with routes=nil, which cannot fail.
+		panic(err)
+	}
+	return c
+}
+
+// NewWithRoutes returns a Client that routes tool calls whose name matches a
+// prefix in routes to that entry's URL, falling back to defaultURL. All URLs
+// are validated up front so a typo fails at startup, not mid-turn.
+func NewWithRoutes(defaultURL string, routes map[string]string) (*Client, error) {
+	if defaultURL == "" && len(routes) == 0 {
+		return nil, nil
+	}
+	if defaultURL != "" {
+		if err := validateURL(defaultURL); err != nil {
+			return nil, fmt.Errorf("callback: default URL: %w", err)
+		}
+	}
+	for prefix, u := range routes {
+		if prefix == "" {
+			return nil, fmt.Errorf("callback: route with empty tool prefix")
+		}
+		if err := validateURL(u); err != nil {
+			return nil, fmt.Errorf("callback: route %q: %w", prefix, err)
+		}
+	}
+	return &Client{
+		url:    defaultURL,
+		routes: routes,
+		// No overall http.Client timeout: a streaming tool response may
+		// legitimately outlive any fixed bound. The stall watchdog in
+		// ExecuteToolStream enforces liveness instead.
+		http:         &http.Client{},
+		stallTimeout: defaultStallTimeout,
+	}, nil
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q in %q", u.Scheme, raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host in %q", raw)
+	}
+	return nil
+}
+
+// URL returns the default callback URL.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// urlFor returns the callback URL for the given tool: the longest configured
+// prefix that matches the tool name wins, then the default.
+func (c *Client) urlFor(tool string) string {
+	best := c.url
+	bestLen := -1
+	for prefix, u := range c.routes {
+		if strings.HasPrefix(tool, prefix) && len(prefix) > bestLen {
+			best, bestLen = u, len(prefix)
+		}
+	}
+	return best
+}
+
+// ExecuteTool sends one tool call to the plugin and returns its result.
+// Progress updates from a streaming response, if any, are discarded.
+func (c *Client) ExecuteTool(ctx context.Context, req ToolRequest) (*ToolResponse, error) {
+	return c.ExecuteToolStream(ctx, req, nil)
+}
+
+// ExecuteToolStream sends one tool call to the plugin and returns its
+// result, forwarding incremental progress to onProgress along the way.
+//
+// The request advertises "Accept: application/x-ndjson". A plugin that
+// replies with plain application/json behaves exactly as before — one
+// ToolResponse object, the whole exchange bounded by the stall timeout. A
+// plugin that replies with Content-Type application/x-ndjson streams
+// newline-delimited JSON objects instead: any number of
+// {"progress":{"message":...,"percent":...}} lines followed by one final
+// ToolResponse object. Each line resets the stall watchdog, so a
+// long-running tool stays alive as long as it keeps reporting; a stream
+// that goes silent for the full stall timeout — or ends without a final
+// result — is an error.
+func (c *Client) ExecuteToolStream(ctx context.Context, req ToolRequest, onProgress func(ToolProgress)) (*ToolResponse, error) {
+	target := c.urlFor(req.Tool)
+	if target == "" {
+		return nil, fmt.Errorf("callback: no endpoint configured for tool %q", req.Tool)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/x-ndjson, application/json")
+	for name, value := range c.headers {
+		httpReq.Header.Set(name, value)
+	}
+	// The watchdog kills the exchange by cancelling its context; stalled
+	// distinguishes that from a caller-initiated cancellation.
+	var stalled atomic.Bool
+	watchdog := time.AfterFunc(c.stallTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer watchdog.Stop()
+	stallErr := func() error {
+		return fmt.Errorf("callback: %s: tool stalled (no response or progress for %s)", req.Tool, c.stallTimeout)
+	}
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		if stalled.Load() {
+			return nil, stallErr()
+		}
+		return nil, fmt.Errorf("callback: %s: %w", req.Tool, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("callback: %s: plugin returned %s", req.Tool, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/x-ndjson") {
+		// Plain response: one object, no watchdog resets, so the whole
+		// round trip keeps the historical single-timeout bound.
+		var out ToolResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			if stalled.Load() {
+				return nil, stallErr()
+			}
+			return nil, fmt.Errorf("callback: %s: decoding response: %w", req.Tool, err)
+		}
+		return &out, nil
+	}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var line toolStreamLine
+		if err := dec.Decode(&line); err != nil {
+			if stalled.Load() {
+				return nil, stallErr()
+			}
+			if err == io.EOF {
+				return nil, fmt.Errorf("callback: %s: stream ended without a final result", req.Tool)
+			}
+			return nil, fmt.Errorf("callback: %s: decoding stream: %w", req.Tool, err)
+		}
+		watchdog.Reset(c.stallTimeout)
+		if line.Progress != nil {
+			if onProgress != nil {
+				onProgress(*line.Progress)
+			}
+			continue
+		}
+		out := line.ToolResponse
+		return &out, nil
+	}
+}
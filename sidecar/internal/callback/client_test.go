@@ -0,0 +1,193 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewWithRoutesValidatesURLs(t *testing.T) {
+	cases := []struct {
+		name       string
+		defaultURL string
+		routes     map[string]string
+		wantErr    bool
+	}{
+		{"valid default only", "http://127.0.0.1:8765/tools", nil, false},
+		{"valid routes", "http://127.0.0.1:8765/tools", map[string]string{"file_": "http://127.0.0.1:8765/files"}, false},
+		{"bad scheme", "ftp://127.0.0.1/tools", nil, true},
+		{"missing host", "http:///tools", nil, true},
+		{"bad route URL", "http://127.0.0.1:8765/tools", map[string]string{"file_": "not a url"}, true},
+		{"empty prefix", "http://127.0.0.1:8765/tools", map[string]string{"": "http://127.0.0.1:8765/x"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewWithRoutes(tc.defaultURL, tc.routes)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("NewWithRoutes(%q, %v) error = %v, wantErr %v", tc.defaultURL, tc.routes, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestURLForPrefixRouting(t *testing.T) {
+	c, err := NewWithRoutes("http://default.example/tools", map[string]string{
+		"file_":       "http://files.example/tools",
+		"file_write":  "http://writes.example/tools",
+		"run_command": "http://terminal.example/tools",
+	})
+	if err != nil {
+		t.Fatalf("NewWithRoutes: %v", err)
+	}
+	cases := map[string]string{
+		"file_read":       "http://files.example/tools",
+		"file_write_text": "http://writes.example/tools", // longest prefix wins
+		"run_command":     "http://terminal.example/tools",
+		"search_text":     "http://default.example/tools",
+	}
+	for tool, want := range cases {
+		if got := c.urlFor(tool); got != want {
+			t.Errorf("urlFor(%q) = %q, want %q", tool, got, want)
+		}
+	}
+}
+
+func TestSetHeadersValidation(t *testing.T) {
+	c, err := NewWithRoutes("http://default.example/tools", nil)
+	if err != nil {
+		t.Fatalf("NewWithRoutes: %v", err)
+	}
+	if err := c.SetHeaders(map[string]string{"Authorization": "Bearer x", "X-Api-Key": "k"}); err != nil {
+		t.Errorf("valid headers rejected: %v", err)
+	}
+	if err := c.SetHeaders(map[string]string{"bad name": "x"}); err == nil {
+		t.Error("header name with space accepted")
+	}
+	if err := c.SetHeaders(map[string]string{"X-Key": "a\r\nInjected: b"}); err == nil {
+		t.Error("header value with CRLF accepted")
+	}
+}
+
+func TestExecuteToolSendsConfiguredHeaders(t *testing.T) {
+	var gotAuth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(ToolResponse{Result: "ok"})
+	}))
+	defer ts.Close()
+	c, err := NewWithRoutes(ts.URL, nil)
+	if err != nil {
+		t.Fatalf("NewWithRoutes: %v", err)
+	}
+	if err := c.SetHeaders(map[string]string{"Authorization": "Bearer sekrit"}); err != nil {
+		t.Fatalf("SetHeaders: %v", err)
+	}
+	if _, err := c.ExecuteTool(context.Background(), ToolRequest{Tool: "file_read"}); err != nil {
+		t.Fatalf("ExecuteTool: %v", err)
+	}
+	if gotAuth != "Bearer sekrit" {
+		t.Errorf("Authorization = %q, want configured value", gotAuth)
+	}
+}
+
+func TestExecuteToolRoutesByPrefix(t *testing.T) {
+	var gotPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewEncoder(w).Encode(ToolResponse{Result: "ok"})
+	}))
+	defer ts.Close()
+	c, err := NewWithRoutes(ts.URL+"/default", map[string]string{"file_": ts.URL + "/files"})
+	if err != nil {
+		t.Fatalf("NewWithRoutes: %v", err)
+	}
+	if _, err := c.ExecuteTool(context.Background(), ToolRequest{Tool: "file_read"}); err != nil {
+		t.Fatalf("ExecuteTool: %v", err)
+	}
+	if gotPath != "/files" {
+		t.Errorf("file_read routed to %q, want /files", gotPath)
+	}
+	if _, err := c.ExecuteTool(context.Background(), ToolRequest{Tool: "other"}); err != nil {
+		t.Fatalf("ExecuteTool: %v", err)
+	}
+	if gotPath != "/default" {
+		t.Errorf("other routed to %q, want /default", gotPath)
+	}
+}
+
+func TestExecuteToolStreamForwardsProgress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); !strings.Contains(accept, "application/x-ndjson") {
+			t.Errorf("Accept = %q, want ndjson advertised", accept)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher := w.(http.Flusher)
+		for i, pct := range []float64{25, 50, 75} {
+			fmt.Fprintf(w, `{"progress":{"message":"step %d","percent":%g}}`+"\n", i+1, pct)
+			flusher.Flush()
+		}
+		fmt.Fprintln(w, `{"result":"3 steps done"}`)
+	}))
+	defer ts.Close()
+	c, err := NewWithRoutes(ts.URL, nil)
+	if err != nil {
+		t.Fatalf("NewWithRoutes: %v", err)
+	}
+	var progress []ToolProgress
+	resp, err := c.ExecuteToolStream(context.Background(), ToolRequest{Tool: "run_tests"}, func(p ToolProgress) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatalf("ExecuteToolStream: %v", err)
+	}
+	if resp.Result != "3 steps done" || resp.Failed() {
+		t.Errorf("final response = %+v, want the last line's result", resp)
+	}
+	if len(progress) != 3 {
+		t.Fatalf("got %d progress updates, want 3: %+v", len(progress), progress)
+	}
+	if progress[1].Message != "step 2" || progress[1].Percent == nil || *progress[1].Percent != 50 {
+		t.Errorf("progress[1] = %+v, want step 2 at 50%%", progress[1])
+	}
+}
+
+func TestExecuteToolStreamStallAndTruncation(t *testing.T) {
+	stall := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"progress":{"message":"started"}}`)
+		w.(http.Flusher).Flush()
+		<-stall // never send the final result
+	}))
+	defer ts.Close()
+	defer close(stall)
+	c, err := NewWithRoutes(ts.URL, nil)
+	if err != nil {
+		t.Fatalf("NewWithRoutes: %v", err)
+	}
+	c.stallTimeout = 100 * time.Millisecond
+	_, err = c.ExecuteToolStream(context.Background(), ToolRequest{Tool: "run_tests"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Errorf("stalled stream: err = %v, want a stall error", err)
+	}
+
+	// A stream the plugin closes without a final result is an error too.
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"progress":{"message":"started"}}`)
+	}))
+	defer ts2.Close()
+	c2, err := NewWithRoutes(ts2.URL, nil)
+	if err != nil {
+		t.Fatalf("NewWithRoutes: %v", err)
+	}
+	if _, err := c2.ExecuteToolStream(context.Background(), ToolRequest{Tool: "run_tests"}, nil); err == nil ||
+		!strings.Contains(err.Error(), "without a final result") {
+		t.Errorf("truncated stream: err = %v, want a missing-result error", err)
+	}
+}
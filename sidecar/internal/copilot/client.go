@@ -0,0 +1,329 @@
+// Package copilot wraps the Copilot CLI SDK behind a small interface so the
+// rest of the sidecar can be tested against fakes and run in --mock mode
+// without a CLI installation.
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Model describes a model exposed by the Copilot CLI.
+type Model struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Vendor  string `json:"vendor,omitempty"`
+	Default bool   `json:"default,omitempty"`
+	// Capabilities lists optional features the model supports (e.g.
+	// "structured_output"). Empty means the CLI did not report capabilities
+	// and callers should not assume anything either way.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Deprecated marks models Copilot has scheduled for removal; the bridge
+	// warns sessions that select one. DeprecationMessage, when present,
+	// carries the CLI's guidance (timeline, suggested replacement).
+	Deprecated         bool   `json:"deprecated,omitempty"`
+	DeprecationMessage string `json:"deprecationMessage,omitempty"`
+}
+
+// CapabilityStructuredOutput marks models that can be constrained to emit
+// JSON (the responseFormat send option).
+const CapabilityStructuredOutput = "structured_output"
+
+// CapabilityCodeExecution marks models whose turns may run generated code in
+// the SDK's sandbox (the codeExecution send option).
+const CapabilityCodeExecution = "code_execution"
+
+// ContextItem is a piece of IDE context attached to a message. File ranges
+// are 1-based and inclusive.
+type ContextItem struct {
+	Type      string `json:"type,omitempty"` // "file" (default), "selection", "terminal"
+	File      string `json:"file,omitempty"`
+	StartLine int    `json:"startLine,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	Content   string `json:"content,omitempty"`
+	// Symbol names a code symbol the item refers to. The bridge renders a
+	// symbol without a line range as a labeled reference; when a range is
+	// also present the range wins and the symbol only labels it.
+	Symbol string `json:"symbol,omitempty"`
+	// Command, Output and ExitCode describe a "terminal" item: the command
+	// that ran, what it printed, and how it exited. The bridge formats them
+	// into Content before the item reaches the SDK.
+	Command  string `json:"command,omitempty"`
+	Output   string `json:"output,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	// RepoPath and Count describe a "gitLog" item: the repository whose
+	// recent commit subjects to attach and how many. The bridge runs git
+	// and formats the result into Content before the item reaches the SDK.
+	RepoPath string `json:"repoPath,omitempty"`
+	Count    int    `json:"count,omitempty"`
+	// Symbols carries a "symbolGraph" item's structured symbol metadata, as
+	// computed by the plugin's language server. The bridge formats the graph
+	// into Content before the item reaches the SDK.
+	Symbols []SymbolInfo `json:"symbols,omitempty"`
+	// Severity, Message, Line and Stacktrace describe a "diagnostic" item:
+	// one IDE inspection or compiler error, forwarded with its structure
+	// intact instead of pasted into the prompt. The bridge folds all of a
+	// send's diagnostic items into one labeled Content block before the
+	// item reaches the SDK; see the server's diagnostics.go.
+	Severity   string `json:"severity,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	Stacktrace string `json:"stacktrace,omitempty"`
+	// Handle references content uploaded earlier with files.upload; the
+	// bridge resolves it into Content before the item reaches the SDK, so
+	// recurring large attachments transmit once. Mutually exclusive with
+	// inline Content.
+	Handle string `json:"handle,omitempty"`
+	// Fetch asks the bridge to retrieve the file's content from the plugin
+	// over the callback channel instead of carrying it inline, keeping the
+	// send request small for huge attachments. The bridge clears the flag
+	// once Content is filled in; the SDK never sees it set.
+	Fetch bool `json:"fetch,omitempty"`
+	// Priority orders items for truncation when context must be shed to
+	// fit: higher values are kept longer, ties fall back to insertion
+	// order. The default 0 marks incidental context; user-pinned items
+	// should carry a positive priority.
+	Priority int `json:"priority,omitempty"`
+}
+
+// SymbolInfo is one entry in a "symbolGraph" context item: a code symbol as
+// the IDE's language server sees it. Name and Kind are required; the rest is
+// attached when the language server knows it.
+type SymbolInfo struct {
+	Name string `json:"name"`
+	// Kind is the language server's symbol kind ("function", "method",
+	// "struct", "interface", ...), passed through rather than constrained to
+	// an enum — kinds vary by language.
+	Kind      string `json:"kind"`
+	Signature string `json:"signature,omitempty"`
+	// File and Line locate the definition; Line is 1-based.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// Relations are this symbol's edges in the graph: who it calls, who
+	// calls it, what it implements.
+	Relations []SymbolRelation `json:"relations,omitempty"`
+}
+
+// SymbolRelation is one directed edge from a symbol to another, e.g.
+// {"kind":"calls","target":"dispatch"}. Typical kinds are "calls",
+// "calledBy", "implements", "implementedBy" and "references".
+type SymbolRelation struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+}
+
+// Tool describes a tool the CLI can route through the plugin callback.
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// SessionConfig carries per-session settings into CreateSession.
+type SessionConfig struct {
+	Model        string
+	SystemPrompt string
+	// WorkingDir is the base directory tools and relative file attachments
+	// resolve against. Empty means the SDK's own default.
+	WorkingDir string
+}
+
+// MessageRequest is one user turn sent into an SDK session.
+type MessageRequest struct {
+	Prompt      string
+	Context     []ContextItem
+	MaxTokens   int
+	Temperature float64
+	// ResponseFormat constrains the model's output: "" or "text" for free
+	// text, "json" for any JSON value, "json_schema" for JSON matching
+	// ResponseSchema.
+	ResponseFormat string
+	// ResponseSchema is the JSON Schema for ResponseFormat "json_schema".
+	ResponseSchema json.RawMessage
+	// Continue asks the SDK to resume the previous response from where it
+	// was truncated instead of answering a new prompt.
+	Continue bool
+	// Tools, when non-nil, names the only tools the SDK may expose for this
+	// turn. nil means all tools, subject to the usual permission flow.
+	Tools []string
+	// StopSequences asks generation to halt when any of these strings is
+	// produced. CLI builds that predate the option ignore it; the bridge
+	// detects the sequences server-side either way.
+	StopSequences []string
+	// CodeExecution enables the SDK's code-interpreter tool for this turn:
+	// generated code runs in the SDK's sandbox and its output streams back
+	// as "code_output" events. CLI builds without the tool ignore it.
+	CodeExecution bool
+}
+
+// Usage reports token accounting for a completed turn, when available.
+type Usage struct {
+	PromptTokens     int `json:"promptTokens,omitempty"`
+	CompletionTokens int `json:"completionTokens,omitempty"`
+}
+
+// MessageResponse is the terminal result of a turn.
+type MessageResponse struct {
+	MessageID string
+	// RequestID is the raw SDK request identifier, exactly as the Copilot
+	// CLI logs it. MessageID is the prefixed form ("msg-" + RequestID);
+	// keep the raw value so bridge logs can be correlated with CLI logs
+	// without un-prefixing.
+	RequestID string
+	Content   string
+	Usage     Usage
+	// FinishReason reports why generation stopped: "stop" (natural end),
+	// "length" (hit the token limit), or "" when the SDK did not say.
+	FinishReason string
+}
+
+// Citation identifies a source the model drew on — a referenced file or doc
+// — with an optional supporting snippet.
+type Citation struct {
+	Title   string `json:"title,omitempty"`
+	URI     string `json:"uri,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// StreamEvent is a single streamed event from the SDK for an in-flight turn.
+type StreamEvent struct {
+	Type       string // "text", "reasoning", "tool_call", "tool_result", "citation"
+	Content    string
+	ToolCallID string
+	ToolName   string
+	ToolArgs   map[string]any
+	// Citation carries the source on "citation" events and is nil otherwise.
+	Citation *Citation
+	// Parallel marks a tool_call the SDK considers independent of its
+	// neighbors, so the bridge may execute it alongside other parallel-marked
+	// calls. Unmarked calls carry ordering dependencies and run alone.
+	Parallel bool
+	// Stdout and Artifacts carry a "code_output" event: what the sandboxed
+	// code printed and any files it produced (a chart, a CSV). Only turns
+	// that requested code execution see these events.
+	Stdout    string
+	Artifacts []Artifact
+}
+
+// Artifact is one file produced by sandboxed code execution, delivered
+// inline by the SDK. The bridge moves the body into its file store and
+// hands clients a handle instead; see the server's code_output frames.
+type Artifact struct {
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// ToolResult carries the outcome of one executed tool call back to the SDK.
+type ToolResult struct {
+	CallID  string `json:"callId"`
+	Content string `json:"content,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// EventHandler receives streamed events for a turn as they arrive. Handlers
+// must not block; slow consumers should buffer on their side.
+type EventHandler func(StreamEvent)
+
+// ErrNotStarted is returned when an operation requires a running SDK client.
+var ErrNotStarted = errors.New("copilot: SDK client not started")
+
+// ErrModelNotFound is returned when a requested model is not available.
+var ErrModelNotFound = errors.New("copilot: model not found")
+
+// Error categories for failed turns. The bridge tags error frames with one
+// of these so a UI can pick the right reaction without parsing messages:
+// "application" means the model or platform rejected this particular turn
+// (refusal, content filter, quota) and retrying the same prompt will fail
+// the same way; "transport" means the turn itself was fine but the plumbing
+// failed, so a retry is worth offering.
+const (
+	ErrorCategoryApplication = "application"
+	ErrorCategoryTransport   = "transport"
+)
+
+// CLIError is an error the Copilot CLI itself reported in a response frame,
+// as opposed to a failure reaching or running the CLI. Method is the request
+// that failed; Message is the CLI's error text verbatim.
+type CLIError struct {
+	Method  string
+	Message string
+}
+
+func (e *CLIError) Error() string { return "copilot: " + e.Method + ": " + e.Message }
+
+// applicationErrorMarkers are the substrings (matched case-insensitively)
+// that identify a CLI error as application-level. The CLI reports errors as
+// free text, so this is a vocabulary, not a protocol; an unrecognized error
+// stays transport, where the UI's "retry" offer is the safe default.
+var applicationErrorMarkers = []string{
+	"content filter",
+	"content_filter",
+	"filtered",
+	"quota",
+	"rate limit",
+	"rate_limit",
+	"refused",
+	"refusal",
+	"blocked by policy",
+}
+
+// ErrorCategory classifies a failed turn's error. Only errors the CLI
+// itself reported can be application-level; anything else — a dead pipe, a
+// timeout, a context cancellation — is transport by construction.
+func ErrorCategory(err error) string {
+	var ce *CLIError
+	if !errors.As(err, &ce) {
+		return ErrorCategoryTransport
+	}
+	msg := strings.ToLower(ce.Message)
+	for _, marker := range applicationErrorMarkers {
+		if strings.Contains(msg, marker) {
+			return ErrorCategoryApplication
+		}
+	}
+	return ErrorCategoryTransport
+}
+
+// Client is the SDK surface the sidecar depends on.
+type Client interface {
+	// Start launches the underlying CLI. It is safe to call concurrently;
+	// only the first call does work.
+	Start(ctx context.Context) error
+	// Stop tears down the CLI and all sessions.
+	Stop() error
+	// CreateSession creates an SDK session and returns its ID.
+	CreateSession(ctx context.Context, cfg SessionConfig) (string, error)
+	// DestroySession destroys an SDK session.
+	DestroySession(ctx context.Context, sessionID string) error
+	// SendMessage sends one turn and blocks until it completes, invoking
+	// onEvent for each streamed event. Implementations must not invoke
+	// onEvent once SendMessage has returned — early cancellation returns
+	// included — because callers mutate unsynchronized turn state from the
+	// callback and close channels it writes to as soon as the send is over.
+	SendMessage(ctx context.Context, sessionID string, req MessageRequest, onEvent EventHandler) (*MessageResponse, error)
+	// SendToolResult feeds the outcome of a tool call back into the
+	// session so the model can continue the turn.
+	SendToolResult(ctx context.Context, sessionID string, result ToolResult) error
+	// CancelMessage cancels the in-flight turn on a session, if any.
+	CancelMessage(ctx context.Context, sessionID string) error
+	// ListModels returns the models available to the authenticated user.
+	ListModels(ctx context.Context) ([]Model, error)
+	// ListTools returns the tools the CLI can invoke.
+	ListTools(ctx context.Context) ([]Tool, error)
+}
+
+// startTimeout bounds how long a lazy Start may take before the first
+// request fails.
+const startTimeout = 30 * time.Second
+
+// readinessTimeout bounds how long the post-start readiness probe waits for
+// the CLI's model registry to come up; readinessPollInterval spaces the
+// probe attempts.
+const (
+	readinessTimeout      = 10 * time.Second
+	readinessPollInterval = 250 * time.Millisecond
+)
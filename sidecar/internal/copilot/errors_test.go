@@ -0,0 +1,29 @@
+package copilot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorCategory(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"quota", &CLIError{Method: "send", Message: "quota exceeded for this billing period"}, ErrorCategoryApplication},
+		{"content filter", &CLIError{Method: "send", Message: "response blocked: Content_Filter triggered"}, ErrorCategoryApplication},
+		{"refusal", &CLIError{Method: "send", Message: "the model refused to answer"}, ErrorCategoryApplication},
+		{"rate limit", &CLIError{Method: "send", Message: "Rate limit reached, slow down"}, ErrorCategoryApplication},
+		{"unrecognized CLI error", &CLIError{Method: "send", Message: "internal error in session handling"}, ErrorCategoryTransport},
+		{"wrapped CLI error", fmt.Errorf("sending: %w", &CLIError{Method: "send", Message: "quota exhausted"}), ErrorCategoryApplication},
+		{"plain error", errors.New("write to CLI: broken pipe"), ErrorCategoryTransport},
+		{"context cancelled", fmt.Errorf("copilot: waiting for CLI start: %w", errors.New("context canceled")), ErrorCategoryTransport},
+	}
+	for _, tc := range cases {
+		if got := ErrorCategory(tc.err); got != tc.want {
+			t.Errorf("%s: ErrorCategory(%v) = %q, want %q", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Record/replay: for deterministic plugin integration tests, a
+// RecordingClient wraps the real client and writes every turn — prompt,
+// streamed events, final response — plus the model and tool listings to a
+// fixture file; a ReplayClient then serves those turns back keyed by
+// prompt, with no CLI, network or auth involved. Mock mode serves canned
+// text; replay serves what Copilot actually said.
+
+// ErrPromptNotRecorded is returned by a ReplayClient for a prompt the
+// fixture has no turn for.
+var ErrPromptNotRecorded = errors.New("copilot: prompt not in replay fixture")
+
+// fixture is the JSON shape of a record/replay fixture file.
+type fixture struct {
+	Models []Model                `json:"models,omitempty"`
+	Tools  []Tool                 `json:"tools,omitempty"`
+	Turns  map[string]fixtureTurn `json:"turns"`
+}
+
+// fixtureTurn is one recorded send: the events streamed during it and the
+// final response.
+type fixtureTurn struct {
+	Events   []StreamEvent    `json:"events,omitempty"`
+	Response *MessageResponse `json:"response"`
+}
+
+// RecordingClient passes every call through to the wrapped client and
+// persists what it saw after each turn, so a crash mid-suite loses at most
+// the in-flight turn.
+type RecordingClient struct {
+	inner Client
+	path  string
+
+	mu  sync.Mutex
+	fix fixture
+}
+
+// NewRecordingClient wraps inner so all interactions are recorded to the
+// fixture file at path, overwriting whatever is there.
+func NewRecordingClient(inner Client, path string) *RecordingClient {
+	return &RecordingClient{inner: inner, path: path,
+		fix: fixture{Turns: make(map[string]fixtureTurn)}}
+}
+
+func (r *RecordingClient) Start(ctx context.Context) error { return r.inner.Start(ctx) }
+func (r *RecordingClient) Stop() error                     { return r.inner.Stop() }
+
+func (r *RecordingClient) CreateSession(ctx context.Context, cfg SessionConfig) (string, error) {
+	return r.inner.CreateSession(ctx, cfg)
+}
+
+func (r *RecordingClient) DestroySession(ctx context.Context, sessionID string) error {
+	return r.inner.DestroySession(ctx, sessionID)
+}
+
+func (r *RecordingClient) SendMessage(ctx context.Context, sessionID string, req MessageRequest, onEvent EventHandler) (*MessageResponse, error) {
+	var events []StreamEvent
+	var evMu sync.Mutex
+	resp, err := r.inner.SendMessage(ctx, sessionID, req, func(ev StreamEvent) {
+		evMu.Lock()
+		events = append(events, ev)
+		evMu.Unlock()
+		onEvent(ev)
+	})
+	if err != nil {
+		return resp, err
+	}
+	r.mu.Lock()
+	r.fix.Turns[req.Prompt] = fixtureTurn{Events: events, Response: resp}
+	r.saveLocked()
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *RecordingClient) SendToolResult(ctx context.Context, sessionID string, result ToolResult) error {
+	return r.inner.SendToolResult(ctx, sessionID, result)
+}
+
+func (r *RecordingClient) CancelMessage(ctx context.Context, sessionID string) error {
+	return r.inner.CancelMessage(ctx, sessionID)
+}
+
+func (r *RecordingClient) ListModels(ctx context.Context) ([]Model, error) {
+	models, err := r.inner.ListModels(ctx)
+	if err == nil {
+		r.mu.Lock()
+		r.fix.Models = models
+		r.saveLocked()
+		r.mu.Unlock()
+	}
+	return models, err
+}
+
+func (r *RecordingClient) ListTools(ctx context.Context) ([]Tool, error) {
+	tools, err := r.inner.ListTools(ctx)
+	if err == nil {
+		r.mu.Lock()
+		r.fix.Tools = tools
+		r.saveLocked()
+		r.mu.Unlock()
+	}
+	return tools, err
+}
+
+// saveLocked writes the fixture out; called with r.mu held. A failed write
+// must not fail the turn that triggered it — the recording is a side
+// effect — so it is reported on stderr instead of returned.
+func (r *RecordingClient) saveLocked() {
+	raw, err := json.MarshalIndent(r.fix, "", "  ")
+	if err == nil {
+		err = os.WriteFile(r.path, raw, 0o600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "copilot: writing fixture %s: %v\n", r.path, err)
+	}
+}
+
+// ReplayClient serves recorded turns from a fixture file. Session IDs are
+// minted locally; tool results and cancels are accepted and dropped, since
+// the recorded events already include whatever tool calls the original
+// turns made.
+type ReplayClient struct {
+	fix    fixture
+	nextID atomic.Int64
+}
+
+// NewReplayClient loads the fixture at path.
+func NewReplayClient(path string) (*ReplayClient, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("copilot: reading replay fixture: %w", err)
+	}
+	var fix fixture
+	if err := json.Unmarshal(raw, &fix); err != nil {
+		return nil, fmt.Errorf("copilot: parsing replay fixture %s: %w", path, err)
+	}
+	return &ReplayClient{fix: fix}, nil
+}
+
+func (r *ReplayClient) Start(ctx context.Context) error { return nil }
+func (r *ReplayClient) Stop() error                     { return nil }
+
+func (r *ReplayClient) CreateSession(ctx context.Context, cfg SessionConfig) (string, error) {
+	return fmt.Sprintf("replay-%d", r.nextID.Add(1)), nil
+}
+
+func (r *ReplayClient) DestroySession(ctx context.Context, sessionID string) error { return nil }
+
+func (r *ReplayClient) SendMessage(ctx context.Context, sessionID string, req MessageRequest, onEvent EventHandler) (*MessageResponse, error) {
+	turn, ok := r.fix.Turns[req.Prompt]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrPromptNotRecorded, req.Prompt)
+	}
+	for _, ev := range turn.Events {
+		onEvent(ev)
+	}
+	return turn.Response, nil
+}
+
+func (r *ReplayClient) SendToolResult(ctx context.Context, sessionID string, result ToolResult) error {
+	return nil
+}
+
+func (r *ReplayClient) CancelMessage(ctx context.Context, sessionID string) error { return nil }
+
+func (r *ReplayClient) ListModels(ctx context.Context) ([]Model, error) {
+	return r.fix.Models, nil
+}
+
+func (r *ReplayClient) ListTools(ctx context.Context) ([]Tool, error) {
+	return r.fix.Tools, nil
+}
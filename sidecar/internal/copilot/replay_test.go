@@ -0,0 +1,85 @@
+package copilot
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// scriptedClient is a minimal Client for exercising the recorder.
+type scriptedClient struct {
+	send func(ctx context.Context, sessionID string, req MessageRequest, onEvent EventHandler) (*MessageResponse, error)
+}
+
+func (c *scriptedClient) Start(ctx context.Context) error { return nil }
+func (c *scriptedClient) Stop() error                     { return nil }
+func (c *scriptedClient) CreateSession(ctx context.Context, cfg SessionConfig) (string, error) {
+	return "scripted-1", nil
+}
+func (c *scriptedClient) DestroySession(ctx context.Context, sessionID string) error { return nil }
+func (c *scriptedClient) SendMessage(ctx context.Context, sessionID string, req MessageRequest, onEvent EventHandler) (*MessageResponse, error) {
+	return c.send(ctx, sessionID, req, onEvent)
+}
+func (c *scriptedClient) SendToolResult(ctx context.Context, sessionID string, result ToolResult) error {
+	return nil
+}
+func (c *scriptedClient) CancelMessage(ctx context.Context, sessionID string) error { return nil }
+func (c *scriptedClient) ListModels(ctx context.Context) ([]Model, error) {
+	return []Model{{ID: "gpt-4o", Default: true}}, nil
+}
+func (c *scriptedClient) ListTools(ctx context.Context) ([]Tool, error) {
+	return []Tool{{Name: "read_file"}}, nil
+}
+
+func TestRecordThenReplayRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	inner := &scriptedClient{
+		send: func(ctx context.Context, sessionID string, req MessageRequest, onEvent EventHandler) (*MessageResponse, error) {
+			onEvent(StreamEvent{Type: "text", Content: "recorded "})
+			onEvent(StreamEvent{Type: "text", Content: "reply"})
+			return &MessageResponse{MessageID: "msg-rec", Content: "recorded reply", FinishReason: "stop"}, nil
+		},
+	}
+	rec := NewRecordingClient(inner, path)
+	ctx := context.Background()
+	if _, err := rec.ListModels(ctx); err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	var liveEvents int
+	resp, err := rec.SendMessage(ctx, "scripted-1", MessageRequest{Prompt: "hello"}, func(ev StreamEvent) {
+		liveEvents++
+	})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if liveEvents != 2 {
+		t.Errorf("recorder delivered %d live events, want 2", liveEvents)
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("loading fixture: %v", err)
+	}
+	models, _ := replay.ListModels(ctx)
+	if len(models) != 1 || models[0].ID != "gpt-4o" {
+		t.Errorf("replayed models = %v", models)
+	}
+	var replayed []string
+	got, err := replay.SendMessage(ctx, "replay-1", MessageRequest{Prompt: "hello"}, func(ev StreamEvent) {
+		replayed = append(replayed, ev.Content)
+	})
+	if err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	if got.Content != resp.Content || got.FinishReason != "stop" {
+		t.Errorf("replayed response = %+v, want the recorded one", got)
+	}
+	if len(replayed) != 2 || replayed[0]+replayed[1] != "recorded reply" {
+		t.Errorf("replayed events = %v", replayed)
+	}
+
+	if _, err := replay.SendMessage(ctx, "replay-1", MessageRequest{Prompt: "never seen"}, func(StreamEvent) {}); !errors.Is(err, ErrPromptNotRecorded) {
+		t.Errorf("unrecorded prompt: got %v, want ErrPromptNotRecorded", err)
+	}
+}
@@ -0,0 +1,534 @@
+package copilot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SDKClient drives the Copilot CLI over a newline-delimited JSON stdio
+// protocol. The CLI is started lazily on first use so that the sidecar can
+// come up (and serve /health) before the CLI finishes its own startup.
+type SDKClient struct {
+	cliPath string
+	cliArgs []string
+
+	mu            sync.Mutex
+	started       bool
+	skipReadiness bool
+	cmd           *exec.Cmd
+	stdin         io.WriteCloser
+
+	reqID   atomic.Int64
+	pending sync.Map // request id -> chan cliMessage
+	events  sync.Map // session id -> *sessionHandler
+
+	// ready mirrors started and startingSince tracks an in-flight start
+	// (unix nanos, zero when none), so TryStart can report progress without
+	// queueing on mu behind the start itself.
+	ready         atomic.Bool
+	startingSince atomic.Int64
+
+	// orphanEvents counts CLI events that arrived for a session with no
+	// registered handler — after a CLI reconnect or crash recovery it may
+	// replay events the bridge no longer has state for. Dropped and
+	// counted, never a crash; a climbing count signals a state-sync bug.
+	orphanEvents atomic.Int64
+
+	// startMu guards startCh and startErr: a tiny singleflight around the
+	// CLI start, so waiters block on a channel (and their own context)
+	// instead of on mu behind the start. startCh is nil when no start has
+	// run, open while one is in flight, and stays closed after success;
+	// a failed start resets it so the next caller retries.
+	startMu  sync.Mutex
+	startCh  chan struct{}
+	startErr error
+}
+
+// sessionHandler wraps a turn's EventHandler so deregistration can
+// synchronize with dispatch: readLoop invokes fn under mu and removeHandler
+// nils it under the same mu, so once removeHandler returns no callback is
+// running and none can start. Without this, a SendMessage that returns
+// early on context cancellation would race its caller against an event
+// still being dispatched — the caller's turn state is not built for that.
+type sessionHandler struct {
+	mu sync.Mutex
+	fn EventHandler
+}
+
+// cliMessage is one frame of the stdio protocol, in either direction.
+type cliMessage struct {
+	ID        int64           `json:"id,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Event     *StreamEvent    `json:"event,omitempty"`
+}
+
+// NewWithLazySDK returns an SDKClient that will start the CLI at cliPath on
+// first use rather than immediately.
+func NewWithLazySDK(cliPath string, args ...string) *SDKClient {
+	return &SDKClient{cliPath: cliPath, cliArgs: args}
+}
+
+// DisableReadinessProbe skips the post-start readiness check for users who
+// would rather take the occasional cold-start failure than the extra wait.
+func (c *SDKClient) DisableReadinessProbe() {
+	c.mu.Lock()
+	c.skipReadiness = true
+	c.mu.Unlock()
+}
+
+// ensureStarted makes sure the CLI is running, starting it if needed.
+// Concurrent callers share one start attempt: the first to arrive kicks it
+// off and everyone waits on its completion channel — against their own
+// context, so a client that gives up (an HTTP request cancelled mid
+// session.create) abandons only its wait. The start itself runs detached
+// with its own startTimeout budget and completes for the remaining waiters;
+// cancelling it outright would waste the work everyone else is queued on.
+func (c *SDKClient) ensureStarted(ctx context.Context) error {
+	if c.ready.Load() {
+		return nil
+	}
+	c.startMu.Lock()
+	ch := c.startCh
+	if ch == nil {
+		ch = make(chan struct{})
+		c.startCh = ch
+		go c.runStart(ch)
+	}
+	c.startMu.Unlock()
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		return fmt.Errorf("copilot: waiting for CLI start: %w", ctx.Err())
+	}
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+	return c.startErr
+}
+
+// runStart performs one CLI start attempt and publishes the result on done.
+// Before marking the client started it probes the CLI with a cheap
+// list_models call: the process accepting stdio does not mean its model
+// registry is loaded, and without the probe the first CreateSession
+// occasionally lands in that gap and fails spuriously.
+func (c *SDKClient) runStart(done chan struct{}) {
+	err := c.doStart()
+	c.startMu.Lock()
+	c.startErr = err
+	if err != nil && c.startCh == done {
+		// Let the next caller retry instead of serving this error forever.
+		c.startCh = nil
+	}
+	close(done)
+	c.startMu.Unlock()
+}
+
+func (c *SDKClient) doStart() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return nil
+	}
+	c.startingSince.CompareAndSwap(0, time.Now().UnixNano())
+	defer c.startingSince.Store(0)
+	startCtx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	if err := c.startLocked(startCtx); err != nil {
+		return err
+	}
+	if !c.skipReadiness {
+		if err := c.awaitReadyLocked(startCtx); err != nil {
+			// Tear the process down so the next call restarts cleanly
+			// instead of talking to a CLI we know is wedged.
+			c.stopLocked()
+			return err
+		}
+	}
+	c.started = true
+	c.ready.Store(true)
+	return nil
+}
+
+// TryStart reports whether the CLI is ready without blocking, kicking off a
+// background start when none is running. wait estimates how long a blocking
+// caller would have to wait: the full start budget when the start was only
+// just kicked off, the remaining budget while one is in flight, and zero once
+// ready. Clients that would rather not block (session.create with
+// nonBlocking) probe this and poll.
+func (c *SDKClient) TryStart() (ready bool, wait time.Duration) {
+	if c.ready.Load() {
+		return true, 0
+	}
+	now := time.Now()
+	if c.startingSince.CompareAndSwap(0, now.UnixNano()) {
+		go func() {
+			// ensureStarted's singleflight means this goroutine either
+			// performs the start or observes one already in flight.
+			if err := c.ensureStarted(context.Background()); err != nil {
+				log.Printf("copilot: background start: %v", err)
+			}
+		}()
+		return false, startTimeout
+	}
+	since := c.startingSince.Load()
+	if since == 0 {
+		// The start finished between the loads; report the current state.
+		return c.ready.Load(), 0
+	}
+	wait = startTimeout - now.Sub(time.Unix(0, since))
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return false, wait
+}
+
+// awaitReadyLocked polls the CLI with list_models until it answers or the
+// bounded wait expires. Called with c.mu held; the read loop that completes
+// pending calls runs independently, so blocking here is safe.
+func (c *SDKClient) awaitReadyLocked(ctx context.Context) error {
+	probeCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	var lastErr error
+	for {
+		if lastErr = c.probeLocked(probeCtx); lastErr == nil {
+			return nil
+		}
+		select {
+		case <-probeCtx.Done():
+			return fmt.Errorf("copilot: CLI did not become ready: %w", lastErr)
+		case <-time.After(readinessPollInterval):
+		}
+	}
+}
+
+// probeLocked issues one list_models call without going through call(),
+// which would try to re-acquire c.mu.
+func (c *SDKClient) probeLocked(ctx context.Context) error {
+	id := c.reqID.Add(1)
+	frame, err := json.Marshal(cliMessage{ID: id, Method: "list_models"})
+	if err != nil {
+		return err
+	}
+	ch := make(chan cliMessage, 1)
+	c.pending.Store(id, ch)
+	if _, err := c.stdin.Write(append(frame, '\n')); err != nil {
+		c.pending.Delete(id)
+		return fmt.Errorf("copilot: write to CLI: %w", err)
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != "" {
+			return fmt.Errorf("copilot: list_models: %s", msg.Error)
+		}
+		return nil
+	case <-ctx.Done():
+		c.pending.Delete(id)
+		return ctx.Err()
+	}
+}
+
+func (c *SDKClient) startLocked(ctx context.Context) error {
+	cmd := exec.Command(c.cliPath, c.cliArgs...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("copilot: stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("copilot: stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("copilot: start %s: %w", c.cliPath, err)
+	}
+	c.cmd = cmd
+	c.stdin = stdin
+	go c.readLoop(stdout)
+	select {
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("copilot: CLI start timed out: %w", ctx.Err())
+	default:
+	}
+	return nil
+}
+
+// Start implements Client.
+func (c *SDKClient) Start(ctx context.Context) error {
+	return c.ensureStarted(ctx)
+}
+
+// Ready reports whether the CLI is started and past its readiness probe,
+// without kicking off a start — readiness endpoints poll this and must not
+// defeat the lazy start.
+func (c *SDKClient) Ready() bool {
+	return c.ready.Load()
+}
+
+// OrphanEvents reports how many CLI events were dropped for lack of a
+// registered session handler; see readLoop.
+func (c *SDKClient) OrphanEvents() int64 {
+	return c.orphanEvents.Load()
+}
+
+// Stop implements Client.
+func (c *SDKClient) Stop() error {
+	// Forget the completed start so a later call starts the CLI afresh
+	// instead of observing the stale success.
+	c.startMu.Lock()
+	c.startCh = nil
+	c.startErr = nil
+	c.startMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		return nil
+	}
+	c.started = false
+	c.ready.Store(false)
+	c.stopLocked()
+	return nil
+}
+
+func (c *SDKClient) stopLocked() {
+	if c.stdin != nil {
+		_ = c.stdin.Close()
+		c.stdin = nil
+	}
+	if c.cmd != nil && c.cmd.Process != nil {
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	}
+	c.cmd = nil
+}
+
+// readLoop dispatches CLI output: responses go to the pending call's channel,
+// events go to the registered per-session handler.
+func (c *SDKClient) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg cliMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("copilot: discarding unparseable CLI line: %v", err)
+			continue
+		}
+		if msg.Event != nil {
+			if !c.dispatchEvent(msg.SessionID, *msg.Event) {
+				// No handler means the bridge stopped tracking this session,
+				// never knew it, or its turn already ended; see the
+				// orphanEvents field comment.
+				c.orphanEvents.Add(1)
+				log.Printf("copilot: dropping %q event for unknown session %q", msg.Event.Type, msg.SessionID)
+			}
+			continue
+		}
+		if ch, ok := c.pending.LoadAndDelete(msg.ID); ok {
+			ch.(chan cliMessage) <- msg
+		}
+	}
+}
+
+// dispatchEvent runs the session's registered handler for one event,
+// reporting whether one ran. The handler executes under its sessionHandler
+// mutex so removeHandler can wait it out.
+func (c *SDKClient) dispatchEvent(sessionID string, ev StreamEvent) bool {
+	h, ok := c.events.Load(sessionID)
+	if !ok {
+		return false
+	}
+	sh := h.(*sessionHandler)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.fn == nil {
+		// Deregistered between the load and the lock: the turn is over.
+		return false
+	}
+	sh.fn(ev)
+	return true
+}
+
+// removeHandler deregisters a turn's handler and waits out any dispatch
+// already running under it, so the caller can rely on no callback firing
+// after this returns. CompareAndDelete leaves a newer turn's handler alone.
+func (c *SDKClient) removeHandler(sessionID string, sh *sessionHandler) {
+	c.events.CompareAndDelete(sessionID, sh)
+	sh.mu.Lock()
+	sh.fn = nil
+	sh.mu.Unlock()
+}
+
+// call sends one request frame and waits for its response or ctx cancellation.
+func (c *SDKClient) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	if err := c.ensureStarted(ctx); err != nil {
+		return nil, err
+	}
+	id := c.reqID.Add(1)
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := json.Marshal(cliMessage{ID: id, Method: method, Params: raw})
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan cliMessage, 1)
+	c.pending.Store(id, ch)
+	c.mu.Lock()
+	_, err = c.stdin.Write(append(frame, '\n'))
+	c.mu.Unlock()
+	if err != nil {
+		c.pending.Delete(id)
+		return nil, fmt.Errorf("copilot: write to CLI: %w", err)
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != "" {
+			return nil, &CLIError{Method: method, Message: msg.Error}
+		}
+		return msg.Result, nil
+	case <-ctx.Done():
+		c.pending.Delete(id)
+		return nil, ctx.Err()
+	}
+}
+
+// CreateSession implements Client.
+func (c *SDKClient) CreateSession(ctx context.Context, cfg SessionConfig) (string, error) {
+	res, err := c.call(ctx, "create_session", map[string]any{
+		"model":        cfg.Model,
+		"systemPrompt": cfg.SystemPrompt,
+		"workingDir":   cfg.WorkingDir,
+	})
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(res, &out); err != nil {
+		return "", err
+	}
+	return out.SessionID, nil
+}
+
+// DestroySession implements Client.
+func (c *SDKClient) DestroySession(ctx context.Context, sessionID string) error {
+	if h, ok := c.events.Load(sessionID); ok {
+		c.removeHandler(sessionID, h.(*sessionHandler))
+	}
+	_, err := c.call(ctx, "destroy_session", map[string]any{"sessionId": sessionID})
+	return err
+}
+
+// SendMessage implements Client.
+func (c *SDKClient) SendMessage(ctx context.Context, sessionID string, req MessageRequest, onEvent EventHandler) (*MessageResponse, error) {
+	if onEvent != nil {
+		sh := &sessionHandler{fn: onEvent}
+		c.events.Store(sessionID, sh)
+		// Deregistration waits out any in-flight dispatch, so even when call
+		// returns early on a cancelled context — the response path that does
+		// not order after the event stream — no callback runs past this
+		// return.
+		defer c.removeHandler(sessionID, sh)
+	}
+	params := map[string]any{
+		"sessionId":   sessionID,
+		"prompt":      req.Prompt,
+		"context":     req.Context,
+		"maxTokens":   req.MaxTokens,
+		"temperature": req.Temperature,
+	}
+	if req.ResponseFormat != "" && req.ResponseFormat != "text" {
+		params["responseFormat"] = req.ResponseFormat
+		if len(req.ResponseSchema) > 0 {
+			params["responseSchema"] = req.ResponseSchema
+		}
+	}
+	if req.Continue {
+		params["continue"] = true
+	}
+	if req.Tools != nil {
+		params["tools"] = req.Tools
+	}
+	if len(req.StopSequences) > 0 {
+		params["stopSequences"] = req.StopSequences
+	}
+	if req.CodeExecution {
+		params["codeExecution"] = true
+	}
+	res, err := c.call(ctx, "send", params)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		RequestID    string `json:"requestId"`
+		Content      string `json:"content"`
+		Usage        Usage  `json:"usage"`
+		FinishReason string `json:"finishReason"`
+	}
+	if err := json.Unmarshal(res, &out); err != nil {
+		return nil, err
+	}
+	messageID := "msg-" + out.RequestID
+	return &MessageResponse{MessageID: messageID, RequestID: out.RequestID, Content: out.Content,
+		Usage: out.Usage, FinishReason: out.FinishReason}, nil
+}
+
+// SendToolResult implements Client.
+func (c *SDKClient) SendToolResult(ctx context.Context, sessionID string, result ToolResult) error {
+	_, err := c.call(ctx, "tool_result", map[string]any{
+		"sessionId": sessionID,
+		"callId":    result.CallID,
+		"content":   result.Content,
+		"success":   result.Success,
+		"error":     result.Error,
+	})
+	return err
+}
+
+// CancelMessage implements Client.
+func (c *SDKClient) CancelMessage(ctx context.Context, sessionID string) error {
+	_, err := c.call(ctx, "cancel", map[string]any{"sessionId": sessionID})
+	return err
+}
+
+// ListTools implements Client.
+func (c *SDKClient) ListTools(ctx context.Context) ([]Tool, error) {
+	res, err := c.call(ctx, "list_tools", nil)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Tools []Tool `json:"tools"`
+	}
+	if err := json.Unmarshal(res, &out); err != nil {
+		return nil, err
+	}
+	return out.Tools, nil
+}
+
+// ListModels implements Client.
+func (c *SDKClient) ListModels(ctx context.Context) ([]Model, error) {
+	res, err := c.call(ctx, "list_models", nil)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Models []Model `json:"models"`
+	}
+	if err := json.Unmarshal(res, &out); err != nil {
+		return nil, err
+	}
+	return out.Models, nil
+}
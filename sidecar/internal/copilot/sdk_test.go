@@ -0,0 +1,179 @@
+package copilot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeCLIScript writes a shell script that speaks just enough of the stdio
+// protocol for the start path: it sleeps before answering, so the readiness
+// probe — and with it ensureStarted — blocks for startDelay.
+func fakeCLIScript(t *testing.T, startDelay time.Duration) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI script needs a POSIX shell")
+	}
+	script := "#!/bin/sh\n" +
+		fmt.Sprintf("sleep %.3f\n", startDelay.Seconds()) +
+		`while read line; do
+  id=$(printf '%s' "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+  printf '{"id":%s,"result":{"sessionId":"cli-1","models":[]}}\n' "$id"
+done
+`
+	path := filepath.Join(t.TempDir(), "fake-cli.sh")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing fake CLI: %v", err)
+	}
+	return path
+}
+
+func TestEnsureStartedCancelledWaiterDoesNotAbortStart(t *testing.T) {
+	c := NewWithLazySDK(fakeCLIScript(t, 500*time.Millisecond))
+	defer c.Stop()
+
+	// Caller A gives up while the CLI is still starting.
+	ctxA, cancelA := context.WithCancel(context.Background())
+	errA := make(chan error, 1)
+	go func() { errA <- c.Start(ctxA) }()
+	time.Sleep(100 * time.Millisecond)
+	cancelA()
+	select {
+	case err := <-errA:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled waiter got %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelled waiter did not return promptly")
+	}
+
+	// Caller B keeps waiting; the start A kicked off must complete for it.
+	ctxB, cancelB := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelB()
+	if err := c.Start(ctxB); err != nil {
+		t.Fatalf("patient waiter: %v", err)
+	}
+	if !c.Ready() {
+		t.Error("client not ready after a successful start")
+	}
+	if _, err := c.CreateSession(ctxB, SessionConfig{Model: "gpt-4o"}); err != nil {
+		t.Errorf("CreateSession after start: %v", err)
+	}
+}
+
+// streamingCLIScript writes a fake CLI that answers a send with a burst of
+// text events before the response, so a test can cancel mid-stream with
+// dispatches still in flight. Other requests get the generic result the
+// start path and create_session expect.
+func streamingCLIScript(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI script needs a POSIX shell")
+	}
+	script := `#!/bin/sh
+while read line; do
+  id=$(printf '%s' "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+  case "$line" in
+  *'"method":"send"'*)
+    i=0
+    while [ $i -lt 50 ]; do
+      printf '{"sessionId":"cli-1","event":{"type":"text","content":"x"}}\n'
+      i=$((i+1))
+    done
+    sleep 1
+    printf '{"id":%s,"result":{"requestId":"r1","content":"done","finishReason":"stop"}}\n' "$id"
+    ;;
+  *)
+    printf '{"id":%s,"result":{"sessionId":"cli-1","models":[]}}\n' "$id"
+    ;;
+  esac
+done
+`
+	path := filepath.Join(t.TempDir(), "streaming-cli.sh")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing fake CLI: %v", err)
+	}
+	return path
+}
+
+// The fake and replay clients dispatch onEvent synchronously, so only a real
+// SDKClient — whose readLoop runs on its own goroutine — can exercise the
+// guarantee under test here: once SendMessage has returned, no event
+// callback is running or can still start, even when the return was an early
+// one on a cancelled context. Run with -race; the old code fails it.
+func TestSendMessageCancelStopsEventDelivery(t *testing.T) {
+	c := NewWithLazySDK(streamingCLIScript(t))
+	defer c.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	id, err := c.CreateSession(ctx, SessionConfig{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	var returned atomic.Bool
+	var lateEvents atomic.Int64
+	// Deliberately unsynchronized, like the turn-local state real handlers
+	// mutate; the race detector flags any dispatch past SendMessage's return.
+	events := 0
+	first := make(chan struct{})
+	var once sync.Once
+	sendCtx, cancelSend := context.WithCancel(ctx)
+	defer cancelSend()
+	go func() {
+		<-first
+		cancelSend()
+	}()
+	_, err = c.SendMessage(sendCtx, id, MessageRequest{Prompt: "hi"}, func(ev StreamEvent) {
+		once.Do(func() { close(first) })
+		// Sleep first so a dispatch is reliably mid-flight when the cancel
+		// lands; the writes below are what must not happen past the return.
+		time.Sleep(20 * time.Millisecond)
+		if returned.Load() {
+			lateEvents.Add(1)
+		}
+		events++
+	})
+	returned.Store(true)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SendMessage returned %v, want context.Canceled", err)
+	}
+	if events == 0 {
+		t.Fatal("handler never ran before the cancel")
+	}
+	// The fake CLI keeps streaming after the cancel; give those events time
+	// to land as orphans rather than handler calls.
+	time.Sleep(300 * time.Millisecond)
+	if n := lateEvents.Load(); n != 0 {
+		t.Errorf("%d event(s) dispatched after SendMessage returned", n)
+	}
+}
+
+func TestReadLoopDropsEventsForUnknownSession(t *testing.T) {
+	c := NewWithLazySDK("unused")
+	var got []StreamEvent
+	c.events.Store("known", &sessionHandler{fn: func(ev StreamEvent) { got = append(got, ev) }})
+	// One event for a tracked session, two for sessions the bridge does not
+	// know — as a reconnected CLI replaying stale state would produce.
+	input := strings.NewReader(
+		`{"sessionId":"ghost","event":{"type":"text","content":"stale"}}` + "\n" +
+			`{"sessionId":"known","event":{"type":"text","content":"live"}}` + "\n" +
+			`{"sessionId":"ghost-2","event":{"type":"tool_call","toolCallId":"c1"}}` + "\n")
+	c.readLoop(input) // must not panic on the unknown lookups
+	if len(got) != 1 || got[0].Content != "live" {
+		t.Errorf("tracked session saw %+v, want just the live event", got)
+	}
+	if n := c.OrphanEvents(); n != 2 {
+		t.Errorf("OrphanEvents() = %d, want 2", n)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// Abandoned turns: session.send returns a streamUrl, but nothing forces the
+// client to ever connect to it. With no subscriber the producer fills
+// EventChan and then drops frames, and the SDK keeps generating for nobody.
+// watchAbandonedTurn runs alongside each turn and applies two opt-in
+// windows: after --no-subscriber-pause-after it stops live delivery and
+// buffers into the ring instead (a late subscriber catches up via /poll or
+// reattach), and after --no-subscriber-cancel-after it cancels the turn
+// outright to free SDK resources. A subscriber attaching at any point
+// stands the watchdog down for the rest of the turn.
+
+// abandonPollInterval is how often the watchdog re-checks for a subscriber.
+const abandonPollInterval = 100 * time.Millisecond
+
+func (s *Server) watchAbandonedTurn(ctx context.Context, sess *session.Session) {
+	pauseAfter, cancelAfter := s.cfg.NoSubscriberPauseAfter, s.cfg.NoSubscriberCancelAfter
+	if pauseAfter <= 0 && cancelAfter <= 0 {
+		return
+	}
+	poll := time.NewTicker(abandonPollInterval)
+	defer poll.Stop()
+	start := time.Now()
+	paused := false
+	for {
+		select {
+		case <-ctx.Done():
+			if paused {
+				sess.Resume()
+			}
+			return
+		case <-poll.C:
+			if sess.Subscribers() > 0 {
+				if paused {
+					sess.Resume()
+				}
+				return
+			}
+			idle := time.Since(start)
+			if cancelAfter > 0 && idle >= cancelAfter {
+				log.Printf("session %s: no subscriber %v after the turn started; cancelling it", sess.ID, cancelAfter)
+				s.metrics.turnsAbandoned.Add(1)
+				if err := s.cancelActiveTurn(ctx, sess, "disconnect"); err != nil {
+					log.Printf("session %s: cancelling abandoned turn: %v", sess.ID, err)
+				}
+				return
+			}
+			if pauseAfter > 0 && !paused && idle >= pauseAfter {
+				paused = sess.Pause()
+			}
+		}
+	}
+}
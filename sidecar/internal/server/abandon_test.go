@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestAbandonedTurnIsPausedThenCancelled(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "for nobody"})
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.NoSubscriberPauseAfter = 200 * time.Millisecond
+		cfg.NoSubscriberCancelAfter = 600 * time.Millisecond
+	})
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "abandoned",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	// No subscriber ever attaches: first the session pauses (frames buffer
+	// in the ring only), then the turn is cancelled at the SDK.
+	waitFor(t, 2*time.Second, sess.Paused, "pause after the first window")
+	waitFor(t, 2*time.Second, func() bool { return fake.cancelCalls.Load() > 0 },
+		"SDK cancel after the second window")
+	// The ring still holds the frames a late poller could fetch.
+	frames, _ := sess.EventsSince(0)
+	if len(frames) == 0 {
+		t.Error("ring is empty; buffered frames were lost")
+	}
+}
+
+func TestSubscriberAttachStandsWatchdogDown(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "watched"})
+		select {
+		case <-time.After(700 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "watched", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.NoSubscriberPauseAfter = 200 * time.Millisecond
+		cfg.NoSubscriberCancelAfter = 400 * time.Millisecond
+	})
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	detach := sess.AddSubscriber()
+	defer detach()
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "watched",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if fake.cancelCalls.Load() != 0 {
+		t.Error("watchdog cancelled a turn that had a subscriber")
+	}
+	last := frames[len(frames)-1]
+	if last["type"] != "done" {
+		t.Errorf("turn did not complete normally: last frame %v", last)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type adminInspectParams struct {
+	SessionID string `json:"sessionId"`
+	// IncludeContent opts in to the conversation history; by default prompts
+	// and responses are redacted so an inspect dump is safe to paste into a
+	// support ticket.
+	IncludeContent bool `json:"includeContent,omitempty"`
+}
+
+// rpcAdminInspectSession dumps a session's internal state for field
+// diagnosis of stuck streams. It is only reachable with --debug; without it
+// the method does not exist, so the admin surface stays invisible in
+// production. Conversation content is redacted unless includeContent is set.
+func (s *Server) rpcAdminInspectSession(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	if !s.cfg.Debug {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: admin.inspectSession"}
+	}
+	var p adminInspectParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	st := sess.Stats()
+	result := map[string]any{
+		"sessionId":    sess.ID,
+		"model":        sess.Model,
+		"sdkSessionId": sess.SDKID,
+		"workingDir":   sess.WorkingDir(),
+		"createdAt":    sess.CreatedAt.Format(time.RFC3339),
+		"lastActivity": sess.LastActivity().Format(time.RFC3339),
+		"eventChan": map[string]any{
+			"length":   st.EventChanLen,
+			"capacity": st.EventChanCap,
+			"dropped":  st.Dropped,
+		},
+		"subscribers": st.Subscribers,
+		"ring": map[string]any{
+			"length": st.RingLen,
+			"start":  st.RingStart,
+		},
+		"turn": map[string]any{
+			"active":    st.TurnActive,
+			"cancelled": st.TurnCancelled,
+		},
+		"paused":       st.Paused,
+		"closed":       st.Closed,
+		"finishReason": st.FinishReason,
+		"messages":     st.Messages,
+	}
+	if p.IncludeContent {
+		result["history"] = sess.History()
+	}
+	return result, nil
+}
+
+// orphanReporter is the optional probe SDK-backed clients implement so the
+// bridge can surface events the CLI delivered for sessions it no longer
+// tracks (see copilot.SDKClient.OrphanEvents). A steadily climbing count
+// points at a state-sync bug between the bridge and the CLI.
+type orphanReporter interface {
+	OrphanEvents() int64
+}
+
+// rpcAdminStats reports lifetime counters for capacity planning on shared
+// deployments: sessions ever created (total and per model — monotonic,
+// unaffected by eviction), the current active count, messages sent, and
+// completion tokens. Counters only, no conversation content, so like
+// getDefaultModel it is not debug-gated.
+func (s *Server) rpcAdminStats(ctx context.Context) (any, *rpcError) {
+	result := map[string]any{
+		"sessionsCreated": s.manager.CreatedTotal(),
+		"sessionsByModel": s.manager.CreatedByModel(),
+		"sessionsActive":  s.manager.Len(),
+		"messagesSent":    s.metrics.messagesSent.Load(),
+		// Completion tokens as reported by the SDK; turns where the SDK
+		// omitted usage contribute nothing.
+		"completionTokens": s.metrics.completionTokens.Load(),
+		// Time-to-first-token percentiles over a rolling window of recent
+		// turns (see ttft.go); the /metrics histogram holds the lifetime view.
+		"ttft": map[string]any{
+			"p50Ms":   s.ttft.percentile(50),
+			"p95Ms":   s.ttft.percentile(95),
+			"samples": s.ttft.samples(),
+		},
+	}
+	if c, ok := s.client.(orphanReporter); ok {
+		// Events the CLI delivered for sessions the bridge no longer
+		// tracks; anything but a flat 0 here deserves investigation.
+		result["orphanEvents"] = c.OrphanEvents()
+	}
+	return result, nil
+}
+
+type adminSetDefaultModelParams struct {
+	Model string `json:"model"`
+}
+
+// rpcAdminGetDefaultModel reports the model session.create uses when none is
+// given. Unlike inspectSession this is not debug-gated: it exposes nothing
+// sensitive and admins need it in production, where changing the default is
+// the whole point.
+func (s *Server) rpcAdminGetDefaultModel(ctx context.Context) (any, *rpcError) {
+	return map[string]any{"model": s.DefaultModel()}, nil
+}
+
+// rpcAdminSetDefaultModel changes the default model for new sessions at
+// runtime. The model (aliases allowed) is validated against models.list so
+// a typo cannot leave every omitted-model create failing. Existing sessions
+// keep their model.
+func (s *Server) rpcAdminSetDefaultModel(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p adminSetDefaultModelParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Model == "" {
+		return nil, errInvalidParams("model is required")
+	}
+	model, aliasNote := s.resolveModel(ctx, p.Model)
+	if aliasNote != "" {
+		// A broken alias would "resolve" to the current default; refusing it
+		// beats silently setting the default to itself.
+		return nil, errInvalidParams("%s", aliasNote)
+	}
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	known := false
+	for _, m := range models {
+		if m.ID == model {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, errInvalidParams("unknown model: %s", p.Model)
+	}
+	old := s.setDefaultModel(model)
+	return map[string]any{"previousModel": old, "model": model}, nil
+}
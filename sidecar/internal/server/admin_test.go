@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAdminInspectSessionRequiresDebug(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	_, rpcErr := doRPC(t, srv, "admin.inspectSession", map[string]any{"sessionId": sess.ID})
+	if rpcErr == nil || rpcErr.Code != codeMethodNotFound {
+		t.Fatalf("expected method-not-found without --debug, got %v", rpcErr)
+	}
+}
+
+func TestAdminInspectSession(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.Debug = true })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-42", "")
+	sess.AppendHistory("user", "secret prompt")
+	sess.AppendHistory("assistant", "secret answer")
+	sess.Publish([]byte(`{"type":"text"}`))
+
+	raw, rpcErr := doRPC(t, srv, "admin.inspectSession", map[string]any{"sessionId": sess.ID})
+	if rpcErr != nil {
+		t.Fatalf("admin.inspectSession: %v", rpcErr)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("unmarshalling result: %v", err)
+	}
+	if result["model"] != "gpt-4o" || result["sdkSessionId"] != "sdk-42" {
+		t.Fatalf("unexpected identity fields: %v", result)
+	}
+	if result["messages"] != float64(2) {
+		t.Fatalf("messages = %v, want 2", result["messages"])
+	}
+	if _, ok := result["history"]; ok {
+		t.Fatal("history present without includeContent")
+	}
+	ec, ok := result["eventChan"].(map[string]any)
+	if !ok || ec["capacity"] != float64(256) || ec["length"] != float64(1) {
+		t.Fatalf("unexpected eventChan stats: %v", result["eventChan"])
+	}
+	ring, ok := result["ring"].(map[string]any)
+	if !ok || ring["length"] != float64(1) {
+		t.Fatalf("unexpected ring stats: %v", result["ring"])
+	}
+
+	raw, rpcErr = doRPC(t, srv, "admin.inspectSession", map[string]any{
+		"sessionId":      sess.ID,
+		"includeContent": true,
+	})
+	if rpcErr != nil {
+		t.Fatalf("admin.inspectSession with content: %v", rpcErr)
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("unmarshalling result: %v", err)
+	}
+	history, ok := result["history"].([]any)
+	if !ok || len(history) != 2 {
+		t.Fatalf("history = %v, want 2 entries", result["history"])
+	}
+}
+
+func TestAdminInspectSessionUnknown(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.Debug = true })
+	_, rpcErr := doRPC(t, srv, "admin.inspectSession", map[string]any{"sessionId": "nope"})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("expected -32602 for unknown session, got %v", rpcErr)
+	}
+}
+
+func TestAdminDefaultModel(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.DefaultModel = "gpt-4o" })
+	result, rpcErr := doRPC(t, srv, "admin.getDefaultModel", map[string]any{})
+	if rpcErr != nil {
+		t.Fatalf("admin.getDefaultModel: %v", rpcErr)
+	}
+	var got struct {
+		Model         string `json:"model"`
+		PreviousModel string `json:"previousModel"`
+	}
+	if err := json.Unmarshal(result, &got); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if got.Model != "gpt-4o" {
+		t.Fatalf("default model = %q, want gpt-4o", got.Model)
+	}
+
+	if _, rpcErr := doRPC(t, srv, "admin.setDefaultModel", map[string]any{"model": "no-such-model"}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("got %v, want code %d for an unknown model", rpcErr, codeInvalidParams)
+	}
+
+	result, rpcErr = doRPC(t, srv, "admin.setDefaultModel", map[string]any{"model": "gpt-5-mini"})
+	if rpcErr != nil {
+		t.Fatalf("admin.setDefaultModel: %v", rpcErr)
+	}
+	if err := json.Unmarshal(result, &got); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if got.PreviousModel != "gpt-4o" || got.Model != "gpt-5-mini" {
+		t.Errorf("setter returned %+v, want previous gpt-4o and new gpt-5-mini", got)
+	}
+
+	// New sessions pick up the new default; nothing names a model here.
+	result, rpcErr = doRPC(t, srv, "session.create", map[string]any{})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if created.Model != "gpt-5-mini" {
+		t.Errorf("new session model = %q, want the runtime default gpt-5-mini", created.Model)
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	srv := newMockServer(t, nil)
+	var ids []string
+	for _, model := range []string{"gpt-4o", "gpt-4o", "claude-sonnet-4"} {
+		result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": model})
+		if rpcErr != nil {
+			t.Fatalf("session.create: %v", rpcErr)
+		}
+		var out struct {
+			SessionID string `json:"sessionId"`
+		}
+		if err := json.Unmarshal(result, &out); err != nil {
+			t.Fatalf("decoding result: %v", err)
+		}
+		ids = append(ids, out.SessionID)
+	}
+	sess := srv.Manager().Get(ids[0])
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": ids[0], "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+	if _, rpcErr := doRPC(t, srv, "session.close", map[string]any{"sessionId": ids[2]}); rpcErr != nil {
+		t.Fatalf("session.close: %v", rpcErr)
+	}
+
+	result, rpcErr := doRPC(t, srv, "admin.stats", nil)
+	if rpcErr != nil {
+		t.Fatalf("admin.stats: %v", rpcErr)
+	}
+	var stats struct {
+		SessionsCreated  int64            `json:"sessionsCreated"`
+		SessionsByModel  map[string]int64 `json:"sessionsByModel"`
+		SessionsActive   int64            `json:"sessionsActive"`
+		MessagesSent     int64            `json:"messagesSent"`
+		CompletionTokens int64            `json:"completionTokens"`
+	}
+	if err := json.Unmarshal(result, &stats); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	// Created is monotonic: the closed session still counts.
+	if stats.SessionsCreated != 3 {
+		t.Errorf("sessionsCreated = %d, want 3", stats.SessionsCreated)
+	}
+	if stats.SessionsByModel["gpt-4o"] != 2 || stats.SessionsByModel["claude-sonnet-4"] != 1 {
+		t.Errorf("sessionsByModel = %v", stats.SessionsByModel)
+	}
+	if stats.SessionsActive != 2 {
+		t.Errorf("sessionsActive = %d, want 2", stats.SessionsActive)
+	}
+	if stats.MessagesSent != 1 {
+		t.Errorf("messagesSent = %d, want 1", stats.MessagesSent)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"fmt"
+)
+
+// resolveModel maps a model alias to its real ID. When the alias's target no
+// longer exists in the model list, the configured default model is used
+// instead and a note describing the substitution is returned; callers emit
+// it as a meta frame so the user learns their saved preference was remapped.
+// Non-alias names pass through untouched: they are the SDK's to validate.
+func (s *Server) resolveModel(ctx context.Context, name string) (model string, note string) {
+	target, ok := s.cfg.ModelAliases[name]
+	if !ok {
+		return name, ""
+	}
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr == nil {
+		for _, m := range models {
+			if m.ID == target {
+				return target, ""
+			}
+		}
+	}
+	fallback := s.DefaultModel()
+	return fallback, fmt.Sprintf(
+		"model alias %q points at %q, which is no longer available; using %q instead",
+		name, target, fallback)
+}
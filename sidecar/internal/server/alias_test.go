@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func newAliasServer(t *testing.T) *Server {
+	return newMockServer(t, func(cfg *Config) {
+		cfg.DefaultModel = "gpt-4o"
+		cfg.ModelAliases = map[string]string{
+			"fast":   "gpt-5-mini",
+			"legacy": "gpt-3-retired",
+		}
+	})
+}
+
+func TestModelAliasResolvedOnCreate(t *testing.T) {
+	srv := newAliasServer(t)
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "fast"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if created.Model != "gpt-5-mini" {
+		t.Errorf("model = %q, want gpt-5-mini", created.Model)
+	}
+}
+
+func TestModelAliasFallbackEmitsMeta(t *testing.T) {
+	srv := newAliasServer(t)
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "legacy"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+		Model     string `json:"model"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if created.Model != "gpt-4o" {
+		t.Errorf("model = %q, want fallback gpt-4o", created.Model)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	frames, _ := sess.EventsSince(0)
+	found := false
+	for _, raw := range frames {
+		var f Frame
+		if err := json.Unmarshal(raw, &f); err != nil {
+			t.Fatalf("invalid frame %q: %v", raw, err)
+		}
+		if f.Type == "meta" && f.Message != "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no meta frame noting the substitution; buffered frames: %d", len(frames))
+	}
+}
+
+func TestModelAliasInModelsGetAndList(t *testing.T) {
+	srv := newAliasServer(t)
+	result, rpcErr := doRPC(t, srv, "models.get", map[string]any{"model": "fast"})
+	if rpcErr != nil {
+		t.Fatalf("models.get: %v", rpcErr)
+	}
+	var model struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(result, &model); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if model.ID != "gpt-5-mini" {
+		t.Errorf("models.get(fast) = %q, want gpt-5-mini", model.ID)
+	}
+
+	result, rpcErr = doRPC(t, srv, "models.list", nil)
+	if rpcErr != nil {
+		t.Fatalf("models.list: %v", rpcErr)
+	}
+	var list struct {
+		Aliases map[string]string `json:"aliases"`
+	}
+	if err := json.Unmarshal(result, &list); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if list.Aliases["fast"] != "gpt-5-mini" {
+		t.Errorf("aliases = %v, want fast -> gpt-5-mini", list.Aliases)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// TestNoTextAfterCancelled simulates SDK chunks that keep arriving after a
+// cancel and asserts none of them reach the stream once the cancelled frame
+// is out.
+func TestNoTextAfterCancelled(t *testing.T) {
+	firstChunk := make(chan struct{})
+	cancelled := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "before cancel"})
+		close(firstChunk)
+		<-cancelled
+		// Late chunks racing past the cancel.
+		onEvent(copilot.StreamEvent{Type: "text", Content: "straggler 1"})
+		onEvent(copilot.StreamEvent{Type: "text", Content: "straggler 2"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "before cancel"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "cancel me",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	<-firstChunk
+	if _, rpcErr := doRPC(t, srv, "session.cancel", map[string]any{"sessionId": sess.ID}); rpcErr != nil {
+		t.Fatalf("session.cancel: %v", rpcErr)
+	}
+	close(cancelled)
+
+	frames := drainFrames(t, sess, 5*time.Second)
+	sawCancelled := false
+	for _, f := range frames {
+		switch f["type"] {
+		case "cancelled":
+			sawCancelled = true
+		case "text":
+			if sawCancelled {
+				t.Fatalf("text frame %v after cancelled", f)
+			}
+		case "done":
+			if !sawCancelled {
+				t.Fatal("done without a cancelled frame")
+			}
+		default:
+			if sawCancelled && f["type"] != "done" {
+				t.Fatalf("frame %v after cancelled; only done may follow", f)
+			}
+		}
+	}
+	if !sawCancelled {
+		t.Fatalf("no cancelled frame in %v", frames)
+	}
+}
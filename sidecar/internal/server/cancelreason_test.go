@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// cancelledReason scans frames for the cancelled frame and returns its
+// reason, or "" when there is none.
+func cancelledReason(frames []map[string]any) string {
+	for _, f := range frames {
+		if f["type"] == "cancelled" {
+			reason, _ := f["reason"].(string)
+			return reason
+		}
+	}
+	return ""
+}
+
+// blockingSendServer returns a server whose fake send blocks until the turn
+// context is cancelled, plus the created session.
+func blockingSendServer(t *testing.T, mutate func(*Config)) (*Server, *fakeClient, string) {
+	t.Helper()
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "partial"})
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, mutate)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	return srv, fake, created.SessionID
+}
+
+func TestCancelledReasonUser(t *testing.T) {
+	started := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	id := created.SessionID
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	<-started
+	if _, rpcErr := doRPC(t, srv, "session.cancel", map[string]any{"sessionId": id}); rpcErr != nil {
+		t.Fatalf("session.cancel: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if got := cancelledReason(frames); got != "user" {
+		t.Errorf("reason = %q, want user; frames %v", got, frames)
+	}
+}
+
+func TestCancelledReasonTimeout(t *testing.T) {
+	srv, _, id := blockingSendServer(t, func(cfg *Config) {
+		cfg.MaxTurnDuration = 150 * time.Millisecond
+	})
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if got := cancelledReason(frames); got != "timeout" {
+		t.Errorf("reason = %q, want timeout; frames %v", got, frames)
+	}
+}
+
+func TestCancelledReasonToolLimit(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		for i := 0; i < 3; i++ {
+			onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "c", ToolName: "read_file"})
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.MaxToolIterations = 1
+	})
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "loop",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if got := cancelledReason(frames); got != "tool_limit" {
+		t.Errorf("reason = %q, want tool_limit; frames %v", got, frames)
+	}
+}
+
+func TestCancelledReasonDisconnect(t *testing.T) {
+	srv, fake, id := blockingSendServer(t, func(cfg *Config) {
+		cfg.NoSubscriberCancelAfter = 150 * time.Millisecond
+	})
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	waitFor(t, 2*time.Second, func() bool { return fake.cancelCalls.Load() > 0 }, "watchdog cancel")
+	var frames []map[string]any
+	raws, _ := sess.EventsSince(0)
+	for _, raw := range raws {
+		var f map[string]any
+		_ = json.Unmarshal(raw, &f)
+		frames = append(frames, f)
+	}
+	if got := cancelledReason(frames); got != "disconnect" {
+		t.Errorf("reason = %q, want disconnect; frames %v", got, frames)
+	}
+}
+
+func TestCancelledReasonShutdown(t *testing.T) {
+	srv, _, id := blockingSendServer(t, nil)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	waitFor(t, 2*time.Second, sess.TurnActive, "turn start")
+	if !srv.Drain(50 * time.Millisecond) {
+		t.Fatal("drain did not finish after cancelling")
+	}
+	raws, _ := sess.EventsSince(0)
+	var frames []map[string]any
+	for _, raw := range raws {
+		var f map[string]any
+		_ = json.Unmarshal(raw, &f)
+		frames = append(frames, f)
+	}
+	if got := cancelledReason(frames); got != "shutdown" {
+		t.Errorf("reason = %q, want shutdown; frames %v", got, frames)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestCitationFramesAndDoneAggregate(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "see the docs"})
+		onEvent(copilot.StreamEvent{Type: "citation", Citation: &copilot.Citation{
+			Title: "pool.go", URI: "file:///src/pool.go", Snippet: "func take()",
+		}})
+		onEvent(copilot.StreamEvent{Type: "citation", Citation: &copilot.Citation{
+			Title: "Copilot docs", URI: "https://example.com/docs",
+		}})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "see the docs"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "where is take defined?",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second)
+	var cites []map[string]any
+	var done map[string]any
+	for _, f := range frames {
+		switch f["type"] {
+		case "citation":
+			cites = append(cites, f)
+		case "done":
+			done = f
+		}
+	}
+	if len(cites) != 2 {
+		t.Fatalf("got %d citation frames, want 2: %v", len(cites), frames)
+	}
+	if cites[0]["title"] != "pool.go" || cites[0]["uri"] != "file:///src/pool.go" || cites[0]["snippet"] != "func take()" {
+		t.Errorf("first citation frame = %v", cites[0])
+	}
+	if _, ok := cites[1]["snippet"]; ok {
+		t.Errorf("snippet-less citation should omit the field: %v", cites[1])
+	}
+	agg, ok := done["citations"].([]any)
+	if !ok || len(agg) != 2 {
+		t.Fatalf("done citations = %v, want a 2-element list", done["citations"])
+	}
+	if first := agg[0].(map[string]any); first["title"] != "pool.go" {
+		t.Errorf("done aggregate out of order: %v", agg)
+	}
+}
+
+func TestNoCitationsEmitsNothing(t *testing.T) {
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hello",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	for _, f := range drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second) {
+		if f["type"] == "citation" {
+			t.Fatalf("unexpected citation frame: %v", f)
+		}
+		if f["type"] == "done" {
+			if _, ok := f["citations"]; ok {
+				t.Errorf("done frame should omit citations when none were cited: %v", f)
+			}
+		}
+	}
+}
+
+func TestMockCitations(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, _ := doRPC(t, srv, "session.create", nil)
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "explain this and cite sources",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	citations := 0
+	for _, f := range drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second) {
+		switch f["type"] {
+		case "citation":
+			citations++
+			if f["uri"] == "" {
+				t.Errorf("mock citation without a uri: %v", f)
+			}
+		case "done":
+			if agg, ok := f["citations"].([]any); !ok || len(agg) != citations {
+				t.Errorf("done citations = %v, want %d entries", f["citations"], citations)
+			}
+		}
+	}
+	if citations < 2 {
+		t.Errorf("got %d mock citation frames, want at least 2", citations)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// TestCloseAllStrandsNoProducers starts turns whose SDK sends never return on
+// their own, tears everything down with CloseAll, and asserts the producer
+// goroutines all exited: closing a session must cancel its in-flight turn.
+func TestCloseAllStrandsNoProducers(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "stuck"})
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 8; i++ {
+		sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+		if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": sess.ID,
+			"prompt":    "block forever",
+		}); rpcErr != nil {
+			t.Fatalf("session.send: %v", rpcErr)
+		}
+	}
+	srv.Manager().CloseAll()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if n := runtime.NumGoroutine(); n <= before+2 {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("goroutines = %d after CloseAll, started with %d\n%s",
+				runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
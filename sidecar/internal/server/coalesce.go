@@ -0,0 +1,77 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// coalescer batches consecutive text frames produced within a short window
+// into a single frame with concatenated content, cutting per-token SSE
+// overhead for chatty models. Only text frames are batched; any other frame
+// type flushes the pending batch first so clients never observe text
+// reordered across a tool_call or error. A zero window makes the coalescer a
+// pass-through.
+//
+// One coalescer serves one turn producer; it is not shared across turns.
+type coalescer struct {
+	s      *Server
+	sess   *session.Session
+	window time.Duration
+
+	mu         sync.Mutex
+	pending    string
+	hasPending bool
+	timer      *time.Timer
+}
+
+// newCoalescer returns the frame publisher for one of sess's turns, batching
+// with the session's configured window (zero = pass-through).
+func (s *Server) newCoalescer(sess *session.Session) *coalescer {
+	return &coalescer{s: s, sess: sess, window: sess.CoalesceWindow()}
+}
+
+// publish routes one frame through the batcher: text frames accumulate until
+// the window elapses or a non-text frame arrives; everything else is
+// published immediately after flushing any pending text.
+func (c *coalescer) publish(f Frame) {
+	if c.window <= 0 {
+		c.s.publish(c.sess, f)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f.Type != "text" {
+		c.flushLocked()
+		c.s.publish(c.sess, f)
+		return
+	}
+	c.pending += f.Content
+	c.hasPending = true
+	if c.timer == nil {
+		// The timer is armed once per batch, not reset per token, so a
+		// steady token stream still flushes every window; worst-case added
+		// latency is one window.
+		c.timer = time.AfterFunc(c.window, c.flush)
+	}
+}
+
+// flush publishes any pending batched text immediately.
+func (c *coalescer) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+}
+
+func (c *coalescer) flushLocked() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if !c.hasPending {
+		return
+	}
+	c.s.publish(c.sess, Frame{Type: "text", Content: c.pending})
+	c.pending, c.hasPending = "", false
+}
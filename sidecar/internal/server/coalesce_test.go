@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestCoalesceBatchesText(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		for _, tok := range []string{"Hel", "lo ", "wor", "ld"} {
+			onEvent(copilot.StreamEvent{Type: "text", Content: tok})
+		}
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "Hello world"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	// A window far longer than the turn, so the whole reply lands in one
+	// batch flushed at turn end.
+	sess.SetCoalesceWindow(time.Minute)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 2*time.Second)
+	var texts []string
+	for _, f := range frames {
+		if f["type"] == "text" {
+			texts = append(texts, f["content"].(string))
+		}
+	}
+	if len(texts) != 1 || texts[0] != "Hello world" {
+		t.Fatalf("text frames = %q, want one concatenated frame", texts)
+	}
+}
+
+func TestCoalesceFlushesBeforeOtherFrameTypes(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "before"})
+		onEvent(copilot.StreamEvent{Type: "reasoning", Content: "thinking"})
+		onEvent(copilot.StreamEvent{Type: "text", Content: "after"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "beforeafter"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	sess.SetCoalesceWindow(time.Minute)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 2*time.Second)
+	var order []string
+	for _, f := range frames {
+		switch f["type"] {
+		case "text", "reasoning":
+			order = append(order, f["type"].(string)+":"+f["content"].(string))
+		}
+	}
+	want := []string{"text:before", "reasoning:thinking", "text:after"}
+	if len(order) != len(want) {
+		t.Fatalf("content frames = %q, want %q", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("content frames = %q, want %q", order, want)
+		}
+	}
+}
+
+func TestCoalesceWindowFlushesMidTurn(t *testing.T) {
+	release := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "early"})
+		<-release
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "early"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	sess.SetCoalesceWindow(10 * time.Millisecond)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	// The batch must flush after the window even though the turn is still
+	// blocked inside the SDK send.
+	select {
+	case raw := <-sess.EventChan:
+		if string(raw) != `{"type":"text","content":"early"}` {
+			t.Fatalf("flushed frame = %s", raw)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no flush before the turn completed")
+	}
+	close(release)
+	drainFrames(t, sess, 2*time.Second)
+}
+
+func TestSessionCreateCoalesceFlag(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.CoalesceWindow = 45 * time.Millisecond })
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"coalesce": true})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if got := srv.Manager().Get(created.SessionID).CoalesceWindow(); got != 45*time.Millisecond {
+		t.Errorf("CoalesceWindow = %v, want 45ms", got)
+	}
+
+	srvDefault := newMockServer(t, func(cfg *Config) { cfg.Coalesce = true })
+	result, rpcErr = doRPC(t, srvDefault, "session.create", map[string]any{"coalesce": false})
+	if rpcErr != nil {
+		t.Fatalf("session.create opting out: %v", rpcErr)
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if got := srvDefault.Manager().Get(created.SessionID).CoalesceWindow(); got != 0 {
+		t.Errorf("CoalesceWindow = %v after opting out, want 0", got)
+	}
+}
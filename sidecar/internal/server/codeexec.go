@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// Code execution: a send with codeExecution true lets the SDK's
+// code-interpreter tool run model-generated code in the SDK's own sandbox.
+// The code never executes on the bridge or in the IDE — the bridge only
+// relays the sandbox's outputs as "code_output" frames: stdout inline,
+// produced files (charts, CSVs) as file-store handles so large binaries
+// never ride the event stream. Handles expire like any files.upload handle
+// and can be fed back as {"handle":...} context items on a later send.
+
+// checkCodeExecutionSupport rejects a codeExecution send unless the
+// session's model explicitly advertises the capability. Unlike structured
+// output there is no benefit of the doubt: running code is consequential
+// enough that a model that does not advertise it does not get it.
+func (s *Server) checkCodeExecutionSupport(ctx context.Context, model string) *rpcError {
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	for _, m := range models {
+		if m.ID != model {
+			continue
+		}
+		for _, c := range m.Capabilities {
+			if c == copilot.CapabilityCodeExecution {
+				return nil
+			}
+		}
+		break
+	}
+	return errInvalidParams("model %s does not advertise code execution support", model)
+}
+
+// artifactRef is one artifact entry on a code_output frame: the file's
+// identity plus the handle its content is stored under. Error replaces the
+// handle when the body could not be stored (e.g. it breached the file
+// store's size or quota limits).
+type artifactRef struct {
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Bytes    int    `json:"bytes,omitempty"`
+	Handle   string `json:"handle,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// codeOutputFrame converts a code_output SDK event into a client frame,
+// moving artifact bodies into the file store. Artifacts count against the
+// session's storage quota, keyed separately from HTTP uploaders.
+func (s *Server) codeOutputFrame(sess *session.Session, ev copilot.StreamEvent) Frame {
+	f := Frame{Type: "code_output", Stdout: ev.Stdout}
+	for _, a := range ev.Artifacts {
+		ref := artifactRef{Name: a.Name, MimeType: a.MimeType, Bytes: len(a.Content)}
+		handle, _, rpcErr := s.files.upload("session:"+sess.ID, a.Content)
+		if rpcErr != nil {
+			log.Printf("session %s: storing code artifact %q: %s", sess.ID, a.Name, rpcErr.Message)
+			ref.Error = rpcErr.Message
+		} else {
+			ref.Handle = handle
+		}
+		f.Artifacts = append(f.Artifacts, ref)
+	}
+	return f
+}
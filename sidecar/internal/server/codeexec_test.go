@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestCodeExecutionRequiresCapability(t *testing.T) {
+	srv := newMockServer(t, nil)
+	// claude-sonnet-4 advertises capabilities but not code_execution.
+	sess, _ := srv.Manager().Create("claude-sonnet-4", "", "")
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":     sess.ID,
+		"prompt":        "analyze this CSV",
+		"codeExecution": true,
+	})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("got %v, want code %d for a model without the capability", rpcErr, codeInvalidParams)
+	}
+}
+
+func TestMockCodeExecutionEmitsCodeOutput(t *testing.T) {
+	srv := newMockServer(t, nil)
+	id := createSessionID(t, srv) // mock default gpt-4o advertises code_execution
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":     id,
+		"prompt":        "plot the data",
+		"codeExecution": true,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var out map[string]any
+	for _, f := range drainFrames(t, sess, 5*time.Second) {
+		if f["type"] == "code_output" {
+			out = f
+		}
+	}
+	if out == nil {
+		t.Fatal("no code_output frame on a codeExecution mock turn")
+	}
+	stdout, _ := out["stdout"].(string)
+	if stdout == "" {
+		t.Errorf("code_output frame carries no stdout: %v", out)
+	}
+	arts, _ := out["artifacts"].([]any)
+	if len(arts) != 1 {
+		t.Fatalf("artifacts = %v, want one synthetic artifact", out["artifacts"])
+	}
+	art := arts[0].(map[string]any)
+	handle, _ := art["handle"].(string)
+	if art["name"] != "chart.png" || handle == "" {
+		t.Fatalf("artifact = %v, want a named entry with a handle", art)
+	}
+	if content, ok := srv.files.get(handle); !ok || content == "" {
+		t.Errorf("artifact handle %q not resolvable in the file store", handle)
+	}
+	// A turn that did not opt in stays code-output free.
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id,
+		"prompt":    "just answer",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	for _, f := range drainFrames(t, sess, 5*time.Second) {
+		if f["type"] == "code_output" {
+			t.Errorf("unexpected code_output frame without codeExecution: %v", f)
+		}
+	}
+}
+
+func TestCodeOutputEventForwardedWithArtifactHandles(t *testing.T) {
+	fake := newFakeClient()
+	fake.models = []copilot.Model{{ID: "gpt-4o", Name: "GPT-4o", Default: true,
+		Capabilities: []string{copilot.CapabilityCodeExecution}}}
+	var gotReq copilot.MessageRequest
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		gotReq = req
+		onEvent(copilot.StreamEvent{Type: "code_output", Stdout: "42\n",
+			Artifacts: []copilot.Artifact{{Name: "out.csv", MimeType: "text/csv", Content: "a,b\n1,2\n"}}})
+		onEvent(copilot.StreamEvent{Type: "text", Content: "The answer is 42."})
+		return &copilot.MessageResponse{Content: "The answer is 42.", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":     id,
+		"prompt":        "compute it",
+		"codeExecution": true,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var out map[string]any
+	for _, f := range drainFrames(t, sess, 5*time.Second) {
+		if f["type"] == "code_output" {
+			out = f
+		}
+	}
+	if !gotReq.CodeExecution {
+		t.Error("SDK request did not carry the codeExecution flag")
+	}
+	if out == nil {
+		t.Fatal("no code_output frame forwarded")
+	}
+	if out["stdout"] != "42\n" {
+		t.Errorf("stdout = %v, want the sandbox's output", out["stdout"])
+	}
+	arts, _ := out["artifacts"].([]any)
+	if len(arts) != 1 {
+		t.Fatalf("artifacts = %v, want one", out["artifacts"])
+	}
+	art := arts[0].(map[string]any)
+	handle, _ := art["handle"].(string)
+	if content, ok := srv.files.get(handle); !ok || content != "a,b\n1,2\n" {
+		t.Errorf("handle %q resolves to %q, want the artifact body", handle, content)
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// maxCompareModels bounds how many models one session.compare may fan out to.
+// Each model costs an SDK session and a full generation; four columns is
+// already past what the side-by-side UI can usefully render.
+const maxCompareModels = 4
+
+type sessionCompareParams struct {
+	Prompt      string                `json:"prompt"`
+	Models      []string              `json:"models"`
+	Context     []copilot.ContextItem `json:"context,omitempty"`
+	MaxTokens   int                   `json:"maxTokens,omitempty"`
+	Temperature float64               `json:"temperature,omitempty"`
+	// RelativeURLs asks for streamUrl as a bare path instead of an absolute
+	// URL, for same-origin clients.
+	RelativeURLs bool `json:"relativeUrls,omitempty"`
+}
+
+// rpcSessionCompare sends one prompt to several models in parallel and
+// multiplexes their streams onto a single ephemeral session. Every frame
+// carries a modelId tag; each model finishes with its own tagged done frame
+// and the stream ends with one untagged done once all models have completed.
+// Tool calls are not executed in compare mode. session.cancel on the returned
+// session cancels all sub-sessions.
+func (s *Server) rpcSessionCompare(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	ctx := r.Context()
+	var p sessionCompareParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Prompt == "" {
+		return nil, errInvalidParams("prompt is required")
+	}
+	if len(p.Models) < 2 {
+		return nil, errInvalidParams("models must list at least 2 models to compare")
+	}
+	if len(p.Models) > maxCompareModels {
+		return nil, errInvalidParams("models lists %d models; at most %d may be compared", len(p.Models), maxCompareModels)
+	}
+	seen := make(map[string]bool, len(p.Models))
+	var aliasNotes []string
+	for i, m := range p.Models {
+		if m == "" {
+			return nil, errInvalidParams("models contains an empty model ID")
+		}
+		resolved, note := s.resolveModel(ctx, m)
+		if note != "" {
+			aliasNotes = append(aliasNotes, note)
+		}
+		if seen[resolved] {
+			return nil, errInvalidParams("duplicate model in models: %s", resolved)
+		}
+		seen[resolved] = true
+		p.Models[i] = resolved
+	}
+	sess, _ := s.manager.Create("compare", "", "")
+	s.metrics.sessionsCreated.Add(1)
+	// A freshly created session always grants the first turn; claim it so
+	// session.send cannot race a second producer onto the stream.
+	sess.BeginTurn()
+	for _, note := range aliasNotes {
+		s.publish(sess, Frame{Type: "meta", Message: note})
+	}
+	sess.AppendHistory("user", p.Prompt)
+	s.transcripts.record(sess.ID, transcriptEntry{Kind: "prompt", Prompt: p.Prompt})
+	s.metrics.messagesSent.Add(1)
+	s.goTurn(func() { s.runCompare(sess, p) })
+	return map[string]any{
+		"sessionId": sess.ID,
+		"streamUrl": streamURL(r, sess.ID, p.RelativeURLs),
+	}, nil
+}
+
+// runCompare drives the parallel sub-turns of one session.compare call.
+func (s *Server) runCompare(sess *session.Session, p sessionCompareParams) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.SendTimeout)
+	deregister := s.registerTurnCancel(sess.ID, cancel)
+	go func() {
+		select {
+		case <-sess.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer func() {
+		deregister()
+		cancel()
+		s.finishTurn(sess, Frame{Type: "done"})
+	}()
+	var wg sync.WaitGroup
+	for _, model := range p.Models {
+		wg.Add(1)
+		go func(model string) {
+			defer wg.Done()
+			// Each sub-turn is a full SDK generation, so each holds its own
+			// slot under the global turn cap; with fewer free slots than
+			// models the columns queue and run as slots free up rather than
+			// fanning out past --max-concurrent-turns.
+			if rpcErr := s.acquireTurnSlot(ctx, true); rpcErr != nil {
+				if !sess.TurnCancelled() {
+					s.publish(sess, Frame{Type: "error", ModelID: model,
+						Category: copilot.ErrorCategoryTransport, Message: rpcErr.Message})
+				}
+				s.publish(sess, Frame{Type: "done", ModelID: model})
+				return
+			}
+			defer s.releaseTurnSlot()
+			s.runCompareModel(ctx, sess, model, p)
+		}(model)
+	}
+	wg.Wait()
+}
+
+// runCompareModel runs one model's sub-turn, tagging every frame it produces.
+func (s *Server) runCompareModel(ctx context.Context, sess *session.Session, model string, p sessionCompareParams) {
+	if s.cfg.Mock {
+		s.streamMockCompareResponse(sess, model, p.Prompt)
+		return
+	}
+	sdkID, err := s.client.CreateSession(ctx, copilot.SessionConfig{Model: model})
+	if err != nil {
+		if !sess.TurnCancelled() {
+			f := errorFrame(err)
+			f.ModelID = model
+			f.Message = "creating session: " + f.Message
+			s.publish(sess, f)
+		}
+		s.publish(sess, Frame{Type: "done", ModelID: model})
+		return
+	}
+	defer func() {
+		// The turn context may already be cancelled; clean up regardless.
+		dctx, dcancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer dcancel()
+		_ = s.client.DestroySession(dctx, sdkID)
+	}()
+	req := copilot.MessageRequest{
+		Prompt:      wrapPrompt(sess, p.Prompt),
+		Context:     p.Context,
+		MaxTokens:   p.MaxTokens,
+		Temperature: p.Temperature,
+	}
+	var textAsm utf8Assembler
+	resp, err := s.client.SendMessage(ctx, sdkID, req, func(ev copilot.StreamEvent) {
+		if !knownStreamEvent(ev.Type) {
+			s.handleUnknownEvent(sess, ev, model)
+			return
+		}
+		if ev.Type == "tool_call" {
+			// Compare sub-sessions have no plugin callback wiring; refuse the
+			// call so the SDK can finish the turn rather than hang.
+			_ = s.client.SendToolResult(ctx, sdkID, copilot.ToolResult{
+				CallID: ev.ToolCallID,
+				Error:  "tools are not available in compare mode",
+			})
+			return
+		}
+		if ev.Type == "text" {
+			if ev.Content = textAsm.add(ev.Content); ev.Content == "" {
+				return
+			}
+		}
+		f := frameForStreamEvent(ev)
+		f.ModelID = model
+		s.publish(sess, f)
+	})
+	if rest := textAsm.flush(); rest != "" {
+		s.publish(sess, Frame{Type: "text", ModelID: model, Content: rest})
+	}
+	if err != nil {
+		if !sess.TurnCancelled() {
+			f := errorFrame(err)
+			f.ModelID = model
+			s.publish(sess, f)
+		}
+		s.publish(sess, Frame{Type: "done", ModelID: model})
+		return
+	}
+	s.publish(sess, Frame{Type: "done", ModelID: model, MessageID: resp.MessageID})
+}
+
+// streamMockCompareResponse is the --mock sub-turn: a short tagged reply so
+// the comparison UI can be developed without a Copilot CLI.
+func (s *Server) streamMockCompareResponse(sess *session.Session, model, prompt string) {
+	s.publish(sess, Frame{Type: "reasoning", ModelID: model, Content: "Thinking..."})
+	time.Sleep(20 * time.Millisecond)
+	chunks := []string{
+		fmt.Sprintf("Mock reply from %s to: %s", model, truncate(prompt, 50)),
+		" (compare mode, --mock).",
+	}
+	for _, chunk := range chunks {
+		s.publish(sess, Frame{Type: "text", ModelID: model, Content: chunk})
+		time.Sleep(20 * time.Millisecond)
+	}
+	s.publish(sess, Frame{Type: "done", ModelID: model})
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// drainCompareFrames collects frames until the final untagged done frame;
+// per-model done frames carry a modelId and do not end the stream.
+func drainCompareFrames(t *testing.T, srv *Server, sessionID string, timeout time.Duration) []map[string]any {
+	t.Helper()
+	sess := srv.Manager().Get(sessionID)
+	if sess == nil {
+		t.Fatalf("unknown session %s", sessionID)
+	}
+	var frames []map[string]any
+	deadline := time.After(timeout)
+	for {
+		select {
+		case raw, ok := <-sess.EventChan:
+			if !ok {
+				return frames
+			}
+			var frame map[string]any
+			if err := json.Unmarshal(raw, &frame); err != nil {
+				t.Fatalf("invalid frame %q: %v", raw, err)
+			}
+			frames = append(frames, frame)
+			if frame["type"] == "done" && frame["modelId"] == nil {
+				return frames
+			}
+		case <-deadline:
+			t.Fatalf("no final done frame within %v; got %v", timeout, frames)
+		}
+	}
+}
+
+func TestSessionCompareMock(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, rpcErr := doRPC(t, srv, "session.compare", map[string]any{
+		"prompt": "which is better?",
+		"models": []string{"gpt-4o", "claude-sonnet-4"},
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.compare: %v", rpcErr)
+	}
+	var out struct {
+		SessionID string `json:"sessionId"`
+		StreamURL string `json:"streamUrl"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if out.StreamURL != "http://example.com/stream/"+out.SessionID {
+		t.Errorf("streamUrl = %q, want http://example.com/stream/%s", out.StreamURL, out.SessionID)
+	}
+	frames := drainCompareFrames(t, srv, out.SessionID, 5*time.Second)
+	sawText := map[string]bool{}
+	sawModelDone := map[string]bool{}
+	for i, f := range frames {
+		tagged := f["modelId"] != nil
+		isFinal := i == len(frames)-1
+		if !tagged && !isFinal {
+			t.Errorf("untagged non-final frame %v", f)
+		}
+		if model, _ := f["modelId"].(string); tagged {
+			switch f["type"] {
+			case "text":
+				sawText[model] = true
+			case "done":
+				sawModelDone[model] = true
+			}
+		}
+	}
+	for _, model := range []string{"gpt-4o", "claude-sonnet-4"} {
+		if !sawText[model] {
+			t.Errorf("no text frames tagged %s", model)
+		}
+		if !sawModelDone[model] {
+			t.Errorf("no per-model done frame for %s", model)
+		}
+	}
+	if last := frames[len(frames)-1]; last["type"] != "done" || last["modelId"] != nil {
+		t.Errorf("final frame %v, want untagged done", last)
+	}
+}
+
+func TestSessionCompareBounds(t *testing.T) {
+	srv := newMockServer(t, nil)
+	for _, models := range [][]string{
+		{"gpt-4o"},
+		{"a", "b", "c", "d", "e"},
+		{"gpt-4o", "gpt-4o"},
+		{"gpt-4o", ""},
+	} {
+		_, rpcErr := doRPC(t, srv, "session.compare", map[string]any{
+			"prompt": "hi",
+			"models": models,
+		})
+		if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("models %v: got %v, want code %d", models, rpcErr, codeInvalidParams)
+		}
+	}
+}
+
+func TestSessionCompareCleansUpSubSessions(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "from " + sessionID})
+		return &copilot.MessageResponse{MessageID: "msg-" + sessionID, Content: "from " + sessionID}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, rpcErr := doRPC(t, srv, "session.compare", map[string]any{
+		"prompt": "hello both",
+		"models": []string{"gpt-4o", "gpt-5-mini"},
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.compare: %v", rpcErr)
+	}
+	var out struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	drainCompareFrames(t, srv, out.SessionID, 5*time.Second)
+	if got := fake.createCalls.Load(); got != 2 {
+		t.Errorf("createCalls = %d, want 2", got)
+	}
+	// Sub-session teardown is deferred inside each sub-turn and therefore
+	// completes before the final done frame is published.
+	if got := fake.destroyCalls.Load(); got != 2 {
+		t.Errorf("destroyCalls = %d, want 2", got)
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestDedupeContextItems(t *testing.T) {
+	items := []copilot.ContextItem{
+		{File: "a.go", StartLine: 1, EndLine: 10, Content: "first"},
+		{File: "a.go", StartLine: 1, EndLine: 10, Content: "duplicate"},
+		{File: "a.go", StartLine: 5, EndLine: 15, Content: "overlapping, not identical"},
+		{File: "b.go", StartLine: 1, EndLine: 10},
+		{Type: "selection", Content: "no file"},
+		{Type: "selection", Content: "also no file"},
+	}
+	kept, dropped := dedupeContextItems(items)
+	if dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", dropped)
+	}
+	if len(kept) != 5 {
+		t.Fatalf("kept %d items, want 5: %v", len(kept), kept)
+	}
+	if kept[0].Content != "first" {
+		t.Errorf("first occurrence not kept: %v", kept[0])
+	}
+	// The overlapping range must survive; it is not an exact duplicate.
+	found := false
+	for _, item := range kept {
+		if item.StartLine == 5 && item.EndLine == 15 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("overlapping range was wrongly dropped")
+	}
+}
+
+func TestDedupeContextItemsEmpty(t *testing.T) {
+	kept, dropped := dedupeContextItems(nil)
+	if len(kept) != 0 || dropped != 0 {
+		t.Errorf("got %v, %d", kept, dropped)
+	}
+}
+
+func TestFormatTerminalItems(t *testing.T) {
+	exit := 1
+	items := []copilot.ContextItem{
+		{Type: "terminal", Command: "go test ./...", Output: "FAIL: TestX", ExitCode: &exit},
+		{File: "a.go", Content: "untouched"},
+	}
+	if rpcErr := formatTerminalItems(items); rpcErr != nil {
+		t.Fatalf("formatTerminalItems: %v", rpcErr)
+	}
+	want := "Terminal output of `go test ./...` (exit code 1):\nFAIL: TestX"
+	if items[0].Content != want {
+		t.Errorf("content = %q, want %q", items[0].Content, want)
+	}
+	if items[0].Output != "" {
+		t.Error("raw output not cleared after formatting")
+	}
+	if items[1].Content != "untouched" {
+		t.Errorf("non-terminal item modified: %v", items[1])
+	}
+
+	noCommand := []copilot.ContextItem{{Type: "terminal", Output: "x"}}
+	if rpcErr := formatTerminalItems(noCommand); rpcErr == nil {
+		t.Error("missing command accepted")
+	}
+	badExit := 512
+	implausible := []copilot.ContextItem{{Type: "terminal", Command: "x", ExitCode: &badExit}}
+	if rpcErr := formatTerminalItems(implausible); rpcErr == nil {
+		t.Error("exitCode 512 accepted")
+	}
+}
+
+func TestMiddleTruncate(t *testing.T) {
+	if got := middleTruncate("short", 100); got != "short" {
+		t.Errorf("short string modified: %q", got)
+	}
+	long := strings.Repeat("a", 200) + "MIDDLE" + strings.Repeat("b", 200)
+	got := middleTruncate(long, 100)
+	if !strings.HasPrefix(got, strings.Repeat("a", 50)) {
+		t.Errorf("head not kept: %q", got)
+	}
+	if !strings.HasSuffix(got, strings.Repeat("b", 50)) {
+		t.Errorf("tail not kept: %q", got)
+	}
+	if !strings.Contains(got, "bytes truncated") {
+		t.Errorf("no elision marker: %q", got)
+	}
+	// Cuts must not split multibyte runes.
+	unicodeLong := strings.Repeat("é", 300)
+	if !utf8.ValidString(middleTruncate(unicodeLong, 100)) {
+		t.Error("truncation split a multibyte rune")
+	}
+}
+
+func TestFormatSymbolItems(t *testing.T) {
+	items := []copilot.ContextItem{
+		{File: "server.go", Symbol: "handleRPC"},
+		{File: "server.go", Symbol: "dispatch", Content: "func dispatch() {}"},
+		{File: "server.go", Symbol: "writeRPC", StartLine: 10, EndLine: 20, Content: "func writeRPC() {}"},
+		{File: "server.go", Symbol: "unused", StartLine: 30, EndLine: 40},
+		{File: "a.go", Content: "untouched"},
+	}
+	if rpcErr := formatSymbolItems(items); rpcErr != nil {
+		t.Fatalf("formatSymbolItems: %v", rpcErr)
+	}
+	if want := "Symbol reference: `handleRPC` in server.go (no source attached; resolve the definition by name)."; items[0].Content != want {
+		t.Errorf("symbol-only content = %q, want %q", items[0].Content, want)
+	}
+	if want := "Symbol `dispatch` (server.go):\nfunc dispatch() {}"; items[1].Content != want {
+		t.Errorf("symbol-with-content = %q, want %q", items[1].Content, want)
+	}
+	// Ranges win: the symbol only labels the range's content.
+	if want := "Symbol `writeRPC` (server.go lines 10-20):\nfunc writeRPC() {}"; items[2].Content != want {
+		t.Errorf("symbol-plus-range = %q, want %q", items[2].Content, want)
+	}
+	if items[3].Content != "" {
+		t.Errorf("range without content grew content: %q", items[3].Content)
+	}
+	if items[4].Content != "untouched" {
+		t.Errorf("symbol-less item modified: %v", items[4])
+	}
+
+	noFile := []copilot.ContextItem{{Symbol: "orphan"}}
+	if rpcErr := formatSymbolItems(noFile); rpcErr == nil {
+		t.Error("symbol without a file accepted")
+	}
+}
+
+func TestFormatSymbolGraphItems(t *testing.T) {
+	items := []copilot.ContextItem{
+		{Type: "symbolGraph", Symbols: []copilot.SymbolInfo{
+			{Name: "handleRPC", Kind: "method", File: "server.go", Line: 120,
+				Signature: "func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request)",
+				Relations: []copilot.SymbolRelation{
+					{Kind: "calls", Target: "dispatch"},
+					{Kind: "calls", Target: "writeRPC"},
+					{Kind: "calledBy", Target: "New"},
+				}},
+			{Name: "rpcError", Kind: "struct", File: "rpc.go"},
+		}},
+		{File: "a.go", Content: "untouched"},
+	}
+	if rpcErr := formatSymbolGraphItems(items); rpcErr != nil {
+		t.Fatalf("formatSymbolGraphItems: %v", rpcErr)
+	}
+	want := "Symbol graph (2 symbols):\n" +
+		"- handleRPC (method) in server.go:120 — func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request)\n" +
+		"  calls: dispatch, writeRPC\n" +
+		"  calledBy: New\n" +
+		"- rpcError (struct) in rpc.go"
+	if items[0].Content != want {
+		t.Errorf("rendered graph = %q, want %q", items[0].Content, want)
+	}
+	if items[0].Symbols != nil {
+		t.Error("symbols not cleared after rendering")
+	}
+	if items[1].Content != "untouched" {
+		t.Errorf("non-graph item modified: %v", items[1])
+	}
+}
+
+func TestFormatSymbolGraphValidation(t *testing.T) {
+	for name, symbols := range map[string][]copilot.SymbolInfo{
+		"no symbols":     nil,
+		"missing kind":   {{Name: "orphan"}},
+		"missing name":   {{Kind: "function"}},
+		"empty relation": {{Name: "f", Kind: "function", Relations: []copilot.SymbolRelation{{Kind: "calls"}}}},
+	} {
+		items := []copilot.ContextItem{{Type: "symbolGraph", Symbols: symbols}}
+		if rpcErr := formatSymbolGraphItems(items); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("%s: got %v, want code %d", name, rpcErr, codeInvalidParams)
+		}
+	}
+}
+
+func TestFormatSymbolGraphSizeCap(t *testing.T) {
+	// Each symbol's signature is ~1KB, so the 16KB cap bites well before the
+	// 64-symbol limit; whole trailing symbols must be dropped, not clipped.
+	symbols := make([]copilot.SymbolInfo, maxSymbolGraphSymbols)
+	for i := range symbols {
+		symbols[i] = copilot.SymbolInfo{
+			Name: fmt.Sprintf("sym%d", i), Kind: "function",
+			Signature: strings.Repeat("x", 1024),
+		}
+	}
+	items := []copilot.ContextItem{{Type: "symbolGraph", Symbols: symbols}}
+	if rpcErr := formatSymbolGraphItems(items); rpcErr != nil {
+		t.Fatalf("formatSymbolGraphItems: %v", rpcErr)
+	}
+	content := items[0].Content
+	if len(content) > maxSymbolGraphBytes+100 {
+		t.Errorf("rendered graph is %d bytes, want about the %d cap", len(content), maxSymbolGraphBytes)
+	}
+	if !strings.Contains(content, "more symbols omitted") {
+		t.Error("no omission marker on a capped graph")
+	}
+	if strings.Contains(content, "- sym63 ") {
+		t.Error("last symbol survived a cap that should have dropped it")
+	}
+}
+
+func TestMaxContextItemsCap(t *testing.T) {
+	fake := newFakeClient()
+	var gotItems []copilot.ContextItem
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		gotItems = req.Context
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "ok", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) { cfg.MaxContextItems = 2 })
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	over := []map[string]any{
+		{"file": "a.go", "content": "a"},
+		{"file": "b.go", "content": "b", "priority": 5},
+		{"file": "c.go", "content": "c"},
+	}
+
+	// Over the cap without truncateContext: invalid params carrying the count.
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hi", "context": over,
+	})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("over-cap send: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	if !strings.Contains(rpcErr.Message, "3 context items") {
+		t.Errorf("error does not carry the count: %q", rpcErr.Message)
+	}
+
+	// With truncateContext the send runs on the highest-priority survivors.
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hi", "context": over, "truncateContext": true,
+	}); rpcErr != nil {
+		t.Fatalf("truncating send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second)
+	if len(gotItems) != 2 {
+		t.Fatalf("SDK saw %d items, want 2: %v", len(gotItems), gotItems)
+	}
+	if gotItems[0].File != "a.go" || gotItems[1].File != "b.go" {
+		t.Errorf("kept %s and %s, want a.go and b.go", gotItems[0].File, gotItems[1].File)
+	}
+}
+
+func TestTruncateContextItemsDropOrder(t *testing.T) {
+	items := []copilot.ContextItem{
+		{File: "pool.go", Priority: 0},    // pooled: same priority, attached first
+		{File: "pinned.go", Priority: 10}, // user-pinned
+		{File: "stray1.go", Priority: 0},  // incidental
+		{File: "related.go", Priority: 5},
+		{File: "stray2.go", Priority: 0}, // incidental, attached last
+	}
+	kept, dropped := truncateContextItems(items, 3)
+	if dropped != 2 {
+		t.Fatalf("dropped = %d, want 2", dropped)
+	}
+	// Highest priority survives; ties go to insertion order; survivors keep
+	// their original relative order.
+	want := []string{"pool.go", "pinned.go", "related.go"}
+	for i, file := range want {
+		if kept[i].File != file {
+			t.Errorf("kept[%d] = %s, want %s", i, kept[i].File, file)
+		}
+	}
+
+	// Under the cap nothing is shed and the slice is untouched.
+	kept, dropped = truncateContextItems(items, 10)
+	if dropped != 0 || len(kept) != len(items) {
+		t.Errorf("under cap: kept %d dropped %d, want all kept", len(kept), dropped)
+	}
+	// A non-positive cap disables truncation rather than dropping all.
+	if _, dropped := truncateContextItems(items, 0); dropped != 0 {
+		t.Errorf("zero cap dropped %d items", dropped)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestSessionContextPool(t *testing.T) {
+	var got []copilot.ContextItem
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		got = req.Context
+		onEvent(copilot.StreamEvent{Type: "text", Content: "ok"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "ok"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+
+	result, rpcErr := doRPC(t, srv, "session.addContext", map[string]any{
+		"sessionId": sess.ID,
+		"context": []map[string]any{
+			{"file": "go.mod", "startLine": 1, "endLine": 5},
+			{"file": "main.go", "startLine": 10, "endLine": 20},
+		},
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.addContext: %v", rpcErr)
+	}
+	var added struct {
+		ContextItems int `json:"contextItems"`
+	}
+	if err := json.Unmarshal(result, &added); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if added.ContextItems != 2 {
+		t.Errorf("contextItems = %d, want 2", added.ContextItems)
+	}
+
+	// The send carries the pool plus its own context, deduped: main.go 10-20
+	// repeats a pooled range and is dropped.
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "hi",
+		"context": []map[string]any{
+			{"file": "main.go", "startLine": 10, "endLine": 20},
+			{"file": "util.go", "startLine": 1, "endLine": 3},
+		},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 2*time.Second)
+	if len(got) != 3 {
+		t.Fatalf("SDK saw %d context items (%v), want 3", len(got), got)
+	}
+	if got[0].File != "go.mod" || got[1].File != "main.go" || got[2].File != "util.go" {
+		t.Errorf("context order = %v, want pool first then per-message", got)
+	}
+
+	info, rpcErr := doRPC(t, srv, "session.info", map[string]any{"sessionId": sess.ID})
+	if rpcErr != nil {
+		t.Fatalf("session.info: %v", rpcErr)
+	}
+	var out struct {
+		ContextItems int `json:"contextItems"`
+	}
+	if err := json.Unmarshal(info, &out); err != nil {
+		t.Fatalf("decoding info: %v", err)
+	}
+	if out.ContextItems != 2 {
+		t.Errorf("session.info contextItems = %d, want 2", out.ContextItems)
+	}
+
+	result, rpcErr = doRPC(t, srv, "session.clearContext", map[string]any{"sessionId": sess.ID})
+	if rpcErr != nil {
+		t.Fatalf("session.clearContext: %v", rpcErr)
+	}
+	var cleared struct {
+		Cleared int `json:"cleared"`
+	}
+	if err := json.Unmarshal(result, &cleared); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if cleared.Cleared != 2 {
+		t.Errorf("cleared = %d, want 2", cleared.Cleared)
+	}
+	if n := len(sess.ContextPool()); n != 0 {
+		t.Errorf("pool size after clear = %d, want 0", n)
+	}
+}
+
+func TestSessionAddContextValidation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.addContext", map[string]any{"sessionId": sess.ID, "context": []any{}}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("empty context: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.addContext", map[string]any{
+		"sessionId": "nope",
+		"context":   []map[string]any{{"file": "a.go"}},
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("unknown session: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
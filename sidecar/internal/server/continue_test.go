@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestContinueAfterLengthFinish(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		if req.Continue {
+			onEvent(copilot.StreamEvent{Type: "text", Content: " and the rest."})
+			return &copilot.MessageResponse{MessageID: "msg-2", Content: " and the rest.", FinishReason: "stop"}, nil
+		}
+		onEvent(copilot.StreamEvent{Type: "text", Content: "The beginning"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "The beginning", FinishReason: "length"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "tell me everything",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	last := frames[len(frames)-1]
+	if last["type"] != "done" || last["finishReason"] != "length" {
+		t.Fatalf("done frame = %v, want finishReason length", last)
+	}
+
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"continue":  true,
+	}); rpcErr != nil {
+		t.Fatalf("continue send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+	history := sess.History()
+	if len(history) != 2 {
+		t.Fatalf("history has %d messages, want 2 (continuation must extend, not append): %+v", len(history), history)
+	}
+	if want := "The beginning and the rest."; history[1].Content != want {
+		t.Errorf("assistant history = %q, want %q", history[1].Content, want)
+	}
+}
+
+func TestContinueValidation(t *testing.T) {
+	fake := newFakeClient()
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	// Nothing streamed yet, so there is nothing to continue.
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"continue":  true,
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("continue with no prior turn: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "also a prompt",
+		"continue":  true,
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("continue with prompt: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// newMockServer returns a Server in mock mode with the given extra config
+// applied.
+func newMockServer(t *testing.T, mutate func(*Config)) *Server {
+	t.Helper()
+	cfg := Config{Mock: true}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	srv, err := New(cfg, session.NewManager(time.Hour), nil, nil)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+	return srv
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	srv := newMockServer(t, nil)
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Origin", "http://evil.example")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no CORS headers by default, got Access-Control-Allow-Origin=%q", got)
+	}
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) {
+		cfg.CORSOrigins = []string{"http://ide.example:3000"}
+	})
+	for _, path := range []string{"/rpc", "/stream/nope", "/health"} {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", "http://ide.example:3000")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s preflight: got status %d, want %d", path, rec.Code, http.StatusNoContent)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://ide.example:3000" {
+			t.Errorf("%s preflight: Access-Control-Allow-Origin=%q", path, got)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "POST") {
+			t.Errorf("%s preflight: Access-Control-Allow-Methods=%q", path, got)
+		}
+	}
+}
+
+func TestCORSDisallowedOriginPreflight(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) {
+		cfg.CORSOrigins = []string{"http://ide.example:3000"}
+	})
+	req := httptest.NewRequest(http.MethodOptions, "/rpc", nil)
+	req.Header.Set("Origin", "http://evil.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("disallowed preflight: got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed preflight: Access-Control-Allow-Origin=%q, want empty", got)
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) {
+		cfg.CORSOrigins = []string{"*"}
+	})
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Origin", "http://anywhere.example")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://anywhere.example" {
+		t.Errorf("wildcard: Access-Control-Allow-Origin=%q", got)
+	}
+}
+
+func TestCORSAppliesToSSE(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) {
+		cfg.CORSOrigins = []string{"http://ide.example:3000"}
+	})
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	sess.Close()
+	req := httptest.NewRequest(http.MethodGet, "/stream/"+sess.ID, nil)
+	req.Header.Set("Origin", "http://ide.example:3000")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://ide.example:3000" {
+		t.Errorf("SSE: Access-Control-Allow-Origin=%q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sendDedupe fires one session.send with dedupe set and returns the
+// messageId, failing the test on an RPC error.
+func sendDedupe(t *testing.T, srv *Server, sessionID, prompt string) string {
+	t.Helper()
+	result, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sessionID, "prompt": prompt, "dedupe": true,
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var resp struct {
+		MessageID string `json:"messageId"`
+	}
+	if err := json.Unmarshal(result, &resp); err != nil {
+		t.Fatalf("decoding send result: %v", err)
+	}
+	return resp.MessageID
+}
+
+func TestDedupeCollapsesConcurrentIdenticalSends(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+
+	const senders = 4
+	start := make(chan struct{})
+	ids := make([]string, senders)
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			ids[i] = sendDedupe(t, srv, created.SessionID, "double-fired prompt")
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	for i := 1; i < senders; i++ {
+		if ids[i] != ids[0] {
+			t.Errorf("send %d got messageId %q, want the in-flight turn's %q", i, ids[i], ids[0])
+		}
+	}
+	drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second)
+}
+
+func TestDedupeOnlyMatchesIdenticalContent(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	sendDedupe(t, srv, created.SessionID, "first prompt")
+
+	// A different prompt is not a duplicate; with the turn still streaming it
+	// gets the usual turn-active error, dedupe or not.
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "a different prompt", "dedupe": true,
+	})
+	if rpcErr == nil || rpcErr.Code != codeTurnActive {
+		t.Errorf("differing send: got %v, want code %d", rpcErr, codeTurnActive)
+	}
+
+	// Without dedupe even an identical send keeps today's behavior.
+	_, rpcErr = doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "first prompt",
+	})
+	if rpcErr == nil || rpcErr.Code != codeTurnActive {
+		t.Errorf("non-dedupe duplicate: got %v, want code %d", rpcErr, codeTurnActive)
+	}
+	drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second)
+}
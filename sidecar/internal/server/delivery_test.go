@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sendWith(t *testing.T, srv *Server, params map[string]any) map[string]any {
+	t.Helper()
+	result, rpcErr := doRPC(t, srv, "session.send", params)
+	if rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var sent map[string]any
+	if err := json.Unmarshal(result, &sent); err != nil {
+		t.Fatalf("decoding send result: %v", err)
+	}
+	return sent
+}
+
+func TestDeliveryStreamIsTheDefault(t *testing.T) {
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	id := createSessionID(t, srv)
+	sent := sendWith(t, srv, map[string]any{"sessionId": id, "prompt": "hi"})
+	if _, ok := sent["streamUrl"]; !ok {
+		t.Errorf("default delivery result = %v, want a streamUrl", sent)
+	}
+	drainFrames(t, srv.Manager().Get(id), 5*time.Second)
+
+	sent = sendWith(t, srv, map[string]any{"sessionId": id, "prompt": "hi again", "delivery": "stream"})
+	if _, ok := sent["streamUrl"]; !ok {
+		t.Errorf(`delivery "stream" result = %v, want a streamUrl`, sent)
+	}
+	if _, ok := sent["pollUrl"]; ok {
+		t.Errorf("stream delivery result should omit pollUrl: %v", sent)
+	}
+	drainFrames(t, srv.Manager().Get(id), 5*time.Second)
+}
+
+func TestDeliveryPollReturnsPollURL(t *testing.T) {
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	id := createSessionID(t, srv)
+	sent := sendWith(t, srv, map[string]any{
+		"sessionId": id, "prompt": "hi", "delivery": "poll", "relativeUrls": true,
+	})
+	pollURL, _ := sent["pollUrl"].(string)
+	if pollURL != "/poll/"+id {
+		t.Errorf("pollUrl = %q, want /poll/%s", pollURL, id)
+	}
+	if _, ok := sent["streamUrl"]; ok {
+		t.Errorf("poll delivery result should omit streamUrl: %v", sent)
+	}
+	if msgID, _ := sent["messageId"].(string); msgID == "" {
+		t.Errorf("result carries no messageId: %v", sent)
+	}
+	// The turn completes with nobody attached; polling the returned URL
+	// eventually yields the done frame.
+	sawDone := func() bool {
+		req := httptest.NewRequest(http.MethodGet, pollURL+"?since=0", nil)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		var body struct {
+			Events []json.RawMessage `json:"events"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding poll response %q: %v", rec.Body.String(), err)
+		}
+		for _, ev := range body.Events {
+			if frameType(ev) == "done" {
+				return true
+			}
+		}
+		return false
+	}
+	waitFor(t, 5*time.Second, sawDone, "done frame never arrived via the poll endpoint")
+}
+
+func TestDeliveryWebhookRequiresAndForbidsWebhookURL(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hook.Close()
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	id := createSessionID(t, srv)
+
+	sent := sendWith(t, srv, map[string]any{
+		"sessionId": id, "prompt": "hi", "delivery": "webhook", "webhookUrl": hook.URL,
+	})
+	if sent["webhook"] != true {
+		t.Errorf(`delivery "webhook" result = %v, want webhook:true`, sent)
+	}
+	if _, ok := sent["streamUrl"]; ok {
+		t.Errorf("webhook delivery result should omit streamUrl: %v", sent)
+	}
+	drainFrames(t, srv.Manager().Get(id), 5*time.Second)
+
+	for _, bad := range []map[string]any{
+		{"delivery": "webhook"},                        // missing webhookUrl
+		{"delivery": "stream", "webhookUrl": hook.URL}, // contradictory
+		{"delivery": "poll", "webhookUrl": hook.URL},
+		{"delivery": "carrier-pigeon"},
+	} {
+		params := map[string]any{"sessionId": id, "prompt": "hi"}
+		for k, v := range bad {
+			params[k] = v
+		}
+		_, rpcErr := doRPC(t, srv, "session.send", params)
+		if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("params %v: got %v, want code %d", bad, rpcErr, codeInvalidParams)
+		}
+		if rpcErr != nil && !strings.Contains(rpcErr.Message, "delivery") {
+			t.Errorf("params %v: error %q does not mention delivery", bad, rpcErr.Message)
+		}
+	}
+}
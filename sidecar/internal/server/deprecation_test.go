@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestModelsGetReportsDeprecation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, rpcErr := doRPC(t, srv, "models.get", map[string]any{"model": "gpt-3.5-turbo"})
+	if rpcErr != nil {
+		t.Fatalf("models.get: %v", rpcErr)
+	}
+	var model struct {
+		Deprecated         bool   `json:"deprecated"`
+		DeprecationMessage string `json:"deprecationMessage"`
+	}
+	if err := json.Unmarshal(result, &model); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if !model.Deprecated || model.DeprecationMessage == "" {
+		t.Errorf("deprecation not surfaced: %+v", model)
+	}
+}
+
+func TestSessionCreateWarnsOnDeprecatedModel(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-3.5-turbo"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	select {
+	case raw := <-sess.EventChan:
+		var frame map[string]any
+		if err := json.Unmarshal(raw, &frame); err != nil {
+			t.Fatalf("invalid frame %q: %v", raw, err)
+		}
+		if frame["type"] != "model_deprecated" || frame["message"] == "" {
+			t.Errorf("frame = %v, want a model_deprecated warning", frame)
+		}
+	default:
+		t.Fatal("no model_deprecated frame published at create")
+	}
+
+	// A current model gets no warning.
+	result, rpcErr = doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if frames, _ := srv.Manager().Get(created.SessionID).EventsSince(0); len(frames) != 0 {
+		t.Errorf("unexpected frames on a current model: %s", frames)
+	}
+}
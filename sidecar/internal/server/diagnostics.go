@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// "diagnostic" context items: {"type":"diagnostic","severity":"error",
+// "message":...,"file":...,"line":...,"stacktrace":...} forwards one IDE
+// inspection or compiler error with its structure intact, instead of a
+// stacktrace pasted into the prompt as anonymous text. The bridge folds
+// every diagnostic item on a send into a single labeled block — most severe
+// first — so a "fix this error" turn carries the full picture as one
+// clearly marked attachment.
+
+// diagnosticSeverities ranks the accepted severity values, mirroring the
+// LSP's set; lower ranks render first in the grouped block.
+var diagnosticSeverities = map[string]int{"error": 0, "warning": 1, "info": 2, "hint": 3}
+
+// maxDiagnosticStacktrace caps one diagnostic's stacktrace. Like terminal
+// output, longer traces lose the middle: the top frames name the failure,
+// the bottom ones its entry point.
+const maxDiagnosticStacktrace = 8 * 1024
+
+// formatDiagnosticItems validates "diagnostic" context items and replaces
+// them with one item carrying the grouped rendered block. It returns the
+// reshaped slice; non-diagnostic items keep their order, and the merged
+// item takes the first diagnostic's position and the group's highest
+// priority so truncation treats the block as its most important member.
+func formatDiagnosticItems(items []copilot.ContextItem) ([]copilot.ContextItem, *rpcError) {
+	var diags []copilot.ContextItem
+	for _, item := range items {
+		if item.Type != "diagnostic" {
+			continue
+		}
+		if _, ok := diagnosticSeverities[item.Severity]; !ok {
+			return nil, errInvalidParams("diagnostic severity %q is not one of error, warning, info, hint", item.Severity)
+		}
+		if item.Message == "" {
+			return nil, errInvalidParams("diagnostic context item needs a message")
+		}
+		if item.Line < 0 {
+			return nil, errInvalidParams("diagnostic line must not be negative")
+		}
+		diags = append(diags, item)
+	}
+	if len(diags) == 0 {
+		return items, nil
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diagnosticSeverities[diags[i].Severity] < diagnosticSeverities[diags[j].Severity]
+	})
+	var b strings.Builder
+	b.WriteString("Diagnostics (" + summarizeDiagnostics(diags) + "):\n")
+	priority := 0
+	for _, d := range diags {
+		b.WriteString(renderDiagnostic(d))
+		if d.Priority > priority {
+			priority = d.Priority
+		}
+	}
+	merged := copilot.ContextItem{
+		Type:     "diagnostic",
+		Content:  strings.TrimRight(b.String(), "\n"),
+		Priority: priority,
+	}
+	out := make([]copilot.ContextItem, 0, len(items)-len(diags)+1)
+	placed := false
+	for _, item := range items {
+		if item.Type != "diagnostic" {
+			out = append(out, item)
+			continue
+		}
+		if !placed {
+			out = append(out, merged)
+			placed = true
+		}
+	}
+	return out, nil
+}
+
+// summarizeDiagnostics renders the block header's severity tally, e.g.
+// "2 errors, 1 warning", in severity order.
+func summarizeDiagnostics(diags []copilot.ContextItem) string {
+	counts := make(map[string]int)
+	for _, d := range diags {
+		counts[d.Severity]++
+	}
+	var parts []string
+	for _, sev := range []string{"error", "warning", "info", "hint"} {
+		n := counts[sev]
+		if n == 0 {
+			continue
+		}
+		label := sev
+		if n > 1 && sev != "info" {
+			label += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", n, label))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// renderDiagnostic renders one diagnostic as a bullet with its location in
+// parentheses and any stacktrace indented beneath it.
+func renderDiagnostic(d copilot.ContextItem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- [%s] %s", d.Severity, d.Message)
+	if d.File != "" {
+		b.WriteString(" (" + d.File)
+		if d.Line > 0 {
+			fmt.Fprintf(&b, ":%d", d.Line)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteByte('\n')
+	if d.Stacktrace != "" {
+		for _, line := range strings.Split(middleTruncate(d.Stacktrace, maxDiagnosticStacktrace), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
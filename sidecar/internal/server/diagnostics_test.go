@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestFormatDiagnosticItemsGroupsMixedSeverity(t *testing.T) {
+	items := []copilot.ContextItem{
+		{File: "a.go", Content: "untouched"},
+		{Type: "diagnostic", Severity: "warning", Message: "unused variable x", File: "main.go", Line: 12},
+		{Type: "diagnostic", Severity: "error", Message: "cannot find symbol Foo", File: "main.go", Line: 42,
+			Stacktrace: "at com.example.Main.run(Main.java:42)\nat com.example.Main.main(Main.java:7)", Priority: 5},
+		{Type: "diagnostic", Severity: "info", Message: "consider a guard clause"},
+	}
+	out, rpcErr := formatDiagnosticItems(items)
+	if rpcErr != nil {
+		t.Fatalf("formatDiagnosticItems: %v", rpcErr)
+	}
+	if len(out) != 2 {
+		t.Fatalf("got %d items, want the file item plus one merged diagnostic block", len(out))
+	}
+	if out[0].Content != "untouched" {
+		t.Errorf("non-diagnostic item modified: %v", out[0])
+	}
+	block := out[1]
+	if block.Type != "diagnostic" || block.Priority != 5 {
+		t.Errorf("merged item = type %q priority %d, want a diagnostic carrying the group's top priority", block.Type, block.Priority)
+	}
+	if !strings.HasPrefix(block.Content, "Diagnostics (1 error, 1 warning, 1 info):\n") {
+		t.Errorf("header = %q, want the severity tally", block.Content)
+	}
+	errIdx := strings.Index(block.Content, "[error] cannot find symbol Foo (main.go:42)")
+	warnIdx := strings.Index(block.Content, "[warning] unused variable x (main.go:12)")
+	infoIdx := strings.Index(block.Content, "[info] consider a guard clause")
+	if errIdx < 0 || warnIdx < 0 || infoIdx < 0 {
+		t.Fatalf("block missing entries:\n%s", block.Content)
+	}
+	if !(errIdx < warnIdx && warnIdx < infoIdx) {
+		t.Errorf("entries not ordered by severity:\n%s", block.Content)
+	}
+	if !strings.Contains(block.Content, "\n  at com.example.Main.run(Main.java:42)\n") {
+		t.Errorf("stacktrace not indented under its diagnostic:\n%s", block.Content)
+	}
+}
+
+func TestFormatDiagnosticItemsValidation(t *testing.T) {
+	bad := []copilot.ContextItem{{Type: "diagnostic", Severity: "fatal", Message: "boom"}}
+	if _, rpcErr := formatDiagnosticItems(bad); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("severity \"fatal\": got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	noMessage := []copilot.ContextItem{{Type: "diagnostic", Severity: "error"}}
+	if _, rpcErr := formatDiagnosticItems(noMessage); rpcErr == nil {
+		t.Error("diagnostic without a message accepted")
+	}
+	plain := []copilot.ContextItem{{File: "a.go", Content: "x"}}
+	out, rpcErr := formatDiagnosticItems(plain)
+	if rpcErr != nil || len(out) != 1 || out[0].Content != "x" {
+		t.Errorf("diagnostic-free context reshaped: %v, %v", out, rpcErr)
+	}
+}
+
+func TestDiagnosticItemsGroupedOnSend(t *testing.T) {
+	fake := newFakeClient()
+	var got []copilot.ContextItem
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		got = req.Context
+		onEvent(copilot.StreamEvent{Type: "text", Content: "ok"})
+		return &copilot.MessageResponse{Content: "ok", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "fix this error",
+		"context": []map[string]any{
+			{"type": "diagnostic", "severity": "error", "message": "nil pointer dereference", "file": "srv.go", "line": 9},
+			{"type": "diagnostic", "severity": "warning", "message": "shadowed variable err", "file": "srv.go", "line": 3},
+		},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+	if len(got) != 1 {
+		t.Fatalf("SDK saw %d context items, want one grouped block: %+v", len(got), got)
+	}
+	if !strings.HasPrefix(got[0].Content, "Diagnostics (1 error, 1 warning):") {
+		t.Errorf("grouped block = %q", got[0].Content)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// editRange is the span an edit frame replaces. Lines are 1-based and
+// inclusive, the same convention context items use. A nil range on an edit
+// frame means the whole file is replaced.
+type editRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// editFromToolCall recognizes the SDK's edit/patch tool calls and translates
+// them into structured edit frames the plugin can render as inline
+// accept/reject UI. The tool still executes through the normal callback
+// flow; the frame is a parallel notification, not a replacement for it.
+func editFromToolCall(ev copilot.StreamEvent) (Frame, bool) {
+	switch ev.ToolName {
+	case "edit_file", "apply_patch", "str_replace":
+	default:
+		return Frame{}, false
+	}
+	args := ev.ToolArgs
+	file := stringArg(args, "file")
+	if file == "" {
+		file = stringArg(args, "path")
+	}
+	if file == "" {
+		return Frame{}, false
+	}
+	newText := stringArg(args, "newText")
+	if newText == "" {
+		newText = stringArg(args, "content")
+	}
+	f := Frame{Type: "edit", Name: ev.ToolName, CallID: ev.ToolCallID, File: file, NewText: newText}
+	start, end := intArg(args, "startLine"), intArg(args, "endLine")
+	if start > 0 {
+		if end < start {
+			end = start
+		}
+		f.Range = &editRange{StartLine: start, EndLine: end}
+	}
+	return f, true
+}
+
+func stringArg(args map[string]any, key string) string {
+	s, _ := args[key].(string)
+	return s
+}
+
+// intArg reads a numeric tool argument; JSON numbers decode as float64.
+func intArg(args map[string]any, key string) int {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func editingSendFunc(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+	onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-1", ToolName: "edit_file",
+		ToolArgs: map[string]any{"path": "main.go", "startLine": float64(3), "endLine": float64(5), "newText": "fixed()"}})
+	onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-2", ToolName: "apply_patch",
+		ToolArgs: map[string]any{"file": "util.go", "content": "package util"}})
+	onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-3", ToolName: "file_read",
+		ToolArgs: map[string]any{"path": "main.go"}})
+	return &copilot.MessageResponse{MessageID: "msg-1", Content: "edited"}, nil
+}
+
+func TestStructuredEditFrames(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = editingSendFunc
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":       sess.ID,
+		"prompt":          "fix it",
+		"structuredEdits": true,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 2*time.Second)
+	var edits []map[string]any
+	var summary map[string]any
+	for _, f := range frames {
+		switch f["type"] {
+		case "edit":
+			edits = append(edits, f)
+		case "edit_summary":
+			summary = f
+		}
+	}
+	if len(edits) != 2 {
+		t.Fatalf("got %d edit frames, want 2 (file_read must not count): %v", len(edits), frames)
+	}
+	first := edits[0]
+	if first["file"] != "main.go" || first["newText"] != "fixed()" {
+		t.Errorf("first edit = %v", first)
+	}
+	rng, _ := first["range"].(map[string]any)
+	if rng == nil || rng["startLine"] != float64(3) || rng["endLine"] != float64(5) {
+		t.Errorf("first edit range = %v, want 1-based 3-5", first["range"])
+	}
+	second := edits[1]
+	if second["file"] != "util.go" || second["newText"] != "package util" {
+		t.Errorf("second edit = %v", second)
+	}
+	if second["range"] != nil {
+		t.Errorf("whole-file edit carries a range: %v", second["range"])
+	}
+	if summary == nil {
+		t.Fatal("no edit_summary frame")
+	}
+	files, _ := summary["files"].([]any)
+	if len(files) != 2 || files[0] != "main.go" || files[1] != "util.go" {
+		t.Errorf("edit_summary files = %v, want [main.go util.go]", files)
+	}
+}
+
+func TestEditFramesAreOptIn(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = editingSendFunc
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "fix it"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	for _, f := range drainFrames(t, sess, 2*time.Second) {
+		if f["type"] == "edit" || f["type"] == "edit_summary" {
+			t.Fatalf("edit frame emitted without structuredEdits: %v", f)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestApplicationErrorFrameThenNormalDone(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		return nil, &copilot.CLIError{Method: "send", Message: "quota exceeded for this billing period"}
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var types []string
+	var errFrame map[string]any
+	for _, f := range drainFrames(t, sess, 5*time.Second) {
+		types = append(types, f["type"].(string))
+		if f["type"] == "error" {
+			errFrame = f
+		}
+	}
+	if errFrame == nil {
+		t.Fatalf("no error frame in %v", types)
+	}
+	if errFrame["category"] != copilot.ErrorCategoryApplication {
+		t.Errorf("category = %v, want %q", errFrame["category"], copilot.ErrorCategoryApplication)
+	}
+	if types[len(types)-1] != "done" {
+		t.Errorf("frame types = %v, want an application error followed by a normal done", types)
+	}
+}
+
+func TestTransportErrorClosesSendStreamWithoutDone(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		return nil, &copilot.CLIError{Method: "send", Message: "unexpected EOF reading CLI response"}
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	body := []byte(`{"sessionId":"` + sess.ID + `","prompt":"hi"}`)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/send-stream", bytes.NewReader(body)))
+
+	var types []string
+	var errFrame map[string]any
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		raw, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var f map[string]any
+		if err := json.Unmarshal([]byte(raw), &f); err != nil {
+			t.Fatalf("invalid frame %q: %v", raw, err)
+		}
+		types = append(types, f["type"].(string))
+		if f["type"] == "error" {
+			errFrame = f
+		}
+	}
+	if errFrame == nil {
+		t.Fatalf("no error frame in %v", types)
+	}
+	if errFrame["category"] != copilot.ErrorCategoryTransport {
+		t.Errorf("category = %v, want %q", errFrame["category"], copilot.ErrorCategoryTransport)
+	}
+	// Abnormal close: the connection ends at the transport error, with no
+	// done event, which is the client's cue to offer a retry.
+	for _, typ := range types {
+		if typ == "done" {
+			t.Errorf("frame types = %v, want the stream closed without done after a transport error", types)
+		}
+	}
+	if types[len(types)-1] != "error" {
+		t.Errorf("frame types = %v, want the transport error to be the last frame", types)
+	}
+}
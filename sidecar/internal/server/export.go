@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+type sessionExportParams struct {
+	SessionID string `json:"sessionId"`
+	Format    string `json:"format,omitempty"` // "markdown" (default) or "json"
+}
+
+// rpcSessionExport renders a session's conversation for pasting into a PR
+// description or issue.
+func (s *Server) rpcSessionExport(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionExportParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	history := sess.History()
+	if len(history) == 0 {
+		return nil, errInvalidParams("session %s has no history", p.SessionID)
+	}
+	switch p.Format {
+	case "", "markdown":
+		return map[string]any{
+			"format":  "markdown",
+			"content": exportMarkdown(sess.Model, sess.CreatedAt, history),
+		}, nil
+	case "json":
+		return map[string]any{
+			"format":    "json",
+			"model":     sess.Model,
+			"createdAt": sess.CreatedAt.Format(time.RFC3339),
+			"messages":  history,
+		}, nil
+	default:
+		return nil, errInvalidParams("unknown format %q (want markdown or json)", p.Format)
+	}
+}
+
+// exportMarkdown renders a conversation as markdown with per-message
+// headings. Message content is emitted verbatim, so fenced code blocks in
+// assistant responses survive; user prompts containing fences are wrapped in
+// a longer fence to keep the document well-formed.
+func exportMarkdown(model string, createdAt time.Time, history []session.Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Copilot conversation\n\n")
+	fmt.Fprintf(&b, "- Model: `%s`\n", model)
+	fmt.Fprintf(&b, "- Started: %s\n\n", createdAt.Format(time.RFC3339))
+	for _, msg := range history {
+		heading := "Assistant"
+		if msg.Role == "user" {
+			heading = "User"
+		}
+		fmt.Fprintf(&b, "## %s (%s)\n\n", heading, msg.Timestamp.Format(time.RFC3339))
+		if msg.Role == "user" && strings.Contains(msg.Content, "```") {
+			fence := "````"
+			for strings.Contains(msg.Content, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "%s\n%s\n%s\n\n", fence, msg.Content, fence)
+		} else {
+			fmt.Fprintf(&b, "%s\n\n", msg.Content)
+		}
+	}
+	return b.String()
+}
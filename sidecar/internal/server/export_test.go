@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+func TestExportMarkdown(t *testing.T) {
+	created := time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC)
+	history := []session.Message{
+		{Role: "user", Content: "explain this:\n```go\nfunc main() {}\n```", Timestamp: created},
+		{Role: "assistant", Content: "It does nothing.\n\n```go\nfunc main() {}\n```", Timestamp: created.Add(time.Minute)},
+	}
+	md := exportMarkdown("gpt-4o", created, history)
+	for _, want := range []string{
+		"# Copilot conversation",
+		"Model: `gpt-4o`",
+		"## User (2026-08-01T12:00:00Z)",
+		"## Assistant (2026-08-01T12:01:00Z)",
+		"It does nothing.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	// The user prompt contains a fence, so it must be wrapped in a longer one.
+	if !strings.Contains(md, "````\nexplain this:") {
+		t.Errorf("user prompt with fence not wrapped:\n%s", md)
+	}
+}
+
+func TestSessionExportRPC(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+
+	if _, rpcErr := doRPC(t, srv, "session.export", map[string]any{"sessionId": sess.ID}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("export with no history: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+
+	sess.AppendHistory("user", "hi")
+	sess.AppendHistory("assistant", "hello")
+
+	result, rpcErr := doRPC(t, srv, "session.export", map[string]any{"sessionId": sess.ID})
+	if rpcErr != nil {
+		t.Fatalf("markdown export: %v", rpcErr)
+	}
+	var md struct {
+		Format  string `json:"format"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(result, &md); err != nil {
+		t.Fatalf("decoding markdown result: %v", err)
+	}
+	if md.Format != "markdown" || !strings.Contains(md.Content, "## User") {
+		t.Errorf("markdown export = %+v", md)
+	}
+
+	result, rpcErr = doRPC(t, srv, "session.export", map[string]any{"sessionId": sess.ID, "format": "json"})
+	if rpcErr != nil {
+		t.Fatalf("json export: %v", rpcErr)
+	}
+	var js struct {
+		Model    string            `json:"model"`
+		Messages []session.Message `json:"messages"`
+	}
+	if err := json.Unmarshal(result, &js); err != nil {
+		t.Fatalf("decoding json result: %v", err)
+	}
+	if js.Model != "gpt-4o" || len(js.Messages) != 2 {
+		t.Errorf("json export = %+v", js)
+	}
+
+	if _, rpcErr := doRPC(t, srv, "session.export", map[string]any{"sessionId": sess.ID, "format": "xml"}); rpcErr == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// fakeClient is a scriptable copilot.Client for server tests.
+type fakeClient struct {
+	models []copilot.Model
+	// send is invoked by SendMessage; tests script turn behavior here.
+	send func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error)
+	// list, when set, replaces the canned ListModels response.
+	list func(ctx context.Context) ([]copilot.Model, error)
+	// create, when set, replaces the canned CreateSession behavior.
+	create func(ctx context.Context, cfg copilot.SessionConfig) (string, error)
+	// start, when set, replaces the canned no-op Start.
+	start func(ctx context.Context) error
+	// tools, when set, replaces the canned ListTools response.
+	tools []copilot.Tool
+
+	createCalls  atomic.Int64
+	listCalls    atomic.Int64
+	cancelCalls  atomic.Int64
+	toolResults  chan copilot.ToolResult
+	destroyCalls atomic.Int64
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		models:      []copilot.Model{{ID: "gpt-4o", Name: "GPT-4o", Default: true}},
+		toolResults: make(chan copilot.ToolResult, 16),
+	}
+}
+
+func (f *fakeClient) Start(ctx context.Context) error {
+	if f.start != nil {
+		return f.start(ctx)
+	}
+	return nil
+}
+func (f *fakeClient) Stop() error { return nil }
+
+func (f *fakeClient) CreateSession(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+	n := f.createCalls.Add(1)
+	if f.create != nil {
+		return f.create(ctx, cfg)
+	}
+	return "sdk-" + string(rune('0'+n%10)), nil
+}
+
+func (f *fakeClient) DestroySession(ctx context.Context, sessionID string) error {
+	f.destroyCalls.Add(1)
+	return nil
+}
+
+func (f *fakeClient) SendMessage(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+	if f.send != nil {
+		return f.send(ctx, sessionID, req, onEvent)
+	}
+	onEvent(copilot.StreamEvent{Type: "text", Content: "ok"})
+	return &copilot.MessageResponse{MessageID: "msg-fake", Content: "ok"}, nil
+}
+
+func (f *fakeClient) SendToolResult(ctx context.Context, sessionID string, result copilot.ToolResult) error {
+	select {
+	case f.toolResults <- result:
+	default:
+	}
+	return nil
+}
+
+func (f *fakeClient) CancelMessage(ctx context.Context, sessionID string) error {
+	f.cancelCalls.Add(1)
+	return nil
+}
+
+func (f *fakeClient) ListTools(ctx context.Context) ([]copilot.Tool, error) {
+	if f.tools != nil {
+		return f.tools, nil
+	}
+	return []copilot.Tool{{Name: "read_file"}, {Name: "write_file"}, {Name: "run_terminal_command"}}, nil
+}
+
+func (f *fakeClient) ListModels(ctx context.Context) ([]copilot.Model, error) {
+	f.listCalls.Add(1)
+	if f.list != nil {
+		return f.list(ctx)
+	}
+	return f.models, nil
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/callback"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestFetchContextItemResolvedViaCallback(t *testing.T) {
+	fake := newFakeClient()
+	var got []copilot.ContextItem
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		got = req.Context
+		return &copilot.MessageResponse{MessageID: "msg-sdk", Content: "ok"}, nil
+	}
+	srv, rec := newFakeServer(t, fake, nil)
+	rec.respond = func(req callback.ToolRequest) (callback.ToolResponse, int) {
+		if req.Tool != fetchFileTool {
+			t.Errorf("callback tool = %q, want %q", req.Tool, fetchFileTool)
+		}
+		if req.Args["file"] != "big.go" {
+			t.Errorf("callback args = %v", req.Args)
+		}
+		return callback.ToolResponse{Result: "package big\n// ... contents ..."}, http.StatusOK
+	}
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID,
+		"prompt":    "explain",
+		"context":   []map[string]any{{"file": "big.go", "fetch": true}},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second)
+	if len(got) != 1 {
+		t.Fatalf("SDK saw %d context items, want 1", len(got))
+	}
+	if got[0].Content != "package big\n// ... contents ..." {
+		t.Errorf("content = %q, want the fetched file", got[0].Content)
+	}
+	if got[0].Fetch {
+		t.Error("fetch flag leaked through to the SDK")
+	}
+}
+
+func TestFetchContextItemFailureFailsTheSend(t *testing.T) {
+	srv, rec := newFakeServer(t, newFakeClient(), nil)
+	rec.respond = func(req callback.ToolRequest) (callback.ToolResponse, int) {
+		return callback.ToolResponse{Error: "no such file"}, http.StatusOK
+	}
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID,
+		"prompt":    "explain",
+		"context":   []map[string]any{{"file": "gone.go", "fetch": true}},
+	})
+	if rpcErr == nil || rpcErr.Code != codeInternalError {
+		t.Errorf("got %v, want code %d", rpcErr, codeInternalError)
+	}
+
+	// Validation failures are invalid params, not internal errors.
+	for _, item := range []map[string]any{
+		{"fetch": true}, // no file
+		{"file": "a.go", "fetch": true, "content": "dup"}, // inline content too
+	} {
+		_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": created.SessionID, "prompt": "x",
+			"context": []map[string]any{item},
+		})
+		if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("item %v: got %v, want code %d", item, rpcErr, codeInvalidParams)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// File handles: files.upload stores content server-side and returns a
+// handle, so a large attachment that recurs across turns — or across
+// sessions, which the per-session context pool cannot cover — is
+// transmitted once and referenced by {"handle":"..."} context items
+// thereafter. Handles expire after fileHandleTTL; files.delete frees one
+// early. Storage is bounded per uploader (keyed by remote address — with
+// the single shared bearer token that is the closest thing to a client
+// identity the bridge has) so one client cannot fill the server's memory.
+
+const (
+	// fileHandleTTL is how long an uploaded file stays referenceable.
+	fileHandleTTL = 1 * time.Hour
+	// maxStoredFileBytes bounds one upload; fileQuotaBytes bounds one
+	// uploader's total live storage.
+	maxStoredFileBytes = 1 << 20
+	fileQuotaBytes     = 16 << 20
+)
+
+// storedFile is one uploaded file awaiting references.
+type storedFile struct {
+	content string
+	owner   string
+	expires time.Time
+}
+
+// fileStore holds uploaded files by handle. Expired entries are purged
+// lazily on every operation, like the dedupe-send table; there is no
+// background sweeper to leak.
+type fileStore struct {
+	mu    sync.Mutex
+	files map[string]storedFile
+	// used tracks live bytes per owner for the quota.
+	used map[string]int64
+}
+
+func newFileStore() *fileStore {
+	return &fileStore{files: make(map[string]storedFile), used: make(map[string]int64)}
+}
+
+// purgeLocked drops expired files and returns their bytes to their owners.
+func (fs *fileStore) purgeLocked(now time.Time) {
+	for handle, f := range fs.files {
+		if now.After(f.expires) {
+			fs.used[f.owner] -= int64(len(f.content))
+			delete(fs.files, handle)
+		}
+	}
+}
+
+// upload stores content for owner and returns the new handle.
+func (fs *fileStore) upload(owner, content string) (string, time.Time, *rpcError) {
+	if content == "" {
+		return "", time.Time{}, errInvalidParams("content is required")
+	}
+	if len(content) > maxStoredFileBytes {
+		return "", time.Time{}, errInvalidParams("upload is %d bytes; the per-file limit is %d", len(content), maxStoredFileBytes)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	now := time.Now()
+	fs.purgeLocked(now)
+	if fs.used[owner]+int64(len(content)) > fileQuotaBytes {
+		return "", time.Time{}, errInvalidParams("upload would exceed the %d-byte storage quota (delete handles or let them expire)", fileQuotaBytes)
+	}
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", time.Time{}, &rpcError{Code: codeInternalError, Message: fmt.Sprintf("generating handle: %v", err)}
+	}
+	handle := "fh-" + hex.EncodeToString(raw[:])
+	expires := now.Add(fileHandleTTL)
+	fs.files[handle] = storedFile{content: content, owner: owner, expires: expires}
+	fs.used[owner] += int64(len(content))
+	return handle, expires, nil
+}
+
+// delete removes a handle, reporting whether it existed (and was unexpired).
+func (fs *fileStore) delete(handle string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.purgeLocked(time.Now())
+	f, ok := fs.files[handle]
+	if !ok {
+		return false
+	}
+	fs.used[f.owner] -= int64(len(f.content))
+	delete(fs.files, handle)
+	return true
+}
+
+// get returns a live handle's content.
+func (fs *fileStore) get(handle string) (string, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.purgeLocked(time.Now())
+	f, ok := fs.files[handle]
+	return f.content, ok
+}
+
+// uploadOwner keys the storage quota: the remote host, the only per-client
+// identity a shared-token deployment has.
+func uploadOwner(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type filesUploadParams struct {
+	Content string `json:"content"`
+}
+
+// rpcFilesUpload stores content and returns the handle context items may
+// reference. Handles are not tied to any session; see the doc block above.
+func (s *Server) rpcFilesUpload(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	var p filesUploadParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	handle, expires, rpcErr := s.files.upload(uploadOwner(r), p.Content)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return map[string]any{
+		"handle":    handle,
+		"bytes":     len(p.Content),
+		"expiresAt": expires.Format(time.RFC3339),
+	}, nil
+}
+
+type filesDeleteParams struct {
+	Handle string `json:"handle"`
+}
+
+// rpcFilesDelete frees a handle before its TTL. Deleting an unknown (or
+// already expired) handle reports deleted: false rather than erroring —
+// the caller's goal, the content being gone, is met either way.
+func (s *Server) rpcFilesDelete(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p filesDeleteParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Handle == "" {
+		return nil, errInvalidParams("handle is required")
+	}
+	return map[string]any{"deleted": s.files.delete(p.Handle)}, nil
+}
+
+// resolveHandleItems fills in Content for context items referencing an
+// uploaded file by handle. An unknown or expired handle fails the send:
+// silently attaching nothing would mislead the model.
+func (s *Server) resolveHandleItems(items []copilot.ContextItem) *rpcError {
+	for i := range items {
+		item := &items[i]
+		if item.Handle == "" {
+			continue
+		}
+		if item.Content != "" {
+			return errInvalidParams("context item has both a handle and inline content")
+		}
+		content, ok := s.files.get(item.Handle)
+		if !ok {
+			return errInvalidParams("unknown or expired file handle %q", item.Handle)
+		}
+		item.Content = content
+		item.Handle = ""
+	}
+	return nil
+}
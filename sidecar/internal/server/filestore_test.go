@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func uploadFile(t *testing.T, srv *Server, content string) string {
+	t.Helper()
+	res, rpcErr := doRPC(t, srv, "files.upload", map[string]any{"content": content})
+	if rpcErr != nil {
+		t.Fatalf("files.upload: %v", rpcErr)
+	}
+	var out struct {
+		Handle string `json:"handle"`
+	}
+	if err := json.Unmarshal(res, &out); err != nil {
+		t.Fatalf("decoding upload result: %v", err)
+	}
+	return out.Handle
+}
+
+func TestFileHandleUploadAndReference(t *testing.T) {
+	var gotItems []copilot.ContextItem
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		gotItems = req.Context
+		return &copilot.MessageResponse{Content: "ok", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	handle := uploadFile(t, srv, "big recurring attachment")
+
+	// Handles are not session-scoped: two sessions reference the same one.
+	for i := 0; i < 2; i++ {
+		id := createSessionID(t, srv)
+		sess := srv.Manager().Get(id)
+		if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": id, "prompt": "use it",
+			"context": []map[string]any{{"file": "big.txt", "handle": handle}},
+		}); rpcErr != nil {
+			t.Fatalf("send %d: %v", i, rpcErr)
+		}
+		drainFrames(t, sess, 5*time.Second)
+		if len(gotItems) != 1 || gotItems[0].Content != "big recurring attachment" {
+			t.Fatalf("send %d: SDK context = %+v, want the uploaded content inline", i, gotItems)
+		}
+		if gotItems[0].Handle != "" {
+			t.Errorf("send %d: handle leaked to the SDK", i)
+		}
+	}
+}
+
+func TestFileHandleDeleteAndExpiry(t *testing.T) {
+	srv := newMockServer(t, nil)
+	handle := uploadFile(t, srv, "short-lived")
+	res, rpcErr := doRPC(t, srv, "files.delete", map[string]any{"handle": handle})
+	if rpcErr != nil {
+		t.Fatalf("files.delete: %v", rpcErr)
+	}
+	var out struct {
+		Deleted bool `json:"deleted"`
+	}
+	if err := json.Unmarshal(res, &out); err != nil || !out.Deleted {
+		t.Errorf("delete result = %s (%v), want deleted true", res, err)
+	}
+	id := createSessionID(t, srv)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "use it",
+		"context": []map[string]any{{"handle": handle}},
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("referencing a deleted handle: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+
+	// An expired handle behaves exactly like a deleted one.
+	expired := uploadFile(t, srv, "stale")
+	srv.files.mu.Lock()
+	f := srv.files.files[expired]
+	f.expires = time.Now().Add(-time.Minute)
+	srv.files.files[expired] = f
+	srv.files.mu.Unlock()
+	if _, ok := srv.files.get(expired); ok {
+		t.Error("expired handle still resolvable")
+	}
+	srv.files.mu.Lock()
+	used := srv.files.used
+	total := int64(0)
+	for _, n := range used {
+		total += n
+	}
+	srv.files.mu.Unlock()
+	if total != 0 {
+		t.Errorf("quota accounting after delete and expiry = %d bytes, want 0", total)
+	}
+}
+
+func TestFileHandleQuota(t *testing.T) {
+	srv := newMockServer(t, nil)
+	if _, rpcErr := doRPC(t, srv, "files.upload", map[string]any{
+		"content": strings.Repeat("x", maxStoredFileBytes+1),
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("oversized upload: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	chunk := strings.Repeat("x", maxStoredFileBytes)
+	var last string
+	for i := 0; i < int(fileQuotaBytes/maxStoredFileBytes); i++ {
+		last = uploadFile(t, srv, chunk)
+	}
+	if _, rpcErr := doRPC(t, srv, "files.upload", map[string]any{"content": chunk}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("upload over quota: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	// Deleting frees quota immediately.
+	if _, rpcErr := doRPC(t, srv, "files.delete", map[string]any{"handle": last}); rpcErr != nil {
+		t.Fatalf("files.delete: %v", rpcErr)
+	}
+	uploadFile(t, srv, chunk)
+}
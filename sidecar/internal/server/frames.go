@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// Frame is one event frame as delivered to streaming clients. All frames are
+// built here and marshaled with encoding/json so prompt-derived content is
+// always escaped correctly; never hand-assemble frame JSON.
+type Frame struct {
+	Type    string         `json:"type"`
+	Content string         `json:"content,omitempty"`
+	Name    string         `json:"name,omitempty"`
+	CallID  string         `json:"callId,omitempty"`
+	Args    map[string]any `json:"args,omitempty"`
+	Message string         `json:"message,omitempty"`
+	// Category appears on error frames and is one of
+	// copilot.ErrorCategoryApplication (the model or platform rejected this
+	// turn — refusal, content filter, quota — and the stream still ends with
+	// a normal done) or copilot.ErrorCategoryTransport (the plumbing failed;
+	// the stream closes abnormally and a retry is worth offering).
+	Category  string `json:"category,omitempty"`
+	MessageID string `json:"messageId,omitempty"`
+	// RequestID appears on done frames and is the raw SDK request
+	// identifier, as the Copilot CLI logs it — the un-prefixed form of
+	// MessageID, kept separate so cross-system log correlation needs no
+	// string surgery. Mock turns have no SDK request and omit it.
+	RequestID string `json:"requestId,omitempty"`
+	// ModelID tags frames on a session.compare stream with the model that
+	// produced them; it is empty on ordinary single-model streams.
+	ModelID string `json:"modelId,omitempty"`
+	// File, Range and NewText describe an "edit" frame: replace Range in
+	// File with NewText (nil Range = replace the whole file). Lines are
+	// 1-based and inclusive; see editFromToolCall.
+	File    string     `json:"file,omitempty"`
+	Range   *editRange `json:"range,omitempty"`
+	NewText string     `json:"newText,omitempty"`
+	// Files lists the files touched by a turn on its edit_summary frame, in
+	// the order first edited.
+	Files []string `json:"files,omitempty"`
+	// Stage appears on timeout frames and names what timed out; today the
+	// only value is "generation" (the turn-duration ceiling).
+	Stage string `json:"stage,omitempty"`
+	// Reason appears on cancelled frames and says why the turn ended early,
+	// always one of: "user" (session.cancel), "timeout" (turn-duration
+	// ceiling), "tool_limit" (tool-iteration cap), "disconnect" (the
+	// client's stream went away or never attached), "shutdown" (the server
+	// is draining). The UI can explain each without guessing. On
+	// model_routed frames it instead names the routing rule that matched.
+	Reason string `json:"reason,omitempty"`
+	// Success appears on tool_result frames the bridge emits when the
+	// plugin reports a tool failure; see executeToolCall.
+	Success *bool `json:"success,omitempty"`
+	// Percent appears on tool_progress frames when the plugin estimated
+	// completion; absent otherwise.
+	Percent *float64 `json:"percent,omitempty"`
+	// FinishReason appears on done frames: "length" means the response was
+	// truncated by the token limit and can be resumed with a continue send.
+	FinishReason string     `json:"finishReason,omitempty"`
+	Stats        *turnStats `json:"stats,omitempty"`
+	// Title, URI and Snippet describe a "citation" frame: a source the model
+	// drew on, emitted as the SDK reports it so the IDE can render a link
+	// inline. Citations aggregates the turn's citations on its done frame, in
+	// the order first cited; turns that cite nothing omit it.
+	Title     string             `json:"title,omitempty"`
+	URI       string             `json:"uri,omitempty"`
+	Snippet   string             `json:"snippet,omitempty"`
+	Citations []copilot.Citation `json:"citations,omitempty"`
+	// Blocks is the parsed markdown structure on "rendered" frames, emitted
+	// when the send opted in with renderMarkdown; see markdown.go.
+	Blocks []markdownBlock `json:"blocks,omitempty"`
+	// Summarized and Kept appear on "history_summarized" frames: how many
+	// stored messages were folded into the summary and how many recent
+	// ones stayed verbatim.
+	Summarized int `json:"summarized,omitempty"`
+	Kept       int `json:"kept,omitempty"`
+	// Requested and Using describe a "model_fallback" frame: the account
+	// could not use Requested, so the session runs on Using instead. Only
+	// emitted when --allow-model-fallback is set; see rpcSessionCreate.
+	// Using also appears on "model_routed" frames, naming the model the
+	// routing policy picked for the turn.
+	Requested string `json:"requested,omitempty"`
+	Using     string `json:"using,omitempty"`
+	// Stdout and Artifacts describe a "code_output" frame: what sandboxed
+	// code execution printed and the files it produced, the latter as
+	// file-store handles rather than inline bodies. See codeexec.go.
+	Stdout    string        `json:"stdout,omitempty"`
+	Artifacts []artifactRef `json:"artifacts,omitempty"`
+	// Raw carries the original SDK event on "unknown" frames (debug mode
+	// only), so new SDK event types are inspectable before the bridge
+	// learns them.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// turnStats is the timing payload of the "stats" frame emitted at the end of
+// each turn, before "done". Measurement starts when session.send is received
+// and stops when generation completes.
+type turnStats struct {
+	TimeToFirstTokenMs int64   `json:"timeToFirstTokenMs"`
+	DurationMs         int64   `json:"durationMs"`
+	Chunks             int64   `json:"chunks"`
+	TokensPerSecond    float64 `json:"tokensPerSecond"`
+}
+
+// encodeFrame marshals a frame for the event channel.
+func encodeFrame(f Frame) []byte {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		// A Frame is always marshalable; this guards future field additions.
+		log.Printf("frames: marshalling %q frame: %v", f.Type, err)
+		return []byte(`{"type":"error","message":"internal frame encoding error"}`)
+	}
+	return raw
+}
+
+// errorFrame builds the error frame for a failed turn, tagged with the
+// category the UI keys on (see Frame.Category and copilot.ErrorCategory).
+func errorFrame(err error) Frame {
+	return Frame{Type: "error", Category: copilot.ErrorCategory(err), Message: err.Error()}
+}
+
+// transportError reports whether an encoded frame is a transport-category
+// error, the one frame after which a stream handler closes the connection
+// instead of waiting for done.
+func transportError(raw []byte) bool {
+	var f struct {
+		Type     string `json:"type"`
+		Category string `json:"category"`
+	}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return false
+	}
+	return f.Type == "error" && f.Category == copilot.ErrorCategoryTransport
+}
+
+// frameType extracts the type field of an encoded frame. Frames are always
+// built by encodeFrame, so a decode failure here cannot happen in practice;
+// it returns "" rather than guess.
+func frameType(raw []byte) string {
+	var f struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return ""
+	}
+	return f.Type
+}
+
+// publish publishes one typed frame to a session and mirrors it to the
+// session's transcript when transcripts are enabled. Content frames are
+// suppressed after the turn is cancelled: once a client has seen a
+// "cancelled" frame, only "done" may follow.
+func (s *Server) publish(sess *session.Session, f Frame) {
+	if s.redactor != nil && f.Type == "text" && f.Content != "" {
+		// Redaction happens before encoding, so the stream, the poll ring
+		// and the transcript all carry the redacted form.
+		f.Content = s.redactor.apply(f.Content)
+	}
+	if f.Type == "error" && f.Message != "" {
+		s.manager.NotifyError(sess.ID, errors.New(f.Message))
+	}
+	raw := encodeFrame(f)
+	switch f.Type {
+	case "text", "reasoning":
+		if !sess.PublishContent(raw) {
+			return
+		}
+	default:
+		sess.Publish(raw)
+	}
+	s.transcripts.record(sess.ID, transcriptEntry{Kind: "frame", Frame: raw})
+}
+
+// finishTurn releases the session's producer slot and then publishes the
+// terminal done frame, in that order, so that a client reacting to "done"
+// can immediately issue the next send without hitting the turn guard.
+func (s *Server) finishTurn(sess *session.Session, done Frame) {
+	sess.EndTurn()
+	s.publish(sess, done)
+	s.manager.NotifyTurnCompleted(sess.ID, done.FinishReason)
+}
+
+// frameForStreamEvent converts one SDK event into a client frame.
+func frameForStreamEvent(ev copilot.StreamEvent) Frame {
+	switch ev.Type {
+	case "tool_call":
+		return Frame{Type: "tool_call", Name: ev.ToolName, CallID: ev.ToolCallID, Args: ev.ToolArgs}
+	case "citation":
+		f := Frame{Type: "citation"}
+		if ev.Citation != nil {
+			f.Title = ev.Citation.Title
+			f.URI = ev.Citation.URI
+			f.Snippet = ev.Citation.Snippet
+		}
+		return f
+	case "code_output":
+		// Artifact storage needs the server's file store; runTurn handles
+		// that itself via codeOutputFrame. This path (retry/compare turns,
+		// which never request code execution) carries stdout only.
+		return Frame{Type: "code_output", Stdout: ev.Stdout}
+	default:
+		return Frame{Type: ev.Type, Content: ev.Content}
+	}
+}
+
+// knownStreamEvent reports whether the bridge understands an SDK event type.
+// Anything else is an SDK addition this build predates; see
+// handleUnknownEvent.
+func knownStreamEvent(t string) bool {
+	switch t {
+	case "text", "reasoning", "tool_call", "tool_result", "citation", "code_output":
+		return true
+	}
+	return false
+}
+
+// handleUnknownEvent absorbs an SDK event type the bridge does not
+// recognize. In debug mode the event is surfaced verbatim as an "unknown"
+// frame so new SDK behavior is visible while developing against a newer
+// CLI; in production it is logged and skipped. Either way the turn carries
+// on — an SDK addition must never break streaming.
+func (s *Server) handleUnknownEvent(sess *session.Session, ev copilot.StreamEvent, modelID string) {
+	if !s.cfg.Debug {
+		log.Printf("session %s: skipping unknown SDK event type %q", sess.ID, ev.Type)
+		return
+	}
+	raw, err := json.Marshal(map[string]any{
+		"type":       ev.Type,
+		"content":    ev.Content,
+		"toolCallId": ev.ToolCallID,
+		"toolName":   ev.ToolName,
+		"toolArgs":   ev.ToolArgs,
+	})
+	if err != nil {
+		raw = []byte(`{}`)
+	}
+	s.publish(sess, Frame{Type: "unknown", ModelID: modelID, Raw: raw})
+}
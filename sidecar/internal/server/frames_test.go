@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStatsFramePrecedesDone verifies the trailing stats frame: it arrives
+// immediately before done and carries plausible measurements.
+func TestStatsFramePrecedesDone(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "measure me",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if len(frames) < 2 {
+		t.Fatalf("got %d frames", len(frames))
+	}
+	last, secondLast := frames[len(frames)-1], frames[len(frames)-2]
+	if last["type"] != "done" || secondLast["type"] != "stats" {
+		t.Fatalf("trailing frames = %v, %v; want stats then done", secondLast["type"], last["type"])
+	}
+	stats, ok := secondLast["stats"].(map[string]any)
+	if !ok {
+		t.Fatalf("stats frame missing payload: %v", secondLast)
+	}
+	if stats["chunks"].(float64) < 1 {
+		t.Errorf("chunks = %v, want >= 1", stats["chunks"])
+	}
+	if stats["durationMs"].(float64) <= 0 {
+		t.Errorf("durationMs = %v, want > 0", stats["durationMs"])
+	}
+	if stats["timeToFirstTokenMs"].(float64) < 0 {
+		t.Errorf("timeToFirstTokenMs = %v, want >= 0", stats["timeToFirstTokenMs"])
+	}
+}
+
+// TestSSEFramesAreValidJSON streams a mock response for a hostile prompt and
+// asserts every data: line parses as JSON. Hand-assembled frames used to
+// break on quotes and backslashes in the echoed prompt.
+func TestSSEFramesAreValidJSON(t *testing.T) {
+	srv := newMockServer(t, nil)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	prompt := "say \"hi\" \\ twice\nand a newline, plus 世界 🌍"
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    prompt,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+
+	resp, err := http.Get(ts.URL + "/stream/" + sess.ID)
+	if err != nil {
+		t.Fatalf("attaching stream: %v", err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	frames := 0
+	deadline := time.After(5 * time.Second)
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream ended after %d frames without a done frame", frames)
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			payload := strings.TrimPrefix(line, "data: ")
+			var frame map[string]any
+			if err := json.Unmarshal([]byte(payload), &frame); err != nil {
+				t.Fatalf("frame is not valid JSON: %q: %v", payload, err)
+			}
+			frames++
+			if frame["type"] == "done" {
+				if frames < 3 {
+					t.Errorf("expected several frames before done, got %d", frames)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatalf("timed out after %d frames", frames)
+		}
+	}
+}
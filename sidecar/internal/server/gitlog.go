@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// "gitLog" context items: {"type":"gitLog","repoPath":...,"count":N}
+// attaches the repository's recent commit subjects — the natural context for
+// "write a changelog entry" prompts. The bridge resolves the item itself by
+// running git, so the plugin only names the repository instead of shipping
+// the log inline, and the rendering stays consistent across clients.
+
+const (
+	// defaultGitLogCount and maxGitLogCount bound the -N passed to git log;
+	// an omitted count gets the default, a larger one is rejected.
+	defaultGitLogCount = 20
+	maxGitLogCount     = 100
+	// gitLogTimeout bounds the git invocation so a repository on a hung
+	// network mount cannot stall the send.
+	gitLogTimeout = 10 * time.Second
+)
+
+// validateRepoPath checks that a VCS context item's repoPath names an
+// existing directory inside the tool allowlist. Shared by every
+// VCS-derived item type so they reject bad paths identically.
+func (s *Server) validateRepoPath(itemType, path string) *rpcError {
+	if path == "" {
+		return errInvalidParams("%s context item needs a repoPath", itemType)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errInvalidParams("%s repoPath %q: %v", itemType, path, err)
+	}
+	if !info.IsDir() {
+		return errInvalidParams("%s repoPath %q is not a directory", itemType, path)
+	}
+	if !s.toolPaths().allows(path) {
+		return errInvalidParams("%s repoPath %q is outside the allowed paths", itemType, path)
+	}
+	return nil
+}
+
+// resolveGitLogItems fills in Content for "gitLog" context items by running
+// git log --oneline in the named repository and labeling the output.
+func (s *Server) resolveGitLogItems(ctx context.Context, items []copilot.ContextItem) *rpcError {
+	for i := range items {
+		item := &items[i]
+		if item.Type != "gitLog" {
+			continue
+		}
+		if rpcErr := s.validateRepoPath("gitLog", item.RepoPath); rpcErr != nil {
+			return rpcErr
+		}
+		count := item.Count
+		switch {
+		case count == 0:
+			count = defaultGitLogCount
+		case count < 0 || count > maxGitLogCount:
+			return errInvalidParams("gitLog count %d is out of range (1-%d)", count, maxGitLogCount)
+		}
+		gctx, cancel := context.WithTimeout(ctx, gitLogTimeout)
+		cmd := exec.CommandContext(gctx, "git", "-C", item.RepoPath,
+			"log", "--oneline", fmt.Sprintf("-%d", count))
+		out, err := cmd.CombinedOutput()
+		cancel()
+		if err != nil {
+			if strings.Contains(strings.ToLower(string(out)), "not a git repository") {
+				return errInvalidParams("repoPath %q is not a git repository", item.RepoPath)
+			}
+			return errInvalidParams("git log in %q: %v: %s", item.RepoPath, err, strings.TrimSpace(string(out)))
+		}
+		item.Content = fmt.Sprintf("Recent commits in %s (git log --oneline -%d):\n%s",
+			item.RepoPath, count, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
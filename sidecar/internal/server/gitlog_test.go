@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// makeGitRepo initializes a repository with two commits and returns its path.
+func makeGitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir,
+			"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "a.txt")
+	run("commit", "-q", "-m", "first commit")
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("b"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	run("commit", "-q", "-am", "second commit")
+	return dir
+}
+
+func TestGitLogContextItemResolved(t *testing.T) {
+	repo := makeGitRepo(t)
+	fake := newFakeClient()
+	var got []copilot.ContextItem
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		got = req.Context
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "ok", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "write a changelog entry",
+		"context": []map[string]any{{"type": "gitLog", "repoPath": repo, "count": 5}},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second)
+	if len(got) != 1 {
+		t.Fatalf("SDK saw %d context items, want 1", len(got))
+	}
+	content := got[0].Content
+	if !strings.Contains(content, "Recent commits in") || !strings.Contains(content, "-5") {
+		t.Errorf("missing label: %q", content)
+	}
+	if !strings.Contains(content, "second commit") || !strings.Contains(content, "first commit") {
+		t.Errorf("missing commit subjects: %q", content)
+	}
+}
+
+func TestGitLogContextItemValidation(t *testing.T) {
+	fake := newFakeClient()
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	send := func(item map[string]any) *rpcError {
+		t.Helper()
+		_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": created.SessionID, "prompt": "hi",
+			"context": []map[string]any{item},
+		})
+		return rpcErr
+	}
+	notRepo := t.TempDir()
+	if rpcErr := send(map[string]any{"type": "gitLog", "repoPath": notRepo}); rpcErr == nil ||
+		rpcErr.Code != codeInvalidParams || !strings.Contains(rpcErr.Message, "not a git repository") {
+		t.Errorf("non-repo dir: got %v", rpcErr)
+	}
+	if rpcErr := send(map[string]any{"type": "gitLog"}); rpcErr == nil ||
+		rpcErr.Code != codeInvalidParams || !strings.Contains(rpcErr.Message, "repoPath") {
+		t.Errorf("missing repoPath: got %v", rpcErr)
+	}
+	repo := makeGitRepo(t)
+	if rpcErr := send(map[string]any{"type": "gitLog", "repoPath": repo, "count": maxGitLogCount + 1}); rpcErr == nil ||
+		rpcErr.Code != codeInvalidParams || !strings.Contains(rpcErr.Message, "out of range") {
+		t.Errorf("oversized count: got %v", rpcErr)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postRPC(t *testing.T, srv *Server, encoding string, body []byte) (json.RawMessage, *rpcError) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return resp.Result, resp.Error
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGzipRequestBodyDecompressed(t *testing.T) {
+	srv := newMockServer(t, nil)
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"session.create","params":{}}`)
+	result, rpcErr := postRPC(t, srv, "gzip", gzipBytes(t, body))
+	if rpcErr != nil {
+		t.Fatalf("gzipped create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil || created.SessionID == "" {
+		t.Errorf("result = %s, err = %v", result, err)
+	}
+}
+
+func TestGzipRequestErrors(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.MaxBodyBytes = 2048 })
+
+	// Garbage with the gzip header claim.
+	_, rpcErr := postRPC(t, srv, "gzip", []byte("definitely not gzip"))
+	if rpcErr == nil || rpcErr.Code != codeInvalidRequest || !strings.Contains(rpcErr.Message, "gzip") {
+		t.Errorf("malformed gzip: got %v, want invalid-request mentioning gzip", rpcErr)
+	}
+
+	// A small compressed body that inflates past the limit.
+	big := bytes.Repeat([]byte(" "), 64*1024)
+	bomb := append([]byte(`{"jsonrpc":"2.0","id":1,"method":"models.list","params":{}`), big...)
+	_, rpcErr = postRPC(t, srv, "gzip", gzipBytes(t, bomb))
+	if rpcErr == nil || rpcErr.Code != codeInvalidRequest || !strings.Contains(rpcErr.Message, "decompression") {
+		t.Errorf("zip bomb: got %v, want invalid-request mentioning decompression", rpcErr)
+	}
+
+	// Encodings the server does not speak are rejected, not guessed at.
+	_, rpcErr = postRPC(t, srv, "br", []byte(`{"jsonrpc":"2.0","id":1,"method":"models.list"}`))
+	if rpcErr == nil || rpcErr.Code != codeInvalidRequest {
+		t.Errorf("unsupported encoding: got %v, want code %d", rpcErr, codeInvalidRequest)
+	}
+}
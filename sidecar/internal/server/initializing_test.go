@@ -0,0 +1,130 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// slowStartClient is a fakeClient whose lazy start does not finish until the
+// test releases it, mimicking the CLI's cold-start window.
+type slowStartClient struct {
+	*fakeClient
+	release chan struct{}
+
+	mu       sync.Mutex
+	starting bool
+	ready    bool
+	starts   int
+}
+
+func (c *slowStartClient) TryStart() (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ready {
+		return true, 0
+	}
+	if !c.starting {
+		c.starting = true
+		c.starts++
+		go func() {
+			<-c.release
+			c.mu.Lock()
+			c.ready = true
+			c.mu.Unlock()
+		}()
+	}
+	return false, 12 * time.Second
+}
+
+func (c *slowStartClient) startCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.starts
+}
+
+// setReady forces the readiness state, so tests can simulate the CLI going
+// cold again (e.g. after a Stop) without a second release channel.
+func (c *slowStartClient) setReady(v bool) {
+	c.mu.Lock()
+	c.ready = v
+	c.mu.Unlock()
+}
+
+func TestNonBlockingCreateDuringStartup(t *testing.T) {
+	slow := &slowStartClient{fakeClient: newFakeClient(), release: make(chan struct{})}
+	srv, err := New(Config{}, session.NewManager(time.Hour), slow, nil)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o", "nonBlocking": true})
+		if rpcErr == nil || rpcErr.Code != codeInitializing {
+			t.Fatalf("create %d: got %v, want code %d", i, rpcErr, codeInitializing)
+		}
+		data, ok := rpcErr.Data.(map[string]any)
+		if !ok || data["estimatedWaitSeconds"].(float64) <= 0 {
+			t.Fatalf("create %d: error data = %v, want a positive estimatedWaitSeconds", i, rpcErr.Data)
+		}
+	}
+	if got := slow.startCount(); got != 1 {
+		t.Errorf("starts kicked off = %d, want 1 (polls must share the in-flight start)", got)
+	}
+
+	// Without nonBlocking the create takes the blocking path as before.
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"}); rpcErr != nil {
+		t.Fatalf("blocking create during startup: %v", rpcErr)
+	}
+
+	close(slow.release)
+	waitFor(t, 2*time.Second, func() bool {
+		ready, _ := slow.TryStart()
+		return ready
+	}, "fake start to complete")
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o", "nonBlocking": true}); rpcErr != nil {
+		t.Fatalf("non-blocking create after startup: %v", rpcErr)
+	}
+}
+
+func TestModelsListDuringStartup(t *testing.T) {
+	slow := &slowStartClient{fakeClient: newFakeClient(), release: make(chan struct{})}
+	srv, err := New(Config{}, session.NewManager(time.Hour), slow, nil)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+
+	// Cold server, models.list first: no cached list exists yet, so the call
+	// fails fast with initializing instead of blocking out the CLI start.
+	_, rpcErr := doRPC(t, srv, "models.list", nil)
+	if rpcErr == nil || rpcErr.Code != codeInitializing {
+		t.Fatalf("cold models.list: got %v, want code %d", rpcErr, codeInitializing)
+	}
+	data, ok := rpcErr.Data.(map[string]any)
+	if !ok || data["estimatedWaitSeconds"].(float64) <= 0 {
+		t.Fatalf("error data = %v, want a positive estimatedWaitSeconds", rpcErr.Data)
+	}
+
+	close(slow.release)
+	waitFor(t, 2*time.Second, func() bool {
+		ready, _ := slow.TryStart()
+		return ready
+	}, "fake start to complete")
+	result, rpcErr := doRPC(t, srv, "models.list", nil)
+	if rpcErr != nil {
+		t.Fatalf("models.list after startup: %v", rpcErr)
+	}
+
+	// With a list fetched once, a CLI that goes cold again is served the
+	// cached copy rather than an error.
+	slow.setReady(false)
+	cached, rpcErr := doRPC(t, srv, "models.list", nil)
+	if rpcErr != nil {
+		t.Fatalf("models.list while cold with cache: %v", rpcErr)
+	}
+	if string(cached) != string(result) {
+		t.Errorf("cached result = %s, want the warm result %s", cached, result)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestCloseWithTurnInFlightDefersTeardown(t *testing.T) {
+	release := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return &copilot.MessageResponse{MessageID: "msg-sdk", Content: "ok"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.close", map[string]any{
+		"sessionId": created.SessionID,
+	}); rpcErr != nil {
+		t.Fatalf("session.close: %v", rpcErr)
+	}
+	// The blocked turn still holds the session: close is underway but must
+	// not have torn EventChan down under the producer.
+	if !sess.Closing() {
+		t.Fatal("session with a blocked turn should be closing after session.close")
+	}
+	select {
+	case _, ok := <-sess.EventChan:
+		if !ok {
+			t.Fatal("EventChan closed while the turn still held the session")
+		}
+	default:
+	}
+	close(release)
+	waitFor(t, 2*time.Second, func() bool { return sess.Closed() && !sess.Closing() },
+		"turn release did not complete the deferred close")
+}
+
+func TestSendToClosingSessionRejected(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if !sess.BeginTurn() {
+		t.Fatal("BeginTurn on a fresh session failed")
+	}
+	sess.Close()
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID, "prompt": "hi",
+	})
+	if rpcErr == nil || rpcErr.Code != codeSessionClosed || rpcErr.Message != "session is closing" {
+		t.Errorf("send during close: got %v, want code %d %q", rpcErr, codeSessionClosed, "session is closing")
+	}
+	sess.EndTurn()
+	_, rpcErr = doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID, "prompt": "hi",
+	})
+	if rpcErr == nil || rpcErr.Code != codeSessionClosed || rpcErr.Message != "session is closed" {
+		t.Errorf("send after close: got %v, want code %d %q", rpcErr, codeSessionClosed, "session is closed")
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// recordListener collects lifecycle events behind a mutex.
+type recordListener struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *recordListener) add(ev string) {
+	l.mu.Lock()
+	l.events = append(l.events, ev)
+	l.mu.Unlock()
+}
+
+func (l *recordListener) has(ev string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, got := range l.events {
+		if got == ev {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *recordListener) SessionCreated(id, model string) { l.add("created " + id) }
+func (l *recordListener) SessionClosed(id string)         { l.add("closed " + id) }
+func (l *recordListener) MessageSent(id, msgID string)    { l.add("sent " + id) }
+func (l *recordListener) TurnCompleted(id, reason string) { l.add("turn " + id + " " + reason) }
+func (l *recordListener) ErrorOccurred(id string, err error) {
+	l.add("error " + id + " " + err.Error())
+}
+
+func TestServerFiresListenerHooks(t *testing.T) {
+	fake := newFakeClient()
+	fail := false
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		if fail {
+			return nil, errors.New("model exploded")
+		}
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "ok", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	l := &recordListener{}
+	srv.Manager().AddListener(l)
+
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	id := created.SessionID
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": id, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(id), 5*time.Second)
+	waitFor(t, 2*time.Second, func() bool {
+		return l.has("created "+id) && l.has("sent "+id) && l.has("turn "+id+" stop")
+	}, "lifecycle events after a successful turn")
+
+	fail = true
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": id, "prompt": "again"}); rpcErr != nil {
+		t.Fatalf("second send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(id), 5*time.Second)
+	waitFor(t, 2*time.Second, func() bool {
+		return l.has("error " + id + " model exploded")
+	}, "error event after a failed turn")
+
+	if _, rpcErr := doRPC(t, srv, "session.close", map[string]any{"sessionId": id}); rpcErr != nil {
+		t.Fatalf("session.close: %v", rpcErr)
+	}
+	waitFor(t, 2*time.Second, func() bool { return l.has("closed " + id) }, "closed event")
+}
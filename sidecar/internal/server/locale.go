@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Locale preference: session.create may carry a BCP-47 tag (e.g. de-DE) and
+// the sidecar turns it into a standing "respond in German" system
+// instruction, appended after any caller-supplied systemPrompt. The SDK has
+// no native locale option, so the instruction is the whole mechanism; see
+// the README for how it stacks with prompt prefix/suffix.
+
+// localeTagRE accepts plausible BCP-47 tags: a 2-8 letter primary language
+// subtag followed by dash-separated alphanumeric subtags. It deliberately
+// does not validate against the registry — an unknown-but-well-formed tag
+// still yields a usable instruction naming the tag itself.
+var localeTagRE = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// plausibleLocale reports whether tag is shaped like a BCP-47 language tag.
+func plausibleLocale(tag string) bool {
+	return localeTagRE.MatchString(tag)
+}
+
+// localeLanguages names the common primary language subtags so the
+// instruction can say "German" rather than "de-DE". Tags outside this map
+// fall back to naming the tag.
+var localeLanguages = map[string]string{
+	"ar": "Arabic",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fi": "Finnish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"no": "Norwegian",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// localeInstruction renders the system instruction for a locale tag.
+func localeInstruction(tag string) string {
+	primary := strings.ToLower(tag)
+	if i := strings.Index(primary, "-"); i > 0 {
+		primary = primary[:i]
+	}
+	if name, ok := localeLanguages[primary]; ok {
+		return fmt.Sprintf("Respond in %s.", name)
+	}
+	return fmt.Sprintf("Respond in the language of locale %s.", tag)
+}
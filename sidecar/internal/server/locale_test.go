@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestLocaleBecomesSystemInstruction(t *testing.T) {
+	var got copilot.SessionConfig
+	fake := newFakeClient()
+	fake.create = func(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+		got = cfg
+		return "sdk-locale", nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{
+		"model": "gpt-4o", "systemPrompt": "Be terse.", "locale": "de-DE",
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	want := "Be terse.\n\nRespond in German."
+	if got.SystemPrompt != want {
+		t.Errorf("system prompt = %q, want %q", got.SystemPrompt, want)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	info, rpcErr := doRPC(t, srv, "session.info", map[string]any{"sessionId": created.SessionID})
+	if rpcErr != nil {
+		t.Fatalf("session.info: %v", rpcErr)
+	}
+	var decoded struct {
+		Locale string `json:"locale"`
+	}
+	if err := json.Unmarshal(info, &decoded); err != nil {
+		t.Fatalf("decoding info result: %v", err)
+	}
+	if decoded.Locale != "de-DE" {
+		t.Errorf("info locale = %q, want de-DE", decoded.Locale)
+	}
+}
+
+func TestLocaleUnknownTagNamesItself(t *testing.T) {
+	var got copilot.SessionConfig
+	fake := newFakeClient()
+	fake.create = func(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+		got = cfg
+		return "sdk-locale", nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{
+		"model": "gpt-4o", "locale": "tlh-Latn",
+	}); rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	if !strings.Contains(got.SystemPrompt, "locale tlh-Latn") {
+		t.Errorf("system prompt = %q, want the tag named", got.SystemPrompt)
+	}
+}
+
+func TestLocaleValidation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	for _, tag := range []string{"x", "de_DE", "de-", "respond in pirate", "de-DE!"} {
+		_, rpcErr := doRPC(t, srv, "session.create", map[string]any{
+			"model": "gpt-4o", "locale": tag,
+		})
+		if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("locale %q: got %v, want code %d", tag, rpcErr, codeInvalidParams)
+		}
+	}
+}
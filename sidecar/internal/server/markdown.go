@@ -0,0 +1,95 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Rendered markdown: session.send with renderMarkdown emits one final
+// {"type":"rendered","blocks":[...]} frame after the text stream, carrying
+// the assembled reply parsed into block-level structure. The IDE keeps the
+// raw text frames for copy and editing; the blocks spare it a markdown
+// parser of its own. Parsing is goldmark's (CommonMark); only block
+// structure is extracted — inline markup inside a block rides along as
+// written, for the IDE's inline renderer.
+
+// markdownBlock is one block of a "rendered" frame.
+type markdownBlock struct {
+	// Type is "heading", "paragraph", "code" or "list".
+	Type string `json:"type"`
+	// Level is the heading level, 1-6, on heading blocks.
+	Level int `json:"level,omitempty"`
+	// Text carries heading and paragraph content, inline markup intact.
+	Text string `json:"text,omitempty"`
+	// Language and Code describe a code block; Language is the fence's info
+	// string ("" for indented or bare fences).
+	Language string `json:"language,omitempty"`
+	Code     string `json:"code,omitempty"`
+	// Ordered and Items describe a list; each item's blocks are flattened
+	// to text, newline-joined.
+	Ordered bool     `json:"ordered,omitempty"`
+	Items   []string `json:"items,omitempty"`
+}
+
+// renderMarkdownBlocks parses markdown source into its top-level blocks.
+func renderMarkdownBlocks(source string) []markdownBlock {
+	src := []byte(source)
+	doc := goldmark.New().Parser().Parse(text.NewReader(src))
+	var blocks []markdownBlock
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		switch b := n.(type) {
+		case *ast.Heading:
+			blocks = append(blocks, markdownBlock{Type: "heading", Level: b.Level, Text: nodeLines(b, src)})
+		case *ast.FencedCodeBlock:
+			blocks = append(blocks, markdownBlock{Type: "code",
+				Language: string(b.Language(src)), Code: nodeLines(b, src)})
+		case *ast.CodeBlock:
+			blocks = append(blocks, markdownBlock{Type: "code", Code: nodeLines(b, src)})
+		case *ast.List:
+			list := markdownBlock{Type: "list", Ordered: b.IsOrdered()}
+			for item := b.FirstChild(); item != nil; item = item.NextSibling() {
+				list.Items = append(list.Items, deepLines(item, src))
+			}
+			blocks = append(blocks, list)
+		default:
+			// Paragraphs, and any block kind without a mapping of its own
+			// (blockquotes, tables, raw HTML), carry their source text so
+			// nothing the model wrote disappears from the structure.
+			if txt := deepLines(n, src); txt != "" {
+				blocks = append(blocks, markdownBlock{Type: "paragraph", Text: txt})
+			}
+		}
+	}
+	return blocks
+}
+
+// nodeLines returns a block node's own source lines, newline-joined with
+// the trailing newline trimmed.
+func nodeLines(n ast.Node, src []byte) string {
+	var sb strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		sb.Write(seg.Value(src))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// deepLines collects the source lines of a node and all its descendants,
+// for container blocks (list items, blockquotes) whose text lives on inner
+// nodes.
+func deepLines(n ast.Node, src []byte) string {
+	if n.Lines().Len() > 0 {
+		return nodeLines(n, src)
+	}
+	var parts []string
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if txt := deepLines(c, src); txt != "" {
+			parts = append(parts, txt)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestRenderMarkdownBlocksMixedContent(t *testing.T) {
+	source := "# Title\n\nSome *inline* prose.\n\n```go\nfmt.Println(\"hi\")\n```\n\n" +
+		"- first\n- second\n\n1. one\n2. two\n"
+	got := renderMarkdownBlocks(source)
+	want := []markdownBlock{
+		{Type: "heading", Level: 1, Text: "Title"},
+		{Type: "paragraph", Text: "Some *inline* prose."},
+		{Type: "code", Language: "go", Code: "fmt.Println(\"hi\")"},
+		{Type: "list", Items: []string{"first", "second"}},
+		{Type: "list", Ordered: true, Items: []string{"one", "two"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %+v, want %+v", got, want)
+	}
+}
+
+func TestRenderMarkdownBlocksUnmappedKinds(t *testing.T) {
+	got := renderMarkdownBlocks("> quoted advice\n\n    indented code\n")
+	want := []markdownBlock{
+		{Type: "paragraph", Text: "quoted advice"},
+		{Type: "code", Code: "indented code"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %+v, want %+v", got, want)
+	}
+}
+
+func TestRenderedFrameOptIn(t *testing.T) {
+	reply := "## Plan\n\nDo the thing.\n\n```sh\nmake test\n```\n"
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: reply})
+		return &copilot.MessageResponse{Content: reply}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+
+	for _, opted := range []bool{false, true} {
+		id := createSessionID(t, srv)
+		sess := srv.Manager().Get(id)
+		if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": id, "prompt": "plan it", "renderMarkdown": opted,
+		}); rpcErr != nil {
+			t.Fatalf("session.send (opted=%v): %v", opted, rpcErr)
+		}
+		var rendered *struct {
+			Blocks []markdownBlock `json:"blocks"`
+		}
+		for _, f := range drainFrames(t, sess, 5*time.Second) {
+			if f["type"] != "rendered" {
+				continue
+			}
+			raw, _ := json.Marshal(f)
+			rendered = &struct {
+				Blocks []markdownBlock `json:"blocks"`
+			}{}
+			if err := json.Unmarshal(raw, rendered); err != nil {
+				t.Fatalf("decoding rendered frame: %v", err)
+			}
+		}
+		if !opted {
+			if rendered != nil {
+				t.Errorf("rendered frame emitted without renderMarkdown")
+			}
+			continue
+		}
+		if rendered == nil {
+			t.Fatal("no rendered frame on an opted-in turn")
+		}
+		want := []markdownBlock{
+			{Type: "heading", Level: 2, Text: "Plan"},
+			{Type: "paragraph", Text: "Do the thing."},
+			{Type: "code", Language: "sh", Code: "make test"},
+		}
+		if !reflect.DeepEqual(rendered.Blocks, want) {
+			t.Errorf("blocks = %+v, want %+v", rendered.Blocks, want)
+		}
+	}
+}
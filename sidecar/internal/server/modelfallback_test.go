@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// unavailableModelClient fails CreateSession for any model outside its
+// model list, the way the CLI does for models the account cannot access.
+func unavailableModelClient() *fakeClient {
+	fake := newFakeClient()
+	fake.create = func(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+		for _, m := range fake.models {
+			if m.ID == cfg.Model {
+				return "sdk-ok", nil
+			}
+		}
+		return "", errors.New("model access denied")
+	}
+	return fake
+}
+
+func TestCreateRejectsUnavailableModelWithAlternatives(t *testing.T) {
+	srv, _ := newFakeServer(t, unavailableModelClient(), nil)
+	_, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-imaginary"})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	if !strings.Contains(rpcErr.Message, "model not found") {
+		t.Errorf("message = %q, want it based on ErrModelNotFound", rpcErr.Message)
+	}
+	data, ok := rpcErr.Data.(map[string]any)
+	if !ok {
+		t.Fatalf("error data = %v, want a map with availableModels", rpcErr.Data)
+	}
+	avail, _ := data["availableModels"].([]any)
+	if len(avail) != 1 || avail[0] != "gpt-4o" {
+		t.Errorf("availableModels = %v, want [gpt-4o]", avail)
+	}
+}
+
+func TestCreateFallsBackToAvailableModel(t *testing.T) {
+	srv, _ := newFakeServer(t, unavailableModelClient(), func(cfg *Config) {
+		cfg.AllowModelFallback = true
+	})
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-imaginary"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+		Model     string `json:"model"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if created.Model != "gpt-4o" {
+		t.Errorf("session model = %q, want the fallback gpt-4o", created.Model)
+	}
+	frames, _ := srv.Manager().Get(created.SessionID).EventsSince(0)
+	for _, raw := range frames {
+		var f map[string]any
+		if err := json.Unmarshal(raw, &f); err != nil {
+			t.Fatalf("invalid frame %q: %v", raw, err)
+		}
+		if f["type"] != "model_fallback" {
+			continue
+		}
+		if f["requested"] != "gpt-imaginary" || f["using"] != "gpt-4o" {
+			t.Errorf("model_fallback frame = %v", f)
+		}
+		return
+	}
+	t.Fatal("no model_fallback frame published at create")
+}
+
+func TestCreateSDKFaultIsNotMisreportedAsModelNotFound(t *testing.T) {
+	fake := newFakeClient()
+	fake.create = func(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+		return "", errors.New("CLI crashed")
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) { cfg.AllowModelFallback = true })
+	// gpt-4o IS in the model list, so the failure is an SDK fault and no
+	// fallback applies.
+	_, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	if rpcErr == nil || rpcErr.Code != codeInternalError {
+		t.Fatalf("got %v, want code %d", rpcErr, codeInternalError)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Model routing: --route-model maps prompt patterns to models, so an org
+// with several entitlements can steer "review this diff" prompts to one
+// model and conversational prompts to another without teaching every client
+// the policy. The policy only applies when a send opts in with autoRoute —
+// the model the session was explicitly created with wins otherwise — and a
+// routed turn runs on an ephemeral SDK session, like a retry with a model
+// override.
+
+// modelRoute is one compiled policy rule: prompts matching re route to model.
+type modelRoute struct {
+	re *regexp.Regexp
+	// pattern is the spec's original pattern text, for the model_routed
+	// frame's reason (re.String carries the case-folding prefix).
+	pattern string
+	model   string
+}
+
+// modelRouter evaluates the routing policy. First matching rule wins.
+type modelRouter struct {
+	routes []modelRoute
+}
+
+// newModelRouter compiles "pattern=model" route specs, or returns nil when
+// there are none. The spec splits on its last "=" so patterns may contain
+// the character; patterns match case-insensitively, since routing on prompt
+// wording should not hinge on capitalization.
+func newModelRouter(specs []string) (*modelRouter, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	r := &modelRouter{routes: make([]modelRoute, 0, len(specs))}
+	for _, spec := range specs {
+		eq := strings.LastIndex(spec, "=")
+		if eq <= 0 || eq == len(spec)-1 {
+			return nil, fmt.Errorf("route %q is not in pattern=model form", spec)
+		}
+		pattern, model := spec[:eq], spec[eq+1:]
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling route pattern %q: %w", pattern, err)
+		}
+		r.routes = append(r.routes, modelRoute{re: re, pattern: pattern, model: model})
+	}
+	return r, nil
+}
+
+// route returns the model the first matching rule names, along with the
+// rule's pattern for the model_routed frame's reason. ok is false when no
+// rule matches and the session's own model should be used.
+func (r *modelRouter) route(prompt string) (model, pattern string, ok bool) {
+	for _, rt := range r.routes {
+		if rt.re.MatchString(prompt) {
+			return rt.model, rt.pattern, true
+		}
+	}
+	return "", "", false
+}
+
+// routeModel evaluates the routing policy for an autoRoute send and returns
+// the model to run the turn on ("" to stay on the session's own model) plus
+// the reason for the model_routed frame. Routed models are validated against
+// the live model list, so a policy typo fails the send loudly instead of
+// failing every routed turn deep in the producer.
+func (s *Server) routeModel(ctx context.Context, prompt, sessionModel string) (model, reason string, rpcErr *rpcError) {
+	if s.router == nil {
+		return "", "", errInvalidParams("autoRoute needs a routing policy (--route-model)")
+	}
+	target, pattern, ok := s.router.route(prompt)
+	if !ok || target == sessionModel {
+		return "", "", nil
+	}
+	if !s.cfg.Mock {
+		models, rpcErr := s.listModels(ctx)
+		if rpcErr != nil {
+			return "", "", rpcErr
+		}
+		known := false
+		for _, m := range models {
+			if m.ID == target {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return "", "", errInvalidParams("route target model %q does not exist", target)
+		}
+	}
+	return target, fmt.Sprintf("prompt matched route pattern %q", pattern), nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestModelRouterMatchingAndFallthrough(t *testing.T) {
+	r, err := newModelRouter([]string{`review|diff=gpt-review`, `\bdocs?\b=gpt-doc`})
+	if err != nil {
+		t.Fatalf("newModelRouter: %v", err)
+	}
+	if model, pattern, ok := r.route("Please REVIEW this change"); !ok || model != "gpt-review" {
+		t.Errorf("route(review prompt) = (%q, %q, %v), want gpt-review (case-insensitive)", model, pattern, ok)
+	}
+	if model, _, ok := r.route("update the docs for the flag"); !ok || model != "gpt-doc" {
+		t.Errorf("route(docs prompt) = (%q, %v), want gpt-doc", model, ok)
+	}
+	if _, _, ok := r.route("hello there"); ok {
+		t.Error("unmatched prompt routed; want fallthrough to the session model")
+	}
+
+	for _, spec := range []string{"noequals", "=model", "pattern=", "(=m"} {
+		if _, err := newModelRouter([]string{spec}); err == nil {
+			t.Errorf("spec %q accepted, want an error", spec)
+		}
+	}
+}
+
+func TestAutoRouteRunsMatchedPromptOnRoutedModel(t *testing.T) {
+	var gotModels []string
+	fake := newFakeClient()
+	fake.models = []copilot.Model{{ID: "gpt-4o", Default: true}, {ID: "gpt-review"}}
+	fake.create = func(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+		gotModels = append(gotModels, cfg.Model)
+		return "sdk-" + cfg.Model, nil
+	}
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "routed reply from " + sessionID})
+		return &copilot.MessageResponse{Content: "routed reply", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.ModelRoutes = []string{"review=gpt-review"}
+	})
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "please review this diff", "autoRoute": true,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var routedTo, reason, text string
+	for _, f := range drainFrames(t, sess, 5*time.Second) {
+		switch f["type"] {
+		case "model_routed":
+			routedTo, _ = f["using"].(string)
+			reason, _ = f["reason"].(string)
+		case "text":
+			content, _ := f["content"].(string)
+			text += content
+		}
+	}
+	if routedTo != "gpt-review" {
+		t.Errorf("model_routed using = %q, want gpt-review", routedTo)
+	}
+	if !strings.Contains(reason, "review") {
+		t.Errorf("model_routed reason = %q, want it to name the matched pattern", reason)
+	}
+	// The routed turn runs on an ephemeral SDK session created for the
+	// routed model, then destroys it.
+	if !strings.Contains(text, "sdk-gpt-review") {
+		t.Errorf("turn text = %q, want it produced on the routed model's session", text)
+	}
+	if len(gotModels) != 2 || gotModels[1] != "gpt-review" {
+		t.Errorf("CreateSession models = %v, want the routed model's ephemeral session", gotModels)
+	}
+	if fake.destroyCalls.Load() == 0 {
+		t.Error("ephemeral routed session was never destroyed")
+	}
+}
+
+func TestAutoRouteFallsThroughToSessionModel(t *testing.T) {
+	fake := newFakeClient()
+	fake.models = []copilot.Model{{ID: "gpt-4o", Default: true}, {ID: "gpt-review"}}
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "plain reply"})
+		return &copilot.MessageResponse{Content: "plain reply", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.ModelRoutes = []string{"review=gpt-review"}
+	})
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "hello there", "autoRoute": true,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	for _, f := range drainFrames(t, sess, 5*time.Second) {
+		if f["type"] == "model_routed" {
+			t.Errorf("unmatched prompt emitted model_routed: %v", f)
+		}
+	}
+	if got := fake.createCalls.Load(); got != 1 {
+		t.Errorf("CreateSession called %d times, want only the session's own", got)
+	}
+}
+
+func TestAutoRouteValidation(t *testing.T) {
+	// No policy configured: autoRoute is an error, not a silent no-op.
+	fake := newFakeClient()
+	srv, _ := newFakeServer(t, fake, nil)
+	id := createSessionID(t, srv)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "review this", "autoRoute": true,
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("autoRoute without a policy: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+
+	// A route naming a model the account does not have fails the send.
+	fake2 := newFakeClient()
+	srv2, _ := newFakeServer(t, fake2, func(cfg *Config) {
+		cfg.ModelRoutes = []string{"review=ghost-model"}
+	})
+	id2 := createSessionID(t, srv2)
+	if _, rpcErr := doRPC(t, srv2, "session.send", map[string]any{
+		"sessionId": id2, "prompt": "review this", "autoRoute": true,
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("route to unknown model: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// Create outbox: when a session.create completes server-side but the
+// response is lost in transit, the client retries with the same
+// idempotencyKey. The manager's idempotency map already makes the retry
+// land on the same bridge session, but only after the handler has created
+// a second SDK session and then thrown it away — and if that best-effort
+// destroy fails, the SDK session leaks. The outbox closes that window:
+// every keyed create records its result before returning, and a retry
+// consults the outbox first, so it never touches the SDK at all.
+
+// createOutboxTTL is how long a keyed create's result stays replayable
+// from the outbox. A retry after that falls through to the manager's
+// idempotency map, which keeps the key for the session's lifetime.
+const createOutboxTTL = 5 * time.Minute
+
+// outboxEntry is one completed keyed create awaiting a possible retry.
+type outboxEntry struct {
+	sessionID string
+	model     string
+	expires   time.Time
+}
+
+// createOutbox maps idempotency keys to recently completed creates.
+// Expired entries are purged lazily on every operation, like the
+// dedupe-send table and the file store.
+type createOutbox struct {
+	mu      sync.Mutex
+	entries map[string]outboxEntry
+}
+
+func newCreateOutbox() *createOutbox {
+	return &createOutbox{entries: make(map[string]outboxEntry)}
+}
+
+// purgeLocked drops entries past their TTL.
+func (o *createOutbox) purgeLocked(now time.Time) {
+	for key, e := range o.entries {
+		if now.After(e.expires) {
+			delete(o.entries, key)
+		}
+	}
+}
+
+// record stores the result of a completed keyed create.
+func (o *createOutbox) record(key, sessionID, model string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	o.purgeLocked(now)
+	o.entries[key] = outboxEntry{sessionID: sessionID, model: model, expires: now.Add(createOutboxTTL)}
+}
+
+// lookup returns the recorded result for key, if it is still live.
+func (o *createOutbox) lookup(key string) (sessionID, model string, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.purgeLocked(time.Now())
+	e, ok := o.entries[key]
+	return e.sessionID, e.model, ok
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCreateRetryReplaysFromOutboxWithoutSDKCall(t *testing.T) {
+	fake := newFakeClient()
+	srv, _ := newFakeServer(t, fake, nil)
+
+	// First create succeeds server-side; pretend the response was lost.
+	res, rpcErr := doRPC(t, srv, "session.create", map[string]any{"idempotencyKey": "key-1"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var first struct {
+		SessionID string `json:"sessionId"`
+		Model     string `json:"model"`
+	}
+	if err := json.Unmarshal(res, &first); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got := fake.createCalls.Load(); got != 1 {
+		t.Fatalf("SDK creates after first call = %d, want 1", got)
+	}
+
+	// The retry must land on the same session without a second SDK create —
+	// and therefore without a destroy of a redundant one.
+	res, rpcErr = doRPC(t, srv, "session.create", map[string]any{"idempotencyKey": "key-1"})
+	if rpcErr != nil {
+		t.Fatalf("retried session.create: %v", rpcErr)
+	}
+	var second struct {
+		SessionID string `json:"sessionId"`
+		Model     string `json:"model"`
+	}
+	if err := json.Unmarshal(res, &second); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if second.SessionID != first.SessionID || second.Model != first.Model {
+		t.Errorf("retry returned %+v, want the original %+v", second, first)
+	}
+	if got := fake.createCalls.Load(); got != 1 {
+		t.Errorf("SDK creates after retry = %d, want still 1", got)
+	}
+	if got := fake.destroyCalls.Load(); got != 0 {
+		t.Errorf("SDK destroys after retry = %d, want 0", got)
+	}
+}
+
+func TestCreateRetryAfterOutboxExpiryFallsBackToManager(t *testing.T) {
+	fake := newFakeClient()
+	srv, _ := newFakeServer(t, fake, nil)
+	res, rpcErr := doRPC(t, srv, "session.create", map[string]any{"idempotencyKey": "key-2"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var first struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(res, &first); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	// Age the outbox entry past its TTL; the manager's idempotency map
+	// still covers the key, at the cost of one redundant SDK round trip.
+	srv.outbox.mu.Lock()
+	e := srv.outbox.entries["key-2"]
+	e.expires = time.Now().Add(-time.Minute)
+	srv.outbox.entries["key-2"] = e
+	srv.outbox.mu.Unlock()
+
+	res, rpcErr = doRPC(t, srv, "session.create", map[string]any{"idempotencyKey": "key-2"})
+	if rpcErr != nil {
+		t.Fatalf("retried session.create: %v", rpcErr)
+	}
+	var second struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(res, &second); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if second.SessionID != first.SessionID {
+		t.Errorf("retry returned session %q, want the original %q", second.SessionID, first.SessionID)
+	}
+	if got := fake.createCalls.Load(); got != 2 {
+		t.Errorf("SDK creates = %d, want 2 (the expired-outbox path creates then discards)", got)
+	}
+	if got := fake.destroyCalls.Load(); got != 1 {
+		t.Errorf("SDK destroys = %d, want 1 for the redundant session", got)
+	}
+}
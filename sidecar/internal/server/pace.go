@@ -0,0 +1,125 @@
+package server
+
+import (
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// turnPublisher is the per-turn pipeline stage between the SDK event bridge
+// and publish: a coalescer (batch bursty tokens into fewer frames), a pacer
+// (smooth bursty tokens into a steady drip), or a pass-through. Producers
+// must call flush before their terminal frames so no buffered text outlives
+// the turn.
+type turnPublisher interface {
+	publish(Frame)
+	flush()
+}
+
+// newTurnPublisher picks the pipeline stage for one of sess's turns. Pacing
+// and coalescing pull in opposite directions — fewer bigger frames versus a
+// steady stream of small ones — so a session with pacing enabled paces and
+// its coalescing setting is ignored.
+func (s *Server) newTurnPublisher(sess *session.Session) turnPublisher {
+	if cps := sess.PaceCPS(); cps > 0 {
+		return newPacer(s, sess, cps)
+	}
+	return s.newCoalescer(sess)
+}
+
+// paceTick is the drip interval for paced delivery: long enough that each
+// release is worth an SSE frame, short enough to read as steady.
+const paceTick = 50 * time.Millisecond
+
+// pacer releases buffered text at a fixed character rate so bursty SDK
+// output renders as a steady stream. Only text frames are paced; any other
+// frame drains the buffer first and passes straight through, so frame order
+// is preserved and terminal frames (done in particular) are never delayed
+// behind the drip.
+//
+// One pacer serves one turn producer; it is not shared across turns.
+type pacer struct {
+	s    *Server
+	sess *session.Session
+	cps  int
+
+	mu      sync.Mutex
+	pending []byte
+	timer   *time.Timer
+}
+
+func newPacer(s *Server, sess *session.Session, cps int) *pacer {
+	return &pacer{s: s, sess: sess, cps: cps}
+}
+
+// publish buffers text for paced release; everything else flushes the buffer
+// and goes out immediately.
+func (p *pacer) publish(f Frame) {
+	if f.Type != "text" {
+		p.flush()
+		p.s.publish(p.sess, f)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, f.Content...)
+	if p.timer == nil {
+		p.timer = time.AfterFunc(paceTick, p.drip)
+	}
+}
+
+// drip releases one tick's worth of characters and re-arms until the buffer
+// is empty.
+func (p *pacer) drip() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer == nil || len(p.pending) == 0 {
+		// flush ran between the tick firing and the lock; nothing to do.
+		return
+	}
+	n := int(float64(p.cps) * paceTick.Seconds())
+	if n < 1 {
+		n = 1
+	}
+	if n >= len(p.pending) {
+		p.releaseLocked(len(p.pending))
+		p.timer = nil
+		return
+	}
+	// The buffer holds whole characters (the UTF-8 assembler runs upstream);
+	// back the cut onto a rune boundary so the drip never splits one.
+	for n > 0 && !utf8.RuneStart(p.pending[n]) {
+		n--
+	}
+	if n == 0 {
+		n = len(p.pending)
+	}
+	p.releaseLocked(n)
+	if len(p.pending) > 0 {
+		p.timer.Reset(paceTick)
+	} else {
+		p.timer = nil
+	}
+}
+
+// flush drains everything buffered immediately, abandoning the cadence.
+// Producers call it before terminal frames so done never waits on the drip.
+func (p *pacer) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.releaseLocked(len(p.pending))
+}
+
+func (p *pacer) releaseLocked(n int) {
+	if n == 0 {
+		return
+	}
+	p.s.publish(p.sess, Frame{Type: "text", Content: string(p.pending[:n])})
+	p.pending = p.pending[n:]
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestPacerSmoothsBurstyText(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		// One burst, as a chatty SDK would deliver after a stall.
+		onEvent(copilot.StreamEvent{Type: "text", Content: strings.Repeat("x", 100)})
+		// Give the drip a few ticks before the turn ends and flushes.
+		time.Sleep(200 * time.Millisecond)
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: strings.Repeat("x", 100)}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	sess.SetPaceCPS(200) // 10 chars per 50ms tick
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	var texts []string
+	total := 0
+	for _, f := range frames {
+		if f["type"] == "text" {
+			texts = append(texts, f["content"].(string))
+			total += len(f["content"].(string))
+		}
+	}
+	if total != 100 {
+		t.Fatalf("paced frames carry %d chars, want 100: %q", total, texts)
+	}
+	if len(texts) < 3 {
+		t.Errorf("burst arrived in %d frame(s), want it dripped across several: %q", len(texts), texts)
+	}
+}
+
+func TestPacerFlushesBeforeDone(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: strings.Repeat("y", 5000)})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	// At 20 cps the buffer would take minutes to drip; done must not wait.
+	sess.SetPaceCPS(20)
+	start := time.Now()
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("turn took %v; the flush before done must abandon the cadence", elapsed)
+	}
+	total := 0
+	sawDone := false
+	for _, f := range frames {
+		if f["type"] == "text" {
+			total += len(f["content"].(string))
+		}
+		if f["type"] == "done" {
+			sawDone = true
+		}
+	}
+	if !sawDone || total != 5000 {
+		t.Errorf("done = %v, chars = %d; buffered text must be fully flushed before done", sawDone, total)
+	}
+}
+
+func TestSessionCreatePaceParam(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.PaceCharsPerSecond = 120 })
+
+	// Inheriting the server default.
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if got := srv.Manager().Get(created.SessionID).PaceCPS(); got != 120 {
+		t.Errorf("PaceCPS = %d, want the server default 120", got)
+	}
+
+	// An explicit zero opts out.
+	result, rpcErr = doRPC(t, srv, "session.create", map[string]any{"paceCharsPerSecond": 0})
+	if rpcErr != nil {
+		t.Fatalf("session.create opting out: %v", rpcErr)
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if got := srv.Manager().Get(created.SessionID).PaceCPS(); got != 0 {
+		t.Errorf("PaceCPS = %d after opting out, want 0", got)
+	}
+
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"paceCharsPerSecond": -5}); rpcErr == nil {
+		t.Error("negative rate accepted")
+	}
+}
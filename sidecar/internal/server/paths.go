@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pathArgKeys are the tool argument keys the allowlist inspects. Tool schemas
+// in the SDK use these names for filesystem locations; values under other
+// keys are treated as opaque.
+var pathArgKeys = []string{"path", "file", "filePath", "dir", "directory", "cwd"}
+
+// pathListArgKeys are the keys whose values are arrays of paths.
+var pathListArgKeys = []string{"paths", "files"}
+
+// pathAllowlist is a set of resolved absolute roots that tool file
+// operations are confined to. An empty allowlist permits everything.
+type pathAllowlist []string
+
+// newPathAllowlist resolves each configured root to an absolute,
+// symlink-free path so later containment checks compare like with like.
+func newPathAllowlist(roots []string) (pathAllowlist, error) {
+	out := make(pathAllowlist, 0, len(roots))
+	for _, root := range roots {
+		resolved, err := resolvePath(root)
+		if err != nil {
+			return nil, fmt.Errorf("allowed path %q: %w", root, err)
+		}
+		out = append(out, resolved)
+	}
+	return out, nil
+}
+
+// resolvePath makes a path absolute and resolves symlinks. The target may
+// not exist yet (a tool may be about to create it); in that case the deepest
+// existing ancestor is resolved and the remaining components are appended
+// cleaned, so a `../` or symlink earlier in the path still cannot escape.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Clean(abs)
+	var pending []string
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, pending...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			// Walked all the way up without finding anything on disk.
+			return filepath.Join(append([]string{p}, pending...)...), nil
+		}
+		pending = append([]string{filepath.Base(p)}, pending...)
+		p = parent
+	}
+}
+
+// allows reports whether path (after normalization and symlink resolution)
+// is inside one of the allowed roots.
+func (a pathAllowlist) allows(path string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		// If the path cannot be resolved we cannot prove containment.
+		return false
+	}
+	for _, root := range a {
+		if resolved == root || strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkToolArgs scans a tool call's arguments for filesystem paths and
+// returns the first one outside the allowlist, if any.
+func (a pathAllowlist) checkToolArgs(args map[string]any) (string, bool) {
+	if len(a) == 0 {
+		return "", true
+	}
+	for _, key := range pathArgKeys {
+		if v, ok := args[key].(string); ok && v != "" && !a.allows(v) {
+			return v, false
+		}
+	}
+	for _, key := range pathListArgKeys {
+		list, ok := args[key].([]any)
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			if v, ok := item.(string); ok && v != "" && !a.allows(v) {
+				return v, false
+			}
+		}
+	}
+	return "", true
+}
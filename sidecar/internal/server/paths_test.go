@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestPathAllowlist(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A symlink inside the root pointing outside it must not grant access.
+	escape := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, escape); err != nil {
+		t.Fatal(err)
+	}
+	allow, err := newPathAllowlist([]string{root})
+	if err != nil {
+		t.Fatalf("newPathAllowlist: %v", err)
+	}
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(root, "a.go"), true},
+		{filepath.Join(root, "sub", "not-yet-created.go"), true},
+		{filepath.Join(root, "sub", "..", "a.go"), true},
+		{filepath.Join(outside, "secret"), false},
+		{filepath.Join(root, "..", "elsewhere"), false},
+		{filepath.Join(root, "sub", "..", "..", "elsewhere"), false},
+		{filepath.Join(escape, "secret"), false},
+		{filepath.Join(escape, "not-yet-created"), false},
+	}
+	for _, tc := range cases {
+		if got := allow.allows(tc.path); got != tc.want {
+			t.Errorf("allows(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestBlockedToolCallNeverReachesCallback(t *testing.T) {
+	root := t.TempDir()
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-1", ToolName: "file_read", ToolArgs: map[string]any{
+			"path": filepath.Join(root, "..", "outside.txt"),
+		}})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "done"}, nil
+	}
+	srv, rec := newFakeServer(t, fake, func(cfg *Config) { cfg.AllowedPaths = []string{root} })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "read outside",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	select {
+	case result := <-fake.toolResults:
+		if result.Success || result.Error == "" {
+			t.Errorf("blocked tool result = %+v, want an error result", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("SDK never received a tool result for the blocked call")
+	}
+	frames := drainFrames(t, sess, 2*time.Second)
+	found := false
+	for _, f := range frames {
+		if f["type"] == "tool_blocked" && f["name"] == "file_read" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no tool_blocked frame in %v", frames)
+	}
+	select {
+	case req := <-rec.requests:
+		t.Errorf("blocked call was forwarded to the callback: %+v", req)
+	default:
+	}
+}
+
+func TestAllowedToolCallForwarded(t *testing.T) {
+	root := t.TempDir()
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-1", ToolName: "file_read", ToolArgs: map[string]any{
+			"path": filepath.Join(root, "inside.txt"),
+		}})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "done"}, nil
+	}
+	srv, rec := newFakeServer(t, fake, func(cfg *Config) { cfg.AllowedPaths = []string{root} })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "read inside",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	select {
+	case <-rec.requests:
+	case <-time.After(2 * time.Second):
+		t.Fatal("allowed call never reached the callback")
+	}
+}
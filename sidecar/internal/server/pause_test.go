@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestStreamPauseResume(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "stream.pause", map[string]any{"sessionId": sess.ID}); rpcErr != nil {
+		t.Fatalf("stream.pause: %v", rpcErr)
+	}
+	for i := 0; i < 3; i++ {
+		srv.publish(sess, Frame{Type: "text", Content: fmt.Sprintf("chunk %d", i)})
+	}
+	select {
+	case raw := <-sess.EventChan:
+		t.Fatalf("event %q delivered while paused", raw)
+	default:
+	}
+
+	result, rpcErr := doRPC(t, srv, "stream.resume", map[string]any{"sessionId": sess.ID})
+	if rpcErr != nil {
+		t.Fatalf("stream.resume: %v", rpcErr)
+	}
+	var out struct {
+		Flushed int `json:"flushed"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if out.Flushed != 3 {
+		t.Errorf("flushed = %d, want 3", out.Flushed)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case raw := <-sess.EventChan:
+			var f Frame
+			if err := json.Unmarshal(raw, &f); err != nil {
+				t.Fatalf("invalid frame %q: %v", raw, err)
+			}
+			if want := fmt.Sprintf("chunk %d", i); f.Content != want {
+				t.Errorf("flushed frame %d = %q, want %q", i, f.Content, want)
+			}
+		default:
+			t.Fatalf("only %d of 3 buffered events flushed", i)
+		}
+	}
+}
+
+func TestStreamPauseClosedSession(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	srv.Manager().Remove(sess.ID)
+	if _, rpcErr := doRPC(t, srv, "stream.pause", map[string]any{"sessionId": sess.ID}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("pause on removed session: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
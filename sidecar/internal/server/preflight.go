@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// system.preflight is the one-call diagnostic the plugin runs before opening
+// the chat UI: is the SDK up, is the CLI authenticated with at least one
+// model to offer, and can the sidecar reach the plugin's callback endpoint.
+// The checks run in parallel, each under its own timeout, so one hung
+// dependency delays the report instead of hiding the others' results.
+
+// preflightCheckTimeout bounds each individual preflight check.
+const preflightCheckTimeout = 10 * time.Second
+
+// preflightCheck is one entry in the system.preflight report.
+type preflightCheck struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+func (s *Server) rpcSystemPreflight(ctx context.Context) (any, *rpcError) {
+	type probe struct {
+		name string
+		run  func(context.Context) (string, error)
+	}
+	probes := []probe{
+		{"sdk", s.preflightSDK},
+		{"models", s.preflightModels},
+	}
+	if s.callback != nil && s.callback.URL() != "" {
+		probes = append(probes, probe{"callback", s.preflightCallback})
+	}
+	checks := make([]preflightCheck, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		i, p := i, p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, preflightCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			detail, err := p.run(cctx)
+			if err != nil {
+				detail = err.Error()
+			}
+			checks[i] = preflightCheck{Name: p.name, OK: err == nil, Detail: detail,
+				DurationMs: time.Since(start).Milliseconds()}
+		}()
+	}
+	wg.Wait()
+	ok := true
+	for _, c := range checks {
+		ok = ok && c.OK
+	}
+	return map[string]any{"ok": ok, "checks": checks}, nil
+}
+
+// preflightSDK confirms the SDK process is running, starting it if this is
+// the first request to need it.
+func (s *Server) preflightSDK(ctx context.Context) (string, error) {
+	if s.cfg.Mock {
+		return "mock mode; no SDK to start", nil
+	}
+	if err := s.client.Start(ctx); err != nil {
+		return "", fmt.Errorf("starting the SDK: %w", err)
+	}
+	return "SDK running", nil
+}
+
+// preflightModels confirms the authenticated user can see at least one
+// model. A successful listing doubles as the authentication check: the CLI
+// refuses it when not signed in.
+func (s *Server) preflightModels(ctx context.Context) (string, error) {
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return "", errors.New(rpcErr.Message)
+	}
+	if len(models) == 0 {
+		return "", errors.New("authenticated, but no models are available")
+	}
+	return fmt.Sprintf("%d models available", len(models)), nil
+}
+
+// preflightCallback confirms the plugin's callback endpoint answers at all.
+// Any HTTP response counts — the endpoint only has to exist, not accept a
+// bodiless GET — so only transport failures fail the check.
+func (s *Server) preflightCallback(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.callback.URL(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("callback unreachable: %w", err)
+	}
+	resp.Body.Close()
+	return fmt.Sprintf("callback answered with HTTP %d", resp.StatusCode), nil
+}
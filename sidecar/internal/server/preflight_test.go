@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/callback"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// preflightReport runs system.preflight and decodes the report.
+func preflightReport(t *testing.T, srv *Server) (bool, map[string]preflightCheck) {
+	t.Helper()
+	result, rpcErr := doRPC(t, srv, "system.preflight", map[string]any{})
+	if rpcErr != nil {
+		t.Fatalf("system.preflight: %v", rpcErr)
+	}
+	var out struct {
+		OK     bool             `json:"ok"`
+		Checks []preflightCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		t.Fatalf("decoding report: %v", err)
+	}
+	byName := make(map[string]preflightCheck, len(out.Checks))
+	for _, c := range out.Checks {
+		byName[c.Name] = c
+	}
+	return out.OK, byName
+}
+
+func TestPreflightAllChecksPass(t *testing.T) {
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	ok, checks := preflightReport(t, srv)
+	if !ok {
+		t.Errorf("overall ok = false with a healthy pipeline: %v", checks)
+	}
+	for _, name := range []string{"sdk", "models", "callback"} {
+		c, present := checks[name]
+		if !present {
+			t.Errorf("report missing the %s check", name)
+		} else if !c.OK {
+			t.Errorf("%s check failed: %s", name, c.Detail)
+		}
+	}
+}
+
+func TestPreflightReportsSDKFailure(t *testing.T) {
+	fake := newFakeClient()
+	fake.start = func(ctx context.Context) error {
+		return errors.New("copilot CLI not found on PATH")
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	ok, checks := preflightReport(t, srv)
+	if ok {
+		t.Error("overall ok = true with the SDK down")
+	}
+	if c := checks["sdk"]; c.OK || !strings.Contains(c.Detail, "CLI not found") {
+		t.Errorf("sdk check = %+v, want a failure naming the cause", c)
+	}
+	// The other checks still report; one failure must not hide them.
+	if c := checks["models"]; !c.OK {
+		t.Errorf("models check = %+v, want a pass", c)
+	}
+}
+
+func TestPreflightReportsEmptyModelList(t *testing.T) {
+	fake := newFakeClient()
+	fake.list = func(ctx context.Context) ([]copilot.Model, error) {
+		return nil, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	ok, checks := preflightReport(t, srv)
+	if ok {
+		t.Error("overall ok = true with no models available")
+	}
+	if c := checks["models"]; c.OK || !strings.Contains(c.Detail, "no models") {
+		t.Errorf("models check = %+v, want a failure about the empty list", c)
+	}
+}
+
+func TestPreflightReportsUnreachableCallback(t *testing.T) {
+	// Grab a port nothing listens on by binding and immediately releasing it.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserving a port: %v", err)
+	}
+	dead := "http://" + l.Addr().String()
+	l.Close()
+	cb, err := callback.NewWithRoutes(dead, nil)
+	if err != nil {
+		t.Fatalf("building callback client: %v", err)
+	}
+	srv, err := New(Config{}, session.NewManager(time.Hour), newFakeClient(), cb)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+	ok, checks := preflightReport(t, srv)
+	if ok {
+		t.Error("overall ok = true with the callback unreachable")
+	}
+	if c := checks["callback"]; c.OK || !strings.Contains(c.Detail, "unreachable") {
+		t.Errorf("callback check = %+v, want an unreachable failure", c)
+	}
+}
+
+func TestPreflightSkipsCallbackWhenUnconfigured(t *testing.T) {
+	srv := newMockServer(t, nil)
+	ok, checks := preflightReport(t, srv)
+	if !ok {
+		t.Errorf("overall ok = false in mock mode: %v", checks)
+	}
+	if _, present := checks["callback"]; present {
+		t.Error("callback check reported with no callback configured")
+	}
+	if c := checks["sdk"]; !c.OK || !strings.Contains(c.Detail, "mock") {
+		t.Errorf("sdk check = %+v, want a mock-mode pass", c)
+	}
+}
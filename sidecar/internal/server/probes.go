@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Orchestration probes: /health answers whenever the process is up, which
+// conflates "alive" with "ready for traffic". /livez and /readyz split the
+// two for k8s-style orchestration — liveness stays truthful through the
+// CLI's lazy start (the process is fine), while readiness reports 503 until
+// the SDK has actually started and flips back to 503 the moment shutdown
+// begins, so load balancers stop routing while in-flight turns drain.
+// Neither requires auth: probes run before any token is provisioned.
+
+// readinessReporter is the optional probe SDK-backed clients implement so
+// /readyz can check CLI readiness without triggering a start.
+type readinessReporter interface {
+	Ready() bool
+}
+
+// BeginShutdown flips the server into the shutting-down state: /readyz and
+// /livez answer 503 from here on and attached streams get their shutdown
+// event. main calls it on SIGTERM, before closing the HTTP listener, so the
+// readiness flip is observable while requests still flow. Idempotent; Drain
+// implies it.
+func (s *Server) BeginShutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdownCh) })
+}
+
+// shuttingDown reports whether BeginShutdown (or Drain) has run.
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.shuttingDown() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, `{"status":"shutting_down"}`)
+		return
+	}
+	fmt.Fprintln(w, `{"status":"ok"}`)
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case s.shuttingDown():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, `{"status":"shutting_down"}`)
+	case !s.sdkReady():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, `{"status":"starting"}`)
+	default:
+		fmt.Fprintln(w, `{"status":"ready"}`)
+	}
+}
+
+// sdkReady reports whether the SDK underneath is ready for requests. Mock
+// servers have no SDK to wait for; clients without a readiness probe are
+// assumed ready, since the alternative is a /readyz that never passes.
+func (s *Server) sdkReady() bool {
+	if s.cfg.Mock {
+		return true
+	}
+	if c, ok := s.client.(readinessReporter); ok {
+		return c.Ready()
+	}
+	return s.client != nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// probe issues a GET against the server's handler and returns the status.
+func probe(t *testing.T, srv *Server, path string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec.Code
+}
+
+// readyClient is a fakeClient with a switchable readiness probe.
+type readyClient struct {
+	*fakeClient
+	ready atomic.Bool
+}
+
+func (c *readyClient) Ready() bool { return c.ready.Load() }
+
+func TestReadyzTracksSDKReadiness(t *testing.T) {
+	client := &readyClient{fakeClient: newFakeClient()}
+	srv, err := New(Config{}, session.NewManager(time.Hour), client, nil)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+	if got := probe(t, srv, "/readyz"); got != 503 {
+		t.Errorf("/readyz before SDK start = %d, want 503", got)
+	}
+	if got := probe(t, srv, "/livez"); got != 200 {
+		t.Errorf("/livez before SDK start = %d, want 200", got)
+	}
+	client.ready.Store(true)
+	if got := probe(t, srv, "/readyz"); got != 200 {
+		t.Errorf("/readyz with SDK ready = %d, want 200", got)
+	}
+}
+
+func TestProbesShutdownTransition(t *testing.T) {
+	srv := newMockServer(t, nil)
+	for _, path := range []string{"/livez", "/readyz", "/health"} {
+		if got := probe(t, srv, path); got != 200 {
+			t.Errorf("%s before shutdown = %d, want 200", path, got)
+		}
+	}
+	srv.BeginShutdown()
+	for _, path := range []string{"/livez", "/readyz"} {
+		if got := probe(t, srv, path); got != 503 {
+			t.Errorf("%s during shutdown = %d, want 503", path, got)
+		}
+	}
+	// The legacy alias keeps answering 200 for existing callers.
+	if got := probe(t, srv, "/health"); got != 200 {
+		t.Errorf("/health during shutdown = %d, want 200", got)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionSendPromptRef(t *testing.T) {
+	dir := t.TempDir()
+	ref := filepath.Join(dir, "prompt.txt")
+	if err := os.WriteFile(ref, []byte("generated prompt from disk"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "promptRef": ref}); rpcErr != nil {
+		t.Fatalf("session.send with promptRef: %v", rpcErr)
+	}
+	drainFrames(t, sess, 2*time.Second)
+	history := sess.History()
+	if len(history) == 0 || history[0].Content != "generated prompt from disk" {
+		t.Fatalf("history = %v, want the file contents as the user prompt", history)
+	}
+}
+
+func TestSessionSendPromptRefValidation(t *testing.T) {
+	dir := t.TempDir()
+	ref := filepath.Join(dir, "prompt.txt")
+	if err := os.WriteFile(ref, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+
+	cases := []struct {
+		name   string
+		params map[string]any
+	}{
+		{"both prompt and promptRef", map[string]any{"sessionId": sess.ID, "prompt": "inline", "promptRef": ref}},
+		{"missing file", map[string]any{"sessionId": sess.ID, "promptRef": filepath.Join(dir, "nope.txt")}},
+		{"directory", map[string]any{"sessionId": sess.ID, "promptRef": dir}},
+	}
+	for _, tc := range cases {
+		if _, rpcErr := doRPC(t, srv, "session.send", tc.params); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("%s: got %v, want code %d", tc.name, rpcErr, codeInvalidParams)
+		}
+	}
+}
+
+func TestSessionSendPromptRefAllowlist(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	ref := filepath.Join(outside, "prompt.txt")
+	if err := os.WriteFile(ref, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := newMockServer(t, func(cfg *Config) { cfg.AllowedPaths = []string{allowed} })
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "promptRef": ref}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("promptRef outside the allowlist: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
+
+func TestSessionSendPromptRefSizeCap(t *testing.T) {
+	dir := t.TempDir()
+	ref := filepath.Join(dir, "prompt.txt")
+	if err := os.WriteFile(ref, []byte(strings.Repeat("x", 2048)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := newMockServer(t, func(cfg *Config) { cfg.MaxBodyBytes = 1024 })
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "promptRef": ref}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("oversized promptRef: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
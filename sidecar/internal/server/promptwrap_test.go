@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// capturePrompt scripts the fake to record the prompt each turn carried.
+func capturePrompt(fake *fakeClient, prompts *[]string) {
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		*prompts = append(*prompts, req.Prompt)
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "ok"}, nil
+	}
+}
+
+func createAndSend(t *testing.T, srv *Server, createParams map[string]any, prompt string) string {
+	t.Helper()
+	result, rpcErr := doRPC(t, srv, "session.create", createParams)
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": prompt,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second)
+	return created.SessionID
+}
+
+func TestPromptWrappedWithServerDefaults(t *testing.T) {
+	fake := newFakeClient()
+	var prompts []string
+	capturePrompt(fake, &prompts)
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.PromptPrefix = "You are helping inside an IDE."
+		cfg.PromptSuffix = "Respond concisely."
+	})
+	id := createAndSend(t, srv, map[string]any{"model": "gpt-4o"}, "what is a mutex?")
+	if len(prompts) != 1 {
+		t.Fatalf("SDK saw %d prompts, want 1", len(prompts))
+	}
+	want := "You are helping inside an IDE.\nwhat is a mutex?\nRespond concisely."
+	if prompts[0] != want {
+		t.Errorf("prompt = %q, want %q", prompts[0], want)
+	}
+	// History keeps what the user wrote, not the wrapped form.
+	sess := srv.Manager().Get(id)
+	if msg, ok := sess.UserMessage(""); !ok || msg.Content != "what is a mutex?" {
+		t.Errorf("history content = %q, want the unwrapped prompt", msg.Content)
+	}
+}
+
+func TestPromptWrapSessionOverride(t *testing.T) {
+	fake := newFakeClient()
+	var prompts []string
+	capturePrompt(fake, &prompts)
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.PromptPrefix = "server prefix"
+		cfg.PromptSuffix = "server suffix"
+	})
+	// Override the suffix, clear the prefix with an explicit empty string.
+	createAndSend(t, srv, map[string]any{
+		"model": "gpt-4o", "promptPrefix": "", "promptSuffix": "Use bullet points.",
+	}, "list the options")
+	if len(prompts) != 1 {
+		t.Fatalf("SDK saw %d prompts, want 1", len(prompts))
+	}
+	if want := "list the options\nUse bullet points."; prompts[0] != want {
+		t.Errorf("prompt = %q, want %q", prompts[0], want)
+	}
+}
+
+func TestEchoPromptFrameInDebugMode(t *testing.T) {
+	fake := newFakeClient()
+	var prompts []string
+	capturePrompt(fake, &prompts)
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.Debug = true
+		cfg.PromptSuffix = "Respond concisely."
+	})
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hello",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	echoed := ""
+	for _, f := range drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second) {
+		if f["type"] == "echo_prompt" {
+			echoed, _ = f["content"].(string)
+		}
+	}
+	if want := "hello\nRespond concisely."; echoed != want {
+		t.Errorf("echo_prompt content = %q, want %q", echoed, want)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// Session-churn guard: a plugin bug that loops session.create (or
+// create/close) in a tight loop thrashes the Copilot CLI with session
+// setup and teardown and starves everything else of the manager's lock.
+// createLimiter is a per-client token bucket over session.create, keyed
+// the same way the file-store quota is (remote host, the only per-client
+// identity a shared-token deployment has). A create over budget fails
+// with codeRateLimited and costs the SDK nothing.
+type createLimiter struct {
+	mu sync.Mutex
+	// rate is tokens added per second and also the bucket capacity, so a
+	// well-behaved client can burst one second's worth of creates.
+	rate    float64
+	buckets map[string]*createBucket
+}
+
+type createBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newCreateLimiter returns nil when the rate is zero or negative, the
+// "no limit" default.
+func newCreateLimiter(rate float64) *createLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &createLimiter{rate: rate, buckets: make(map[string]*createBucket)}
+}
+
+// allow spends one token from key's bucket, refilling by elapsed time
+// first. Like the file store, stale state is purged inline on use — a
+// bucket that has refilled completely is indistinguishable from a fresh
+// one, so it is dropped rather than swept by a background goroutine.
+func (l *createLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, b := range l.buckets {
+		if now.Sub(b.last).Seconds()*l.rate >= l.rate {
+			delete(l.buckets, k)
+		}
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &createBucket{tokens: l.rate}
+		l.buckets[key] = b
+	} else {
+		b.tokens = min(l.rate, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestCreateLimiterBucket(t *testing.T) {
+	l := newCreateLimiter(2)
+	now := time.Now()
+	if !l.allow("a", now) || !l.allow("a", now) {
+		t.Fatal("burst within the limit was rejected")
+	}
+	if l.allow("a", now) {
+		t.Error("third create in the same instant allowed at rate 2/s")
+	}
+	// Another client has its own budget.
+	if !l.allow("b", now) {
+		t.Error("an unrelated client was charged for a's churn")
+	}
+	// Half a second refills one token at 2/s.
+	if !l.allow("a", now.Add(500*time.Millisecond)) {
+		t.Error("bucket did not refill with elapsed time")
+	}
+	if l.allow("a", now.Add(500*time.Millisecond)) {
+		t.Error("refill granted more than elapsed time earns")
+	}
+	if newCreateLimiter(0) != nil {
+		t.Error("rate 0 should disable the limiter")
+	}
+}
+
+func TestCreateRateLimitReturnsRateLimited(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.CreateRateLimit = 2 })
+	for i := 0; i < 2; i++ {
+		if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"}); rpcErr != nil {
+			t.Fatalf("create %d within the limit: %v", i+1, rpcErr)
+		}
+	}
+	_, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	if rpcErr == nil || rpcErr.Code != codeRateLimited {
+		t.Fatalf("create over the limit: got %v, want code %d", rpcErr, codeRateLimited)
+	}
+	// Other methods are untouched by the create limiter.
+	if _, rpcErr := doRPC(t, srv, "session.list", nil); rpcErr != nil {
+		t.Errorf("session.list while create-limited: %v", rpcErr)
+	}
+}
+
+// TestSessionChurnStress hammers create/close from several goroutines while
+// an unrelated session keeps serving lookups, exercising the invariant that
+// the manager lock is never held across a (slow) SDK call.
+func TestSessionChurnStress(t *testing.T) {
+	fake := newFakeClient()
+	var sdkIDs atomic.Int64
+	fake.create = func(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+		time.Sleep(2 * time.Millisecond) // a slow SDK create; must not stall the manager
+		return fmt.Sprintf("sdk-%d", sdkIDs.Add(1)), nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	keep, _ := srv.Manager().Create("gpt-4o", "sdk-keep", "")
+
+	rpc := func(method, params string) (json.RawMessage, *rpcError, error) {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, params)
+		req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+			Error  *rpcError       `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			return nil, nil, fmt.Errorf("decoding %q: %w", rec.Body.String(), err)
+		}
+		return resp.Result, resp.Error, nil
+	}
+
+	const workers, rounds = 8, 10
+	errs := make(chan string, workers*rounds)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				result, rpcErr, err := rpc("session.create", `{"model":"gpt-4o"}`)
+				if err != nil || rpcErr != nil {
+					errs <- fmt.Sprintf("create: %v / %v", err, rpcErr)
+					return
+				}
+				var created struct {
+					SessionID string `json:"sessionId"`
+				}
+				if err := json.Unmarshal(result, &created); err != nil {
+					errs <- fmt.Sprintf("decoding create result: %v", err)
+					return
+				}
+				if _, rpcErr, err := rpc("session.close", `{"sessionId":"`+created.SessionID+`"}`); err != nil || rpcErr != nil {
+					errs <- fmt.Sprintf("close: %v / %v", err, rpcErr)
+					return
+				}
+			}
+		}()
+	}
+	churnDone := make(chan struct{})
+	go func() { wg.Wait(); close(churnDone) }()
+	// Unrelated lookups must stay responsive throughout the churn; the
+	// bound is generous because CI is slow, but a lock held across the
+	// sleeping SDK create would blow far past it.
+	for looking := true; looking; {
+		start := time.Now()
+		if srv.Manager().Get(keep.ID) == nil {
+			errs <- "unrelated session vanished during churn"
+		}
+		if d := time.Since(start); d > time.Second {
+			errs <- fmt.Sprintf("manager lookup took %s under churn", d)
+		}
+		select {
+		case <-churnDone:
+			looking = false
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(errs)
+	for msg := range errs {
+		t.Error(msg)
+	}
+	if n := srv.Manager().Len(); n != 1 {
+		t.Errorf("%d sessions live after churn, want only the kept one", n)
+	}
+	if got := fake.createCalls.Load(); got != workers*rounds {
+		t.Errorf("SDK creates = %d, want %d", got, workers*rounds)
+	}
+	if got := fake.destroyCalls.Load(); got != workers*rounds {
+		t.Errorf("SDK destroys = %d, want %d", got, workers*rounds)
+	}
+}
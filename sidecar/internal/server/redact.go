@@ -0,0 +1,45 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// redactedPlaceholder replaces every --redact-pattern match in outgoing text.
+const redactedPlaceholder = "***REDACTED***"
+
+// redactor rewrites outgoing text frame content, replacing anything matching
+// a configured pattern before it reaches a client. It sits in the publish
+// path, so streamed frames, the poll ring and transcripts all see the
+// redacted form — a secret never leaves the server in any delivery mode.
+type redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// newRedactor compiles the configured patterns, or returns nil when there
+// are none. With ignoreCase set every pattern matches case-insensitively.
+func newRedactor(patterns []string, ignoreCase bool) (*redactor, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	r := &redactor{patterns: make([]*regexp.Regexp, 0, len(patterns))}
+	for _, p := range patterns {
+		if ignoreCase {
+			p = "(?i)" + p
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("compiling redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// apply replaces every pattern match in content with the placeholder.
+func (r *redactor) apply(content string) string {
+	for _, re := range r.patterns {
+		content = re.ReplaceAllString(content, redactedPlaceholder)
+	}
+	return content
+}
@@ -0,0 +1,79 @@
+package server
+
+// Config reload. A long-running sidecar occasionally needs a new auth
+// token or a changed path allowlist without dropping its live sessions.
+// cmd/sidecar re-reads its --config file on SIGHUP and calls Reload with
+// the result; everything else in Config (ports, timeouts, model policy)
+// keeps its startup value. Sessions, in-flight turns and open streams are
+// untouched — only the next authorization check, tool-path check and
+// session.create see the new values.
+
+// ReloadableConfig is the subset of Config that Reload may replace on a
+// running server. Values are absolute, not deltas: a zero AuthToken
+// disables auth and an empty AllowedPaths lifts the path restriction,
+// exactly as they would at startup.
+type ReloadableConfig struct {
+	// AuthToken replaces the Bearer token; see Config.AuthToken.
+	AuthToken string `json:"authToken"`
+	// CreateRateLimit replaces the per-client session.create budget; see
+	// Config.CreateRateLimit. Buckets start full again.
+	CreateRateLimit float64 `json:"createRateLimit"`
+	// AllowedPaths replaces the tool-path allowlist; see
+	// Config.AllowedPaths.
+	AllowedPaths []string `json:"allowedPaths"`
+}
+
+// Reloadable returns the server's current hot-reloadable settings, so a
+// caller can re-apply them with individual changes.
+func (s *Server) Reloadable() ReloadableConfig {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	rc := ReloadableConfig{
+		AuthToken:    s.authToken,
+		AllowedPaths: append([]string(nil), s.allowedPaths...),
+	}
+	if s.createLimit != nil {
+		rc.CreateRateLimit = s.createLimit.rate
+	}
+	return rc
+}
+
+// Reload applies rc to the running server. It validates first and applies
+// nothing on error, for the same reason New fails on an unresolvable
+// allowed path: silently dropping an allowlist entry would change what
+// the agent may touch.
+func (s *Server) Reload(rc ReloadableConfig) error {
+	allowed, err := newPathAllowlist(rc.AllowedPaths)
+	if err != nil {
+		return err
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.authToken = rc.AuthToken
+	s.allowedPaths = allowed
+	s.createLimit = newCreateLimiter(rc.CreateRateLimit)
+	return nil
+}
+
+// bearerToken returns the token authorized checks requests against; empty
+// disables auth.
+func (s *Server) bearerToken() string {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.authToken
+}
+
+// toolPaths returns the current tool-path allowlist.
+func (s *Server) toolPaths() pathAllowlist {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.allowedPaths
+}
+
+// createLimiter returns the current session.create limiter; nil means no
+// limit.
+func (s *Server) limiter() *createLimiter {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.createLimit
+}
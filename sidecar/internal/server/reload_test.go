@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// authedRPC is doRPC with a Bearer token, for servers running with
+// --auth-token set.
+func authedRPC(t *testing.T, srv *Server, token, method string, params any) (json.RawMessage, *rpcError) {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("marshalling params: %v", err)
+	}
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, raw)
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return resp.Result, resp.Error
+}
+
+func TestReloadRotatesAuthTokenWithoutDroppingSessions(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.AuthToken = "old" })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := authedRPC(t, srv, "old", "session.list", map[string]any{}); rpcErr != nil {
+		t.Fatalf("old token rejected before reload: %v", rpcErr)
+	}
+	if err := srv.Reload(ReloadableConfig{AuthToken: "new"}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, rpcErr := authedRPC(t, srv, "old", "session.list", map[string]any{}); rpcErr == nil || rpcErr.Code != codeUnauthorized {
+		t.Errorf("old token after reload: got %v, want code %d", rpcErr, codeUnauthorized)
+	}
+	if _, rpcErr := authedRPC(t, srv, "new", "session.list", map[string]any{}); rpcErr != nil {
+		t.Fatalf("new token rejected after reload: %v", rpcErr)
+	}
+	// The session created before the reload is still live and still takes
+	// turns; its event stream delivers as before.
+	if srv.Manager().Get(sess.ID) == nil {
+		t.Fatal("session dropped by reload")
+	}
+	if _, rpcErr := authedRPC(t, srv, "new", "session.send", map[string]any{
+		"sessionId": sess.ID, "prompt": "still here?",
+	}); rpcErr != nil {
+		t.Fatalf("session.send after reload: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if len(frames) == 0 || frames[len(frames)-1]["type"] != "done" {
+		t.Errorf("turn after reload did not complete: %v", frames)
+	}
+}
+
+func TestReloadSwapsAllowedPaths(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	srv := newMockServer(t, func(cfg *Config) { cfg.AllowedPaths = []string{dirA} })
+	inA, inB := filepath.Join(dirA, "f.txt"), filepath.Join(dirB, "f.txt")
+	if !srv.toolPaths().allows(inA) || srv.toolPaths().allows(inB) {
+		t.Fatal("allowlist wrong before reload")
+	}
+	if err := srv.Reload(ReloadableConfig{AllowedPaths: []string{dirB}}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if srv.toolPaths().allows(inA) || !srv.toolPaths().allows(inB) {
+		t.Error("allowlist not swapped by reload")
+	}
+	// An unresolvable path fails the whole reload, leaving everything in
+	// place — same contract as New. A path routed through a regular file
+	// cannot resolve (nonexistent paths are fine; see resolvePath).
+	file := filepath.Join(dirA, "plain.txt")
+	if err := os.WriteFile(file, []byte("x"), 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	err := srv.Reload(ReloadableConfig{
+		AuthToken:    "should-not-apply",
+		AllowedPaths: []string{filepath.Join(file, "sub")},
+	})
+	if err == nil {
+		t.Fatal("reload with unresolvable path accepted")
+	}
+	if srv.bearerToken() != "" || !srv.toolPaths().allows(inB) {
+		t.Error("failed reload applied partial settings")
+	}
+}
+
+func TestReloadCreateRateLimit(t *testing.T) {
+	srv := newMockServer(t, nil)
+	if err := srv.Reload(ReloadableConfig{CreateRateLimit: 1}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"}); rpcErr != nil {
+		t.Fatalf("first create: %v", rpcErr)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"}); rpcErr == nil || rpcErr.Code != codeRateLimited {
+		t.Fatalf("second create: got %v, want code %d", rpcErr, codeRateLimited)
+	}
+	if err := srv.Reload(ReloadableConfig{CreateRateLimit: 0}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"}); rpcErr != nil {
+			t.Fatalf("create %d after lifting the limit: %v", i, rpcErr)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestDoneFrameCarriesSDKRequestID(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		return &copilot.MessageResponse{
+			MessageID: "msg-req-abc123", RequestID: "req-abc123",
+			Content: "ok", FinishReason: "stop",
+		}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	for _, f := range drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second) {
+		if f["type"] != "done" {
+			continue
+		}
+		if f["messageId"] != "msg-req-abc123" {
+			t.Errorf("messageId = %v, want msg-req-abc123", f["messageId"])
+		}
+		if f["requestId"] != "req-abc123" {
+			t.Errorf("requestId = %v, want req-abc123", f["requestId"])
+		}
+		return
+	}
+	t.Fatal("no done frame seen")
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+type sessionRetryParams struct {
+	SessionID string `json:"sessionId"`
+	// Model optionally overrides the session's model for this one turn.
+	Model string `json:"model,omitempty"`
+	// MessageID names the user message to replay; empty means the most
+	// recent user message.
+	MessageID string `json:"messageId,omitempty"`
+	// RelativeURLs asks for streamUrl as a bare path instead of an absolute
+	// URL, for same-origin clients.
+	RelativeURLs bool `json:"relativeUrls,omitempty"`
+}
+
+// rpcSessionRetry re-sends a user prompt from history — with the context
+// items it originally carried — as a fresh streamed turn, optionally on a
+// different model. A retry on the session's own model is an ordinary turn; a
+// model override runs on an ephemeral SDK session (the other model has no
+// view of this session's conversation), so like session.compare it answers
+// the prompt standalone and without tool execution.
+func (s *Server) rpcSessionRetry(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	ctx := r.Context()
+	var p sessionRetryParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	msg, ok := sess.UserMessage(p.MessageID)
+	if !ok {
+		if p.MessageID == "" {
+			return nil, errInvalidParams("session has no user message to retry")
+		}
+		return nil, errInvalidParams("unknown message: %s", p.MessageID)
+	}
+	model := sess.Model
+	var aliasNote string
+	if p.Model != "" {
+		model, aliasNote = s.resolveModel(ctx, p.Model)
+	}
+	// The global turn cap applies to retries like any send — acquired before
+	// the per-session turn slot, as in startSend, and released by the
+	// producer when the turn ends.
+	if rpcErr := s.acquireTurnSlot(ctx, false); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if !sess.BeginTurn() {
+		s.releaseTurnSlot()
+		switch {
+		case sess.Closing():
+			return nil, &rpcError{Code: codeSessionClosed, Message: "session is closing"}
+		case sess.Closed():
+			return nil, &rpcError{Code: codeSessionClosed, Message: "session is closed"}
+		}
+		return nil, &rpcError{Code: codeTurnActive, Message: "a turn is already streaming on this session"}
+	}
+	sess.Touch()
+	if aliasNote != "" {
+		s.publish(sess, Frame{Type: "meta", Message: aliasNote})
+	}
+	messageID := fmt.Sprintf("msg-%d", time.Now().UnixNano())
+	sess.AppendUserMessage(messageID, msg.Content, msg.Context)
+	s.transcripts.record(sess.ID, transcriptEntry{Kind: "prompt", Prompt: msg.Content})
+	s.metrics.messagesSent.Add(1)
+	st := newStatsTracker(time.Now())
+	sp := sessionSendParams{SessionID: sess.ID, Prompt: msg.Content, Context: msg.Context}
+	switch {
+	case s.cfg.Mock:
+		s.goTurn(func() {
+			defer s.releaseTurnSlot()
+			s.streamMockResponse(sess, sp, st)
+		})
+	case model == sess.Model:
+		s.goTurn(func() {
+			defer s.releaseTurnSlot()
+			s.runTurn(sess, sp, messageID, st)
+		})
+	default:
+		s.goTurn(func() {
+			defer s.releaseTurnSlot()
+			s.runRetryModel(sess, model, sp, messageID, st)
+		})
+	}
+	return map[string]any{
+		"messageId": messageID,
+		"model":     model,
+		"streamUrl": streamURL(r, sess.ID, p.RelativeURLs),
+	}, nil
+}
+
+// runRetryModel drives a turn against a model other than the session's own,
+// on a throwaway SDK session that is destroyed when the turn ends. Shared by
+// session.retry's model override and autoRoute sends. Mirrors
+// runCompareModel, minus the per-model frame tagging.
+func (s *Server) runRetryModel(sess *session.Session, model string, p sessionSendParams, messageID string, st *statsTracker) {
+	defer sess.EndTurn()
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.SendTimeout)
+	defer cancel()
+	defer s.registerTurnCancel(sess.ID, cancel)()
+	go func() {
+		select {
+		case <-sess.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	sdkID, err := s.client.CreateSession(ctx, copilot.SessionConfig{Model: model, WorkingDir: sess.WorkingDir()})
+	if err != nil {
+		if !sess.TurnCancelled() {
+			f := errorFrame(err)
+			f.Message = "creating session: " + f.Message
+			s.publish(sess, f)
+		}
+		s.finishTurn(sess, Frame{Type: "done", MessageID: messageID})
+		return
+	}
+	defer func() {
+		// The turn context may already be cancelled; clean up regardless.
+		dctx, dcancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer dcancel()
+		_ = s.client.DestroySession(dctx, sdkID)
+	}()
+	req := copilot.MessageRequest{Prompt: p.sdkPrompt(sess), Context: p.Context, MaxTokens: p.MaxTokens}
+	var textAsm utf8Assembler
+	resp, err := s.client.SendMessage(ctx, sdkID, req, func(ev copilot.StreamEvent) {
+		if !knownStreamEvent(ev.Type) {
+			s.handleUnknownEvent(sess, ev, "")
+			return
+		}
+		if ev.Type == "tool_call" {
+			// The throwaway session has no plugin callback wiring; refuse the
+			// call so the SDK can finish the turn rather than hang.
+			_ = s.client.SendToolResult(ctx, sdkID, copilot.ToolResult{
+				CallID: ev.ToolCallID,
+				Error:  "tools are not available on a turn running on a different model",
+			})
+			return
+		}
+		if ev.Type == "text" {
+			if ev.Content = textAsm.add(ev.Content); ev.Content == "" {
+				return
+			}
+		}
+		st.observe(ev.Content)
+		s.publish(sess, frameForStreamEvent(ev))
+	})
+	if rest := textAsm.flush(); rest != "" {
+		s.publish(sess, Frame{Type: "text", Content: rest})
+	}
+	if err != nil {
+		if !sess.TurnCancelled() {
+			s.publish(sess, errorFrame(err))
+		}
+		s.finishTurn(sess, Frame{Type: "done", MessageID: messageID})
+		return
+	}
+	sess.AppendHistory("assistant", resp.Content)
+	sess.SetFinishReason(resp.FinishReason)
+	sess.Touch()
+	if !sess.TurnCancelled() {
+		s.finishTurnStats(sess, st, resp.Usage.CompletionTokens)
+	}
+	s.finishTurn(sess, Frame{Type: "done", MessageID: messageID, FinishReason: resp.FinishReason})
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestSessionRetryOnDifferentModel(t *testing.T) {
+	fake := newFakeClient()
+	fake.models = append(fake.models, copilot.Model{ID: "gpt-5-mini", Name: "GPT-5 mini"})
+	var mu sync.Mutex
+	var sent []copilot.MessageRequest
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		mu.Lock()
+		sent = append(sent, req)
+		mu.Unlock()
+		onEvent(copilot.StreamEvent{Type: "text", Content: "from " + sessionID})
+		return &copilot.MessageResponse{MessageID: "msg-sdk", Content: "from " + sessionID, FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	items := []map[string]any{{"file": "main.go", "content": "package main"}}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "explain this", "context": items,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+
+	result, rpcErr = doRPC(t, srv, "session.retry", map[string]any{
+		"sessionId": created.SessionID, "model": "gpt-5-mini",
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.retry: %v", rpcErr)
+	}
+	var retried struct {
+		MessageID string `json:"messageId"`
+		Model     string `json:"model"`
+	}
+	if err := json.Unmarshal(result, &retried); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if retried.Model != "gpt-5-mini" {
+		t.Errorf("model = %q, want gpt-5-mini", retried.Model)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	if last := frames[len(frames)-1]; last["messageId"] != retried.MessageID {
+		t.Errorf("done messageId = %v, want %s", last["messageId"], retried.MessageID)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 2 {
+		t.Fatalf("SendMessage called %d times, want 2", len(sent))
+	}
+	if sent[1].Prompt != "explain this" {
+		t.Errorf("retried prompt = %q, want the original", sent[1].Prompt)
+	}
+	if len(sent[1].Context) != 1 || sent[1].Context[0].File != "main.go" {
+		t.Errorf("retried context = %+v, want the original attachment", sent[1].Context)
+	}
+	// The override ran on a throwaway SDK session: one extra create, torn
+	// down before the done frame.
+	if got := fake.createCalls.Load(); got != 2 {
+		t.Errorf("createCalls = %d, want 2", got)
+	}
+	if got := fake.destroyCalls.Load(); got != 1 {
+		t.Errorf("destroyCalls = %d, want 1", got)
+	}
+}
+
+func TestSessionRetrySameModelReusesSession(t *testing.T) {
+	fake := newFakeClient()
+	var sdkIDs []string
+	var mu sync.Mutex
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		mu.Lock()
+		sdkIDs = append(sdkIDs, sessionID)
+		mu.Unlock()
+		return &copilot.MessageResponse{MessageID: "msg-sdk", Content: "ok"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hi",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+	if _, rpcErr := doRPC(t, srv, "session.retry", map[string]any{
+		"sessionId": created.SessionID,
+	}); rpcErr != nil {
+		t.Fatalf("session.retry: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sdkIDs) != 2 || sdkIDs[0] != sdkIDs[1] {
+		t.Errorf("SDK sessions used = %v, want the same one twice", sdkIDs)
+	}
+	if got := fake.createCalls.Load(); got != 1 {
+		t.Errorf("createCalls = %d, want 1 (no throwaway session)", got)
+	}
+}
+
+func TestSessionRetryUnknownMessage(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	_, rpcErr := doRPC(t, srv, "session.retry", map[string]any{
+		"sessionId": sess.ID, "messageId": "msg-nope",
+	})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	// No user message at all: the "last user message" default has nothing
+	// to resolve to either.
+	_, rpcErr = doRPC(t, srv, "session.retry", map[string]any{"sessionId": sess.ID})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("empty history: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
@@ -0,0 +1,859 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// JSON-RPC 2.0 error codes. The -32000 range is reserved for
+// implementation-defined server errors.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeUnauthorized   = -32001
+	codeSessionClosed  = -32002
+	codeRateLimited    = -32003
+	codeTurnActive     = -32004
+	codeInitializing   = -32005
+	codeServerBusy     = -32006
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// errInvalidParams builds a -32602 error with a formatted message.
+func errInvalidParams(format string, args ...any) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// handleRPC decodes one JSON-RPC request from the body, dispatches it and
+// writes the response. Batch requests are not supported; the plugin never
+// sends them.
+func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.metrics.rpcRequests.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	// Enforce the content type up front: form-encoded or plain-text bodies
+	// would otherwise surface as confusing JSON parse errors. A charset
+	// suffix (application/json; charset=utf-8) is fine.
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || mediaType != "application/json" {
+			s.writeRPC(w, nil, nil, &rpcError{
+				Code:    codeInvalidRequest,
+				Message: fmt.Sprintf("unsupported Content-Type %q: /rpc requires application/json", ct),
+			})
+			return
+		}
+	}
+	var req rpcRequest
+	// The wire bytes are capped first; gzip bodies are then capped again on
+	// the decompressed size, so a zip bomb cannot expand past the limit.
+	reader := io.Reader(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes))
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			s.writeRPC(w, nil, nil, &rpcError{Code: codeInvalidRequest, Message: "malformed gzip body: " + err.Error()})
+			return
+		}
+		defer zr.Close()
+		reader = io.LimitReader(zr, s.cfg.MaxBodyBytes+1)
+	default:
+		s.writeRPC(w, nil, nil, &rpcError{
+			Code:    codeInvalidRequest,
+			Message: fmt.Sprintf("unsupported Content-Encoding %q: /rpc accepts identity or gzip", enc),
+		})
+		return
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		s.writeRPC(w, nil, nil, &rpcError{Code: codeInvalidRequest, Message: "reading body: " + err.Error()})
+		return
+	}
+	if int64(len(body)) > s.cfg.MaxBodyBytes {
+		s.writeRPC(w, nil, nil, &rpcError{
+			Code:    codeInvalidRequest,
+			Message: fmt.Sprintf("request body exceeds %d bytes after decompression", s.cfg.MaxBodyBytes),
+		})
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		s.writeRPC(w, nil, nil, &rpcError{Code: codeParseError, Message: "parse error: " + err.Error()})
+		return
+	}
+	if !s.authorized(r) {
+		s.writeRPC(w, req.ID, nil, &rpcError{Code: codeUnauthorized, Message: "unauthorized"})
+		return
+	}
+	result, rpcErr := s.dispatch(r, &req)
+	s.writeRPC(w, req.ID, result, rpcErr)
+}
+
+func (s *Server) writeRPC(w http.ResponseWriter, id json.RawMessage, result any, rpcErr *rpcError) {
+	if rpcErr != nil {
+		s.metrics.rpcErrors.Add(1)
+	}
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("rpc: writing response: %v", err)
+	}
+}
+
+// dispatch routes one request to its method handler.
+func (s *Server) dispatch(r *http.Request, req *rpcRequest) (any, *rpcError) {
+	switch req.Method {
+	case "session.create":
+		return s.rpcSessionCreate(r, req.Params)
+	case "session.send":
+		return s.rpcSessionSend(r, req.Params)
+	case "session.compare":
+		return s.rpcSessionCompare(r, req.Params)
+	case "session.retry":
+		return s.rpcSessionRetry(r, req.Params)
+	case "session.cancel":
+		return s.rpcSessionCancel(r.Context(), req.Params)
+	case "session.touch":
+		return s.rpcSessionTouch(r.Context(), req.Params)
+	case "stream.pause":
+		return s.rpcStreamPause(r.Context(), req.Params)
+	case "stream.resume":
+		return s.rpcStreamResume(r.Context(), req.Params)
+	case "session.addContext":
+		return s.rpcSessionAddContext(r.Context(), req.Params)
+	case "session.clearContext":
+		return s.rpcSessionClearContext(r.Context(), req.Params)
+	case "session.close":
+		return s.rpcSessionClose(r.Context(), req.Params)
+	case "session.summarize":
+		return s.rpcSessionSummarize(r.Context(), req.Params)
+	case "session.export":
+		return s.rpcSessionExport(r.Context(), req.Params)
+	case "session.list":
+		return s.rpcSessionList(r.Context())
+	case "session.info":
+		return s.rpcSessionInfo(r.Context(), req.Params)
+	case "admin.inspectSession":
+		return s.rpcAdminInspectSession(r.Context(), req.Params)
+	case "admin.stats":
+		return s.rpcAdminStats(r.Context())
+	case "admin.getDefaultModel":
+		return s.rpcAdminGetDefaultModel(r.Context())
+	case "admin.setDefaultModel":
+		return s.rpcAdminSetDefaultModel(r.Context(), req.Params)
+	case "admin.snapshot":
+		return s.rpcAdminSnapshot(r.Context())
+	case "admin.restore":
+		return s.rpcAdminRestore(r.Context(), req.Params)
+	case "files.upload":
+		return s.rpcFilesUpload(r, req.Params)
+	case "files.delete":
+		return s.rpcFilesDelete(r.Context(), req.Params)
+	case "models.list":
+		return s.rpcModelsList(r.Context())
+	case "system.preflight":
+		return s.rpcSystemPreflight(r.Context())
+	case "models.get":
+		return s.rpcModelsGet(r.Context(), req.Params)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+// streamURL builds the stream URL returned by send and compare. By default
+// it is absolute — scheme derived from whether the request arrived over TLS,
+// host and port taken from the request — so clients on a different base URL
+// (remote setups, port forwards) can use it directly. relative=true returns
+// the bare path for same-origin clients that resolve against their own base.
+func streamURL(r *http.Request, sessionID string, relative bool) string {
+	return endpointURL(r, "/stream/"+sessionID, relative)
+}
+
+// pollURL builds the long-poll URL returned when a send chooses poll
+// delivery, with the same base-URL rules as streamURL.
+func pollURL(r *http.Request, sessionID string, relative bool) string {
+	return endpointURL(r, "/poll/"+sessionID, relative)
+}
+
+func endpointURL(r *http.Request, path string, relative bool) string {
+	if relative {
+		return path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// sessionRef is the common {"sessionId": ...} parameter shape.
+type sessionRef struct {
+	SessionID string `json:"sessionId"`
+}
+
+func unmarshalParams(params json.RawMessage, v any) *rpcError {
+	if len(params) == 0 {
+		return errInvalidParams("missing params")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return errInvalidParams("invalid params: %v", err)
+	}
+	return nil
+}
+
+type sessionCreateParams struct {
+	Model          string `json:"model,omitempty"`
+	SystemPrompt   string `json:"systemPrompt,omitempty"`
+	WorkingDir     string `json:"workingDir,omitempty"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// TTLSeconds overrides the server's default idle timeout for this
+	// session. session.touch still resets the idle clock; the TTL is an
+	// idle bound, not an absolute lifetime.
+	TTLSeconds int `json:"ttlSeconds,omitempty"`
+	// MaxTurnSeconds tightens the server's turn-duration ceiling
+	// (--max-turn-duration) for this session's turns. It may lower the
+	// ceiling but never raise it. Distinct from the send timeout: this
+	// bounds the whole turn, tool execution included.
+	MaxTurnSeconds int `json:"maxTurnSeconds,omitempty"`
+	// Coalesce overrides the server's default for text-frame batching on
+	// this session's streams (see --coalesce / --coalesce-window).
+	Coalesce *bool `json:"coalesce,omitempty"`
+	// PaceCharsPerSecond overrides the server's paced-delivery default
+	// (--pace-chars-per-second) for this session: text is released at this
+	// steady character rate instead of in the SDK's bursts. nil inherits
+	// the server default; an explicit 0 disables pacing. A session that
+	// paces does not coalesce.
+	PaceCharsPerSecond *int `json:"paceCharsPerSecond,omitempty"`
+	// Thinking opts this session into synthetic "thinking" frames while a
+	// turn waits for its first content, so the UI can tie its spinner to the
+	// backend instead of guessing. Instant responses emit none.
+	Thinking bool `json:"thinking,omitempty"`
+	// PromptPrefix and PromptSuffix override the server's prompt wrapping
+	// (--prompt-prefix / --prompt-suffix) for this session. nil inherits the
+	// server default; an explicit empty string clears it.
+	PromptPrefix *string `json:"promptPrefix,omitempty"`
+	PromptSuffix *string `json:"promptSuffix,omitempty"`
+	// Locale is a BCP-47 tag (e.g. de-DE) naming the language responses
+	// should use. It becomes a standing system instruction appended after
+	// systemPrompt; see locale.go and the README for precedence against
+	// prompt prefix/suffix.
+	Locale string `json:"locale,omitempty"`
+	// NonBlocking asks the server not to wait out a lazy SDK start: if the
+	// CLI is still coming up the create fails fast with codeInitializing and
+	// an estimated wait, so the UI can show "starting" and poll instead of
+	// hanging for the full start budget.
+	NonBlocking bool `json:"nonBlocking,omitempty"`
+}
+
+// startupReporter is the optional probe SDK-backed clients implement so
+// non-blocking creates can bail out while the CLI is still starting (see
+// copilot.SDKClient.TryStart).
+type startupReporter interface {
+	TryStart() (ready bool, wait time.Duration)
+}
+
+type sessionInfoResult struct {
+	SessionID    string `json:"sessionId"`
+	Model        string `json:"model"`
+	WorkingDir   string `json:"workingDir,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+	LastActivity string `json:"lastActivity"`
+	TTLSeconds   int    `json:"ttlSeconds,omitempty"`
+	Locale       string `json:"locale,omitempty"`
+	Messages     int    `json:"messages"`
+	// ContextItems counts the session's persistent context pool (see
+	// session.addContext), so clients can see how much context every send
+	// is carrying.
+	ContextItems int `json:"contextItems,omitempty"`
+}
+
+// validateWorkingDir checks that a requested working directory exists, is a
+// directory, and (when --workspace-root is configured) sits inside the
+// workspace root. It returns the cleaned absolute path.
+func (s *Server) validateWorkingDir(dir string) (string, *rpcError) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errInvalidParams("workingDir: %v", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", errInvalidParams("workingDir: %v", err)
+	}
+	if !info.IsDir() {
+		return "", errInvalidParams("workingDir is not a directory: %s", dir)
+	}
+	if root := s.cfg.WorkspaceRoot; root != "" {
+		rootAbs, err := filepath.Abs(root)
+		if err != nil {
+			return "", &rpcError{Code: codeInternalError, Message: "resolving workspace root: " + err.Error()}
+		}
+		if abs != rootAbs && !strings.HasPrefix(abs, rootAbs+string(filepath.Separator)) {
+			return "", errInvalidParams("workingDir is outside the workspace root: %s", dir)
+		}
+	}
+	return abs, nil
+}
+
+func (s *Server) rpcSessionCreate(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	ctx := r.Context()
+	var p sessionCreateParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, errInvalidParams("invalid params: %v", err)
+		}
+	}
+	if limit := s.limiter(); limit != nil && !limit.allow(uploadOwner(r), time.Now()) {
+		// Checked before anything that could touch the SDK: the whole point
+		// is that a create/close loop burns its own budget, not CLI cycles.
+		return nil, &rpcError{Code: codeRateLimited, Message: "session.create rate limit exceeded; retry shortly"}
+	}
+	if p.NonBlocking && !s.cfg.Mock {
+		// Probed before anything that could touch the SDK (resolveModel may
+		// list models), since that is exactly the call that would block.
+		if c, ok := s.client.(startupReporter); ok {
+			if ready, wait := c.TryStart(); !ready {
+				return nil, &rpcError{
+					Code:    codeInitializing,
+					Message: "Copilot CLI is starting; retry shortly",
+					Data:    map[string]any{"estimatedWaitSeconds": int((wait + time.Second - 1) / time.Second)},
+				}
+			}
+		}
+	}
+	model := p.Model
+	if model == "" {
+		model = s.DefaultModel()
+	}
+	model, aliasNote := s.resolveModel(ctx, model)
+	if p.TTLSeconds < 0 {
+		return nil, errInvalidParams("ttlSeconds must be positive")
+	}
+	if p.TTLSeconds > 0 {
+		if s.manager.IdleTimeout() <= 0 {
+			return nil, errInvalidParams("ttlSeconds is not available: idle eviction is disabled on this server")
+		}
+		if ttl := time.Duration(p.TTLSeconds) * time.Second; ttl > s.cfg.MaxSessionTTL {
+			return nil, errInvalidParams("ttlSeconds %d exceeds the maximum of %d", p.TTLSeconds, int(s.cfg.MaxSessionTTL/time.Second))
+		}
+	}
+	if p.MaxTurnSeconds < 0 {
+		return nil, errInvalidParams("maxTurnSeconds must be positive")
+	}
+	if d := time.Duration(p.MaxTurnSeconds) * time.Second; d > s.cfg.MaxTurnDuration {
+		return nil, errInvalidParams("maxTurnSeconds %d exceeds the maximum of %d", p.MaxTurnSeconds, int(s.cfg.MaxTurnDuration/time.Second))
+	}
+	if p.PaceCharsPerSecond != nil && *p.PaceCharsPerSecond < 0 {
+		return nil, errInvalidParams("paceCharsPerSecond must not be negative")
+	}
+	workingDir := ""
+	if p.WorkingDir != "" {
+		var rpcErr *rpcError
+		if workingDir, rpcErr = s.validateWorkingDir(p.WorkingDir); rpcErr != nil {
+			return nil, rpcErr
+		}
+	}
+	systemPrompt := p.SystemPrompt
+	if p.Locale != "" {
+		if !plausibleLocale(p.Locale) {
+			return nil, errInvalidParams("locale %q is not a plausible BCP-47 tag", p.Locale)
+		}
+		// The instruction rides in the system prompt, after anything the
+		// caller supplied, so an explicit systemPrompt still leads.
+		if systemPrompt != "" {
+			systemPrompt += "\n\n"
+		}
+		systemPrompt += localeInstruction(p.Locale)
+	}
+	if p.IdempotencyKey != "" {
+		// A retry of a create whose response was lost: replay the recorded
+		// result before touching the SDK, so no redundant SDK session is
+		// ever made. See outbox.go.
+		if id, prevModel, ok := s.outbox.lookup(p.IdempotencyKey); ok {
+			if sess := s.manager.Get(id); sess != nil {
+				return map[string]any{"sessionId": sess.ID, "model": prevModel}, nil
+			}
+		}
+	}
+	sdkID := ""
+	fallbackFrom := ""
+	if !s.cfg.Mock {
+		// Vanilla creates can take a pre-warmed SDK session; anything with
+		// custom configuration has to be created to order.
+		if s.warm != nil && model == s.warm.model && systemPrompt == "" && workingDir == "" {
+			sdkID = s.warm.take()
+		}
+		if sdkID == "" {
+			var err error
+			sdkID, err = s.client.CreateSession(ctx, copilot.SessionConfig{
+				Model:        model,
+				SystemPrompt: systemPrompt,
+				WorkingDir:   workingDir,
+			})
+			if err != nil {
+				// Classify the failure: if the model is absent from the live
+				// model list the account simply cannot use it, and the error
+				// deserves better than "creating SDK session: ...".
+				available, missing := s.modelUnavailable(ctx, model)
+				if !missing {
+					return nil, &rpcError{Code: codeInternalError, Message: "creating SDK session: " + err.Error()}
+				}
+				if !s.cfg.AllowModelFallback || len(available) == 0 {
+					return nil, &rpcError{
+						Code:    codeInvalidParams,
+						Message: fmt.Sprintf("%v: %q is not available to this account", copilot.ErrModelNotFound, model),
+						Data:    map[string]any{"availableModels": available},
+					}
+				}
+				fallbackFrom, model = model, available[0]
+				sdkID, err = s.client.CreateSession(ctx, copilot.SessionConfig{
+					Model:        model,
+					SystemPrompt: systemPrompt,
+					WorkingDir:   workingDir,
+				})
+				if err != nil {
+					return nil, &rpcError{Code: codeInternalError, Message: "creating SDK session: " + err.Error()}
+				}
+				log.Printf("session create: model %q unavailable; falling back to %q", fallbackFrom, model)
+			}
+		}
+	}
+	sess, created := s.manager.Create(model, sdkID, p.IdempotencyKey)
+	if created {
+		sess.SetWorkingDir(workingDir)
+		if p.TTLSeconds > 0 {
+			sess.SetIdleTTL(time.Duration(p.TTLSeconds) * time.Second)
+		}
+		if coalesce := s.cfg.Coalesce; (p.Coalesce != nil && *p.Coalesce) || (p.Coalesce == nil && coalesce) {
+			sess.SetCoalesceWindow(s.cfg.CoalesceWindow)
+		}
+		if pace := s.cfg.PaceCharsPerSecond; p.PaceCharsPerSecond != nil {
+			sess.SetPaceCPS(*p.PaceCharsPerSecond)
+		} else if pace > 0 {
+			sess.SetPaceCPS(pace)
+		}
+		sess.SetThinking(p.Thinking)
+		sess.SetLocale(p.Locale)
+		prefix, suffix := s.cfg.PromptPrefix, s.cfg.PromptSuffix
+		if p.PromptPrefix != nil {
+			prefix = *p.PromptPrefix
+		}
+		if p.PromptSuffix != nil {
+			suffix = *p.PromptSuffix
+		}
+		sess.SetPromptWrap(prefix, suffix)
+		if p.MaxTurnSeconds > 0 {
+			sess.SetMaxTurnDuration(time.Duration(p.MaxTurnSeconds) * time.Second)
+		}
+		s.metrics.sessionsCreated.Add(1)
+		if fallbackFrom != "" {
+			// First into the ring, so the client learns which model it
+			// actually got before any other frame.
+			s.publish(sess, Frame{Type: "model_fallback", Requested: fallbackFrom, Using: model})
+		}
+		if aliasNote != "" {
+			s.publish(sess, Frame{Type: "meta", Message: aliasNote})
+		}
+		if note := s.deprecationNote(ctx, model); note != "" {
+			// Lands in the ring now, so the first stream the client attaches
+			// sees the warning ahead of any turn output.
+			s.publish(sess, Frame{Type: "model_deprecated", Message: note})
+		}
+	} else if sdkID != "" {
+		// Idempotent replay that outlived the outbox TTL: the SDK session
+		// we just made is redundant.
+		_ = s.client.DestroySession(ctx, sdkID)
+	}
+	if p.IdempotencyKey != "" {
+		s.outbox.record(p.IdempotencyKey, sess.ID, sess.Model)
+	}
+	return map[string]any{"sessionId": sess.ID, "model": sess.Model}, nil
+}
+
+func (s *Server) rpcSessionClose(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionRef
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Remove(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	s.transcripts.closeSession(sess.ID)
+	if !s.cfg.Mock && sess.SDKID != "" {
+		if err := s.client.DestroySession(ctx, sess.SDKID); err != nil {
+			log.Printf("session %s: destroying SDK session: %v", sess.ID, err)
+		}
+	}
+	return map[string]any{"closed": true}, nil
+}
+
+func (s *Server) rpcSessionCancel(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionRef
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	if err := s.cancelActiveTurn(ctx, sess, "user"); err != nil {
+		return nil, &rpcError{Code: codeInternalError, Message: "cancelling: " + err.Error()}
+	}
+	return map[string]any{"cancelled": true}, nil
+}
+
+// cancelActiveTurn stops a session's in-flight turn: the SDK message, the
+// turn context, and the turn's cancelled mark. Shared by session.cancel, the
+// /send-stream disconnect path and the abandoned-turn watchdog; reason says
+// which (see Frame.Reason).
+func (s *Server) cancelActiveTurn(ctx context.Context, sess *session.Session, reason string) error {
+	if !s.cfg.Mock && sess.SDKID != "" {
+		if err := s.client.CancelMessage(ctx, sess.SDKID); err != nil {
+			return err
+		}
+	}
+	// Cancelling the turn's context stops the in-flight send promptly; for
+	// compare turns, which have no SDKID of their own, it is the only lever.
+	s.cancelTurnCtx(sess.ID)
+	s.markTurnCancelled(sess, reason)
+	return nil
+}
+
+// markTurnCancelled emits the cancelled frame, reason always populated,
+// atomically with the cancel mark: any SDK chunks still in flight after this
+// point are discarded, so a client that has seen "cancelled" will only ever
+// see "done" after it.
+func (s *Server) markTurnCancelled(sess *session.Session, reason string) {
+	frame := encodeFrame(Frame{Type: "cancelled", Reason: reason})
+	if sess.CancelTurn(frame) {
+		s.transcripts.record(sess.ID, transcriptEntry{Kind: "frame", Frame: frame})
+	}
+}
+
+// rpcSessionTouch refreshes a session's LastActivity without sending a
+// message, so an open-but-idle chat is not idle-evicted. Clients should
+// heartbeat at well under the idle timeout; every idleTimeout/3 is a safe
+// cadence.
+func (s *Server) rpcSessionTouch(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionRef
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	sess.Touch()
+	return map[string]any{"lastActivity": sess.LastActivity().Format(time.RFC3339)}, nil
+}
+
+// rpcStreamPause stops draining events to the session's subscriber; they
+// buffer in the ring until stream.resume. A slow-rendering client uses this
+// as flow control instead of letting its channel overflow and drop chunks.
+// Pauses expire after two minutes (see session.maxPauseDuration): past that
+// the server resumes delivery on its own rather than buffer indefinitely.
+func (s *Server) rpcStreamPause(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionRef
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	if !sess.Pause() {
+		return nil, &rpcError{Code: codeSessionClosed, Message: "session is closed"}
+	}
+	return map[string]any{"paused": true}, nil
+}
+
+// rpcStreamResume flushes events buffered by stream.pause, in order, and
+// restores live delivery.
+func (s *Server) rpcStreamResume(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionRef
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	flushed := sess.Resume()
+	return map[string]any{"paused": false, "flushed": flushed}, nil
+}
+
+type sessionAddContextParams struct {
+	SessionID string                `json:"sessionId"`
+	Context   []copilot.ContextItem `json:"context"`
+}
+
+// rpcSessionAddContext stores context items on the session so every
+// subsequent send carries them without the plugin re-sending the same large
+// attachments each turn. Terminal items are rendered once, here.
+func (s *Server) rpcSessionAddContext(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionAddContextParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Context) == 0 {
+		return nil, errInvalidParams("context must list at least one item")
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	// Pooled items resolve their handles and lazy fetches once, here, not on
+	// every send.
+	if rpcErr := s.resolveHandleItems(p.Context); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := s.resolveFetchItems(ctx, sess.ID, p.Context); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := formatTerminalItems(p.Context); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := s.resolveGitLogItems(ctx, p.Context); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := formatSymbolItems(p.Context); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := formatSymbolGraphItems(p.Context); rpcErr != nil {
+		return nil, rpcErr
+	}
+	grouped, rpcErr := formatDiagnosticItems(p.Context)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	sess.Touch()
+	return map[string]any{"contextItems": sess.AddContext(grouped)}, nil
+}
+
+// rpcSessionClearContext empties the session's persistent context pool.
+func (s *Server) rpcSessionClearContext(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionRef
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	return map[string]any{"cleared": sess.ClearContext()}, nil
+}
+
+func (s *Server) rpcSessionList(ctx context.Context) (any, *rpcError) {
+	sessions := s.manager.List()
+	out := make([]sessionInfoResult, 0, len(sessions))
+	for _, sess := range sessions {
+		out = append(out, s.sessionInfo(sess))
+	}
+	return map[string]any{"sessions": out}, nil
+}
+
+func (s *Server) rpcSessionInfo(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionRef
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	return s.sessionInfo(sess), nil
+}
+
+func (s *Server) sessionInfo(sess *session.Session) sessionInfoResult {
+	// The effective TTL: the per-session override when one was set, the
+	// manager default otherwise. Zero (eviction disabled) is omitted.
+	ttl := sess.IdleTTL()
+	if ttl <= 0 {
+		ttl = s.manager.IdleTimeout()
+	}
+	return sessionInfoResult{
+		SessionID:    sess.ID,
+		Model:        sess.Model,
+		WorkingDir:   sess.WorkingDir(),
+		CreatedAt:    sess.CreatedAt.Format(time.RFC3339),
+		LastActivity: sess.LastActivity().Format(time.RFC3339),
+		TTLSeconds:   int(ttl / time.Second),
+		Locale:       sess.Locale(),
+		Messages:     len(sess.History()),
+		ContextItems: len(sess.ContextPool()),
+	}
+}
+
+func (s *Server) rpcModelsList(ctx context.Context) (any, *rpcError) {
+	if !s.cfg.Mock {
+		// models.list can be the first request a cold sidecar sees, and the
+		// fetch would then run the whole lazy CLI start on this goroutine.
+		// The same probe session.create's nonBlocking uses lets it answer
+		// from the last good list instead, or fail fast with initializing
+		// so the client polls rather than hangs.
+		if c, ok := s.client.(startupReporter); ok {
+			if ready, wait := c.TryStart(); !ready {
+				if cached := s.cachedModels(); len(cached) > 0 {
+					return s.modelsListResult(cached), nil
+				}
+				return nil, &rpcError{
+					Code:    codeInitializing,
+					Message: "Copilot CLI is starting; retry shortly",
+					Data:    map[string]any{"estimatedWaitSeconds": int((wait + time.Second - 1) / time.Second)},
+				}
+			}
+		}
+	}
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return s.modelsListResult(models), nil
+}
+
+// modelsListResult shapes the models.list response.
+func (s *Server) modelsListResult(models []copilot.Model) map[string]any {
+	result := map[string]any{"models": models}
+	if len(s.cfg.ModelAliases) > 0 {
+		result["aliases"] = s.cfg.ModelAliases
+	}
+	return result
+}
+
+func (s *Server) rpcModelsGet(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		Model string `json:"model"`
+	}
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	resolved, _ := s.resolveModel(ctx, p.Model)
+	for _, m := range models {
+		if m.ID == resolved {
+			return m, nil
+		}
+	}
+	return nil, errInvalidParams("unknown model: %s", p.Model)
+}
+
+// deprecationNote returns the warning to surface when the given model is
+// deprecated, or "" when it is not (or the model list cannot be fetched —
+// a warning is not worth failing a create over).
+func (s *Server) deprecationNote(ctx context.Context, model string) string {
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return ""
+	}
+	for _, m := range models {
+		if m.ID == model && m.Deprecated {
+			if m.DeprecationMessage != "" {
+				return m.DeprecationMessage
+			}
+			return fmt.Sprintf("model %s is deprecated and may stop working soon", model)
+		}
+	}
+	return ""
+}
+
+// modelUnavailable classifies a CreateSession failure: when the requested
+// model is absent from the live model list, the failure is a model-access
+// problem rather than an SDK fault, and the caller can fall back or report
+// the models that do exist. A failed listing classifies nothing; the
+// original error stands.
+func (s *Server) modelUnavailable(ctx context.Context, model string) (available []string, missing bool) {
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return nil, false
+	}
+	for _, m := range models {
+		if m.ID == model {
+			return nil, false
+		}
+		available = append(available, m.ID)
+	}
+	return available, true
+}
+
+// listModelsTimeout bounds one model-list fetch, lazy CLI start included:
+// generous enough to cover the full start budget plus the list round trip,
+// so only a genuinely wedged CLI hits it.
+const listModelsTimeout = 60 * time.Second
+
+// listModels fetches the model list, coalescing concurrent callers onto one
+// underlying SDK call: on a cold SDK a burst of models.list requests would
+// otherwise each trigger ensureStarted plus its own CLI round trip. Waiters
+// share the leader's result (and its context); they do not cache it across
+// calls, but the last successful list is kept for rpcModelsList's cold path.
+func (s *Server) listModels(ctx context.Context) ([]copilot.Model, *rpcError) {
+	if s.cfg.Mock {
+		return mockModels(), nil
+	}
+	return s.modelFlight.do(func() ([]copilot.Model, *rpcError) {
+		fetchCtx, cancel := context.WithTimeout(ctx, listModelsTimeout)
+		defer cancel()
+		models, err := s.client.ListModels(fetchCtx)
+		if err != nil {
+			return nil, &rpcError{Code: codeInternalError, Message: "listing models: " + err.Error()}
+		}
+		s.modelsMu.Lock()
+		s.lastModels = models
+		s.modelsMu.Unlock()
+		return models, nil
+	})
+}
+
+// cachedModels returns the most recent successful model list, or nil when
+// none has landed yet.
+func (s *Server) cachedModels() []copilot.Model {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+	return s.lastModels
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// doRPC performs one JSON-RPC call against the server and decodes the
+// response envelope.
+func doRPC(t *testing.T, srv *Server, method string, params any) (json.RawMessage, *rpcError) {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("marshalling params: %v", err)
+	}
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, raw)
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return resp.Result, resp.Error
+}
+
+func TestSessionLifecycleMock(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	if created.SessionID == "" {
+		t.Fatal("session.create returned empty sessionId")
+	}
+
+	result, rpcErr = doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID,
+		"prompt":    "hello",
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var sent struct {
+		StreamURL string `json:"streamUrl"`
+	}
+	if err := json.Unmarshal(result, &sent); err != nil {
+		t.Fatalf("decoding send result: %v", err)
+	}
+	if want := "http://example.com/stream/" + created.SessionID; sent.StreamURL != want {
+		t.Errorf("streamUrl = %q, want %q", sent.StreamURL, want)
+	}
+
+	if _, rpcErr = doRPC(t, srv, "session.close", map[string]any{"sessionId": created.SessionID}); rpcErr != nil {
+		t.Fatalf("session.close: %v", rpcErr)
+	}
+	if _, rpcErr = doRPC(t, srv, "session.info", map[string]any{"sessionId": created.SessionID}); rpcErr == nil {
+		t.Fatal("session.info after close: expected an error")
+	} else if rpcErr.Code != codeInvalidParams {
+		t.Errorf("session.info after close: code = %d, want %d", rpcErr.Code, codeInvalidParams)
+	}
+}
+
+func TestSessionCreateWorkingDir(t *testing.T) {
+	srv := newMockServer(t, nil)
+	dir := t.TempDir()
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"workingDir": dir})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	result, rpcErr = doRPC(t, srv, "session.info", map[string]any{"sessionId": created.SessionID})
+	if rpcErr != nil {
+		t.Fatalf("session.info: %v", rpcErr)
+	}
+	var info struct {
+		WorkingDir string `json:"workingDir"`
+	}
+	if err := json.Unmarshal(result, &info); err != nil {
+		t.Fatalf("decoding info result: %v", err)
+	}
+	if info.WorkingDir != dir {
+		t.Errorf("workingDir = %q, want %q", info.WorkingDir, dir)
+	}
+
+	file := filepath.Join(dir, "not-a-dir")
+	if err := os.WriteFile(file, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{filepath.Join(dir, "missing"), file} {
+		if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"workingDir": bad}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("workingDir %q: got %v, want code %d", bad, rpcErr, codeInvalidParams)
+		}
+	}
+}
+
+func TestSessionCreateWorkspaceRoot(t *testing.T) {
+	root := t.TempDir()
+	inside := filepath.Join(root, "project")
+	if err := os.Mkdir(inside, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	srv := newMockServer(t, func(cfg *Config) { cfg.WorkspaceRoot = root })
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"workingDir": inside}); rpcErr != nil {
+		t.Errorf("workingDir inside root: %v", rpcErr)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"workingDir": outside}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("workingDir outside root: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
+
+func TestSessionCreateTTL(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"ttlSeconds": 120})
+	if rpcErr != nil {
+		t.Fatalf("session.create with ttlSeconds: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if got := srv.Manager().Get(created.SessionID).IdleTTL(); got != 2*time.Minute {
+		t.Errorf("IdleTTL = %v, want 2m", got)
+	}
+	info, rpcErr := doRPC(t, srv, "session.info", map[string]any{"sessionId": created.SessionID})
+	if rpcErr != nil {
+		t.Fatalf("session.info: %v", rpcErr)
+	}
+	var out struct {
+		TTLSeconds int `json:"ttlSeconds"`
+	}
+	if err := json.Unmarshal(info, &out); err != nil {
+		t.Fatalf("decoding info: %v", err)
+	}
+	if out.TTLSeconds != 120 {
+		t.Errorf("ttlSeconds = %d, want 120", out.TTLSeconds)
+	}
+
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"ttlSeconds": -5}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("negative ttlSeconds: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"ttlSeconds": int(25 * time.Hour / time.Second)}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("ttlSeconds above the maximum: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
+
+func TestSessionTouch(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	before := sess.LastActivity()
+	result, rpcErr := doRPC(t, srv, "session.touch", map[string]any{"sessionId": sess.ID})
+	if rpcErr != nil {
+		t.Fatalf("session.touch: %v", rpcErr)
+	}
+	var out struct {
+		LastActivity string `json:"lastActivity"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if out.LastActivity == "" {
+		t.Error("session.touch returned empty lastActivity")
+	}
+	if sess.LastActivity().Before(before) {
+		t.Error("session.touch did not advance LastActivity")
+	}
+	if _, rpcErr := doRPC(t, srv, "session.touch", map[string]any{"sessionId": "nope"}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("unknown session: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
+
+func TestRPCContentType(t *testing.T) {
+	srv := newMockServer(t, nil)
+	body := `{"jsonrpc":"2.0","id":1,"method":"session.list","params":{}}`
+	post := func(contentType string) *rpcError {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader([]byte(body)))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		var resp struct {
+			Error *rpcError `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+		}
+		return resp.Error
+	}
+	for _, ct := range []string{"application/json", "application/json; charset=utf-8", ""} {
+		if rpcErr := post(ct); rpcErr != nil {
+			t.Errorf("Content-Type %q: unexpected error %v", ct, rpcErr)
+		}
+	}
+	for _, ct := range []string{"application/x-www-form-urlencoded", "text/plain", "application/jsonx"} {
+		if rpcErr := post(ct); rpcErr == nil || rpcErr.Code != codeInvalidRequest {
+			t.Errorf("Content-Type %q: got %v, want code %d", ct, rpcErr, codeInvalidRequest)
+		}
+	}
+}
+
+func TestMethodNotFound(t *testing.T) {
+	srv := newMockServer(t, nil)
+	_, rpcErr := doRPC(t, srv, "no.such.method", map[string]any{})
+	if rpcErr == nil || rpcErr.Code != codeMethodNotFound {
+		t.Fatalf("got %v, want code %d", rpcErr, codeMethodNotFound)
+	}
+}
+
+func TestDebugStatsGatedBehindFlag(t *testing.T) {
+	srv := newMockServer(t, nil)
+	req := httptest.NewRequest(http.MethodGet, "/debug/stats", nil)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without --debug: status = %d, want 404", rec.Code)
+	}
+
+	srv = newMockServer(t, func(cfg *Config) { cfg.Debug = true })
+	srv.Manager().Create("gpt-4o", "", "")
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with --debug: status = %d, want 200", rec.Code)
+	}
+	var stats struct {
+		Goroutines   int    `json:"goroutines"`
+		HeapAlloc    uint64 `json:"heapAllocBytes"`
+		OpenSessions int    `json:"openSessions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decoding stats: %v", err)
+	}
+	if stats.Goroutines <= 0 || stats.HeapAlloc == 0 {
+		t.Errorf("implausible runtime stats: %+v", stats)
+	}
+	if stats.OpenSessions != 1 {
+		t.Errorf("openSessions = %d, want 1", stats.OpenSessions)
+	}
+}
+
+func TestAuthTokenRequired(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.AuthToken = "secret" })
+	_, rpcErr := doRPC(t, srv, "session.list", map[string]any{})
+	if rpcErr == nil || rpcErr.Code != codeUnauthorized {
+		t.Fatalf("got %v, want code %d", rpcErr, codeUnauthorized)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// responseFormat is the session.send responseFormat parameter.
+type responseFormat struct {
+	// Type is "text" (default), "json", or "json_schema".
+	Type string `json:"type"`
+	// Schema is required for "json_schema".
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// validateResponseFormat checks a responseFormat param, returning it
+// normalized ("" Type becomes "text").
+func validateResponseFormat(rf *responseFormat) *rpcError {
+	switch rf.Type {
+	case "", "text":
+		rf.Type = "text"
+		if len(rf.Schema) > 0 {
+			return errInvalidParams("responseFormat: schema is only valid with type json_schema")
+		}
+	case "json":
+		if len(rf.Schema) > 0 {
+			return errInvalidParams("responseFormat: schema is only valid with type json_schema")
+		}
+	case "json_schema":
+		if len(rf.Schema) == 0 {
+			return errInvalidParams("responseFormat: type json_schema requires a schema")
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(rf.Schema, &schema); err != nil {
+			return errInvalidParams("responseFormat: invalid schema: %v", err)
+		}
+	default:
+		return errInvalidParams("responseFormat: unknown type %q (want text, json or json_schema)", rf.Type)
+	}
+	return nil
+}
+
+// checkResponseContent validates a completed turn's content against the
+// requested response format. The schema check covers the subset of JSON
+// Schema the plugin actually emits — type, properties, required, items —
+// which is enough to catch the model drifting off-contract; full draft
+// compliance is out of scope for the bridge.
+func checkResponseContent(content string, rf *responseFormat) error {
+	if rf == nil || rf.Type == "text" {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	if rf.Type != "json_schema" {
+		return nil
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(rf.Schema, &schema); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	return validateSchema(value, schema, "$")
+}
+
+// validateSchema checks value against schema, reporting the JSON path of the
+// first mismatch.
+func validateSchema(value any, schema map[string]any, path string) error {
+	if want, ok := schema["type"].(string); ok {
+		if err := checkSchemaType(value, want, path); err != nil {
+			return err
+		}
+	}
+	if obj, ok := value.(map[string]any); ok {
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, present := obj[name]; !present {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+		if props, ok := schema["properties"].(map[string]any); ok {
+			for name, sub := range props {
+				subSchema, ok := sub.(map[string]any)
+				if !ok {
+					continue
+				}
+				if v, present := obj[name]; present {
+					if err := validateSchema(v, subSchema, path+"."+name); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	if arr, ok := value.([]any); ok {
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, v := range arr {
+				if err := validateSchema(v, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkSchemaType(value any, want, path string) error {
+	ok := false
+	switch want {
+	case "object":
+		_, ok = value.(map[string]any)
+	case "array":
+		_, ok = value.([]any)
+	case "string":
+		_, ok = value.(string)
+	case "number":
+		_, ok = value.(float64)
+	case "integer":
+		f, isNum := value.(float64)
+		ok = isNum && f == float64(int64(f))
+	case "boolean":
+		_, ok = value.(bool)
+	case "null":
+		ok = value == nil
+	default:
+		// Unknown type keyword: be permissive rather than reject output the
+		// schema author may have meant differently.
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("%s: expected %s, got %T", path, want, value)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+var sampleSchema = map[string]any{
+	"type":     "object",
+	"required": []string{"title", "tags"},
+	"properties": map[string]any{
+		"title": map[string]any{"type": "string"},
+		"count": map[string]any{"type": "integer"},
+		"tags": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+	},
+}
+
+// sendWithFormat scripts one turn returning content and collects the frames.
+func sendWithFormat(t *testing.T, content string, format map[string]any) []map[string]any {
+	t.Helper()
+	fake := newFakeClient()
+	fake.models = []copilot.Model{{ID: "gpt-4o", Name: "GPT-4o", Default: true, Capabilities: []string{copilot.CapabilityStructuredOutput}}}
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: content})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: content}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":      sess.ID,
+		"prompt":         "structured please",
+		"responseFormat": format,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	return drainFrames(t, sess, 5*time.Second)
+}
+
+func hasValidationError(frames []map[string]any) bool {
+	for _, f := range frames {
+		if f["type"] == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestResponseFormatJSONSchemaValid(t *testing.T) {
+	frames := sendWithFormat(t, `{"title":"x","count":2,"tags":["a","b"]}`,
+		map[string]any{"type": "json_schema", "schema": sampleSchema})
+	if hasValidationError(frames) {
+		t.Errorf("unexpected error frame for conforming content: %v", frames)
+	}
+}
+
+func TestResponseFormatJSONSchemaViolations(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{"not JSON at all", "sure, here is the JSON you asked for"},
+		{"missing required", `{"title":"x"}`},
+		{"wrong property type", `{"title":"x","tags":["a"],"count":1.5}`},
+		{"wrong item type", `{"title":"x","tags":["a",3]}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			frames := sendWithFormat(t, tc.content,
+				map[string]any{"type": "json_schema", "schema": sampleSchema})
+			if !hasValidationError(frames) {
+				t.Errorf("no error frame for %q: %v", tc.content, frames)
+			}
+			if last := frames[len(frames)-1]; last["type"] != "done" {
+				t.Errorf("stream did not end with done: %v", frames)
+			}
+		})
+	}
+}
+
+func TestResponseFormatJSON(t *testing.T) {
+	if frames := sendWithFormat(t, `[1,2,3]`, map[string]any{"type": "json"}); hasValidationError(frames) {
+		t.Errorf("unexpected error frame for valid JSON: %v", frames)
+	}
+	if frames := sendWithFormat(t, `oops`, map[string]any{"type": "json"}); !hasValidationError(frames) {
+		t.Error("no error frame for non-JSON content")
+	}
+}
+
+func TestResponseFormatParamValidation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	for _, format := range []map[string]any{
+		{"type": "yaml"},
+		{"type": "json_schema"},
+		{"type": "json", "schema": sampleSchema},
+	} {
+		if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId":      sess.ID,
+			"prompt":         "hi",
+			"responseFormat": format,
+		}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("format %v: got %v, want code %d", format, rpcErr, codeInvalidParams)
+		}
+	}
+}
+
+func TestResponseFormatCapabilityError(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("claude-sonnet-4", "", "")
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":      sess.ID,
+		"prompt":         "hi",
+		"responseFormat": map[string]any{"type": "json"},
+	})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// handleSendStream serves POST /send-stream: a session.send and its SSE
+// stream on one long-lived connection. The body is the same JSON object
+// session.send takes as params. Because the turn's lifetime is tied to the
+// request, aborting the request cancels the turn — the natural cancellation
+// model for clients that do not want the two-step send-then-attach flow.
+// The tradeoff is resumability: a dropped /send-stream connection cancels
+// the turn, where a dropped /stream reattach would have picked it back up.
+func (s *Server) handleSendStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes))
+	if err != nil {
+		writeSendStreamError(w, http.StatusBadRequest, &rpcError{Code: codeInvalidRequest, Message: "reading body: " + err.Error()})
+		return
+	}
+	var p sessionSendParams
+	if err := json.Unmarshal(body, &p); err != nil {
+		writeSendStreamError(w, http.StatusBadRequest, &rpcError{Code: codeParseError, Message: "parse error: " + err.Error()})
+		return
+	}
+	sess, messageID, rpcErr := s.startSend(r.Context(), p)
+	if rpcErr != nil {
+		status := http.StatusBadRequest
+		switch rpcErr.Code {
+		case codeTurnActive, codeSessionClosed:
+			status = http.StatusConflict
+		case codeServerBusy:
+			status = http.StatusServiceUnavailable
+		}
+		writeSendStreamError(w, status, rpcErr)
+		return
+	}
+	s.metrics.streamsAttached.Add(1)
+	s.metrics.streamsActive.Add(1)
+	defer s.metrics.streamsActive.Add(-1)
+	defer sess.AddSubscriber()()
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	sw := s.newStreamWriter(w)
+	// The first frame carries the messageId that the two-step flow returns
+	// from session.send; it goes to this connection only, not the ring.
+	if err := sw.write("data: %s\n\n", encodeFrame(Frame{Type: "meta", MessageID: messageID})); err != nil {
+		s.streamWriteFailed(sess, err)
+		s.cancelAfterDisconnect(sess)
+		return
+	}
+
+	ctx := r.Context()
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	shutdown := s.shutdownCh
+	for {
+		select {
+		case <-shutdown:
+			if err := sw.write("event: shutdown\ndata: {}\n\n"); err != nil {
+				s.streamWriteFailed(sess, err)
+				s.cancelAfterDisconnect(sess)
+				return
+			}
+			shutdown = nil
+		case frame, ok := <-sess.EventChan:
+			if !ok {
+				_ = sw.write("event: gone\ndata: {}\n\n")
+				return
+			}
+			if err := sw.write("data: %s\n\n", frame); err != nil {
+				// The consumer is gone or stuck; on this endpoint the turn's
+				// lifetime is tied to the connection, so cancel it too.
+				s.streamWriteFailed(sess, err)
+				s.cancelAfterDisconnect(sess)
+				return
+			}
+			// The connection exists for this one turn; done ends it. A
+			// transport-category error ends it too, abnormally: no done is
+			// written on this connection, which is the client's cue to offer
+			// a retry rather than render a model failure (see Frame.Category).
+			if frameType(frame) == "done" || transportError(frame) {
+				return
+			}
+		case <-heartbeat.C:
+			if err := sw.write(": heartbeat\n\n"); err != nil {
+				s.streamWriteFailed(sess, err)
+				s.cancelAfterDisconnect(sess)
+				return
+			}
+		case <-ctx.Done():
+			// The client went away before the turn finished: treat it as a
+			// cancel, exactly as if session.cancel had been called.
+			s.cancelAfterDisconnect(sess)
+			return
+		}
+	}
+}
+
+// cancelAfterDisconnect cancels a turn whose /send-stream consumer is gone.
+// The request context is already dead by the time this runs, so it uses a
+// fresh one.
+func (s *Server) cancelAfterDisconnect(sess *session.Session) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.cancelActiveTurn(ctx, sess, "disconnect"); err != nil {
+		log.Printf("session %s: cancelling after /send-stream disconnect: %v", sess.ID, err)
+	}
+}
+
+// writeSendStreamError reports a pre-stream failure as a plain JSON body.
+// The error object matches the JSON-RPC shape so clients can share decoding
+// with /rpc responses.
+func writeSendStreamError(w http.ResponseWriter, status int, rpcErr *rpcError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]any{"error": rpcErr}); err != nil {
+		log.Printf("send-stream: writing error response: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestSendStreamStreamsOnSameConnection(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	body := []byte(`{"sessionId":"` + sess.ID + `","prompt":"hi"}`)
+	req := httptest.NewRequest(http.MethodPost, "/send-stream", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream (body %q)", ct, rec.Body.String())
+	}
+	var types []string
+	var messageID string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		raw, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var frame struct {
+			Type      string `json:"type"`
+			MessageID string `json:"messageId"`
+		}
+		if err := json.Unmarshal([]byte(raw), &frame); err != nil {
+			t.Fatalf("invalid frame %q: %v", raw, err)
+		}
+		if frame.Type == "meta" && frame.MessageID != "" {
+			messageID = frame.MessageID
+		}
+		types = append(types, frame.Type)
+	}
+	if messageID == "" {
+		t.Error("no meta frame carrying the messageId")
+	}
+	if types[0] != "meta" || types[len(types)-1] != "done" {
+		t.Errorf("frame types = %v, want meta first and done last", types)
+	}
+}
+
+func TestSendStreamRejectsBusySession(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if !sess.BeginTurn() {
+		t.Fatal("claiming the turn slot")
+	}
+	req := httptest.NewRequest(http.MethodPost, "/send-stream",
+		strings.NewReader(`{"sessionId":"`+sess.ID+`","prompt":"hi"}`))
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409 (body %q)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Error *rpcError `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding error body %q: %v", rec.Body.String(), err)
+	}
+	if resp.Error == nil || resp.Error.Code != codeTurnActive {
+		t.Errorf("error = %+v, want code %d", resp.Error, codeTurnActive)
+	}
+}
+
+func TestSendStreamAbortCancelsTurn(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "partial"})
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/send-stream",
+		strings.NewReader(`{"sessionId":"`+sess.ID+`","prompt":"hi"}`))
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /send-stream: %v", err)
+	}
+	// Read until the partial text arrives, proving the turn is in flight,
+	// then drop the connection.
+	buf := make([]byte, 1)
+	var got []byte
+	for !bytes.Contains(got, []byte("partial")) {
+		if _, err := resp.Body.Read(buf); err != nil {
+			t.Fatalf("reading stream: %v (got %q)", err, got)
+		}
+		got = append(got, buf[0])
+	}
+	cancel()
+	resp.Body.Close()
+
+	waitFor(t, 2*time.Second, func() bool { return fake.cancelCalls.Load() == 1 },
+		"dropping the connection never cancelled the SDK message")
+	waitFor(t, 2*time.Second, func() bool { return !sess.TurnActive() },
+		"turn still active after the connection dropped")
+}
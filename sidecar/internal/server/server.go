@@ -0,0 +1,593 @@
+// Package server implements the sidecar's HTTP surface: the JSON-RPC /rpc
+// endpoint the plugin calls, the SSE /stream endpoint it reads events from,
+// and the /health and /metrics endpoints.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/callback"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// Config carries the server's startup configuration from main.
+type Config struct {
+	// AuthToken, when non-empty, is required as a Bearer token on every
+	// request except /health.
+	AuthToken string
+	// Mock serves canned responses instead of talking to the Copilot CLI.
+	Mock bool
+	// MaxBodyBytes caps the size of /rpc and /send-stream request bodies.
+	MaxBodyBytes int64
+	// CORSOrigins lists origins allowed to call the server cross-origin.
+	// Empty means no CORS headers are emitted (same-origin only), which is
+	// the right default for the loopback sidecar case. "*" allows any
+	// origin.
+	CORSOrigins []string
+	// DefaultModel is used when session.create omits a model. It is also
+	// the fallback when a model alias points at a model that no longer
+	// exists.
+	DefaultModel string
+	// ModelAliases maps friendly names (e.g. "fast") to real model IDs,
+	// resolved wherever a model is named. Saved user preferences survive
+	// model ID churn by pointing at an alias instead.
+	ModelAliases map[string]string
+	// WorkspaceRoot, when non-empty, confines session.create workingDir
+	// values to directories under this root.
+	WorkspaceRoot string
+	// AllowedPaths, when non-empty, confines tool file operations to these
+	// roots: a tool call referencing a path outside them is blocked before
+	// it ever reaches the plugin callback.
+	AllowedPaths []string
+	// TranscriptDir, when non-empty, enables per-session JSONL transcripts
+	// written under this directory. Opt-in: transcripts contain prompts and
+	// responses.
+	TranscriptDir string
+	// SendTimeout bounds a single SDK send.
+	SendTimeout time.Duration
+	// StreamWriteTimeout bounds a single SSE write. A client that stops
+	// reading but keeps the connection open would otherwise block the
+	// stream goroutine indefinitely; past the deadline the stream is torn
+	// down and the client must reattach.
+	StreamWriteTimeout time.Duration
+	// MaxTurnDuration is a hard ceiling on total turn duration, tool
+	// execution included. A turn that exceeds it is cancelled with a
+	// {"type":"timeout","stage":"generation"} frame. It is both the default
+	// and the ceiling for the session.create maxTurnSeconds param.
+	MaxTurnDuration time.Duration
+	// MaxSessionTTL caps the per-session ttlSeconds override accepted by
+	// session.create.
+	MaxSessionTTL time.Duration
+	// Coalesce batches consecutive text frames for every session unless
+	// session.create opts out. Sessions can also opt in individually.
+	Coalesce bool
+	// CoalesceWindow is the batching window used when coalescing is on.
+	// Larger windows mean fewer frames but more time-to-first-paint.
+	CoalesceWindow time.Duration
+	// PaceCharsPerSecond, when positive, makes every session release text
+	// at this steady character rate by default instead of in the SDK's
+	// bursts (see pace.go). session.create may override per session. A
+	// session that paces does not coalesce.
+	PaceCharsPerSecond int
+	// MaxToolIterations caps how many tool calls one turn may make. It is
+	// both the default and the ceiling for the session.send
+	// maxToolIterations param.
+	MaxToolIterations int
+	// MaxToolConcurrency is how many parallel-marked tool calls may execute
+	// through the plugin callback at once. Calls the SDK did not mark
+	// parallelizable always run alone, draining any in-flight calls first.
+	// The default 1 keeps all execution serial.
+	MaxToolConcurrency int
+	// SummarizeThreshold, when positive, triggers automatic history
+	// summarization after any turn that leaves more than this many
+	// characters of stored history: everything but the most recent
+	// SummarizeKeepTurns exchanges is folded into a model-written summary.
+	// Zero leaves summarization manual (session.summarize).
+	SummarizeThreshold int
+	// SummarizeKeepTurns is how many recent user/assistant exchanges stay
+	// verbatim when history is summarized.
+	SummarizeKeepTurns int
+	// AllowModelFallback lets session.create fall back to the first model
+	// the account can actually use when the requested (or default) model is
+	// unavailable, instead of failing the create. The session then emits a
+	// model_fallback frame naming both models.
+	AllowModelFallback bool
+	// MaxContextItems caps how many context items one send may attach,
+	// persistent pool included, counted after dedupe. Sends over the cap
+	// are rejected unless they set truncateContext, which instead sheds
+	// the lowest-priority items. Independent of the body-bytes limit.
+	MaxContextItems int
+	// NoSubscriberPauseAfter and NoSubscriberCancelAfter guard against
+	// turns nobody is watching: when no stream subscriber has attached this
+	// long after a turn starts, live delivery pauses and frames buffer into
+	// the ring only; when the longer window also passes without one, the
+	// turn is cancelled to free SDK resources. Zero disables each window;
+	// both are off by default. See abandon.go.
+	NoSubscriberPauseAfter  time.Duration
+	NoSubscriberCancelAfter time.Duration
+	// MaxConcurrentTurns caps how many turns may be generating at once
+	// across all sessions. Per-session serialization already limits each
+	// session to one turn; this is the global ceiling protecting the single
+	// Copilot CLI underneath. A send that finds every slot busy fails with
+	// codeServerBusy unless it sets queueIfBusy, which instead waits up to
+	// turnQueueTimeout for a slot. Zero means no global cap. See turncap.go.
+	MaxConcurrentTurns int
+	// CreateRateLimit caps session.create calls per client (keyed like
+	// file uploads, by remote host) at this many per second, with an equal
+	// burst allowance; over-budget creates fail with codeRateLimited. A
+	// guard against plugin bugs that churn sessions in a tight loop. Zero
+	// means no limit. See ratelimit.go.
+	CreateRateLimit float64
+	// WarmSessions pre-creates this many SDK sessions at startup so the
+	// first session.create skips the CLI cold start. Each warm session
+	// holds CLI resources while it waits; see the README for the tradeoff.
+	WarmSessions int
+	// PromptPrefix and PromptSuffix wrap every user prompt before it reaches
+	// the SDK — a lightweight standing reminder ("respond concisely"),
+	// distinct from a full system prompt. Applied after promptRef expansion;
+	// session.create may override either per session. Joined to the prompt
+	// with single newlines; empty strings add nothing.
+	PromptPrefix string
+	PromptSuffix string
+	// RedactPatterns lists regexes whose matches in outgoing text frames
+	// are replaced with ***REDACTED*** before delivery. Each pattern runs
+	// against every text chunk, so keep the list short and the patterns
+	// simple; see the README for the per-chunk cost.
+	RedactPatterns []string
+	// RedactIgnoreCase makes every redact pattern match case-insensitively.
+	RedactIgnoreCase bool
+	// ModelRoutes lists "pattern=model" routing rules evaluated against the
+	// prompt when a send sets autoRoute, steering matching prompts to the
+	// named model on an ephemeral SDK session. First match wins; no match
+	// keeps the session's own model. See modelroute.go.
+	ModelRoutes []string
+	// VerbosityConciseTokens and VerbosityDetailedTokens are the maxTokens
+	// values the "concise" and "detailed" verbosity levels map to when the
+	// send gives no explicit maxTokens. See verbosity.go for the levels'
+	// standing instructions.
+	VerbosityConciseTokens  int
+	VerbosityDetailedTokens int
+	// TTFTWarnThreshold logs a warning whenever a turn's time-to-first-token
+	// exceeds it, for catching CLI-update regressions in the logs before an
+	// alert on the /metrics histogram fires. Zero disables the warning.
+	TTFTWarnThreshold time.Duration
+	// Debug exposes /debug/stats and the pprof handlers for diagnosing
+	// leaks in long-running sidecars. Off by default.
+	Debug bool
+}
+
+// metrics holds the server's cheap operational counters, rendered by
+// /metrics in Prometheus text format.
+type metrics struct {
+	rpcRequests     atomic.Int64
+	rpcErrors       atomic.Int64
+	sessionsCreated atomic.Int64
+	messagesSent    atomic.Int64
+	streamsAttached atomic.Int64
+	streamsActive   atomic.Int64
+	streamsTimedOut atomic.Int64
+	eventsDropped   atomic.Int64
+	turnsAbandoned  atomic.Int64
+	turnsInFlight   atomic.Int64
+
+	completionTokens    atomic.Int64
+	turnsCompleted      atomic.Int64
+	turnTTFTMsTotal     atomic.Int64
+	turnDurationMsTotal atomic.Int64
+	turnChunksTotal     atomic.Int64
+}
+
+// Server wires the HTTP handlers to the session manager, SDK client and
+// plugin callback client.
+type Server struct {
+	cfg         Config
+	manager     *session.Manager
+	client      copilot.Client
+	callback    *callback.Client
+	mux         *http.ServeMux
+	metrics     metrics
+	ttft        ttftRecorder
+	transcripts *transcripts
+	modelFlight modelFlight
+	warm        *warmPool
+	// redactor rewrites outgoing text content per --redact-pattern; nil
+	// when no patterns are configured.
+	redactor *redactor
+	// router evaluates --route-model rules for autoRoute sends; nil when no
+	// routing policy is configured.
+	router *modelRouter
+	// files holds content uploaded via files.upload for attachment by
+	// handle; see filestore.go.
+	files *fileStore
+	// outbox replays recently completed keyed creates so a retried
+	// session.create never makes a redundant SDK session; see outbox.go.
+	outbox *createOutbox
+	// reloadMu guards the hot-reloadable settings below, the subset of
+	// Config that Reload may replace on a running server (see reload.go).
+	// Read them via their accessors, never the fields or cfg directly.
+	reloadMu  sync.Mutex
+	authToken string
+	// allowedPaths restricts where the agent may read and write; empty
+	// means unrestricted. See paths.go.
+	allowedPaths pathAllowlist
+	// createLimit rate-limits session.create per client; nil when
+	// --create-rate-limit is unset. See ratelimit.go.
+	createLimit *createLimiter
+
+	// defaultMu guards defaultModel, which admin.setDefaultModel may change
+	// at runtime; read it via DefaultModel, never cfg.DefaultModel.
+	defaultMu    sync.Mutex
+	defaultModel string
+
+	// modelsMu guards lastModels, the most recent successful model list.
+	// rpcModelsList serves it to callers that arrive while the CLI is still
+	// starting, instead of blocking them on the start.
+	modelsMu   sync.Mutex
+	lastModels []copilot.Model
+
+	// dedupeMu guards dedupeSends: recently started turns keyed by a hash
+	// of (session, prompt, context), consulted by sends that opt into
+	// de-duplication. See startSend.
+	dedupeMu    sync.Mutex
+	dedupeSends map[string]dedupeSend
+
+	// summarizing holds the IDs of sessions with a history summarization in
+	// flight, so the automatic trigger and session.summarize never run two
+	// at once on one session.
+	summarizing sync.Map
+
+	// turnMu guards turnCancels, the cancel functions of in-flight turn
+	// producers (session.send and session.compare) keyed by session ID.
+	turnMu      sync.Mutex
+	turnCancels map[string]context.CancelFunc
+	// turnSem bounds concurrently generating turns when MaxConcurrentTurns
+	// is set; nil means no global cap. See turncap.go.
+	turnSem chan struct{}
+	// turnWG counts in-flight turn producers so Drain can wait for
+	// generations to finish instead of abandoning them at shutdown.
+	turnWG       sync.WaitGroup
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+}
+
+// New constructs a Server. client may be nil in mock mode. It fails when a
+// configured allowed path cannot be resolved, since silently dropping an
+// allowlist entry would change what the agent may touch.
+func New(cfg Config, manager *session.Manager, client copilot.Client, cb *callback.Client) (*Server, error) {
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 10 << 20
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = 5 * time.Minute
+	}
+	if cfg.StreamWriteTimeout <= 0 {
+		cfg.StreamWriteTimeout = 30 * time.Second
+	}
+	if cfg.MaxTurnDuration <= 0 {
+		cfg.MaxTurnDuration = 10 * time.Minute
+	}
+	if cfg.MaxSessionTTL <= 0 {
+		cfg.MaxSessionTTL = 24 * time.Hour
+	}
+	if cfg.CoalesceWindow <= 0 {
+		cfg.CoalesceWindow = 30 * time.Millisecond
+	}
+	if cfg.MaxToolConcurrency <= 0 {
+		cfg.MaxToolConcurrency = 1
+	}
+	if cfg.MaxToolIterations <= 0 {
+		cfg.MaxToolIterations = 32
+	}
+	if cfg.MaxContextItems <= 0 {
+		cfg.MaxContextItems = 64
+	}
+	if cfg.SummarizeKeepTurns <= 0 {
+		cfg.SummarizeKeepTurns = 4
+	}
+	if cfg.VerbosityConciseTokens <= 0 {
+		cfg.VerbosityConciseTokens = defaultConciseTokens
+	}
+	if cfg.VerbosityDetailedTokens <= 0 {
+		cfg.VerbosityDetailedTokens = defaultDetailedTokens
+	}
+	allowedPaths, err := newPathAllowlist(cfg.AllowedPaths)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		cfg:         cfg,
+		manager:     manager,
+		client:      client,
+		callback:    cb,
+		dedupeSends: make(map[string]dedupeSend),
+		turnCancels: make(map[string]context.CancelFunc),
+		shutdownCh:  make(chan struct{}),
+	}
+	if cfg.MaxConcurrentTurns > 0 {
+		s.turnSem = make(chan struct{}, cfg.MaxConcurrentTurns)
+	}
+	s.defaultModel = cfg.DefaultModel
+	s.authToken = cfg.AuthToken
+	s.allowedPaths = allowedPaths
+	s.redactor, err = newRedactor(cfg.RedactPatterns, cfg.RedactIgnoreCase)
+	if err != nil {
+		return nil, err
+	}
+	s.router, err = newModelRouter(cfg.ModelRoutes)
+	if err != nil {
+		return nil, err
+	}
+	s.transcripts = newTranscripts(cfg.TranscriptDir)
+	s.files = newFileStore()
+	s.outbox = newCreateOutbox()
+	s.createLimit = newCreateLimiter(cfg.CreateRateLimit)
+	if cfg.WarmSessions > 0 && !cfg.Mock && client != nil {
+		s.warm = newWarmPool(client, cfg.DefaultModel, cfg.WarmSessions)
+		s.warm.start()
+	}
+	manager.OnEvict(func(sess *session.Session) {
+		s.transcripts.closeSession(sess.ID)
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rpc", s.handleRPC)
+	mux.HandleFunc("/stream/", s.handleStream)
+	mux.HandleFunc("/send-stream", s.handleSendStream)
+	mux.HandleFunc("/poll/", s.handlePoll)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/livez", s.handleLivez)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	if cfg.Debug {
+		mux.HandleFunc("/debug/stats", s.handleDebugStats)
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	s.mux = mux
+	return s, nil
+}
+
+// Handler returns the root handler with middleware applied.
+func (s *Server) Handler() http.Handler {
+	return s.withCORS(s.mux)
+}
+
+// Manager returns the server's session manager.
+func (s *Server) Manager() *session.Manager {
+	return s.manager
+}
+
+// DefaultModel returns the model used when session.create omits one. It
+// starts as Config.DefaultModel and may be changed at runtime by
+// admin.setDefaultModel.
+func (s *Server) DefaultModel() string {
+	s.defaultMu.Lock()
+	defer s.defaultMu.Unlock()
+	return s.defaultModel
+}
+
+// setDefaultModel swaps the default model and returns the previous value.
+// Existing sessions keep their model; only new creates see the change.
+func (s *Server) setDefaultModel(model string) string {
+	s.defaultMu.Lock()
+	defer s.defaultMu.Unlock()
+	old := s.defaultModel
+	s.defaultModel = model
+	return old
+}
+
+// Close releases server-held resources (open transcript files, the warm
+// session pool). It does not touch sessions or the SDK client; main tears
+// those down separately.
+func (s *Server) Close() {
+	s.transcripts.closeAll()
+	if s.warm != nil {
+		s.warm.close()
+	}
+}
+
+// goTurn runs a turn producer in a goroutine tracked by the drain WaitGroup.
+// Every background producer that writes to a session's EventChan must go
+// through here or Drain cannot account for it.
+func (s *Server) goTurn(f func()) {
+	s.turnWG.Add(1)
+	go func() {
+		defer s.turnWG.Done()
+		f()
+	}()
+}
+
+// registerTurnCancel records a turn's cancel function so session.cancel and
+// Drain can tear it down. The returned func deregisters it; callers defer it.
+func (s *Server) registerTurnCancel(sessionID string, cancel context.CancelFunc) func() {
+	s.turnMu.Lock()
+	s.turnCancels[sessionID] = cancel
+	s.turnMu.Unlock()
+	return func() {
+		s.turnMu.Lock()
+		delete(s.turnCancels, sessionID)
+		s.turnMu.Unlock()
+	}
+}
+
+// cancelTurnCtx cancels the context of the in-flight turn on a session, if
+// any. For compare turns this tears down every sub-session's send.
+func (s *Server) cancelTurnCtx(sessionID string) {
+	s.turnMu.Lock()
+	cancel := s.turnCancels[sessionID]
+	s.turnMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Drain announces shutdown to attached streams and waits up to grace for
+// in-flight turns to finish. Turns still running when the grace period
+// expires are cancelled and briefly waited for again. It reports whether all
+// turns completed. Call after httpServer.Shutdown and before stopping the
+// SDK client, so draining turns still have a working SDK underneath them.
+func (s *Server) Drain(grace time.Duration) bool {
+	s.shutdownOnce.Do(func() { close(s.shutdownCh) })
+	done := make(chan struct{})
+	go func() {
+		s.turnWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(grace):
+	}
+	s.turnMu.Lock()
+	for id, cancel := range s.turnCancels {
+		// The client deserves to know this was the server draining, not a
+		// fault: mark the turn cancelled with the shutdown reason first.
+		if sess := s.manager.Get(id); sess != nil {
+			s.markTurnCancelled(sess, "shutdown")
+		}
+		cancel()
+	}
+	s.turnMu.Unlock()
+	select {
+	case <-done:
+		return true
+	case <-time.After(5 * time.Second):
+		log.Printf("server: turns still in flight after drain grace and cancel")
+		return false
+	}
+}
+
+// withCORS applies the configured CORS policy. With no configured origins it
+// is a pass-through: no Access-Control headers are ever emitted and browsers
+// enforce same-origin, which keeps the default loopback deployment locked
+// down. Preflight OPTIONS requests are answered here and never reach the
+// handlers.
+func (s *Server) withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(s.cfg.CORSOrigins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !s.originAllowed(origin) {
+			// A disallowed cross-origin request gets no CORS headers;
+			// the browser blocks the response. Preflights are refused
+			// outright so the real request is never sent.
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		if r.Method == http.MethodOptions {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) originAllowed(origin string) bool {
+	for _, allowed := range s.cfg.CORSOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized checks the Bearer token when one is configured.
+func (s *Server) authorized(r *http.Request) bool {
+	token := s.bearerToken()
+	if token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	return strings.HasPrefix(auth, prefix) && auth[len(prefix):] == token
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok","sessions":%d}`+"\n", s.manager.Len())
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "sidecar_rpc_requests_total %d\n", s.metrics.rpcRequests.Load())
+	fmt.Fprintf(w, "sidecar_rpc_errors_total %d\n", s.metrics.rpcErrors.Load())
+	fmt.Fprintf(w, "sidecar_sessions_created_total %d\n", s.metrics.sessionsCreated.Load())
+	byModel := s.manager.CreatedByModel()
+	models := make([]string, 0, len(byModel))
+	for model := range byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		fmt.Fprintf(w, "sidecar_sessions_created_by_model_total{model=%q} %d\n", model, byModel[model])
+	}
+	fmt.Fprintf(w, "sidecar_sessions_active %d\n", s.manager.Len())
+	fmt.Fprintf(w, "sidecar_messages_sent_total %d\n", s.metrics.messagesSent.Load())
+	fmt.Fprintf(w, "sidecar_streams_attached_total %d\n", s.metrics.streamsAttached.Load())
+	fmt.Fprintf(w, "sidecar_streams_timed_out_total %d\n", s.metrics.streamsTimedOut.Load())
+	fmt.Fprintf(w, "sidecar_events_dropped_total %d\n", s.metrics.eventsDropped.Load())
+	fmt.Fprintf(w, "sidecar_turns_abandoned_total %d\n", s.metrics.turnsAbandoned.Load())
+	fmt.Fprintf(w, "sidecar_turns_in_flight %d\n", s.metrics.turnsInFlight.Load())
+	fmt.Fprintf(w, "sidecar_turns_completed_total %d\n", s.metrics.turnsCompleted.Load())
+	fmt.Fprintf(w, "sidecar_turn_ttft_ms_total %d\n", s.metrics.turnTTFTMsTotal.Load())
+	s.ttft.writeMetrics(w)
+	fmt.Fprintf(w, "sidecar_turn_duration_ms_total %d\n", s.metrics.turnDurationMsTotal.Load())
+	fmt.Fprintf(w, "sidecar_turn_chunks_total %d\n", s.metrics.turnChunksTotal.Load())
+	fmt.Fprintf(w, "sidecar_completion_tokens_total %d\n", s.metrics.completionTokens.Load())
+	if c, ok := s.client.(orphanReporter); ok {
+		fmt.Fprintf(w, "sidecar_orphan_events_total %d\n", c.OrphanEvents())
+	}
+}
+
+// handleDebugStats reports Go runtime numbers useful for confirming or
+// ruling out a suspected leak (e.g. EventChan producer goroutines) without
+// attaching a debugger.
+func (s *Server) handleDebugStats(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"goroutines":     runtime.NumGoroutine(),
+		"heapAllocBytes": mem.HeapAlloc,
+		"heapObjects":    mem.HeapObjects,
+		"numGC":          mem.NumGC,
+		"openSessions":   s.manager.Len(),
+		"openStreams":    s.metrics.streamsActive.Load(),
+	}); err != nil {
+		log.Printf("debug/stats: writing response: %v", err)
+	}
+}
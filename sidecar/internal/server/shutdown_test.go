@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestDrainWaitsForInFlightTurn(t *testing.T) {
+	release := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "partial"})
+		<-release
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "partial done"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "slow one",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+	if !srv.Drain(5 * time.Second) {
+		t.Fatal("Drain reported turns left in flight")
+	}
+	// The turn finished during the grace period, so its assistant reply made
+	// it into history rather than being abandoned.
+	history := sess.History()
+	if len(history) != 2 || history[1].Role != "assistant" {
+		t.Errorf("history after drain = %+v, want user + assistant", history)
+	}
+}
+
+func TestDrainCancelsOverdueTurns(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "never finishes",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	if !srv.Drain(50 * time.Millisecond) {
+		t.Fatal("Drain did not terminate the stuck turn by cancelling it")
+	}
+}
+
+func TestStreamAnnouncesShutdown(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/stream/"+sess.ID, nil)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("attaching stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	srv.Drain(time.Second)
+	scanner := bufio.NewScanner(resp.Body)
+	deadline := time.AfterFunc(5*time.Second, func() { resp.Body.Close() })
+	defer deadline.Stop()
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "event: shutdown" {
+			return
+		}
+	}
+	t.Fatal("stream never announced shutdown")
+}
+
+func TestDrainLeavesNoTurnGoroutines(t *testing.T) {
+	fake := newFakeClient()
+	srv, _ := newFakeServer(t, fake, nil)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+		if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": sess.ID,
+			"prompt":    "quick",
+		}); rpcErr != nil {
+			t.Fatalf("session.send: %v", rpcErr)
+		}
+	}
+	if !srv.Drain(5 * time.Second) {
+		t.Fatal("Drain reported turns left in flight")
+	}
+	// Goroutine counts are noisy (test runner, finalizers); poll briefly and
+	// allow a small margin rather than demanding an exact match.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if n := runtime.NumGoroutine(); n <= before+2 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines = %d after drain, started with %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// modelFlight coalesces concurrent model-list fetches: while one underlying
+// ListModels call is in flight, further callers wait for it and share its
+// result instead of multiplying load on a cold CLI. It deliberately does not
+// cache: once the flight lands, the next caller fetches fresh.
+type modelFlight struct {
+	mu     sync.Mutex
+	flight *modelFetch
+}
+
+type modelFetch struct {
+	done   chan struct{}
+	models []copilot.Model
+	err    *rpcError
+}
+
+// do returns the result of fetch, sharing an in-flight call when one exists.
+func (f *modelFlight) do(fetch func() ([]copilot.Model, *rpcError)) ([]copilot.Model, *rpcError) {
+	f.mu.Lock()
+	if c := f.flight; c != nil {
+		f.mu.Unlock()
+		<-c.done
+		return c.models, c.err
+	}
+	c := &modelFetch{done: make(chan struct{})}
+	f.flight = c
+	f.mu.Unlock()
+
+	c.models, c.err = fetch()
+
+	f.mu.Lock()
+	f.flight = nil
+	f.mu.Unlock()
+	close(c.done)
+	return c.models, c.err
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// TestModelsListCoalesced holds one models.list fetch open, piles more
+// callers on top of it, and asserts they all share the single underlying
+// call. Run with -race.
+func TestModelsListCoalesced(t *testing.T) {
+	release := make(chan struct{})
+	fake := newFakeClient()
+	fake.list = func(ctx context.Context) ([]copilot.Model, error) {
+		<-release
+		return fake.models, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+
+	var wg sync.WaitGroup
+	call := func() {
+		defer wg.Done()
+		if _, rpcErr := doRPC(t, srv, "models.list", nil); rpcErr != nil {
+			t.Errorf("models.list: %v", rpcErr)
+		}
+	}
+	wg.Add(1)
+	go call()
+	// Wait for the leader to be inside the blocked fetch, then pile on: as
+	// long as the flight is open every new caller must join it.
+	deadline := time.Now().Add(2 * time.Second)
+	for fake.listCalls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("leader never reached ListModels")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 19; i++ {
+		wg.Add(1)
+		go call()
+	}
+	// Let the stragglers reach the flight before it lands.
+	time.Sleep(250 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := fake.listCalls.Load(); got != 1 {
+		t.Errorf("underlying ListModels calls = %d, want 1", got)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// snapshotVersion is bumped whenever the snapshot shape changes
+// incompatibly, so a restore can reject a dump from a different sidecar
+// generation instead of misreading it.
+const snapshotVersion = 1
+
+// rpcAdminSnapshot serializes every live session's durable state — identity,
+// settings, conversation history — into one transportable JSON document, for
+// fast restarts during development and for migrating sessions between hosts.
+// Live machinery does not survive a snapshot: in-flight turns, stream
+// subscribers and poll ring contents are simply absent, and the SDK session
+// IDs included are only meaningful on the host that took the dump. Like
+// inspectSession it is debug-gated, since the dump carries full conversation
+// content.
+func (s *Server) rpcAdminSnapshot(ctx context.Context) (any, *rpcError) {
+	if !s.cfg.Debug {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: admin.snapshot"}
+	}
+	sessions := s.manager.List()
+	snaps := make([]session.Snapshot, 0, len(sessions))
+	for _, sess := range sessions {
+		snaps = append(snaps, sess.Snapshot())
+	}
+	return map[string]any{
+		"version":  snapshotVersion,
+		"takenAt":  time.Now().Format(time.RFC3339),
+		"sessions": snaps,
+	}, nil
+}
+
+type adminRestoreParams struct {
+	Version  int                `json:"version"`
+	Sessions []session.Snapshot `json:"sessions"`
+}
+
+// rpcAdminRestore rebuilds the session manager from an admin.snapshot dump,
+// re-creating an SDK session for each entry so restored sessions can take
+// turns again. The bridge-side record comes back whole — ID, history, export
+// and retry all work — but the SDK session is brand new: the model starts
+// with no memory of the conversation, and a custom system prompt (never
+// stored bridge-side) is gone for good. Sessions whose ID is already live are
+// skipped, and a failed SDK create fails only that entry, so a partial
+// restore lands as much as it can.
+func (s *Server) rpcAdminRestore(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	if !s.cfg.Debug {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: admin.restore"}
+	}
+	var p adminRestoreParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Version != snapshotVersion {
+		return nil, errInvalidParams("unsupported snapshot version %d (want %d)", p.Version, snapshotVersion)
+	}
+	restored := 0
+	skipped := []string{}
+	failed := map[string]string{}
+	for _, snap := range p.Sessions {
+		if snap.ID == "" {
+			failed[""] = "snapshot entry has no session ID"
+			continue
+		}
+		if s.manager.Get(snap.ID) != nil {
+			skipped = append(skipped, snap.ID)
+			continue
+		}
+		sdkID := ""
+		if !s.cfg.Mock {
+			id, err := s.client.CreateSession(ctx, copilot.SessionConfig{
+				Model:      snap.Model,
+				WorkingDir: snap.WorkingDir,
+			})
+			if err != nil {
+				failed[snap.ID] = "creating SDK session: " + err.Error()
+				continue
+			}
+			sdkID = id
+		}
+		if _, err := s.manager.RestoreSession(snap, sdkID); err != nil {
+			// Lost the race with a concurrent create; the fresh SDK session
+			// is now redundant.
+			if sdkID != "" {
+				_ = s.client.DestroySession(ctx, sdkID)
+			}
+			skipped = append(skipped, snap.ID)
+			continue
+		}
+		restored++
+	}
+	return map[string]any{
+		"restored": restored,
+		"skipped":  skipped,
+		"failed":   failed,
+	}, nil
+}
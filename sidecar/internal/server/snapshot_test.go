@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	srvA, _ := newFakeServer(t, newFakeClient(), func(cfg *Config) { cfg.Debug = true })
+	sess, _ := srvA.Manager().Create("gpt-4o", "sdk-1", "")
+	sess.SetWorkingDir("/tmp/project")
+	sess.SetLocale("de-DE")
+	sess.SetThinking(true)
+	sess.AppendUserMessage("msg-1", "what is a mutex?", nil)
+	sess.AppendHistory("assistant", "A mutual exclusion lock.")
+
+	result, rpcErr := doRPC(t, srvA, "admin.snapshot", nil)
+	if rpcErr != nil {
+		t.Fatalf("admin.snapshot: %v", rpcErr)
+	}
+	var dump struct {
+		Version  int               `json:"version"`
+		Sessions []json.RawMessage `json:"sessions"`
+	}
+	if err := json.Unmarshal(result, &dump); err != nil {
+		t.Fatalf("decoding snapshot: %v", err)
+	}
+	if dump.Version != snapshotVersion || len(dump.Sessions) != 1 {
+		t.Fatalf("snapshot = version %d with %d sessions, want version %d with 1", dump.Version, len(dump.Sessions), snapshotVersion)
+	}
+
+	// Restore into a second server, as after a restart or on another host.
+	fakeB := newFakeClient()
+	var gotCfg copilot.SessionConfig
+	fakeB.create = func(ctx context.Context, cfg copilot.SessionConfig) (string, error) {
+		gotCfg = cfg
+		return "sdk-fresh", nil
+	}
+	fakeB.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "still here"})
+		return &copilot.MessageResponse{Content: "still here", FinishReason: "stop"}, nil
+	}
+	srvB, _ := newFakeServer(t, fakeB, func(cfg *Config) { cfg.Debug = true })
+	restoreResult, rpcErr := doRPC(t, srvB, "admin.restore", map[string]any{
+		"version":  dump.Version,
+		"sessions": dump.Sessions,
+	})
+	if rpcErr != nil {
+		t.Fatalf("admin.restore: %v", rpcErr)
+	}
+	var rr struct {
+		Restored int               `json:"restored"`
+		Skipped  []string          `json:"skipped"`
+		Failed   map[string]string `json:"failed"`
+	}
+	if err := json.Unmarshal(restoreResult, &rr); err != nil {
+		t.Fatalf("decoding restore result: %v", err)
+	}
+	if rr.Restored != 1 || len(rr.Skipped) != 0 || len(rr.Failed) != 0 {
+		t.Fatalf("restore result = %+v, want exactly one restored", rr)
+	}
+	got := srvB.Manager().Get(sess.ID)
+	if got == nil {
+		t.Fatal("restored session not found under its original ID")
+	}
+	if got.Model != "gpt-4o" || got.SDKID != "sdk-fresh" {
+		t.Errorf("restored session = model %q sdk %q, want gpt-4o on the fresh SDK session", got.Model, got.SDKID)
+	}
+	if got.WorkingDir() != "/tmp/project" || got.Locale() != "de-DE" || !got.Thinking() {
+		t.Errorf("settings not restored: dir=%q locale=%q thinking=%v", got.WorkingDir(), got.Locale(), got.Thinking())
+	}
+	if gotCfg.Model != "gpt-4o" || gotCfg.WorkingDir != "/tmp/project" {
+		t.Errorf("SDK session created with %+v, want the snapshot's model and workingDir", gotCfg)
+	}
+	hist := got.History()
+	if len(hist) != 2 || hist[0].Content != "what is a mutex?" || hist[1].Content != "A mutual exclusion lock." {
+		t.Fatalf("history not restored: %+v", hist)
+	}
+	// The restored session takes turns like any other.
+	if _, rpcErr := doRPC(t, srvB, "session.send", map[string]any{
+		"sessionId": got.ID, "prompt": "still with me?",
+	}); rpcErr != nil {
+		t.Fatalf("session.send after restore: %v", rpcErr)
+	}
+	sawDone := false
+	for _, f := range drainFrames(t, got, 5*time.Second) {
+		if f["type"] == "done" {
+			sawDone = true
+		}
+	}
+	if !sawDone {
+		t.Error("no done frame on a turn after restore")
+	}
+}
+
+func TestRestoreSkipsLiveSessionsAndChecksVersion(t *testing.T) {
+	srv, _ := newFakeServer(t, newFakeClient(), func(cfg *Config) { cfg.Debug = true })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	result, rpcErr := doRPC(t, srv, "admin.snapshot", nil)
+	if rpcErr != nil {
+		t.Fatalf("admin.snapshot: %v", rpcErr)
+	}
+	var dump map[string]json.RawMessage
+	if err := json.Unmarshal(result, &dump); err != nil {
+		t.Fatalf("decoding snapshot: %v", err)
+	}
+
+	// Restoring into the server that took the snapshot skips the live session.
+	restoreResult, rpcErr := doRPC(t, srv, "admin.restore", map[string]any{
+		"version":  snapshotVersion,
+		"sessions": dump["sessions"],
+	})
+	if rpcErr != nil {
+		t.Fatalf("admin.restore: %v", rpcErr)
+	}
+	var rr struct {
+		Restored int      `json:"restored"`
+		Skipped  []string `json:"skipped"`
+	}
+	if err := json.Unmarshal(restoreResult, &rr); err != nil {
+		t.Fatalf("decoding restore result: %v", err)
+	}
+	if rr.Restored != 0 || len(rr.Skipped) != 1 || rr.Skipped[0] != sess.ID {
+		t.Errorf("restore over a live session = %+v, want it skipped", rr)
+	}
+
+	if _, rpcErr := doRPC(t, srv, "admin.restore", map[string]any{
+		"version": snapshotVersion + 1, "sessions": []any{},
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("mismatched version: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
+
+func TestSnapshotRestoreDebugGated(t *testing.T) {
+	srv := newMockServer(t, nil)
+	for _, method := range []string{"admin.snapshot", "admin.restore"} {
+		if _, rpcErr := doRPC(t, srv, method, nil); rpcErr == nil || rpcErr.Code != codeMethodNotFound {
+			t.Errorf("%s without --debug: got %v, want code %d", method, rpcErr, codeMethodNotFound)
+		}
+	}
+}
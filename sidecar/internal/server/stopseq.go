@@ -0,0 +1,117 @@
+package server
+
+import "strings"
+
+// Stop sequences: session.send may name delimiters at which generation
+// halts, for extraction tasks that want everything up to a marker and
+// nothing after. The sequences ride into the SDK request for models that
+// stop natively; because the bridge cannot know whether the SDK honored
+// them, a stopDetector also watches the assembled text stream and, the
+// moment a sequence completes, stops forwarding and cancels the SDK turn.
+// Either way the turn's finishReason is "stop_sequence". A sequence the SDK
+// already stopped at simply never appears in the stream, and the detector
+// stands idle.
+
+const (
+	maxStopSequences   = 4
+	maxStopSequenceLen = 64
+)
+
+// validateStopSequences bounds the count and length of stop sequences.
+func validateStopSequences(seqs []string) *rpcError {
+	if len(seqs) > maxStopSequences {
+		return errInvalidParams("%d stop sequences exceed the limit of %d", len(seqs), maxStopSequences)
+	}
+	for _, seq := range seqs {
+		if seq == "" {
+			return errInvalidParams("stop sequences must not be empty")
+		}
+		if len(seq) > maxStopSequenceLen {
+			return errInvalidParams("stop sequence %q exceeds %d bytes", seq, maxStopSequenceLen)
+		}
+	}
+	return nil
+}
+
+// stopDetector watches the text stream for a completed stop sequence. Like
+// the UTF-8 assembler, it holds back a trailing fragment — here, anything
+// that could still grow into a sequence — so a delimiter the SDK splits
+// across chunks is caught whole and its prefix never leaks to clients.
+type stopDetector struct {
+	sequences []string
+	// pending is held-back text: a suffix of the stream that is a prefix of
+	// some sequence. Forwarded by flush if the sequence never completes.
+	pending string
+	// out accumulates everything forwarded, for history: the SDK's final
+	// response content includes text past the sequence that clients never
+	// saw, so it cannot be stored as-is.
+	out strings.Builder
+	hit bool
+	// cancelled dedupes the turn-context cancel, since text events keep
+	// arriving until the SDK call unwinds.
+	cancelled bool
+}
+
+func newStopDetector(sequences []string) *stopDetector {
+	return &stopDetector{sequences: sequences}
+}
+
+// feed consumes one text chunk and returns the part to forward. hit flips
+// true (permanently) when a stop sequence completes; the sequence itself
+// and anything after it are never forwarded.
+func (d *stopDetector) feed(chunk string) (forward string, hit bool) {
+	if d.hit {
+		return "", true
+	}
+	buf := d.pending + chunk
+	cut := -1
+	for _, seq := range d.sequences {
+		if i := strings.Index(buf, seq); i >= 0 && (cut < 0 || i < cut) {
+			cut = i
+		}
+	}
+	if cut >= 0 {
+		d.hit = true
+		d.pending = ""
+		forward = buf[:cut]
+		d.out.WriteString(forward)
+		return forward, true
+	}
+	hold := d.holdback(buf)
+	forward = buf[:len(buf)-hold]
+	d.pending = buf[len(buf)-hold:]
+	d.out.WriteString(forward)
+	return forward, false
+}
+
+// holdback returns how many trailing bytes of buf could still be the start
+// of a stop sequence and must not be forwarded yet.
+func (d *stopDetector) holdback(buf string) int {
+	max := maxStopSequenceLen - 1
+	if len(buf) < max {
+		max = len(buf)
+	}
+	for hold := max; hold > 0; hold-- {
+		tail := buf[len(buf)-hold:]
+		for _, seq := range d.sequences {
+			if strings.HasPrefix(seq, tail) {
+				return hold
+			}
+		}
+	}
+	return 0
+}
+
+// flush releases the held-back fragment at end of turn: it looked like the
+// start of a sequence that never completed, so clients get it after all.
+func (d *stopDetector) flush() string {
+	rest := d.pending
+	d.pending = ""
+	d.out.WriteString(rest)
+	return rest
+}
+
+// text returns everything the detector forwarded, flush included.
+func (d *stopDetector) text() string {
+	return d.out.String()
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestStopDetectorSplitAcrossChunks(t *testing.T) {
+	d := newStopDetector([]string{"END"})
+	forward, hit := d.feed("Hello, EN")
+	if forward != "Hello, " || hit {
+		t.Errorf(`feed 1 = (%q, %v), want ("Hello, ", false)`, forward, hit)
+	}
+	forward, hit = d.feed("D and this is never seen")
+	if forward != "" || !hit {
+		t.Errorf(`feed 2 = (%q, %v), want ("", true)`, forward, hit)
+	}
+	if got := d.text(); got != "Hello, " {
+		t.Errorf("text() = %q, want the clipped output", got)
+	}
+}
+
+func TestStopDetectorFalseAlarmFlushes(t *testing.T) {
+	d := newStopDetector([]string{"END"})
+	forward, _ := d.feed("the EN")
+	forward2, _ := d.feed("GINE runs")
+	if got := forward + forward2; got != "the ENGINE runs" {
+		t.Errorf("forwarded %q, want the full text once the prefix stopped matching", got)
+	}
+	d = newStopDetector([]string{"END"})
+	d.feed("trailing EN")
+	if rest := d.flush(); rest != "EN" {
+		t.Errorf("flush() = %q, want the held-back fragment", rest)
+	}
+}
+
+func TestStopSequenceValidation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	id := createSessionID(t, srv)
+	for _, seqs := range [][]string{
+		{"a", "b", "c", "d", "e"},
+		{""},
+		{strings.Repeat("x", maxStopSequenceLen+1)},
+	} {
+		_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": id, "prompt": "hi", "stopSequences": seqs,
+		})
+		if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("stopSequences %q: got %v, want code %d", seqs, rpcErr, codeInvalidParams)
+		}
+	}
+}
+
+func TestStopSequenceFallbackClipsAndCancels(t *testing.T) {
+	var gotReq copilot.MessageRequest
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		gotReq = req
+		onEvent(copilot.StreamEvent{Type: "text", Content: "answer: 42\nEND\nnever deliver this"})
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "extract", "stopSequences": []string{"END"},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	var text strings.Builder
+	finishReason := ""
+	for _, f := range frames {
+		switch f["type"] {
+		case "text":
+			content, _ := f["content"].(string)
+			text.WriteString(content)
+		case "done":
+			finishReason, _ = f["finishReason"].(string)
+		case "error", "cancelled":
+			t.Errorf("unexpected %v frame: %v", f["type"], f)
+		}
+	}
+	if text.String() != "answer: 42\n" {
+		t.Errorf("delivered text = %q, want it clipped at the sequence", text.String())
+	}
+	if finishReason != "stop_sequence" {
+		t.Errorf("finishReason = %q, want stop_sequence", finishReason)
+	}
+	if len(gotReq.StopSequences) != 1 || gotReq.StopSequences[0] != "END" {
+		t.Errorf("SDK request stopSequences = %v, want the sequences passed through", gotReq.StopSequences)
+	}
+	if got := sess.History(); len(got) == 0 || got[len(got)-1].Content != "answer: 42\n" {
+		t.Errorf("history = %+v, want the clipped assistant text", got)
+	}
+}
+
+func TestStopSequenceNativeFinish(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		// An SDK that honors stopSequences itself: the stream never contains
+		// the delimiter and the response reports the stop.
+		onEvent(copilot.StreamEvent{Type: "text", Content: "answer: 42\n"})
+		return &copilot.MessageResponse{Content: "answer: 42\n", FinishReason: "stop_sequence"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "extract", "stopSequences": []string{"END"},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	finishReason := ""
+	for _, f := range drainFrames(t, sess, 5*time.Second) {
+		if f["type"] == "done" {
+			finishReason, _ = f["finishReason"].(string)
+		}
+	}
+	if finishReason != "stop_sequence" {
+		t.Errorf("finishReason = %q, want stop_sequence", finishReason)
+	}
+}
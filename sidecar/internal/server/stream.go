@@ -0,0 +1,1547 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/callback"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+type sessionSendParams struct {
+	SessionID string `json:"sessionId"`
+	Prompt    string `json:"prompt"`
+	// PromptRef names a file to read the prompt from instead of inlining it,
+	// for generated prompts too large to carry comfortably in the JSON-RPC
+	// body. Exactly one of prompt and promptRef may be set. The file is
+	// subject to the path allowlist and the max prompt size.
+	PromptRef   string                `json:"promptRef,omitempty"`
+	Context     []copilot.ContextItem `json:"context,omitempty"`
+	MaxTokens   int                   `json:"maxTokens,omitempty"`
+	Temperature float64               `json:"temperature,omitempty"`
+	// AutoApprove names tools that may run without the plugin confirming
+	// with the user first. Everything else goes through the callback's
+	// approval flow. Listing a tool here trades safety for speed: the user
+	// never sees the call before it runs, so only name tools that cannot
+	// mutate state (e.g. read-only file reads).
+	AutoApprove []string `json:"autoApprove,omitempty"`
+	// DedupeContext removes context items that repeat an identical
+	// (file, startLine, endLine) range, keeping the first occurrence.
+	// Defaults to on; overlapping-but-different ranges are never merged.
+	DedupeContext *bool `json:"dedupeContext,omitempty"`
+	// ResponseFormat constrains the model's output; see responseFormat.
+	// Content that fails server-side validation yields an error frame
+	// before done.
+	ResponseFormat *responseFormat `json:"responseFormat,omitempty"`
+	// Continue resumes the previous response after it was truncated by the
+	// token limit (done frame carried finishReason "length"). It takes no
+	// prompt; the continued content extends the previous assistant message
+	// in history rather than starting a new one.
+	Continue bool `json:"continue,omitempty"`
+	// MaxToolIterations caps tool calls for this turn, below the server's
+	// --max-tool-iterations ceiling. Auto-approved and blocked calls count
+	// the same as ones routed through the approval flow: the limit is on
+	// agent loop length, not on what the calls do.
+	MaxToolIterations int `json:"maxToolIterations,omitempty"`
+	// RelativeURLs asks for streamUrl as a bare path instead of an absolute
+	// URL, for same-origin clients.
+	RelativeURLs bool `json:"relativeUrls,omitempty"`
+	// StructuredEdits translates the SDK's edit/patch tool calls into
+	// "edit" frames (file, 1-based inclusive range, newText) so the IDE can
+	// render inline accept/reject UI, plus an "edit_summary" frame listing
+	// every file touched before the turn ends.
+	StructuredEdits bool `json:"structuredEdits,omitempty"`
+	// Tools whitelists the tools exposed for this turn: the SDK sees only
+	// the named tools and the bridge refuses any call outside the list.
+	// Every name must exist in the CLI's tool inventory or the send is
+	// rejected. Omitted means all tools, subject to the usual permissions.
+	Tools []string `json:"tools,omitempty"`
+	// WebhookURL asks for the completed result to be POSTed to this URL when
+	// the turn ends, for headless callers that will not consume a stream.
+	// The send response then carries no streamUrl; see webhook.go for the
+	// payload and retry behavior.
+	WebhookURL string `json:"webhookUrl,omitempty"`
+	// Delivery chooses how this turn's frames reach the caller: "stream"
+	// (the default) returns a streamUrl to attach to; "poll" returns a
+	// pollUrl instead, and the client fetches buffered frames from the
+	// long-poll endpoint until it sees done; "webhook" POSTs the completed
+	// result to WebhookURL, which that mode requires and the others
+	// forbid. One knob over the three delivery paths; a bare webhookUrl
+	// still implies "webhook", as before the param existed. On
+	// /send-stream the connection itself is the delivery and this param
+	// has no effect.
+	Delivery string `json:"delivery,omitempty"`
+	// TruncateContext sheds the lowest-priority context items instead of
+	// rejecting the send when the item count exceeds --max-context-items.
+	// See truncateContextItems for what survives.
+	TruncateContext bool `json:"truncateContext,omitempty"`
+	// Dedupe collapses an accidental identical re-send (an IDE double-fire)
+	// into the turn it duplicates: when an identical (prompt, context) send
+	// started on this session within dedupeSendWindow and is still holding
+	// the turn slot, the duplicate returns that turn's messageId and
+	// streamUrl instead of failing with "turn active". Distinct from
+	// session.create's idempotencyKey, which is caller-chosen and replays
+	// the create response indefinitely; dedupe is content-keyed and only
+	// spans the in-flight turn.
+	Dedupe bool `json:"dedupe,omitempty"`
+	// StopSequences halts generation when any of these strings appears in
+	// the response: the sequence and everything after it are withheld and
+	// the done frame's finishReason is "stop_sequence". At most 4 sequences
+	// of up to 64 bytes each; see stopseq.go.
+	StopSequences []string `json:"stopSequences,omitempty"`
+	// RenderMarkdown additionally emits a final {"type":"rendered"} frame
+	// whose blocks are the assembled reply parsed into markdown structure
+	// (headings, paragraphs, code blocks, lists), sparing the IDE a
+	// markdown parser. Opt-in per turn: it is extra work, and the text
+	// frames already serve clients that render markdown themselves.
+	RenderMarkdown bool `json:"renderMarkdown,omitempty"`
+	// QueueIfBusy makes a send that finds every global turn slot taken
+	// (--max-concurrent-turns) wait for one to free instead of failing
+	// immediately with server busy. The wait is bounded; see turncap.go.
+	QueueIfBusy bool `json:"queueIfBusy,omitempty"`
+	// AutoRoute evaluates the server's --route-model policy against the
+	// prompt: a matching rule runs this turn on the rule's model (announced
+	// by a model_routed frame) instead of the session's. The routed turn
+	// answers standalone on an ephemeral SDK session, like a retry with a
+	// model override. See modelroute.go.
+	AutoRoute bool `json:"autoRoute,omitempty"`
+	// Verbosity is the friendly length knob: "concise", "normal" or
+	// "detailed", each mapping to a maxTokens value plus a standing
+	// instruction. An explicit maxTokens wins over the level's; see
+	// verbosity.go.
+	Verbosity string `json:"verbosity,omitempty"`
+	// CodeExecution enables the SDK's code-interpreter tool for this turn;
+	// its outputs come back as "code_output" frames. Requires the session's
+	// model to advertise the capability; see codeexec.go.
+	CodeExecution bool `json:"codeExecution,omitempty"`
+
+	// verbosityInstruction is the resolved instruction for the level above,
+	// appended to the prompt at the SDK boundary by sdkPrompt.
+	verbosityInstruction string
+}
+
+// Delivery modes for sessionSendParams.Delivery.
+const (
+	deliveryStream  = "stream"
+	deliveryPoll    = "poll"
+	deliveryWebhook = "webhook"
+)
+
+// deliveryMode resolves the send's effective delivery mode: an explicit
+// delivery wins, a bare webhookUrl means "webhook", and otherwise frames
+// stream.
+func (p sessionSendParams) deliveryMode() string {
+	switch {
+	case p.Delivery != "":
+		return p.Delivery
+	case p.WebhookURL != "":
+		return deliveryWebhook
+	default:
+		return deliveryStream
+	}
+}
+
+// dedupeSendWindow bounds how long a send stays eligible as a dedupe match.
+// Long enough to cover any double-click, short enough that a user genuinely
+// re-asking the same question after the turn ends starts a fresh one.
+const dedupeSendWindow = 10 * time.Second
+
+// dedupeSend records one started turn for duplicate detection.
+type dedupeSend struct {
+	messageID string
+	at        time.Time
+}
+
+// dedupeSendKey hashes what makes two sends "identical": the session, the
+// effective prompt (after promptRef expansion) and the context items as
+// attached. Both copies of a double-fired send pass through the same context
+// processing before this point, so equal inputs hash equal.
+func dedupeSendKey(sessionID, prompt string, items []copilot.ContextItem) string {
+	h := sha256.New()
+	h.Write([]byte(sessionID))
+	h.Write([]byte{0})
+	h.Write([]byte(prompt))
+	h.Write([]byte{0})
+	if raw, err := json.Marshal(items); err == nil {
+		h.Write(raw)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// dedupeContextItems drops items whose (file, startLine, endLine) exactly
+// matches an earlier item, returning the kept items and the drop count.
+func dedupeContextItems(items []copilot.ContextItem) ([]copilot.ContextItem, int) {
+	type rangeKey struct {
+		file       string
+		start, end int
+	}
+	seen := make(map[rangeKey]bool, len(items))
+	kept := items[:0:0]
+	for _, item := range items {
+		key := rangeKey{item.File, item.StartLine, item.EndLine}
+		if item.File != "" && seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, item)
+	}
+	return kept, len(items) - len(kept)
+}
+
+// truncateContextItems sheds context items until at most max remain,
+// dropping the lowest-priority ones first and, within a priority, the
+// later-attached ones — so user-pinned files (high priority) and the
+// persistent pool (attached ahead of per-message items) survive while
+// incidental context goes first. Survivors keep their original relative
+// order. Returns the kept items and the drop count.
+func truncateContextItems(items []copilot.ContextItem, max int) ([]copilot.ContextItem, int) {
+	if max <= 0 || len(items) <= max {
+		return items, 0
+	}
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return items[b].Priority - items[a].Priority
+	})
+	keep := order[:max]
+	slices.Sort(keep)
+	kept := make([]copilot.ContextItem, 0, max)
+	for _, i := range keep {
+		kept = append(kept, items[i])
+	}
+	return kept, len(items) - max
+}
+
+// maxTerminalOutput caps how much of a terminal item's output is attached.
+// Longer output is truncated from the middle: the head usually carries the
+// command echo and first error, the tail the final error and exit summary.
+const maxTerminalOutput = 16 * 1024
+
+// formatTerminalItems validates "terminal" context items and renders each
+// into a labeled Content block (see README "Terminal context attachments"),
+// so the model sees stdout/stderr clearly marked as such and not as source.
+func formatTerminalItems(items []copilot.ContextItem) *rpcError {
+	for i := range items {
+		item := &items[i]
+		if item.Type != "terminal" {
+			continue
+		}
+		if item.Command == "" {
+			return errInvalidParams("terminal context item needs a command")
+		}
+		if item.ExitCode != nil && (*item.ExitCode < -1 || *item.ExitCode > 255) {
+			return errInvalidParams("terminal context item has implausible exitCode %d", *item.ExitCode)
+		}
+		exit := "unknown"
+		if item.ExitCode != nil {
+			exit = strconv.Itoa(*item.ExitCode)
+		}
+		item.Content = fmt.Sprintf("Terminal output of `%s` (exit code %s):\n%s",
+			item.Command, exit, middleTruncate(item.Output, maxTerminalOutput))
+		item.Output = ""
+	}
+	return nil
+}
+
+// formatSymbolItems renders Symbol context references. A symbol without a
+// line range is a semantic reference: the CLI does not resolve symbols by
+// name, so the bridge formats a labeled attachment the model can act on.
+// When both a symbol and a line range are present the range wins — the IDE's
+// selection is more precise than a name lookup — and the symbol is demoted
+// to a label on the range's content.
+func formatSymbolItems(items []copilot.ContextItem) *rpcError {
+	for i := range items {
+		item := &items[i]
+		if item.Symbol == "" || item.Type == "terminal" {
+			continue
+		}
+		if item.File == "" {
+			return errInvalidParams("symbol context item %q needs a file", item.Symbol)
+		}
+		switch {
+		case item.StartLine != 0 || item.EndLine != 0:
+			// Range wins; label its content with the symbol, if there is any
+			// content to label. The Symbol field stays on the item either way.
+			if item.Content != "" {
+				item.Content = fmt.Sprintf("Symbol `%s` (%s lines %d-%d):\n%s",
+					item.Symbol, item.File, item.StartLine, item.EndLine, item.Content)
+			}
+		case item.Content != "":
+			item.Content = fmt.Sprintf("Symbol `%s` (%s):\n%s", item.Symbol, item.File, item.Content)
+		default:
+			item.Content = fmt.Sprintf("Symbol reference: `%s` in %s (no source attached; resolve the definition by name).",
+				item.Symbol, item.File)
+		}
+	}
+	return nil
+}
+
+// fetchFileTool is the pseudo-tool name the bridge uses on the callback
+// channel to ask the plugin for a file's content; see README "Lazy file
+// attachments".
+const fetchFileTool = "fetch_file"
+
+// resolveFetchItems fills in Content for context items marked fetch by
+// calling back to the plugin, so huge attachments need not ride inline in
+// the send body. The fetch uses the same endpoint and request shape as tool
+// execution — the plugin sees tool "fetch_file" with the file (and range,
+// when given) as args and replies with the content as result. A failed
+// fetch fails the send: silently attaching an empty file would mislead the
+// model.
+func (s *Server) resolveFetchItems(ctx context.Context, sessionID string, items []copilot.ContextItem) *rpcError {
+	for i := range items {
+		item := &items[i]
+		if !item.Fetch {
+			continue
+		}
+		if item.File == "" {
+			return errInvalidParams("fetch context item needs a file")
+		}
+		if item.Content != "" {
+			return errInvalidParams("fetch context item %s must not also carry inline content", item.File)
+		}
+		if s.callback == nil {
+			return errInvalidParams("fetch context items need a callback endpoint (--callback)")
+		}
+		args := map[string]any{"file": item.File}
+		if item.StartLine != 0 || item.EndLine != 0 {
+			args["startLine"] = item.StartLine
+			args["endLine"] = item.EndLine
+		}
+		resp, err := s.callback.ExecuteTool(ctx, callback.ToolRequest{
+			SessionID: sessionID,
+			Tool:      fetchFileTool,
+			Args:      args,
+		})
+		if err != nil {
+			return &rpcError{Code: codeInternalError, Message: fmt.Sprintf("fetching %s: %v", item.File, err)}
+		}
+		if resp.Failed() {
+			msg := resp.Error
+			if msg == "" {
+				msg = "plugin reported failure"
+			}
+			return &rpcError{Code: codeInternalError, Message: fmt.Sprintf("fetching %s: %s", item.File, msg)}
+		}
+		item.Content = resp.Result
+		item.Fetch = false
+	}
+	return nil
+}
+
+// middleTruncate caps s at roughly max bytes by cutting from the middle,
+// keeping the head and tail and marking the elision. Cuts land on rune
+// boundaries so multibyte characters are never split.
+func middleTruncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	half := max / 2
+	head := half
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	tail := len(s) - half
+	for tail < len(s) && !utf8.RuneStart(s[tail]) {
+		tail++
+	}
+	return fmt.Sprintf("%s\n[... %d bytes truncated ...]\n%s", s[:head], tail-head, s[tail:])
+}
+
+// readPromptRef loads a prompt from the referenced file. The path must pass
+// the tool-path allowlist — the IDE and the tools share the same filesystem
+// boundary — and the file may not exceed the /rpc body cap, since promptRef
+// exists to slim the request body, not to smuggle in a bigger prompt.
+func (s *Server) readPromptRef(path string) (string, *rpcError) {
+	if !s.toolPaths().allows(path) {
+		return "", errInvalidParams("promptRef %q is outside the allowed paths", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errInvalidParams("promptRef: %v", err)
+	}
+	if info.IsDir() {
+		return "", errInvalidParams("promptRef is a directory: %s", path)
+	}
+	if info.Size() > s.cfg.MaxBodyBytes {
+		return "", errInvalidParams("promptRef file is %d bytes; the limit is %d", info.Size(), s.cfg.MaxBodyBytes)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", errInvalidParams("promptRef: %v", err)
+	}
+	if len(raw) == 0 {
+		return "", errInvalidParams("promptRef file is empty: %s", path)
+	}
+	return string(raw), nil
+}
+
+// toolNameRE constrains tool names in autoApprove so a malformed entry
+// fails loudly instead of silently never matching.
+var toolNameRE = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// statsTracker accumulates per-turn timing for the trailing "stats" frame.
+type statsTracker struct {
+	start      time.Time
+	firstToken time.Time
+	chunks     int64
+	chars      int64
+}
+
+func newStatsTracker(start time.Time) *statsTracker {
+	return &statsTracker{start: start}
+}
+
+// observe records one content-bearing event.
+func (st *statsTracker) observe(content string) {
+	if st.firstToken.IsZero() {
+		st.firstToken = time.Now()
+	}
+	st.chunks++
+	st.chars += int64(len(content))
+}
+
+// finish computes the stats for a turn that just completed. When the SDK
+// reported completion tokens those are used for the rate; otherwise tokens
+// are estimated at four characters each.
+func (st *statsTracker) finish(completionTokens int) turnStats {
+	now := time.Now()
+	out := turnStats{
+		DurationMs: now.Sub(st.start).Milliseconds(),
+		Chunks:     st.chunks,
+	}
+	if !st.firstToken.IsZero() {
+		out.TimeToFirstTokenMs = st.firstToken.Sub(st.start).Milliseconds()
+	}
+	tokens := float64(completionTokens)
+	if tokens == 0 {
+		tokens = float64(st.chars) / 4
+	}
+	if secs := now.Sub(st.start).Seconds(); secs > 0 && tokens > 0 {
+		out.TokensPerSecond = tokens / secs
+	}
+	return out
+}
+
+// finishTurnStats publishes the stats frame and rolls the turn into the
+// aggregate metrics.
+func (s *Server) finishTurnStats(sess *session.Session, st *statsTracker, completionTokens int) {
+	stats := st.finish(completionTokens)
+	s.metrics.turnsCompleted.Add(1)
+	s.metrics.completionTokens.Add(int64(completionTokens))
+	s.metrics.turnTTFTMsTotal.Add(stats.TimeToFirstTokenMs)
+	s.metrics.turnDurationMsTotal.Add(stats.DurationMs)
+	s.metrics.turnChunksTotal.Add(stats.Chunks)
+	if !st.firstToken.IsZero() {
+		// Only turns that produced content have a TTFT; an errored or
+		// cancelled turn with no token would skew the histogram toward zero.
+		s.ttft.record(stats.TimeToFirstTokenMs)
+		if thr := s.cfg.TTFTWarnThreshold; thr > 0 && stats.TimeToFirstTokenMs > thr.Milliseconds() {
+			log.Printf("ttft: session %s reached first token after %dms (warn threshold %s)", sess.ID, stats.TimeToFirstTokenMs, thr)
+		}
+	}
+	s.publish(sess, Frame{Type: "stats", Stats: &stats})
+}
+
+// rpcSessionSend validates the send, kicks off the background producer that
+// feeds the session's EventChan, and returns immediately with the stream URL
+// the client should attach to.
+func (s *Server) rpcSessionSend(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	var p sessionSendParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess, messageID, rpcErr := s.startSend(r.Context(), p)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	switch p.deliveryMode() {
+	case deliveryWebhook:
+		// The caller gets its result POSTed; handing out a streamUrl too
+		// would suggest it must also be consumed.
+		return map[string]any{"messageId": messageID, "webhook": true}, nil
+	case deliveryPoll:
+		// No streamUrl either: the point of poll delivery is never holding
+		// a connection open. Frames accumulate in the session's ring; the
+		// client fetches them from pollUrl until it sees done.
+		return map[string]any{
+			"messageId": messageID,
+			"pollUrl":   pollURL(r, sess.ID, p.RelativeURLs),
+		}, nil
+	}
+	return map[string]any{
+		"messageId": messageID,
+		"streamUrl": streamURL(r, sess.ID, p.RelativeURLs),
+	}, nil
+}
+
+// startSend validates a send and launches its background producer, claiming
+// the session's turn slot. It is the shared core of session.send and the
+// /send-stream endpoint; only how the client consumes the frames differs.
+func (s *Server) startSend(ctx context.Context, p sessionSendParams) (*session.Session, string, *rpcError) {
+	if p.Prompt != "" && p.PromptRef != "" {
+		return nil, "", errInvalidParams("prompt and promptRef are mutually exclusive")
+	}
+	switch p.deliveryMode() {
+	case deliveryStream, deliveryPoll:
+		if p.WebhookURL != "" {
+			return nil, "", errInvalidParams("delivery %q cannot take a webhookUrl", p.Delivery)
+		}
+	case deliveryWebhook:
+		if p.WebhookURL == "" {
+			return nil, "", errInvalidParams(`delivery "webhook" requires a webhookUrl`)
+		}
+		if rpcErr := validateWebhookURL(p.WebhookURL); rpcErr != nil {
+			return nil, "", rpcErr
+		}
+	default:
+		return nil, "", errInvalidParams(`delivery must be "stream", "poll" or "webhook"`)
+	}
+	if p.Continue {
+		if p.Prompt != "" || p.PromptRef != "" {
+			return nil, "", errInvalidParams("continue takes no prompt")
+		}
+	} else if p.Prompt == "" && p.PromptRef == "" {
+		return nil, "", errInvalidParams("prompt is required")
+	}
+	if p.PromptRef != "" {
+		prompt, rpcErr := s.readPromptRef(p.PromptRef)
+		if rpcErr != nil {
+			return nil, "", rpcErr
+		}
+		p.Prompt = prompt
+	}
+	for _, tool := range p.AutoApprove {
+		if !toolNameRE.MatchString(tool) {
+			return nil, "", errInvalidParams("invalid tool name in autoApprove: %q", tool)
+		}
+	}
+	if p.Tools != nil {
+		if rpcErr := s.checkToolsExist(ctx, p.Tools); rpcErr != nil {
+			return nil, "", rpcErr
+		}
+	}
+	if p.MaxToolIterations < 0 {
+		return nil, "", errInvalidParams("maxToolIterations must be positive")
+	}
+	if rpcErr := validateStopSequences(p.StopSequences); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	verbosityNote, rpcErr := s.applyVerbosity(&p)
+	if rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, "", errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	if p.Continue && sess.FinishReason() != "length" {
+		return nil, "", errInvalidParams("nothing to continue: the last response was not truncated")
+	}
+	var routedModel, routeReason string
+	if p.AutoRoute {
+		if p.Continue {
+			// A continuation extends the previous response and must stay on
+			// the session that produced it.
+			return nil, "", errInvalidParams("autoRoute cannot be combined with continue")
+		}
+		var rpcErr *rpcError
+		if routedModel, routeReason, rpcErr = s.routeModel(ctx, p.Prompt, sess.Model); rpcErr != nil {
+			return nil, "", rpcErr
+		}
+	}
+	if p.ResponseFormat != nil {
+		if rpcErr := validateResponseFormat(p.ResponseFormat); rpcErr != nil {
+			return nil, "", rpcErr
+		}
+		if p.ResponseFormat.Type != "text" {
+			if rpcErr := s.checkStructuredOutputSupport(ctx, sess.Model); rpcErr != nil {
+				return nil, "", rpcErr
+			}
+		}
+	}
+	if p.CodeExecution {
+		if rpcErr := s.checkCodeExecutionSupport(ctx, sess.Model); rpcErr != nil {
+			return nil, "", rpcErr
+		}
+	}
+	// Handle references and lazy attachments resolve first so their content
+	// is visible to the symbol labeling below.
+	if rpcErr := s.resolveHandleItems(p.Context); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	if rpcErr := s.resolveFetchItems(ctx, sess.ID, p.Context); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	if rpcErr := formatTerminalItems(p.Context); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	if rpcErr := s.resolveGitLogItems(ctx, p.Context); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	if rpcErr := formatSymbolItems(p.Context); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	if rpcErr := formatSymbolGraphItems(p.Context); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	grouped, rpcErr := formatDiagnosticItems(p.Context)
+	if rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	p.Context = grouped
+	// The persistent pool (session.addContext) rides ahead of per-message
+	// context; its items were rendered when they were added. Dedupe below
+	// then drops per-message items that repeat a pooled range.
+	if pool := sess.ContextPool(); len(pool) > 0 {
+		p.Context = append(pool, p.Context...)
+	}
+	if p.DedupeContext == nil || *p.DedupeContext {
+		var dropped int
+		if p.Context, dropped = dedupeContextItems(p.Context); dropped > 0 {
+			log.Printf("session %s: dropped %d duplicate context item(s)", sess.ID, dropped)
+		}
+	}
+	// The per-send item cap, counted after dedupe so legitimate sends are
+	// not penalized for duplicates already shed above.
+	if len(p.Context) > s.cfg.MaxContextItems {
+		if !p.TruncateContext {
+			return nil, "", errInvalidParams("%d context items exceed the limit of %d (set truncateContext to shed the lowest-priority items)",
+				len(p.Context), s.cfg.MaxContextItems)
+		}
+		var dropped int
+		p.Context, dropped = truncateContextItems(p.Context, s.cfg.MaxContextItems)
+		log.Printf("session %s: shed %d context item(s) over the %d-item limit", sess.ID, dropped, s.cfg.MaxContextItems)
+	}
+	// The global turn cap comes before the per-session producer slot so a
+	// queued send never sits on a claimed session while it waits; every
+	// return below this point must release the slot or hand it to the
+	// producer.
+	if rpcErr := s.acquireTurnSlot(ctx, p.QueueIfBusy); rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	// Claim the session's single producer slot before spawning anything:
+	// two rapid sends must never both write to the same EventChan. Dedupe
+	// holds dedupeMu across the claim so two identical concurrent sends are
+	// serialized: the loser reliably sees the winner's recorded turn.
+	var dedupeKey string
+	if p.Dedupe {
+		dedupeKey = dedupeSendKey(sess.ID, p.Prompt, p.Context)
+		s.dedupeMu.Lock()
+	}
+	if !sess.BeginTurn() {
+		s.releaseTurnSlot()
+		if p.Dedupe {
+			e, ok := s.dedupeSends[dedupeKey]
+			s.dedupeMu.Unlock()
+			if ok && time.Since(e.at) < dedupeSendWindow {
+				// The active turn is this very send's twin; hand back its
+				// messageId instead of a turn-active error.
+				return sess, e.messageID, nil
+			}
+		}
+		switch {
+		case sess.Closing():
+			return nil, "", &rpcError{Code: codeSessionClosed, Message: "session is closing"}
+		case sess.Closed():
+			return nil, "", &rpcError{Code: codeSessionClosed, Message: "session is closed"}
+		}
+		return nil, "", &rpcError{Code: codeTurnActive, Message: "a turn is already streaming on this session"}
+	}
+	messageID := fmt.Sprintf("msg-%d", time.Now().UnixNano())
+	if p.Dedupe {
+		s.dedupeSends[dedupeKey] = dedupeSend{messageID: messageID, at: time.Now()}
+		for key, e := range s.dedupeSends {
+			if time.Since(e.at) >= dedupeSendWindow {
+				delete(s.dedupeSends, key)
+			}
+		}
+		s.dedupeMu.Unlock()
+	}
+	sess.Touch()
+	if p.Tools != nil {
+		// Surface the effective tool set so the UI can tell the user what
+		// this turn may and may not do.
+		s.publish(sess, Frame{Type: "meta", Message: "tools for this turn: " + strings.Join(p.Tools, ", ")})
+	}
+	if verbosityNote != "" {
+		s.publish(sess, Frame{Type: "meta", Message: verbosityNote})
+	}
+	if !p.Continue {
+		// History keeps the message's context items alongside its text so
+		// session.retry can replay the turn with its original attachments.
+		sess.AppendUserMessage(messageID, p.Prompt, p.Context)
+		s.transcripts.record(sess.ID, transcriptEntry{Kind: "prompt", Prompt: p.Prompt})
+	}
+	s.metrics.messagesSent.Add(1)
+	s.manager.NotifyMessageSent(sess.ID, messageID)
+	if routedModel != "" {
+		s.publish(sess, Frame{Type: "model_routed", Using: routedModel, Reason: routeReason})
+	}
+	st := newStatsTracker(time.Now())
+	switch {
+	case s.cfg.Mock:
+		s.goTurn(func() {
+			defer s.releaseTurnSlot()
+			s.streamMockResponse(sess, p, st)
+		})
+	case routedModel != "":
+		s.goTurn(func() {
+			defer s.releaseTurnSlot()
+			s.runRetryModel(sess, routedModel, p, messageID, st)
+		})
+	default:
+		s.goTurn(func() {
+			defer s.releaseTurnSlot()
+			s.runTurn(sess, p, messageID, st)
+		})
+	}
+	return sess, messageID, nil
+}
+
+// runTurn drives one SDK turn, bridging SDK stream events into the session's
+// event channel.
+func (s *Server) runTurn(sess *session.Session, p sessionSendParams, messageID string, st *statsTracker) {
+	defer sess.EndTurn()
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.SendTimeout)
+	defer cancel()
+	defer s.registerTurnCancel(sess.ID, cancel)()
+	// Closing the session (session.close, idle eviction, CloseAll) cancels
+	// the turn so this goroutine never outlives its session.
+	go func() {
+		select {
+		case <-sess.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go s.watchAbandonedTurn(ctx, sess)
+	req := copilot.MessageRequest{
+		Prompt:      p.sdkPrompt(sess),
+		Context:     p.Context,
+		MaxTokens:   p.MaxTokens,
+		Temperature: p.Temperature,
+	}
+	if p.ResponseFormat != nil {
+		req.ResponseFormat = p.ResponseFormat.Type
+		req.ResponseSchema = p.ResponseFormat.Schema
+	}
+	req.Continue = p.Continue
+	req.Tools = p.Tools
+	req.StopSequences = p.StopSequences
+	req.CodeExecution = p.CodeExecution
+	// The server-side backstop for stop sequences; nil when none were given.
+	var stopper *stopDetector
+	if len(p.StopSequences) > 0 {
+		stopper = newStopDetector(p.StopSequences)
+	}
+	if s.cfg.Debug && req.Prompt != "" {
+		// The effective prompt — after promptRef expansion and prefix/suffix
+		// wrapping — so prompt plumbing is inspectable during development.
+		s.publish(sess, Frame{Type: "echo_prompt", Content: req.Prompt})
+	}
+	autoApprove := make(map[string]bool, len(p.AutoApprove))
+	for _, tool := range p.AutoApprove {
+		autoApprove[tool] = true
+	}
+	var toolsAllowed map[string]bool
+	if p.Tools != nil {
+		toolsAllowed = make(map[string]bool, len(p.Tools))
+		for _, tool := range p.Tools {
+			toolsAllowed[tool] = true
+		}
+	}
+	// Tool calls are executed off the event path so a slow plugin callback
+	// never blocks event delivery; the SDK waits for each tool result
+	// before continuing the turn anyway. Parallel-marked calls may run
+	// concurrently up to --max-tool-concurrency; an unmarked call is an
+	// ordering barrier — it drains the in-flight calls and runs alone.
+	toolCalls := make(chan copilot.StreamEvent, 16)
+	toolsDone := make(chan struct{})
+	go func() {
+		defer close(toolsDone)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		sem := make(chan struct{}, s.cfg.MaxToolConcurrency)
+		for ev := range toolCalls {
+			if toolsAllowed != nil && !toolsAllowed[ev.ToolName] {
+				// The SDK called outside the whitelist anyway; refuse the
+				// call the same way an allowed-paths block does.
+				msg := fmt.Sprintf("tool %q is not in this turn's tools list", ev.ToolName)
+				s.publish(sess, Frame{Type: "tool_blocked", Name: ev.ToolName, CallID: ev.ToolCallID, Message: msg})
+				if err := s.client.SendToolResult(ctx, sess.SDKID, copilot.ToolResult{CallID: ev.ToolCallID, Error: msg}); err != nil {
+					log.Printf("session %s: sending refused-tool result for %s: %v", sess.ID, ev.ToolName, err)
+				}
+				continue
+			}
+			if !ev.Parallel {
+				wg.Wait()
+				s.executeToolCall(ctx, sess, ev, autoApprove[ev.ToolName])
+				continue
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(ev copilot.StreamEvent) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				s.executeToolCall(ctx, sess, ev, autoApprove[ev.ToolName])
+			}(ev)
+		}
+	}()
+	// The tool-iteration cap: the param may tighten the server ceiling but
+	// never exceed it. Every tool_call event counts — auto-approved and
+	// allowlist-blocked calls included — so a runaway loop is bounded no
+	// matter how its calls are dispositioned.
+	maxIters := s.cfg.MaxToolIterations
+	if p.MaxToolIterations > 0 && p.MaxToolIterations < maxIters {
+		maxIters = p.MaxToolIterations
+	}
+	toolIters := 0
+	limitReached := false
+	// Turn-local state mutated from the onEvent callback with no
+	// synchronization, safe because SendMessage guarantees no callback runs
+	// once it has returned — on the cancelled paths as much as the success
+	// path (see the Client interface contract and SDKClient.removeHandler).
+	// Files touched by structured edits, in the order first edited.
+	var editedFiles []string
+	// Sources the model cited, in order, for the done frame's aggregate.
+	var citations []copilot.Citation
+	// Reassemble multibyte characters the SDK split across chunks, one
+	// assembler per streamed frame type; see utf8.go.
+	var textAsm, reasoningAsm utf8Assembler
+	co := s.newTurnPublisher(sess)
+	ti := s.startThinking(sess)
+	defer ti.done()
+	// The turn-duration ceiling, distinct from the send timeout: SendTimeout
+	// bounds the SDK request, this bounds the whole turn — long agent loops
+	// where every individual call is fast still end. Sessions may tighten it
+	// at creation but never exceed the server's --max-turn-duration.
+	turnLimit := s.cfg.MaxTurnDuration
+	if d := sess.MaxTurnDuration(); d > 0 && d < turnLimit {
+		turnLimit = d
+	}
+	var timedOut atomic.Bool
+	turnTimer := time.AfterFunc(turnLimit, func() {
+		timedOut.Store(true)
+		co.flush()
+		s.publish(sess, Frame{Type: "timeout", Stage: "generation"})
+		s.markTurnCancelled(sess, "timeout")
+		cancel()
+	})
+	defer turnTimer.Stop()
+	resp, err := s.client.SendMessage(ctx, sess.SDKID, req, func(ev copilot.StreamEvent) {
+		if !knownStreamEvent(ev.Type) {
+			s.handleUnknownEvent(sess, ev, "")
+			return
+		}
+		// Real output is flowing; the spinner's job is over.
+		ti.done()
+		if ev.Type == "code_output" {
+			if !p.CodeExecution {
+				// The sandbox should only run when this turn asked for it;
+				// an unrequested event is dropped, not surfaced.
+				log.Printf("session %s: dropping unrequested code_output event", sess.ID)
+				return
+			}
+			st.observe(ev.Stdout)
+			co.publish(s.codeOutputFrame(sess, ev))
+			return
+		}
+		switch ev.Type {
+		case "text":
+			if ev.Content = textAsm.add(ev.Content); ev.Content == "" {
+				return // the whole chunk was a partial character
+			}
+			if stopper != nil {
+				forward, hit := stopper.feed(ev.Content)
+				if hit {
+					if forward != "" {
+						st.observe(forward)
+						co.publish(Frame{Type: "text", Content: forward})
+					}
+					if !stopper.cancelled {
+						stopper.cancelled = true
+						// The SDK would keep generating past the sequence;
+						// aborting the send is how the turn actually stops.
+						cancel()
+					}
+					return
+				}
+			}
+		case "reasoning":
+			if ev.Content = reasoningAsm.add(ev.Content); ev.Content == "" {
+				return
+			}
+		}
+		if ev.Type == "tool_call" {
+			toolIters++
+			if toolIters > maxIters {
+				if !limitReached {
+					limitReached = true
+					co.flush()
+					s.publish(sess, Frame{Type: "tool_limit_reached",
+						Message: fmt.Sprintf("turn exceeded %d tool call(s); stopping the agent loop", maxIters)})
+					s.markTurnCancelled(sess, "tool_limit")
+					// Aborting the send is the only way to stop the loop;
+					// the SDK would otherwise wait forever for a result.
+					cancel()
+				}
+				return
+			}
+		}
+		st.observe(ev.Content)
+		if ev.Type == "citation" && ev.Citation != nil {
+			citations = append(citations, *ev.Citation)
+		}
+		co.publish(frameForStreamEvent(ev))
+		if p.StructuredEdits && ev.Type == "tool_call" {
+			if f, ok := editFromToolCall(ev); ok {
+				co.publish(f)
+				if !slices.Contains(editedFiles, f.File) {
+					editedFiles = append(editedFiles, f.File)
+				}
+			}
+		}
+		if ev.Type == "tool_call" {
+			toolCalls <- ev
+		}
+	})
+	// Safe only because of the SendMessage contract above: a callback still
+	// running here — possible before SDKClient synchronized deregistration
+	// with dispatch — would make this send-on-closed-channel panic, and on
+	// readLoop's goroutine, where it would take down the whole sidecar.
+	close(toolCalls)
+	<-toolsDone
+	// No more events are coming; emit any bytes still held back by the UTF-8
+	// assemblers, then deliver batched text before the frames that end the
+	// turn.
+	if rest := textAsm.flush(); rest != "" && stopper != nil {
+		// Late bytes still pass through stop detection like any chunk.
+		rest, _ = stopper.feed(rest)
+		if rest != "" {
+			co.publish(Frame{Type: "text", Content: rest})
+		}
+	} else if rest != "" {
+		co.publish(Frame{Type: "text", Content: rest})
+	}
+	if stopper != nil && !stopper.hit {
+		// Text held back as a possible sequence start that never completed.
+		if rest := stopper.flush(); rest != "" {
+			co.publish(Frame{Type: "text", Content: rest})
+		}
+	}
+	if rest := reasoningAsm.flush(); rest != "" {
+		co.publish(Frame{Type: "reasoning", Content: rest})
+	}
+	co.flush()
+	if len(editedFiles) > 0 && !sess.TurnCancelled() {
+		s.publish(sess, Frame{Type: "edit_summary", Files: editedFiles})
+	}
+	if err != nil {
+		if stopper != nil && stopper.hit {
+			// Not a failure: the server-side detector completed a stop
+			// sequence and aborted the send. Store what clients actually saw
+			// and finish the turn as a stop, mirroring a native SDK stop.
+			if p.Continue {
+				sess.ExtendLastAssistant(stopper.text())
+			} else {
+				sess.AppendHistory("assistant", stopper.text())
+			}
+			sess.SetFinishReason("stop_sequence")
+			sess.Touch()
+			s.finishTurnStats(sess, st, 0)
+			s.finishTurn(sess, Frame{Type: "done", FinishReason: "stop_sequence"})
+			if p.WebhookURL != "" {
+				go s.deliverWebhook(p.WebhookURL, webhookPayload{
+					SessionID:    sess.ID,
+					Content:      stopper.text(),
+					FinishReason: "stop_sequence",
+				})
+			}
+			return
+		}
+		if p.WebhookURL != "" {
+			msg := err.Error()
+			switch {
+			case limitReached:
+				msg = "turn exceeded the tool iteration limit"
+			case timedOut.Load():
+				msg = "turn exceeded the turn-duration ceiling"
+			}
+			go s.deliverWebhook(p.WebhookURL, webhookPayload{SessionID: sess.ID, Error: msg})
+		}
+		if limitReached || timedOut.Load() {
+			// The frame explaining why was already published; a generic
+			// error frame on top would only muddy it.
+			s.finishTurn(sess, Frame{Type: "done"})
+			return
+		}
+		if !sess.TurnCancelled() {
+			s.publish(sess, errorFrame(err))
+		}
+		s.finishTurn(sess, Frame{Type: "done"})
+		return
+	}
+	if stopper != nil && stopper.hit {
+		// The SDK finished before the detector's cancel landed; its content
+		// runs past the sequence, so history keeps the clipped text instead.
+		resp.Content = stopper.text()
+		resp.FinishReason = "stop_sequence"
+	}
+	if resp.RequestID != "" {
+		// The raw SDK request ID, logged against the bridge's message ID so
+		// a failure here can be chased into the Copilot CLI's own logs.
+		log.Printf("session %s: message %s is SDK request %s", sess.ID, messageID, resp.RequestID)
+	}
+	if p.Continue {
+		sess.ExtendLastAssistant(resp.Content)
+	} else {
+		sess.AppendHistory("assistant", resp.Content)
+	}
+	sess.SetFinishReason(resp.FinishReason)
+	sess.Touch()
+	if !sess.TurnCancelled() {
+		if err := checkResponseContent(resp.Content, p.ResponseFormat); err != nil {
+			// The model produced non-conforming output; that is its failure,
+			// not the plumbing's, so the turn still ends with a normal done.
+			s.publish(sess, Frame{Type: "error", Category: copilot.ErrorCategoryApplication,
+				Message: "response format validation failed: " + err.Error()})
+		}
+		if p.RenderMarkdown && resp.Content != "" {
+			s.publish(sess, Frame{Type: "rendered", Blocks: renderMarkdownBlocks(resp.Content)})
+		}
+		// A cancelled turn goes straight to done: after the cancelled
+		// frame, clients must see nothing but done.
+		s.finishTurnStats(sess, st, resp.Usage.CompletionTokens)
+	}
+	s.finishTurn(sess, Frame{Type: "done", MessageID: resp.MessageID, RequestID: resp.RequestID,
+		FinishReason: resp.FinishReason, Citations: citations})
+	s.maybeSummarize(sess)
+	if p.WebhookURL != "" {
+		usage := resp.Usage
+		go s.deliverWebhook(p.WebhookURL, webhookPayload{
+			SessionID:    sess.ID,
+			MessageID:    resp.MessageID,
+			Content:      resp.Content,
+			FinishReason: resp.FinishReason,
+			Usage:        &usage,
+			Citations:    citations,
+		})
+	}
+}
+
+// executeToolCall runs one tool call through the plugin callback and feeds
+// the result back into the SDK session.
+func (s *Server) executeToolCall(ctx context.Context, sess *session.Session, ev copilot.StreamEvent, autoApproved bool) {
+	if offending, ok := s.toolPaths().checkToolArgs(ev.ToolArgs); !ok {
+		// Blocked calls never reach the plugin; the SDK gets an error result
+		// so the turn can continue without the tool's output.
+		msg := fmt.Sprintf("path %q is outside the allowed paths", offending)
+		s.publish(sess, Frame{Type: "tool_blocked", Name: ev.ToolName, CallID: ev.ToolCallID, Message: msg})
+		if err := s.client.SendToolResult(ctx, sess.SDKID, copilot.ToolResult{CallID: ev.ToolCallID, Error: msg}); err != nil {
+			log.Printf("session %s: sending blocked-tool result for %s: %v", sess.ID, ev.ToolName, err)
+		}
+		return
+	}
+	if autoApproved {
+		s.publish(sess, Frame{Type: "tool_auto_approved", Name: ev.ToolName})
+	}
+	result := copilot.ToolResult{CallID: ev.ToolCallID}
+	if s.callback == nil {
+		result.Error = "no callback endpoint configured"
+	} else {
+		resp, err := s.callback.ExecuteToolStream(ctx, callback.ToolRequest{
+			SessionID:       sess.ID,
+			CallID:          ev.ToolCallID,
+			Tool:            ev.ToolName,
+			Args:            ev.ToolArgs,
+			RequireApproval: !autoApproved,
+		}, func(p callback.ToolProgress) {
+			// Long tools (a build, a test suite) can stream progress; each
+			// update goes to the client as it arrives and also resets the
+			// callback client's stall watchdog.
+			s.publish(sess, Frame{Type: "tool_progress", Name: ev.ToolName, CallID: ev.ToolCallID,
+				Message: p.Message, Percent: p.Percent})
+		})
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case resp.Failed():
+			// The plugin ran the tool and it failed (e.g. the OS denied a
+			// write). The failure goes back to the SDK as the tool result so
+			// the model can retry or explain, never silently dropped.
+			result.Error = resp.Error
+			if result.Error == "" {
+				result.Error = "tool execution failed (plugin gave no detail)"
+			}
+		default:
+			result.Content = resp.Result
+			result.Success = true
+		}
+	}
+	if result.Error != "" {
+		failed := false
+		s.publish(sess, Frame{Type: "tool_result", Name: ev.ToolName, CallID: ev.ToolCallID,
+			Success: &failed, Message: result.Error})
+	}
+	if err := s.client.SendToolResult(ctx, sess.SDKID, result); err != nil {
+		log.Printf("session %s: sending tool result for %s: %v", sess.ID, ev.ToolName, err)
+	}
+}
+
+// handleStream serves the event stream for one session at /stream/{id}.
+// The framing is negotiated from the Accept header — SSE by default,
+// newline-delimited JSON for clients that prefer application/x-ndjson —
+// over the same underlying events either way.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/stream/")
+	sess := s.manager.Get(id)
+	if sess == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	if sess.Closed() {
+		// The session was closed between send and attach; a plain 410 is
+		// clearer to the client than an empty-looking stream.
+		http.Error(w, "session closed", http.StatusGone)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	filter := parseTypeFilter(r.URL.Query().Get("types"))
+	framing := negotiateFraming(r.Header.Get("Accept"))
+	s.metrics.streamsAttached.Add(1)
+	s.metrics.streamsActive.Add(1)
+	defer s.metrics.streamsActive.Add(-1)
+	defer sess.AddSubscriber()()
+	h := w.Header()
+	h.Set("Content-Type", framing.contentType())
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	sw := s.newStreamWriter(w)
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	shutdown := s.shutdownCh
+	for {
+		select {
+		case <-shutdown:
+			// The select picks uniformly among ready cases, so a write case
+			// can win the same iteration the context dies; re-check before
+			// every write rather than log a spurious failure against a
+			// connection that is already gone. Same below.
+			if ctx.Err() != nil {
+				return
+			}
+			// Announce the shutdown once, then keep draining so the client
+			// sees whatever the grace period lets the turn finish.
+			if err := framing.control(sw, "shutdown"); err != nil {
+				s.streamWriteFailed(sess, err)
+				return
+			}
+			shutdown = nil
+		case frame, ok := <-sess.EventChan:
+			if ctx.Err() != nil {
+				return
+			}
+			if !ok {
+				// EventChan only closes when the session itself is torn
+				// down, never at the end of a turn (turns end with a
+				// "done" data frame). Say so explicitly rather than
+				// faking a normal completion.
+				_ = framing.control(sw, "gone")
+				return
+			}
+			if !frameWanted(filter, frame) {
+				continue
+			}
+			if err := framing.frame(sw, frame); err != nil {
+				s.streamWriteFailed(sess, err)
+				return
+			}
+			if transportError(frame) {
+				// Application errors stream on to their normal done;
+				// transport errors close the attachment abnormally, so
+				// "stream ended without done" reliably means "the plumbing
+				// failed, offer a retry" (see Frame.Category).
+				return
+			}
+		case <-heartbeat.C:
+			if ctx.Err() != nil {
+				return
+			}
+			if err := framing.heartbeat(sw); err != nil {
+				s.streamWriteFailed(sess, err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// streamFraming is one subscriber's wire framing on /stream/{id}: classic
+// SSE, or newline-delimited JSON for non-browser clients that would rather
+// not parse SSE field syntax. The events are identical; only the envelope
+// differs. In NDJSON, SSE's out-of-band events (shutdown, gone) become
+// ordinary {"type":...} objects and the heartbeat is a blank line, which
+// NDJSON consumers skip by convention.
+type streamFraming struct {
+	ndjson bool
+}
+
+// negotiateFraming picks the framing from the Accept header: the first
+// media range naming either supported type wins, and anything else —
+// including no header at all — is SSE.
+func negotiateFraming(accept string) streamFraming {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/x-ndjson":
+			return streamFraming{ndjson: true}
+		case "text/event-stream":
+			return streamFraming{}
+		}
+	}
+	return streamFraming{}
+}
+
+func (f streamFraming) contentType() string {
+	if f.ndjson {
+		return "application/x-ndjson"
+	}
+	return "text/event-stream"
+}
+
+func (f streamFraming) frame(sw *streamWriter, frame []byte) error {
+	if f.ndjson {
+		return sw.write("%s\n", frame)
+	}
+	return sw.write("data: %s\n\n", frame)
+}
+
+func (f streamFraming) control(sw *streamWriter, name string) error {
+	if f.ndjson {
+		return sw.write("{\"type\":%q}\n", name)
+	}
+	return sw.write("event: %s\ndata: {}\n\n", name)
+}
+
+func (f streamFraming) heartbeat(sw *streamWriter) error {
+	if f.ndjson {
+		return sw.write("\n")
+	}
+	return sw.write(": heartbeat\n\n")
+}
+
+// parseTypeFilter reads the types query parameter on /stream/{id} into the
+// set of frame types this subscriber wants. The filter is per connection, so
+// a minimal client asking for text,done does not affect other subscribers. A
+// nil result means no filtering — the default. Names that match no frame
+// type simply never match; they are not an error.
+func parseTypeFilter(raw string) map[string]bool {
+	if raw == "" {
+		return nil
+	}
+	filter := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			filter[name] = true
+		}
+	}
+	if len(filter) == 0 {
+		return nil
+	}
+	return filter
+}
+
+// frameWanted reports whether a frame passes the subscriber's type filter.
+// A frame whose type cannot be read is passed through rather than silently
+// swallowed.
+func frameWanted(filter map[string]bool, frame []byte) bool {
+	if filter == nil {
+		return true
+	}
+	var ft struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(frame, &ft); err != nil || ft.Type == "" {
+		return true
+	}
+	return filter[ft.Type]
+}
+
+// streamWriter writes SSE chunks with a per-write deadline so a client that
+// stopped reading but kept the connection open cannot block the stream
+// goroutine forever.
+type streamWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (s *Server) newStreamWriter(w http.ResponseWriter) *streamWriter {
+	return &streamWriter{w: w, rc: http.NewResponseController(w), timeout: s.cfg.StreamWriteTimeout}
+}
+
+// write sends one SSE chunk and flushes it. A non-nil error means the
+// client is gone or not keeping up and the stream must be torn down.
+func (sw *streamWriter) write(format string, args ...any) error {
+	if sw.timeout > 0 {
+		// An error here means the connection cannot take deadlines; the
+		// write below is then simply unbounded, as it always was.
+		_ = sw.rc.SetWriteDeadline(time.Now().Add(sw.timeout))
+	}
+	if _, err := fmt.Fprintf(sw.w, format, args...); err != nil {
+		return err
+	}
+	// Flush through the ResponseController: unlike http.Flusher it reports
+	// the write-deadline error instead of swallowing it.
+	return sw.rc.Flush()
+}
+
+// streamWriteFailed records why a stream was torn down. A deadline failure
+// is the stuck-client case and worth both a counter and a log line; anything
+// else is an ordinary disconnect.
+func (s *Server) streamWriteFailed(sess *session.Session, err error) {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		s.metrics.streamsTimedOut.Add(1)
+		log.Printf("session %s: SSE client stopped reading; dropping the stream after a %v write timeout",
+			sess.ID, s.cfg.StreamWriteTimeout)
+	}
+}
+
+// handlePoll serves buffered events at /poll/{id}?since=N for clients that
+// prefer long-polling over SSE. It returns immediately with whatever is
+// buffered.
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/poll/")
+	sess := s.manager.Get(id)
+	if sess == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+	frames, next := sess.EventsSince(since)
+	events := make([]json.RawMessage, len(frames))
+	for i, f := range frames {
+		events[i] = json.RawMessage(f)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"events": events, "next": next}); err != nil {
+		log.Printf("poll: writing response: %v", err)
+	}
+}
+
+// checkStructuredOutputSupport rejects a structured responseFormat up front
+// when the session's model explicitly reports its capabilities and
+// structured output is not among them. Models that report no capabilities
+// get the benefit of the doubt; the SDK is the authority there.
+func (s *Server) checkStructuredOutputSupport(ctx context.Context, model string) *rpcError {
+	models, rpcErr := s.listModels(ctx)
+	if rpcErr != nil {
+		return nil
+	}
+	for _, m := range models {
+		if m.ID != model || len(m.Capabilities) == 0 {
+			continue
+		}
+		for _, c := range m.Capabilities {
+			if c == copilot.CapabilityStructuredOutput {
+				return nil
+			}
+		}
+		return errInvalidParams("model %s does not support structured output", model)
+	}
+	return nil
+}
+
+// sdkPrompt is the prompt as the SDK sees it: wrapped with the session's
+// prefix and suffix, plus the send's verbosity instruction when one
+// applies. Like the wrapping, the instruction never reaches history.
+func (p sessionSendParams) sdkPrompt(sess *session.Session) string {
+	prompt := wrapPrompt(sess, p.Prompt)
+	if prompt != "" && p.verbosityInstruction != "" {
+		prompt += "\n\n" + p.verbosityInstruction
+	}
+	return prompt
+}
+
+// wrapPrompt applies the session's prompt prefix and suffix, joined with
+// single newlines. It runs at the SDK boundary — after promptRef expansion
+// and without touching history, so exports show what the user actually
+// wrote. Empty prompts (continue sends) are never wrapped.
+func wrapPrompt(sess *session.Session, prompt string) string {
+	if prompt == "" {
+		return prompt
+	}
+	prefix, suffix := sess.PromptWrap()
+	if prefix != "" {
+		prompt = prefix + "\n" + prompt
+	}
+	if suffix != "" {
+		prompt = prompt + "\n" + suffix
+	}
+	return prompt
+}
+
+// checkToolsExist validates a send's tools whitelist against the CLI's tool
+// inventory (a canned set in --mock mode), so a typo fails the send rather
+// than silently exposing nothing.
+func (s *Server) checkToolsExist(ctx context.Context, tools []string) *rpcError {
+	if len(tools) == 0 {
+		return errInvalidParams("tools must name at least one tool when present")
+	}
+	for _, tool := range tools {
+		if !toolNameRE.MatchString(tool) {
+			return errInvalidParams("invalid tool name in tools: %q", tool)
+		}
+	}
+	available := mockTools()
+	if !s.cfg.Mock {
+		var err error
+		if available, err = s.client.ListTools(ctx); err != nil {
+			return &rpcError{Code: codeInternalError, Message: "listing tools: " + err.Error()}
+		}
+	}
+	known := make(map[string]bool, len(available))
+	for _, t := range available {
+		known[t.Name] = true
+	}
+	for _, tool := range tools {
+		if !known[tool] {
+			return errInvalidParams("unknown tool: %q", tool)
+		}
+	}
+	return nil
+}
+
+// mockTools returns the canned tool inventory used in --mock mode.
+func mockTools() []copilot.Tool {
+	return []copilot.Tool{
+		{Name: "read_file", Description: "Read a file from the workspace"},
+		{Name: "write_file", Description: "Write a file in the workspace"},
+		{Name: "list_directory", Description: "List a directory"},
+		{Name: "run_terminal_command", Description: "Run a terminal command"},
+	}
+}
+
+// mockModels returns the canned model list served in --mock mode.
+func mockModels() []copilot.Model {
+	return []copilot.Model{
+		{ID: "gpt-4o", Name: "GPT-4o", Vendor: "openai", Default: true,
+			Capabilities: []string{copilot.CapabilityStructuredOutput, copilot.CapabilityCodeExecution}},
+		{ID: "gpt-5-mini", Name: "GPT-5 mini", Vendor: "openai", Capabilities: []string{copilot.CapabilityStructuredOutput}},
+		{ID: "claude-sonnet-4", Name: "Claude Sonnet 4", Vendor: "anthropic", Capabilities: []string{"chat"}},
+		{ID: "gpt-3.5-turbo", Name: "GPT-3.5 Turbo", Vendor: "openai", Deprecated: true,
+			DeprecationMessage: "GPT-3.5 Turbo is being retired; switch to GPT-4o."},
+	}
+}
+
+// streamMockResponse emits a canned streamed reply so the plugin can be
+// developed without a Copilot CLI installation.
+func (s *Server) streamMockResponse(sess *session.Session, p sessionSendParams, st *statsTracker) {
+	prompt, webhookURL := p.Prompt, p.WebhookURL
+	defer sess.EndTurn()
+	s.publish(sess, Frame{Type: "reasoning", Content: "Thinking about the question..."})
+	time.Sleep(50 * time.Millisecond)
+	if p.CodeExecution {
+		// Synthetic sandbox output, so code_output rendering — stdout plus
+		// artifact handles — can be developed in --mock mode.
+		s.publish(sess, s.codeOutputFrame(sess, copilot.StreamEvent{
+			Type:   "code_output",
+			Stdout: "mock execution: processed 4 rows\n",
+			Artifacts: []copilot.Artifact{
+				{Name: "chart.png", MimeType: "image/png", Content: "mock chart bytes"},
+			},
+		}))
+	}
+	chunks := []string{
+		"This is a mock response to: " + truncate(prompt, 50),
+		" The sidecar is running in --mock mode,",
+		" so no Copilot CLI was consulted.",
+	}
+	full := ""
+	for _, chunk := range chunks {
+		st.observe(chunk)
+		s.publish(sess, Frame{Type: "text", Content: chunk})
+		full += chunk
+		time.Sleep(30 * time.Millisecond)
+	}
+	sess.AppendHistory("assistant", full)
+	sess.SetFinishReason("stop")
+	// Prompts that mention citing get synthetic citations so the UI's link
+	// rendering can be developed in --mock mode; everything else streams as
+	// before.
+	var citations []copilot.Citation
+	if strings.Contains(strings.ToLower(prompt), "cite") {
+		citations = []copilot.Citation{
+			{Title: "mock.go", URI: "file:///mock/mock.go", Snippet: "// a mock source"},
+			{Title: "Copilot docs", URI: "https://example.com/docs"},
+		}
+		for _, c := range citations {
+			s.publish(sess, Frame{Type: "citation", Title: c.Title, URI: c.URI, Snippet: c.Snippet})
+		}
+	}
+	// The mock's sleeps yield realistically shaped stats for UI work.
+	s.finishTurnStats(sess, st, 0)
+	s.finishTurn(sess, Frame{Type: "done", FinishReason: "stop", Citations: citations})
+	s.maybeSummarize(sess)
+	if webhookURL != "" {
+		go s.deliverWebhook(webhookURL, webhookPayload{
+			SessionID: sess.ID, Content: full, FinishReason: "stop", Citations: citations,
+		})
+	}
+}
+
+// truncate shortens s to at most maxLen runes, appending "..." when it was
+// cut. It counts and slices by rune so a multibyte character is never split,
+// which would produce invalid UTF-8 and break JSON encoding downstream.
+func truncate(s string, maxLen int) string {
+	if utf8.RuneCountInString(s) <= maxLen {
+		return s
+	}
+	keep := maxLen - 3
+	if keep < 0 {
+		keep = 0
+	}
+	runes := 0
+	for i := range s {
+		if runes == keep {
+			return s[:i] + "..."
+		}
+		runes++
+	}
+	return s
+}
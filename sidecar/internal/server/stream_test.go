@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStreamOfClosedSessionReturnsGone(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	sess.Close()
+	req := httptest.NewRequest(http.MethodGet, "/stream/"+sess.ID, nil)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusGone {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusGone)
+	}
+}
+
+// TestRapidSendsSingleProducer fires many sends in quick succession and
+// asserts only one producer runs at a time: every send after the first is
+// rejected with codeTurnActive until the running turn finishes. Run with
+// -race to catch producer overlap.
+func TestRapidSendsSingleProducer(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	accepted := 0
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+				"sessionId": sess.ID,
+				"prompt":    "rapid",
+			})
+			if rpcErr == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			} else if rpcErr.Code != codeTurnActive {
+				t.Errorf("unexpected error: %v", rpcErr)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("accepted %d concurrent sends, want exactly 1", accepted)
+	}
+	// After the accepted turn completes, a new send must be accepted again.
+	drainFrames(t, sess, 5e9)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "after",
+	}); rpcErr != nil {
+		t.Errorf("send after turn completion rejected: %v", rpcErr)
+	}
+}
+
+func TestStreamCloseAttachRace(t *testing.T) {
+	// However close and stream-attach interleave, the client must never see
+	// a session teardown reported as a normal "done" completion.
+	for i := 0; i < 50; i++ {
+		srv := newMockServer(t, nil)
+		sess, _ := srv.Manager().Create("gpt-4o", "", "")
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sess.Close()
+		}()
+		req := httptest.NewRequest(http.MethodGet, "/stream/"+sess.ID, nil)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		wg.Wait()
+		body := rec.Body.String()
+		switch {
+		case rec.Code == http.StatusGone:
+		case rec.Code == http.StatusOK && strings.Contains(body, "event: gone"):
+		default:
+			t.Fatalf("iteration %d: status=%d body=%q, want 410 or an event: gone frame", i, rec.Code, body)
+		}
+		if strings.Contains(body, "event: done") {
+			t.Fatalf("iteration %d: closed session reported as normal completion: %q", i, body)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// bodyRecorder is a flushable ResponseWriter that records only body writes,
+// so a test can assert nothing was written after a cancel.
+type bodyRecorder struct {
+	header http.Header
+	body   strings.Builder
+}
+
+func (w *bodyRecorder) Header() http.Header         { return w.header }
+func (w *bodyRecorder) Write(p []byte) (int, error) { return w.body.WriteString(string(p)) }
+func (w *bodyRecorder) WriteHeader(int)             {}
+func (w *bodyRecorder) Flush()                      {}
+
+func TestStreamNoWriteAfterContextCancel(t *testing.T) {
+	srv := newMockServer(t, nil)
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	// A frame is already pending when the handler's select first runs with a
+	// dead context, so the select may pick either case; the handler must not
+	// write the frame either way. One iteration passes by luck half the
+	// time, so repeat until a missing guard would all but surely lose a race.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 20; i++ {
+		srv.publish(sess, Frame{Type: "text", Content: "pending"})
+		w := &bodyRecorder{header: make(http.Header)}
+		r := httptest.NewRequest("GET", "/stream/"+id, nil).WithContext(ctx)
+		srv.handleStream(w, r)
+		if got := w.body.String(); got != "" {
+			t.Fatalf("iteration %d: wrote %q after the context was cancelled", i, got)
+		}
+	}
+}
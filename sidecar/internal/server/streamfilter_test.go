@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFrameTypes attaches to an SSE stream URL and collects the type of
+// every data frame until a done frame arrives.
+func readFrameTypes(t *testing.T, url string) []string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("attaching stream: %v", err)
+	}
+	defer resp.Body.Close()
+	var types []string
+	lines := make(chan string)
+	scanner := bufio.NewScanner(resp.Body)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream ended without a done frame; saw %v", types)
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var frame map[string]any
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &frame); err != nil {
+				t.Fatalf("bad frame %q: %v", line, err)
+			}
+			ft, _ := frame["type"].(string)
+			types = append(types, ft)
+			if ft == "done" {
+				return types
+			}
+		case <-deadline:
+			t.Fatalf("timed out; saw %v", types)
+		}
+	}
+}
+
+func TestStreamTypeFilter(t *testing.T) {
+	srv := newMockServer(t, nil)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+
+	send := func() {
+		t.Helper()
+		if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": sess.ID, "prompt": "filter me",
+		}); rpcErr != nil {
+			t.Fatalf("session.send: %v", rpcErr)
+		}
+	}
+
+	// A filtered subscriber sees only the types it asked for.
+	send()
+	got := readFrameTypes(t, ts.URL+"/stream/"+sess.ID+"?types=text,done")
+	sawText := false
+	for _, ft := range got {
+		if ft != "text" && ft != "done" {
+			t.Errorf("filtered stream delivered a %q frame: %v", ft, got)
+		}
+		sawText = sawText || ft == "text"
+	}
+	if !sawText {
+		t.Errorf("filtered stream delivered no text frames: %v", got)
+	}
+
+	// An unfiltered subscriber on the next turn still gets everything,
+	// including the stats frame the filter above suppressed.
+	send()
+	got = readFrameTypes(t, ts.URL+"/stream/"+sess.ID)
+	sawStats := false
+	for _, ft := range got {
+		sawStats = sawStats || ft == "stats"
+	}
+	if !sawStats {
+		t.Errorf("unfiltered stream missing the stats frame: %v", got)
+	}
+}
+
+func TestStreamTypeFilterIgnoresUnknownNames(t *testing.T) {
+	srv := newMockServer(t, nil)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID, "prompt": "hello",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	// A name that matches no frame type never matches; the filter is not an
+	// allowlist of valid names, so the request is not rejected either.
+	got := readFrameTypes(t, ts.URL+"/stream/"+sess.ID+"?types=done,%20bogus")
+	if len(got) != 1 || got[0] != "done" {
+		t.Errorf("frames = %v, want just done", got)
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// readNDJSONTypes attaches to a stream URL with an NDJSON Accept header and
+// collects the type of every object until done.
+func readNDJSONTypes(t *testing.T, url string) (contentType string, types []string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("attaching stream: %v", err)
+	}
+	defer resp.Body.Close()
+	contentType = resp.Header.Get("Content-Type")
+	lines := make(chan string)
+	scanner := bufio.NewScanner(resp.Body)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("stream ended without a done frame; saw %v", types)
+			}
+			if line == "" {
+				continue // heartbeat
+			}
+			var frame map[string]any
+			if err := json.Unmarshal([]byte(line), &frame); err != nil {
+				t.Fatalf("line %q is not bare JSON: %v", line, err)
+			}
+			ft, _ := frame["type"].(string)
+			types = append(types, ft)
+			if ft == "done" {
+				return contentType, types
+			}
+		case <-deadline:
+			t.Fatalf("timed out; saw %v", types)
+		}
+	}
+}
+
+func TestStreamFramingNegotiation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+
+	send := func() {
+		t.Helper()
+		if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": sess.ID, "prompt": "frame me",
+		}); rpcErr != nil {
+			t.Fatalf("session.send: %v", rpcErr)
+		}
+	}
+
+	// NDJSON subscriber: bare JSON objects, one per line.
+	send()
+	contentType, ndTypes := readNDJSONTypes(t, ts.URL+"/stream/"+sess.ID)
+	if contentType != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", contentType)
+	}
+
+	// SSE subscriber on the same session's next turn: same kinds of events,
+	// SSE envelope. (The mock's exact frame mix varies per turn, so compare
+	// the shape, not the sequence.)
+	send()
+	sseTypes := readFrameTypes(t, ts.URL+"/stream/"+sess.ID)
+	for name, types := range map[string][]string{"NDJSON": ndTypes, "SSE": sseTypes} {
+		sawText := false
+		for _, ft := range types {
+			sawText = sawText || ft == "text"
+		}
+		if !sawText || types[len(types)-1] != "done" {
+			t.Errorf("%s stream = %v, want text frames ending in done", name, types)
+		}
+	}
+}
+
+func TestStreamFramingDefaultsToSSE(t *testing.T) {
+	srv := newMockServer(t, nil)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID, "prompt": "hello",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	// A wildcard Accept (or none at all) stays on SSE; readFrameTypes only
+	// understands "data:" lines, so reaching done proves the framing.
+	got := readFrameTypes(t, ts.URL+"/stream/"+sess.ID)
+	if len(got) == 0 || got[len(got)-1] != "done" {
+		t.Errorf("frames = %v, want an SSE stream ending in done", got)
+	}
+}
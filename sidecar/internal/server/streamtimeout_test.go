@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStuckStreamClientIsDropped(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.StreamWriteTimeout = 100 * time.Millisecond })
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	// A raw connection that sends the request and then never reads: the
+	// frozen-UI case. The TCP buffers eventually fill and the server's
+	// writes block until the write deadline fires.
+	u, _ := url.Parse(ts.URL)
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "GET /stream/%s HTTP/1.1\r\nHost: %s\r\n\r\n", sess.ID, u.Host)
+	waitFor(t, 2*time.Second, func() bool { return sess.Subscribers() == 1 },
+		"stream never attached")
+
+	// Keep publishing sizeable frames so the stream goroutine keeps
+	// writing into the stuffed connection.
+	big := bytes.Repeat([]byte("x"), 64<<10)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				sess.Publish(big)
+			}
+		}
+	}()
+
+	waitFor(t, 10*time.Second, func() bool { return sess.Subscribers() == 0 },
+		"stuck client still holds the stream")
+	waitFor(t, 2*time.Second, func() bool { return srv.metrics.streamsTimedOut.Load() >= 1 },
+		"timed-out stream not counted")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sendOverTLS performs a session.send on a request that looks TLS-terminated.
+func sendOverTLS(t *testing.T, srv *Server, params map[string]any) string {
+	t.Helper()
+	raw, _ := json.Marshal(params)
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"session.send","params":%s}`, raw)
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Host = "bridge.example:8443"
+	req.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Result struct {
+			StreamURL string `json:"streamUrl"`
+		} `json:"result"`
+		Error *rpcError `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("session.send: %v", resp.Error)
+	}
+	return resp.Result.StreamURL
+}
+
+func TestStreamURLSchemes(t *testing.T) {
+	srv := newMockServer(t, nil)
+
+	// Plaintext request: absolute http URL on the request's host.
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	result, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"})
+	if rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var sent struct {
+		StreamURL string `json:"streamUrl"`
+	}
+	if err := json.Unmarshal(result, &sent); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if want := "http://example.com/stream/" + sess.ID; sent.StreamURL != want {
+		t.Errorf("streamUrl = %q, want %q", sent.StreamURL, want)
+	}
+
+	// TLS request: https, host and port from the request.
+	tlsSess, _ := srv.Manager().Create("gpt-4o", "", "")
+	got := sendOverTLS(t, srv, map[string]any{"sessionId": tlsSess.ID, "prompt": "hi"})
+	if want := "https://bridge.example:8443/stream/" + tlsSess.ID; got != want {
+		t.Errorf("streamUrl over TLS = %q, want %q", got, want)
+	}
+}
+
+func TestStreamURLRelativeParam(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	result, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":    sess.ID,
+		"prompt":       "hi",
+		"relativeUrls": true,
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var sent struct {
+		StreamURL string `json:"streamUrl"`
+	}
+	if err := json.Unmarshal(result, &sent); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if want := "/stream/" + sess.ID; sent.StreamURL != want {
+		t.Errorf("streamUrl = %q, want %q", sent.StreamURL, want)
+	}
+	if strings.Contains(sent.StreamURL, "://") {
+		t.Errorf("relative streamUrl contains a scheme: %q", sent.StreamURL)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// summarizePrompt prefixes the transcript handed to the summarizer model.
+const summarizePrompt = "Summarize the following conversation between a user and an assistant into a " +
+	"compact form that preserves every fact, decision, file name and code detail needed to continue " +
+	"the conversation. Reply with the summary only.\n\n"
+
+type sessionSummarizeParams struct {
+	SessionID string `json:"sessionId"`
+	// KeepRecentTurns overrides --summarize-keep-turns for this call: the
+	// most recent N user/assistant exchanges stay verbatim and everything
+	// before them is folded into the summary.
+	KeepRecentTurns *int `json:"keepRecentTurns,omitempty"`
+}
+
+// rpcSessionSummarize folds the older part of a session's history into a
+// model-written summary on demand; the same operation runs automatically
+// when --summarize-threshold is set and history outgrows it.
+func (s *Server) rpcSessionSummarize(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p sessionSummarizeParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	sess := s.manager.Get(p.SessionID)
+	if sess == nil {
+		return nil, errInvalidParams("unknown session: %s", p.SessionID)
+	}
+	keep := s.cfg.SummarizeKeepTurns
+	if p.KeepRecentTurns != nil {
+		keep = *p.KeepRecentTurns
+	}
+	summarized, kept, rpcErr := s.summarizeHistory(ctx, sess, keep)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return map[string]any{"summarized": summarized, "kept": kept}, nil
+}
+
+// maybeSummarize kicks off automatic summarization after a turn when the
+// stored history has grown past --summarize-threshold. It runs in the
+// background — the turn that tripped it is already done — and failures only
+// log: the next turn will trip the threshold again.
+func (s *Server) maybeSummarize(sess *session.Session) {
+	if s.cfg.SummarizeThreshold <= 0 || historyChars(sess.History()) < s.cfg.SummarizeThreshold {
+		return
+	}
+	s.goTurn(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.SendTimeout)
+		defer cancel()
+		if _, _, rpcErr := s.summarizeHistory(ctx, sess, s.cfg.SummarizeKeepTurns); rpcErr != nil {
+			log.Printf("session %s: automatic history summarization: %s", sess.ID, rpcErr.Message)
+		}
+	})
+}
+
+// historyChars measures stored history the same way the stats estimator
+// counts tokens: by content length.
+func historyChars(history []session.Message) int {
+	n := 0
+	for _, m := range history {
+		n += len(m.Content)
+	}
+	return n
+}
+
+// summarizeHistory replaces all history before the kept recent turns with a
+// single role-"summary" message written by the session's model, then emits a
+// history_summarized frame. At most one summarization runs per session at a
+// time; the prefix is replaced by snapshot count, so a turn that completes
+// mid-summarization keeps its messages.
+func (s *Server) summarizeHistory(ctx context.Context, sess *session.Session, keepTurns int) (summarized, kept int, rpcErr *rpcError) {
+	if keepTurns < 0 {
+		return 0, 0, errInvalidParams("keepRecentTurns must not be negative")
+	}
+	if _, loaded := s.summarizing.LoadOrStore(sess.ID, struct{}{}); loaded {
+		return 0, 0, &rpcError{Code: codeInternalError, Message: "a summarization is already running on this session"}
+	}
+	defer s.summarizing.Delete(sess.ID)
+	history := sess.History()
+	cut := len(history) - keepTurns*2
+	if cut < 2 {
+		// Folding a single message into a single summary gains nothing.
+		return 0, 0, errInvalidParams("nothing to summarize: %d message(s) precede the %d kept verbatim",
+			max(cut, 0), keepTurns*2)
+	}
+	var b strings.Builder
+	for _, m := range history[:cut] {
+		fmt.Fprintf(&b, "%s: %s\n", m.Role, m.Content)
+	}
+	summary, err := s.summarizeText(ctx, sess.Model, b.String())
+	if err != nil {
+		return 0, 0, &rpcError{Code: codeInternalError, Message: "summarizing history: " + err.Error()}
+	}
+	if summary == "" {
+		return 0, 0, &rpcError{Code: codeInternalError, Message: "summarizer returned no content"}
+	}
+	sess.ReplaceHistoryPrefix(cut, session.Message{Role: "summary", Content: summary, Timestamp: time.Now()})
+	kept = len(history) - cut
+	s.publish(sess, Frame{Type: "history_summarized", Summarized: cut, Kept: kept})
+	log.Printf("session %s: summarized %d history message(s) into %d chars; %d kept verbatim",
+		sess.ID, cut, len(summary), kept)
+	return cut, kept, nil
+}
+
+// summarizeText asks the model for the summary on a throwaway SDK session,
+// so the session's own SDK conversation never sees the summarization
+// exchange. Mock mode returns a canned summary.
+func (s *Server) summarizeText(ctx context.Context, model, transcript string) (string, error) {
+	if s.cfg.Mock {
+		return "Mock summary of the earlier conversation.", nil
+	}
+	sdkID, err := s.client.CreateSession(ctx, copilot.SessionConfig{Model: model})
+	if err != nil {
+		return "", fmt.Errorf("creating summarizer session: %w", err)
+	}
+	defer func() {
+		dctx, dcancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer dcancel()
+		_ = s.client.DestroySession(dctx, sdkID)
+	}()
+	resp, err := s.client.SendMessage(ctx, sdkID, copilot.MessageRequest{Prompt: summarizePrompt + transcript}, nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
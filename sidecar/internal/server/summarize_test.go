@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// seedHistory appends n user/assistant exchanges to a session.
+func seedHistory(srv *Server, sessionID string, n int) {
+	sess := srv.Manager().Get(sessionID)
+	for i := 0; i < n; i++ {
+		sess.AppendUserMessage("msg-seed", "an old question about the code", nil)
+		sess.AppendHistory("assistant", "a long-winded old answer full of detail")
+	}
+}
+
+func TestSessionSummarizeFoldsOlderHistory(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		if !strings.HasPrefix(req.Prompt, summarizePrompt) {
+			t.Errorf("summarizer prompt missing its preamble: %q", req.Prompt)
+		}
+		if !strings.Contains(req.Prompt, "user: an old question") {
+			t.Errorf("transcript missing from prompt: %q", req.Prompt)
+		}
+		return &copilot.MessageResponse{MessageID: "msg-sum", Content: "SUMMARY", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	seedHistory(srv, created.SessionID, 4)
+
+	result, rpcErr := doRPC(t, srv, "session.summarize", map[string]any{
+		"sessionId": created.SessionID, "keepRecentTurns": 1,
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.summarize: %v", rpcErr)
+	}
+	var out struct {
+		Summarized int `json:"summarized"`
+		Kept       int `json:"kept"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if out.Summarized != 6 || out.Kept != 2 {
+		t.Errorf("summarized %d kept %d, want 6 and 2", out.Summarized, out.Kept)
+	}
+	history := srv.Manager().Get(created.SessionID).History()
+	if len(history) != 3 {
+		t.Fatalf("history has %d messages, want summary + 2 kept", len(history))
+	}
+	if history[0].Role != "summary" || history[0].Content != "SUMMARY" {
+		t.Errorf("history[0] = %+v, want the summary message", history[0])
+	}
+	if history[1].Role != "user" || history[2].Role != "assistant" {
+		t.Errorf("kept tail = %q/%q, want the last exchange verbatim", history[1].Role, history[2].Role)
+	}
+	// The summarizer ran on a throwaway SDK session, destroyed afterwards.
+	if fake.destroyCalls.Load() == 0 {
+		t.Error("summarizer SDK session was never destroyed")
+	}
+
+	frames, _ := srv.Manager().Get(created.SessionID).EventsSince(0)
+	for _, raw := range frames {
+		var f map[string]any
+		_ = json.Unmarshal(raw, &f)
+		if f["type"] == "history_summarized" {
+			if f["summarized"] != float64(6) || f["kept"] != float64(2) {
+				t.Errorf("history_summarized frame = %v", f)
+			}
+			return
+		}
+	}
+	t.Fatal("no history_summarized frame published")
+}
+
+func TestSessionSummarizeValidation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.summarize", map[string]any{
+		"sessionId": created.SessionID,
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("empty history: got %v, want invalid params", rpcErr)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.summarize", map[string]any{
+		"sessionId": created.SessionID, "keepRecentTurns": -1,
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("negative keepRecentTurns: got %v, want invalid params", rpcErr)
+	}
+}
+
+func TestAutoSummarizeTriggersPastThreshold(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		if strings.HasPrefix(req.Prompt, summarizePrompt) {
+			return &copilot.MessageResponse{MessageID: "msg-sum", Content: "AUTO SUMMARY"}, nil
+		}
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "a reply", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.SummarizeThreshold = 40
+		cfg.SummarizeKeepTurns = 1
+	})
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	sess := srv.Manager().Get(created.SessionID)
+	seedHistory(srv, created.SessionID, 2)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "one more question",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+	waitFor(t, 2*time.Second, func() bool {
+		h := sess.History()
+		return len(h) > 0 && h[0].Role == "summary" && h[0].Content == "AUTO SUMMARY"
+	}, "automatic summarization after the turn")
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// "symbolGraph" context items: {"type":"symbolGraph","symbols":[...]}
+// attaches structured symbol metadata — signatures, definition sites and
+// relationships the plugin's language server already computes — instead of
+// raw source ranges. The bridge renders the graph into a compact labeled
+// block, so the model gets the semantic structure without a full file
+// attachment. See copilot.SymbolInfo for the symbol schema.
+
+const (
+	// maxSymbolGraphSymbols bounds how many symbols one item may carry;
+	// maxSymbolGraphBytes caps the rendered block. When the byte cap bites,
+	// whole trailing symbols are dropped — clipping mid-entry would leave
+	// the model a dangling half-symbol — and the block says how many.
+	maxSymbolGraphSymbols = 64
+	maxSymbolGraphBytes   = 16 * 1024
+)
+
+// formatSymbolGraphItems validates "symbolGraph" context items and renders
+// each into a labeled Content block.
+func formatSymbolGraphItems(items []copilot.ContextItem) *rpcError {
+	for i := range items {
+		item := &items[i]
+		if item.Type != "symbolGraph" {
+			continue
+		}
+		if len(item.Symbols) == 0 {
+			return errInvalidParams("symbolGraph context item needs at least one symbol")
+		}
+		if len(item.Symbols) > maxSymbolGraphSymbols {
+			return errInvalidParams("symbolGraph has %d symbols; the limit is %d", len(item.Symbols), maxSymbolGraphSymbols)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Symbol graph (%d symbols):\n", len(item.Symbols))
+		omitted := 0
+		for _, sym := range item.Symbols {
+			if sym.Name == "" || sym.Kind == "" {
+				return errInvalidParams("symbolGraph symbols need a name and a kind")
+			}
+			for _, rel := range sym.Relations {
+				if rel.Kind == "" || rel.Target == "" {
+					return errInvalidParams("symbolGraph relation on %q needs a kind and a target", sym.Name)
+				}
+			}
+			entry := renderSymbol(sym)
+			if omitted > 0 || b.Len()+len(entry) > maxSymbolGraphBytes {
+				omitted++
+				continue
+			}
+			b.WriteString(entry)
+		}
+		if omitted > 0 {
+			fmt.Fprintf(&b, "(%d more symbols omitted to fit the size cap)\n", omitted)
+		}
+		item.Content = strings.TrimRight(b.String(), "\n")
+		item.Symbols = nil
+	}
+	return nil
+}
+
+// renderSymbol renders one symbol as a bullet with its relations grouped by
+// kind on indented lines beneath it, in first-seen order.
+func renderSymbol(sym copilot.SymbolInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- %s (%s)", sym.Name, sym.Kind)
+	if sym.File != "" {
+		b.WriteString(" in " + sym.File)
+		if sym.Line > 0 {
+			fmt.Fprintf(&b, ":%d", sym.Line)
+		}
+	}
+	if sym.Signature != "" {
+		b.WriteString(" — " + sym.Signature)
+	}
+	b.WriteByte('\n')
+	var kinds []string
+	targets := make(map[string][]string)
+	for _, rel := range sym.Relations {
+		if _, ok := targets[rel.Kind]; !ok {
+			kinds = append(kinds, rel.Kind)
+		}
+		targets[rel.Kind] = append(targets[rel.Kind], rel.Target)
+	}
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "  %s: %s\n", kind, strings.Join(targets[kind], ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// Thinking-frame timing: the first frame is delayed so a cached or otherwise
+// instant response never shows a spinner it immediately contradicts, then
+// repeats so a stream that reconnects mid-wait still sees one.
+const (
+	thinkingInitialDelay = 200 * time.Millisecond
+	thinkingInterval     = 2 * time.Second
+)
+
+// thinkingIndicator emits synthetic {"type":"thinking"} frames between the
+// start of a turn and its first real event, giving the UI a backend-driven
+// signal to show a spinner during a cold model's multi-second warm-up.
+type thinkingIndicator struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+// startThinking begins the indicator for one turn. On sessions that did not
+// opt in it returns an inert indicator, so callers need no conditional.
+func (s *Server) startThinking(sess *session.Session) *thinkingIndicator {
+	ti := &thinkingIndicator{stop: make(chan struct{})}
+	if !sess.Thinking() {
+		ti.done()
+		return ti
+	}
+	go func() {
+		timer := time.NewTimer(thinkingInitialDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ti.stop:
+				return
+			case <-timer.C:
+				s.publish(sess, Frame{Type: "thinking"})
+				timer.Reset(thinkingInterval)
+			}
+		}
+	}()
+	return ti
+}
+
+// done stops the indicator; safe to call more than once.
+func (ti *thinkingIndicator) done() {
+	ti.once.Do(func() { close(ti.stop) })
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestThinkingFramesWhileWaitingForFirstToken(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		time.Sleep(2 * thinkingInitialDelay)
+		onEvent(copilot.StreamEvent{Type: "text", Content: "hello"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "hello"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	sess.SetThinking(true)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	firstThinking, firstText := -1, -1
+	for i, f := range frames {
+		switch f["type"] {
+		case "thinking":
+			if firstThinking < 0 {
+				firstThinking = i
+			}
+		case "text":
+			if firstText < 0 {
+				firstText = i
+			}
+		}
+	}
+	if firstThinking < 0 {
+		t.Fatal("no thinking frame during the slow first token")
+	}
+	if firstText >= 0 && firstThinking > firstText {
+		t.Errorf("thinking frame at %d arrived after text at %d", firstThinking, firstText)
+	}
+}
+
+func TestNoThinkingFramesForInstantOrUnoptedTurns(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "instant"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "instant"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+
+	// Opted in, but the response arrives before the initial delay elapses.
+	instant, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	instant.SetThinking(true)
+	// Not opted in at all; a slow turn still emits nothing.
+	unopted, _ := srv.Manager().Create("gpt-4o", "sdk-2", "")
+
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": instant.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	for _, f := range drainFrames(t, instant, 2*time.Second) {
+		if f["type"] == "thinking" {
+			t.Error("thinking frame emitted for an instant response")
+		}
+	}
+
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		time.Sleep(2 * thinkingInitialDelay)
+		onEvent(copilot.StreamEvent{Type: "text", Content: "slow"})
+		return &copilot.MessageResponse{MessageID: "msg-2", Content: "slow"}, nil
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": unopted.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	for _, f := range drainFrames(t, unopted, 5*time.Second) {
+		if f["type"] == "thinking" {
+			t.Error("thinking frame emitted for a session that did not opt in")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/callback"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// sendToolCalls scripts a fake turn that issues the given tool calls and then
+// completes; the bridge drains them all before the done frame.
+func sendToolCalls(events ...copilot.StreamEvent) func(context.Context, string, copilot.MessageRequest, copilot.EventHandler) (*copilot.MessageResponse, error) {
+	return func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		for _, ev := range events {
+			onEvent(ev)
+		}
+		return &copilot.MessageResponse{MessageID: "msg-tools", Content: "done"}, nil
+	}
+}
+
+func runToolTurn(t *testing.T, srv *Server) {
+	t.Helper()
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "run the tools", "autoApprove": []string{"a", "b", "c"},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(created.SessionID), 10*time.Second)
+}
+
+func TestParallelToolCallsRunConcurrently(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = sendToolCalls(
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c1", ToolName: "a", Parallel: true},
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c2", ToolName: "b", Parallel: true},
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c3", ToolName: "c", Parallel: true},
+	)
+	srv, rec := newFakeServer(t, fake, func(cfg *Config) { cfg.MaxToolConcurrency = 4 })
+	var inFlight, maxInFlight atomic.Int64
+	rec.respond = func(req callback.ToolRequest) (callback.ToolResponse, int) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			cur := maxInFlight.Load()
+			if n <= cur || maxInFlight.CompareAndSwap(cur, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		return callback.ToolResponse{Result: "ok"}, http.StatusOK
+	}
+	runToolTurn(t, srv)
+	if got := maxInFlight.Load(); got < 2 {
+		t.Errorf("max concurrent tool executions = %d, want at least 2", got)
+	}
+}
+
+func TestToolCallsSerialByDefault(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = sendToolCalls(
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c1", ToolName: "a", Parallel: true},
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c2", ToolName: "b", Parallel: true},
+	)
+	srv, rec := newFakeServer(t, fake, nil)
+	var inFlight, maxInFlight atomic.Int64
+	rec.respond = func(req callback.ToolRequest) (callback.ToolResponse, int) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		if cur := maxInFlight.Load(); n > cur {
+			maxInFlight.Store(n)
+		}
+		time.Sleep(30 * time.Millisecond)
+		return callback.ToolResponse{Result: "ok"}, http.StatusOK
+	}
+	runToolTurn(t, srv)
+	if got := maxInFlight.Load(); got != 1 {
+		t.Errorf("max concurrent tool executions = %d, want 1 with the default cap", got)
+	}
+}
+
+func TestUnmarkedToolCallWaitsForParallelBatch(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = sendToolCalls(
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c1", ToolName: "a", Parallel: true},
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c2", ToolName: "b", Parallel: true},
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c3", ToolName: "c"}, // ordering-dependent
+	)
+	srv, rec := newFakeServer(t, fake, func(cfg *Config) { cfg.MaxToolConcurrency = 4 })
+	var mu sync.Mutex
+	finished := map[string]time.Time{}
+	var serialStart time.Time
+	rec.respond = func(req callback.ToolRequest) (callback.ToolResponse, int) {
+		if req.Tool == "c" {
+			mu.Lock()
+			serialStart = time.Now()
+			mu.Unlock()
+			return callback.ToolResponse{Result: "ok"}, http.StatusOK
+		}
+		time.Sleep(60 * time.Millisecond)
+		mu.Lock()
+		finished[req.Tool] = time.Now()
+		mu.Unlock()
+		return callback.ToolResponse{Result: "ok"}, http.StatusOK
+	}
+	runToolTurn(t, srv)
+	mu.Lock()
+	defer mu.Unlock()
+	if serialStart.IsZero() || len(finished) != 2 {
+		t.Fatalf("expected all three tools to run; serial at %v, finished %v", serialStart, finished)
+	}
+	for tool, done := range finished {
+		if serialStart.Before(done) {
+			t.Errorf("serial call started at %v, before parallel %q finished at %v", serialStart, tool, done)
+		}
+	}
+}
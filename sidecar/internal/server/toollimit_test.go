@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// loopingToolClient emits tool_call events until its context is cancelled,
+// modelling an agent stuck in a tool loop.
+func loopingToolClient() *fakeClient {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		for i := 0; ; i++ {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			onEvent(copilot.StreamEvent{
+				Type:       "tool_call",
+				ToolName:   "readFile",
+				ToolCallID: "call-" + string(rune('a'+i%26)),
+				ToolArgs:   map[string]any{"path": "main.go"},
+			})
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return fake
+}
+
+func TestMaxToolIterations(t *testing.T) {
+	srv, _ := newFakeServer(t, loopingToolClient(), nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":         sess.ID,
+		"prompt":            "loop forever",
+		"maxToolIterations": 3,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	toolCalls, limitFrames := 0, 0
+	for _, f := range frames {
+		switch f["type"] {
+		case "tool_call":
+			toolCalls++
+		case "tool_limit_reached":
+			limitFrames++
+		case "error":
+			t.Errorf("unexpected error frame: %v", f)
+		}
+	}
+	if toolCalls != 3 {
+		t.Errorf("tool_call frames = %d, want 3", toolCalls)
+	}
+	if limitFrames != 1 {
+		t.Errorf("tool_limit_reached frames = %d, want 1", limitFrames)
+	}
+	if last := frames[len(frames)-1]; last["type"] != "done" {
+		t.Errorf("last frame = %v, want done", last)
+	}
+}
+
+func TestMaxToolIterationsServerCeiling(t *testing.T) {
+	srv, _ := newFakeServer(t, loopingToolClient(), func(cfg *Config) { cfg.MaxToolIterations = 2 })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	// The param cannot raise the server's ceiling.
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":         sess.ID,
+		"prompt":            "loop forever",
+		"maxToolIterations": 50,
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	toolCalls := 0
+	for _, f := range frames {
+		if f["type"] == "tool_call" {
+			toolCalls++
+		}
+	}
+	if toolCalls != 2 {
+		t.Errorf("tool_call frames = %d, want the server ceiling of 2", toolCalls)
+	}
+}
+
+func TestMaxToolIterationsValidation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":         sess.ID,
+		"prompt":            "hi",
+		"maxToolIterations": -1,
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("negative maxToolIterations: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/callback"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/session"
+)
+
+// newFakeServer returns a Server backed by a fakeClient and a recording
+// callback endpoint.
+func newFakeServer(t *testing.T, fake *fakeClient, mutate func(*Config)) (*Server, *callbackRecorder) {
+	t.Helper()
+	rec := &callbackRecorder{requests: make(chan callback.ToolRequest, 16)}
+	ts := httptest.NewServer(rec)
+	t.Cleanup(ts.Close)
+	cb, err := callback.NewWithRoutes(ts.URL, nil)
+	if err != nil {
+		t.Fatalf("building callback client: %v", err)
+	}
+	cfg := Config{}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	srv, err := New(cfg, session.NewManager(time.Hour), fake, cb)
+	if err != nil {
+		t.Fatalf("building server: %v", err)
+	}
+	return srv, rec
+}
+
+// callbackRecorder is an httptest handler that records tool requests.
+type callbackRecorder struct {
+	requests chan callback.ToolRequest
+	respond  func(callback.ToolRequest) (callback.ToolResponse, int)
+	// streamRespond, when set, takes over the response entirely so a test
+	// can emit a streaming (ndjson) tool response with progress lines.
+	streamRespond func(http.ResponseWriter, callback.ToolRequest)
+}
+
+func (c *callbackRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req callback.ToolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.requests <- req
+	if c.streamRespond != nil {
+		c.streamRespond(w, req)
+		return
+	}
+	resp := callback.ToolResponse{Result: "tool ok"}
+	status := http.StatusOK
+	if c.respond != nil {
+		resp, status = c.respond(req)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// drainFrames collects frames published to a session until a done frame or
+// the timeout.
+func drainFrames(t *testing.T, sess *session.Session, timeout time.Duration) []map[string]any {
+	t.Helper()
+	var frames []map[string]any
+	deadline := time.After(timeout)
+	for {
+		select {
+		case raw, ok := <-sess.EventChan:
+			if !ok {
+				return frames
+			}
+			var frame map[string]any
+			if err := json.Unmarshal(raw, &frame); err != nil {
+				t.Fatalf("invalid frame %q: %v", raw, err)
+			}
+			frames = append(frames, frame)
+			if frame["type"] == "done" {
+				return frames
+			}
+		case <-deadline:
+			return frames
+		}
+	}
+}
+
+func TestAutoApproveValidation(t *testing.T) {
+	srv := newMockServer(t, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "", "")
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":   sess.ID,
+		"prompt":      "hi",
+		"autoApprove": []string{"read file"},
+	})
+	if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
+
+func TestAutoApprovedToolSkipsApproval(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-1", ToolName: "file_read", ToolArgs: map[string]any{"path": "a.go"}})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "done"}, nil
+	}
+	srv, rec := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId":   sess.ID,
+		"prompt":      "read it",
+		"autoApprove": []string{"file_read"},
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	select {
+	case req := <-rec.requests:
+		if req.RequireApproval {
+			t.Error("auto-approved tool still asked for approval")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback never invoked")
+	}
+	frames := drainFrames(t, sess, 2*time.Second)
+	found := false
+	for _, f := range frames {
+		if f["type"] == "tool_auto_approved" && f["name"] == "file_read" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no tool_auto_approved frame in %v", frames)
+	}
+}
+
+func TestUnlistedToolRequiresApproval(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-1", ToolName: "file_write"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "done"}, nil
+	}
+	srv, rec := newFakeServer(t, fake, nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "write it",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	select {
+	case req := <-rec.requests:
+		if !req.RequireApproval {
+			t.Error("unlisted tool was not routed through approval")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback never invoked")
+	}
+}
+
+func TestToolProgressForwardedAsFrames(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-1", ToolName: "run_tests"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "done"}, nil
+	}
+	srv, rec := newFakeServer(t, fake, nil)
+	rec.streamRespond = func(w http.ResponseWriter, req callback.ToolRequest) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, pct := range []float64{30, 90} {
+			p := pct
+			enc.Encode(map[string]any{"progress": map[string]any{"message": "running", "percent": &p}})
+			w.(http.Flusher).Flush()
+		}
+		enc.Encode(callback.ToolResponse{Result: "142 tests passed"})
+	}
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "run the suite",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	select {
+	case result := <-fake.toolResults:
+		if !result.Success || result.Content != "142 tests passed" {
+			t.Errorf("tool result = %+v, want the stream's final result", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no tool result reached the SDK")
+	}
+	var percents []float64
+	for _, f := range drainFrames(t, sess, 2*time.Second) {
+		if f["type"] != "tool_progress" {
+			continue
+		}
+		if f["name"] != "run_tests" || f["callId"] != "call-1" || f["message"] != "running" {
+			t.Errorf("tool_progress frame = %v, want tool identity and message carried", f)
+		}
+		pct, _ := f["percent"].(float64)
+		percents = append(percents, pct)
+	}
+	if len(percents) != 2 || percents[0] != 30 || percents[1] != 90 {
+		t.Errorf("tool_progress percents = %v, want [30 90]", percents)
+	}
+}
+
+func TestFailingToolResultForwardedToSDK(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "tool_call", ToolCallID: "call-1", ToolName: "file_write"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "done"}, nil
+	}
+	srv, rec := newFakeServer(t, fake, nil)
+	rec.respond = func(callback.ToolRequest) (callback.ToolResponse, int) {
+		failed := false
+		return callback.ToolResponse{Success: &failed, Error: "write denied: EACCES"}, http.StatusOK
+	}
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": sess.ID,
+		"prompt":    "write it",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	select {
+	case result := <-fake.toolResults:
+		if result.Success || result.Error != "write denied: EACCES" {
+			t.Errorf("tool result = %+v, want the plugin's failure forwarded", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no tool result reached the SDK")
+	}
+	found := false
+	for _, f := range drainFrames(t, sess, 2*time.Second) {
+		if f["type"] == "tool_result" && f["success"] == false && f["message"] == "write denied: EACCES" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("no tool_result frame reporting the failure")
+	}
+}
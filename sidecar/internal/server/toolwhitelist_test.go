@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestToolsWhitelistUnknownToolRejected(t *testing.T) {
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	for _, tools := range [][]string{
+		{"no_such_tool"},
+		{"read_file", "no_such_tool"},
+		{},
+	} {
+		_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": created.SessionID, "prompt": "go", "tools": tools,
+		})
+		if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("tools %v: got %v, want code %d", tools, rpcErr, codeInvalidParams)
+		}
+	}
+}
+
+func TestToolsWhitelistEnforcedAndEchoed(t *testing.T) {
+	fake := newFakeClient()
+	var sdkTools []string
+	inner := sendToolCalls(
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c1", ToolName: "read_file"},
+		copilot.StreamEvent{Type: "tool_call", ToolCallID: "c2", ToolName: "write_file"},
+	)
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		sdkTools = req.Tools
+		return inner(ctx, sessionID, req, onEvent)
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "read it", "tools": []string{"read_file"},
+		"autoApprove": []string{"read_file", "write_file"},
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var metaSeen, blockedSeen bool
+	for _, f := range drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second) {
+		switch f["type"] {
+		case "meta":
+			if msg, _ := f["message"].(string); strings.Contains(msg, "read_file") {
+				metaSeen = true
+			}
+		case "tool_blocked":
+			if f["name"] == "write_file" {
+				blockedSeen = true
+			}
+		}
+	}
+	if !metaSeen {
+		t.Error("no meta frame announcing the tool whitelist")
+	}
+	if !blockedSeen {
+		t.Error("write_file was not blocked by the whitelist")
+	}
+	if len(sdkTools) != 1 || sdkTools[0] != "read_file" {
+		t.Errorf("SDK saw tools %v, want [read_file]", sdkTools)
+	}
+}
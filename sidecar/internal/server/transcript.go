@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// transcriptQueueSize bounds how many pending lines a session's transcript
+// can buffer before further lines are dropped. Writing must never block the
+// event stream.
+const transcriptQueueSize = 256
+
+// transcripts manages per-session JSONL transcript files under a directory.
+// It is inert when the directory is empty (the feature is opt-in:
+// transcripts contain prompts and streamed responses, i.e. potentially
+// sensitive code).
+type transcripts struct {
+	dir string
+
+	mu      sync.Mutex
+	writers map[string]*transcriptWriter
+}
+
+func newTranscripts(dir string) *transcripts {
+	return &transcripts{dir: dir, writers: make(map[string]*transcriptWriter)}
+}
+
+// transcriptEntry is one line of a transcript file.
+type transcriptEntry struct {
+	Time   string          `json:"time"`
+	Kind   string          `json:"kind"` // "prompt" or "frame"
+	Prompt string          `json:"prompt,omitempty"`
+	Frame  json.RawMessage `json:"frame,omitempty"`
+}
+
+// enabled reports whether transcript writing is configured.
+func (t *transcripts) enabled() bool {
+	return t != nil && t.dir != ""
+}
+
+// record appends one entry to the session's transcript, creating the file
+// lazily. The write is queued; a full queue drops the entry rather than
+// blocking the caller.
+func (t *transcripts) record(sessionID string, entry transcriptEntry) {
+	if !t.enabled() {
+		return
+	}
+	entry.Time = time.Now().Format(time.RFC3339Nano)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("transcript %s: marshalling entry: %v", sessionID, err)
+		return
+	}
+	t.mu.Lock()
+	w := t.writers[sessionID]
+	if w == nil {
+		w = newTranscriptWriter(filepath.Join(t.dir, sessionID+".jsonl"))
+		t.writers[sessionID] = w
+	}
+	t.mu.Unlock()
+	w.enqueue(line)
+}
+
+// closeSession flushes and closes the session's transcript file, if any.
+func (t *transcripts) closeSession(sessionID string) {
+	if !t.enabled() {
+		return
+	}
+	t.mu.Lock()
+	w := t.writers[sessionID]
+	delete(t.writers, sessionID)
+	t.mu.Unlock()
+	if w != nil {
+		w.close()
+	}
+}
+
+// closeAll flushes and closes every open transcript.
+func (t *transcripts) closeAll() {
+	if !t.enabled() {
+		return
+	}
+	t.mu.Lock()
+	writers := t.writers
+	t.writers = make(map[string]*transcriptWriter)
+	t.mu.Unlock()
+	for _, w := range writers {
+		w.close()
+	}
+}
+
+// transcriptWriter appends lines to one file from a dedicated goroutine.
+type transcriptWriter struct {
+	lines chan []byte
+	done  chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newTranscriptWriter(path string) *transcriptWriter {
+	w := &transcriptWriter{
+		lines: make(chan []byte, transcriptQueueSize),
+		done:  make(chan struct{}),
+	}
+	go w.run(path)
+	return w
+}
+
+func (w *transcriptWriter) run(path string) {
+	defer close(w.done)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		log.Printf("transcript: opening %s: %v", path, err)
+		// Drain so enqueuers are not stuck behind a full channel forever.
+		for range w.lines {
+		}
+		return
+	}
+	defer f.Close()
+	for line := range w.lines {
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			log.Printf("transcript: writing %s: %v", path, err)
+		}
+	}
+}
+
+func (w *transcriptWriter) enqueue(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.lines <- line:
+	default:
+		// Dropping beats blocking the event stream on slow disk.
+	}
+}
+
+func (w *transcriptWriter) close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.lines)
+	w.mu.Unlock()
+	<-w.done
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		name   string
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"short ascii untouched", "hello", 10, "hello"},
+		{"exact length untouched", "hello", 5, "hello"},
+		{"long ascii cut", "hello world", 8, "hello..."},
+		{"cjk cut on rune boundary", strings.Repeat("世", 10), 8, strings.Repeat("世", 5) + "..."},
+		{"emoji cut on rune boundary", strings.Repeat("🌍", 10), 8, strings.Repeat("🌍", 5) + "..."},
+		{"mixed", "ab界🌍cdef界🌍", 7, "ab界🌍..."},
+		{"tiny maxLen", "hello", 2, "..."},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := truncate(tc.in, tc.maxLen)
+			if got != tc.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tc.in, tc.maxLen, got, tc.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) produced invalid UTF-8: %q", tc.in, tc.maxLen, got)
+			}
+			if tc.maxLen >= 3 && utf8.RuneCountInString(got) > tc.maxLen {
+				t.Errorf("truncate(%q, %d) is %d runes", tc.in, tc.maxLen, utf8.RuneCountInString(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Time-to-first-token instrumentation: TTFT is the interval between the
+// producer starting a turn and the first content-bearing event, the number
+// that regresses first when a Copilot CLI update slows cold inference. The
+// statsTracker already timestamps both ends for the per-turn stats frame;
+// the recorder here aggregates those samples into a /metrics histogram for
+// alerting and a rolling p50/p95 in admin.stats for eyeballing.
+
+// ttftBuckets are the histogram upper bounds in milliseconds, chosen so the
+// interesting regressions (sub-second to tens of seconds) land in distinct
+// buckets. Prometheus convention adds an implicit +Inf bucket at the end.
+var ttftBuckets = []int64{100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// ttftWindow is how many recent samples the percentile estimate covers.
+const ttftWindow = 256
+
+// ttftRecorder accumulates TTFT samples: cumulative bucket counts for the
+// /metrics histogram and a ring of the most recent samples for percentiles.
+// Turns that produce no content contribute nothing.
+type ttftRecorder struct {
+	mu      sync.Mutex
+	counts  []int64 // one per ttftBuckets entry, plus +Inf at the end
+	sumMs   int64
+	total   int64
+	recent  []int64
+	nextIdx int
+}
+
+func (r *ttftRecorder) record(ms int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make([]int64, len(ttftBuckets)+1)
+	}
+	idx := len(ttftBuckets)
+	for i, bound := range ttftBuckets {
+		if ms <= bound {
+			idx = i
+			break
+		}
+	}
+	r.counts[idx]++
+	r.sumMs += ms
+	r.total++
+	if len(r.recent) < ttftWindow {
+		r.recent = append(r.recent, ms)
+	} else {
+		r.recent[r.nextIdx] = ms
+		r.nextIdx = (r.nextIdx + 1) % ttftWindow
+	}
+}
+
+// percentile returns the p-th percentile (nearest-rank) of the rolling
+// window, or 0 when no turn has produced a token yet.
+func (r *ttftRecorder) percentile(p int) int64 {
+	r.mu.Lock()
+	sorted := make([]int64, len(r.recent))
+	copy(sorted, r.recent)
+	r.mu.Unlock()
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// samples reports how many turns the rolling window currently holds.
+func (r *ttftRecorder) samples() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.recent)
+}
+
+// writeMetrics renders the histogram in Prometheus text format. Bucket
+// counts are cumulative, per the exposition format.
+func (r *ttftRecorder) writeMetrics(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cum := int64(0)
+	for i, bound := range ttftBuckets {
+		if r.counts != nil {
+			cum += r.counts[i]
+		}
+		fmt.Fprintf(w, "sidecar_turn_ttft_ms_bucket{le=\"%d\"} %d\n", bound, cum)
+	}
+	fmt.Fprintf(w, "sidecar_turn_ttft_ms_bucket{le=\"+Inf\"} %d\n", r.total)
+	fmt.Fprintf(w, "sidecar_turn_ttft_ms_sum %d\n", r.sumMs)
+	fmt.Fprintf(w, "sidecar_turn_ttft_ms_count %d\n", r.total)
+}
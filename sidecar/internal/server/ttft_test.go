@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestTTFTRecorderBucketsAndPercentiles(t *testing.T) {
+	var r ttftRecorder
+	for _, ms := range []int64{50, 80, 120, 300, 12000} {
+		r.record(ms)
+	}
+	if got := r.percentile(50); got != 120 {
+		t.Errorf("p50 = %d, want 120", got)
+	}
+	if got := r.percentile(95); got != 12000 {
+		t.Errorf("p95 = %d, want 12000", got)
+	}
+	var buf bytes.Buffer
+	r.writeMetrics(&buf)
+	out := buf.String()
+	for _, line := range []string{
+		`sidecar_turn_ttft_ms_bucket{le="100"} 2`,
+		`sidecar_turn_ttft_ms_bucket{le="500"} 4`,
+		`sidecar_turn_ttft_ms_bucket{le="+Inf"} 5`,
+		"sidecar_turn_ttft_ms_count 5",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("metrics output missing %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestTTFTSlowFirstTokenIsRecordedAndWarned(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		// The delay is what the tracker should measure: the turn starts at
+		// send time, the first token arrives only now.
+		time.Sleep(60 * time.Millisecond)
+		onEvent(copilot.StreamEvent{Type: "text", Content: "slow hello"})
+		return &copilot.MessageResponse{Content: "slow hello"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.TTFTWarnThreshold = time.Millisecond
+	})
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": id, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+
+	res, rpcErr := doRPC(t, srv, "admin.stats", map[string]any{})
+	if rpcErr != nil {
+		t.Fatalf("admin.stats: %v", rpcErr)
+	}
+	var stats struct {
+		TTFT struct {
+			P50Ms   int64 `json:"p50Ms"`
+			P95Ms   int64 `json:"p95Ms"`
+			Samples int   `json:"samples"`
+		} `json:"ttft"`
+	}
+	if err := json.Unmarshal(res, &stats); err != nil {
+		t.Fatalf("decoding admin.stats: %v", err)
+	}
+	if stats.TTFT.Samples != 1 {
+		t.Errorf("ttft.samples = %d, want 1", stats.TTFT.Samples)
+	}
+	if stats.TTFT.P50Ms < 50 {
+		t.Errorf("ttft.p50Ms = %d, want at least the 50ms the fake slept", stats.TTFT.P50Ms)
+	}
+	if stats.TTFT.P95Ms < stats.TTFT.P50Ms {
+		t.Errorf("ttft.p95Ms = %d, want >= p50 %d", stats.TTFT.P95Ms, stats.TTFT.P50Ms)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `sidecar_turn_ttft_ms_bucket{le="+Inf"} 1`) {
+		t.Errorf("/metrics missing the TTFT histogram:\n%s", body)
+	}
+	if !strings.Contains(logBuf.String(), "warn threshold") {
+		t.Errorf("expected a TTFT warning in the log, got:\n%s", logBuf.String())
+	}
+}
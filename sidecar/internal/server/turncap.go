@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Global turn cap: per-session serialization stops one session from running
+// two turns at once, but nothing stops fifty sessions from all generating
+// simultaneously through the one Copilot CLI. --max-concurrent-turns bounds
+// that. startSend acquires a slot before spawning the producer and the
+// producer releases it when the turn ends, however it ends; a send arriving
+// with every slot taken is rejected with codeServerBusy, or waits up to
+// turnQueueTimeout when it sets queueIfBusy. session.retry claims a slot
+// the same way, and session.compare's sub-turns each hold one for the
+// length of their SDK send — every path into a generation goes through the
+// cap, or it protects nothing.
+
+// turnQueueTimeout bounds how long a queueIfBusy send waits for a turn slot
+// before giving up with codeServerBusy.
+const turnQueueTimeout = 30 * time.Second
+
+// acquireTurnSlot claims a slot under the global turn cap, queueing when
+// asked to. It also maintains the in-flight gauge, so it runs (and must be
+// paired with releaseTurnSlot) even when no cap is configured.
+func (s *Server) acquireTurnSlot(ctx context.Context, queue bool) *rpcError {
+	if s.turnSem == nil {
+		s.metrics.turnsInFlight.Add(1)
+		return nil
+	}
+	select {
+	case s.turnSem <- struct{}{}:
+		s.metrics.turnsInFlight.Add(1)
+		return nil
+	default:
+	}
+	if !queue {
+		return &rpcError{Code: codeServerBusy, Message: fmt.Sprintf(
+			"all %d turn slots are in use (set queueIfBusy to wait for one)", s.cfg.MaxConcurrentTurns)}
+	}
+	timer := time.NewTimer(turnQueueTimeout)
+	defer timer.Stop()
+	select {
+	case s.turnSem <- struct{}{}:
+		s.metrics.turnsInFlight.Add(1)
+		return nil
+	case <-timer.C:
+		return &rpcError{Code: codeServerBusy, Message: fmt.Sprintf(
+			"no turn slot freed up within %v", turnQueueTimeout)}
+	case <-ctx.Done():
+		return &rpcError{Code: codeServerBusy, Message: "request ended while queued for a turn slot"}
+	}
+}
+
+// releaseTurnSlot returns a slot claimed by acquireTurnSlot.
+func (s *Server) releaseTurnSlot() {
+	s.metrics.turnsInFlight.Add(-1)
+	if s.turnSem != nil {
+		<-s.turnSem
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// createSessionID runs session.create and returns the new session's ID.
+func createSessionID(t *testing.T, srv *Server) string {
+	t.Helper()
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding create result: %v", err)
+	}
+	return created.SessionID
+}
+
+func TestTurnCapRejectsWhenSaturated(t *testing.T) {
+	started := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		if req.Prompt == "hold the slot" {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		onEvent(copilot.StreamEvent{Type: "text", Content: "ok"})
+		return &copilot.MessageResponse{Content: "ok"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.MaxConcurrentTurns = 1
+	})
+	first := createSessionID(t, srv)
+	second := createSessionID(t, srv)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": first, "prompt": "hold the slot",
+	}); rpcErr != nil {
+		t.Fatalf("first send: %v", rpcErr)
+	}
+	<-started
+	_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": second, "prompt": "over the cap",
+	})
+	if rpcErr == nil || rpcErr.Code != codeServerBusy {
+		t.Errorf("saturated send: got %v, want code %d", rpcErr, codeServerBusy)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.cancel", map[string]any{"sessionId": first}); rpcErr != nil {
+		t.Fatalf("session.cancel: %v", rpcErr)
+	}
+	// The slot frees once the cancelled turn's producer exits; the rejected
+	// session can then run.
+	waitFor(t, 2*time.Second, func() bool {
+		_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": second, "prompt": "after the slot freed",
+		})
+		return rpcErr == nil
+	}, "send after slot freed")
+	drainFrames(t, srv.Manager().Get(second), 5*time.Second)
+}
+
+func TestTurnCapQueuesWhenRequested(t *testing.T) {
+	release := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		if req.Prompt == "hold the slot" {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+		}
+		onEvent(copilot.StreamEvent{Type: "text", Content: "ok"})
+		return &copilot.MessageResponse{Content: "ok"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.MaxConcurrentTurns = 1
+	})
+	first := createSessionID(t, srv)
+	second := createSessionID(t, srv)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": first, "prompt": "hold the slot",
+	}); rpcErr != nil {
+		t.Fatalf("first send: %v", rpcErr)
+	}
+	queued := make(chan *rpcError, 1)
+	go func() {
+		_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": second, "prompt": "queued", "queueIfBusy": true,
+		})
+		queued <- rpcErr
+	}()
+	// The queued send must still be waiting, not failed, while the slot is
+	// held.
+	select {
+	case rpcErr := <-queued:
+		t.Fatalf("queued send returned early: %v", rpcErr)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case rpcErr := <-queued:
+		if rpcErr != nil {
+			t.Errorf("queued send after slot freed: %v", rpcErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued send never returned after the slot freed")
+	}
+	drainFrames(t, srv.Manager().Get(second), 5*time.Second)
+}
+
+func TestTurnCapCoversRetry(t *testing.T) {
+	started := make(chan struct{})
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		if req.Prompt == "hold the slot" {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		onEvent(copilot.StreamEvent{Type: "text", Content: "ok"})
+		return &copilot.MessageResponse{Content: "ok"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.MaxConcurrentTurns = 1
+	})
+	first := createSessionID(t, srv)
+	second := createSessionID(t, srv)
+	// Give the second session a user message to retry, and let that turn end.
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": second, "prompt": "original question",
+	}); rpcErr != nil {
+		t.Fatalf("seeding send: %v", rpcErr)
+	}
+	drainFrames(t, srv.Manager().Get(second), 5*time.Second)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": first, "prompt": "hold the slot",
+	}); rpcErr != nil {
+		t.Fatalf("first send: %v", rpcErr)
+	}
+	<-started
+	// The retry must not slip past the cap the way a plain send cannot.
+	_, rpcErr := doRPC(t, srv, "session.retry", map[string]any{"sessionId": second})
+	if rpcErr == nil || rpcErr.Code != codeServerBusy {
+		t.Errorf("saturated retry: got %v, want code %d", rpcErr, codeServerBusy)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.cancel", map[string]any{"sessionId": first}); rpcErr != nil {
+		t.Fatalf("session.cancel: %v", rpcErr)
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		_, rpcErr := doRPC(t, srv, "session.retry", map[string]any{"sessionId": second})
+		return rpcErr == nil
+	}, "retry after slot freed")
+	drainFrames(t, srv.Manager().Get(second), 5*time.Second)
+}
+
+func TestTurnCapBoundsCompareFanOut(t *testing.T) {
+	var inFlight, peak atomic.Int64
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		n := inFlight.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		inFlight.Add(-1)
+		onEvent(copilot.StreamEvent{Type: "text", Content: "ok"})
+		return &copilot.MessageResponse{Content: "ok"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.MaxConcurrentTurns = 1
+	})
+	result, rpcErr := doRPC(t, srv, "session.compare", map[string]any{
+		"prompt": "which is best?", "models": []string{"gpt-4o", "gpt-4o-mini", "o1"},
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.compare: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	frames := drainCompareFrames(t, srv, created.SessionID, 10*time.Second)
+	// Queued columns still finish: one tagged done per model plus the final
+	// untagged one.
+	dones := 0
+	for _, f := range frames {
+		if f["type"] == "done" && f["modelId"] != nil {
+			dones++
+		}
+	}
+	if dones != 3 {
+		t.Errorf("got %d tagged done frames, want 3:\n%v", dones, frames)
+	}
+	if got := peak.Load(); got > 1 {
+		t.Errorf("compare ran %d SDK sends concurrently past a cap of 1", got)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestTurnDurationCeiling(t *testing.T) {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		// Stream indefinitely; only the turn-duration ceiling stops it.
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Millisecond):
+				onEvent(copilot.StreamEvent{Type: "text", Content: "more "})
+			}
+		}
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) { cfg.MaxTurnDuration = 100 * time.Millisecond })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "go on forever"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 5*time.Second)
+	var sawTimeout bool
+	for _, f := range frames {
+		switch f["type"] {
+		case "timeout":
+			sawTimeout = true
+			if f["stage"] != "generation" {
+				t.Errorf("timeout stage = %v, want generation", f["stage"])
+			}
+		case "error":
+			t.Errorf("unexpected error frame after timeout: %v", f)
+		}
+	}
+	if !sawTimeout {
+		t.Fatalf("no timeout frame in %v", frames)
+	}
+	if last := frames[len(frames)-1]; last["type"] != "done" {
+		t.Errorf("last frame = %v, want done", last)
+	}
+}
+
+func TestMaxTurnSecondsValidation(t *testing.T) {
+	srv := newMockServer(t, func(cfg *Config) { cfg.MaxTurnDuration = time.Minute })
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"maxTurnSeconds": 120}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("got %v, want code %d for maxTurnSeconds above the ceiling", rpcErr, codeInvalidParams)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"maxTurnSeconds": -1}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Fatalf("got %v, want code %d for negative maxTurnSeconds", rpcErr, codeInvalidParams)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"maxTurnSeconds": 30}); rpcErr != nil {
+		t.Fatalf("session.create with a valid maxTurnSeconds: %v", rpcErr)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// unknownEventClient emits an event type this bridge has never heard of in
+// the middle of an otherwise normal turn.
+func unknownEventClient() *fakeClient {
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "before"})
+		onEvent(copilot.StreamEvent{Type: "hologram", Content: "from the future"})
+		onEvent(copilot.StreamEvent{Type: "text", Content: "after"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "beforeafter"}, nil
+	}
+	return fake
+}
+
+func TestUnknownEventSkippedInProduction(t *testing.T) {
+	srv, _ := newFakeServer(t, unknownEventClient(), nil)
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 2*time.Second)
+	texts := 0
+	for _, f := range frames {
+		switch f["type"] {
+		case "unknown", "hologram":
+			t.Errorf("unknown event leaked into the stream: %v", f)
+		case "text":
+			texts++
+		}
+	}
+	if texts != 2 {
+		t.Errorf("text frames = %d, want 2 (the turn must survive the unknown event)", texts)
+	}
+	if last := frames[len(frames)-1]; last["type"] != "done" {
+		t.Errorf("last frame = %v, want done", last)
+	}
+}
+
+func TestUnknownEventSurfacedInDebug(t *testing.T) {
+	srv, _ := newFakeServer(t, unknownEventClient(), func(cfg *Config) { cfg.Debug = true })
+	sess, _ := srv.Manager().Create("gpt-4o", "sdk-1", "")
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{"sessionId": sess.ID, "prompt": "hi"}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	frames := drainFrames(t, sess, 2*time.Second)
+	found := false
+	for _, f := range frames {
+		if f["type"] != "unknown" {
+			continue
+		}
+		found = true
+		raw, ok := f["raw"].(map[string]any)
+		if !ok || raw["type"] != "hologram" || raw["content"] != "from the future" {
+			t.Errorf("unknown frame raw payload = %v", f["raw"])
+		}
+	}
+	if !found {
+		t.Error("no unknown frame in debug mode")
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import "unicode/utf8"
+
+// utf8Assembler reassembles multibyte UTF-8 sequences the SDK split across
+// stream chunks. Emitting a split sequence as-is would put invalid UTF-8
+// into a frame's JSON string (encoding/json turns it into U+FFFD), so the
+// producer holds back a trailing incomplete sequence and prepends it to the
+// next chunk. One assembler serves one turn's stream of a single frame type.
+type utf8Assembler struct {
+	pending []byte
+}
+
+// add appends a chunk and returns the longest prefix that ends on a complete
+// character, holding the rest for the next call. It returns "" when the
+// whole chunk is a partial sequence.
+func (a *utf8Assembler) add(chunk string) string {
+	s := append(a.pending, chunk...)
+	keep := len(s) - incompleteTailLen(s)
+	a.pending = append([]byte(nil), s[keep:]...)
+	return string(s[:keep])
+}
+
+// flush returns whatever is still buffered at the end of the turn. A
+// non-empty result is a sequence the SDK never finished; it is emitted
+// verbatim and JSON encoding will map it to U+FFFD.
+func (a *utf8Assembler) flush() string {
+	rest := string(a.pending)
+	a.pending = nil
+	return rest
+}
+
+// incompleteTailLen reports how many trailing bytes of s form the start of a
+// multibyte UTF-8 sequence whose continuation has not arrived yet. Complete
+// or outright invalid sequences report zero — only a genuinely unfinished
+// tail is worth holding back.
+func incompleteTailLen(s []byte) int {
+	n := len(s)
+	for i := 1; i <= utf8.UTFMax && i <= n; i++ {
+		b := s[n-i]
+		if b < 0x80 {
+			return 0 // ASCII: the tail is complete.
+		}
+		if b < 0xC0 {
+			continue // Continuation byte: keep looking for the start.
+		}
+		// Start byte: expected sequence length tells us if it is still open.
+		var want int
+		switch {
+		case b < 0xE0:
+			want = 2
+		case b < 0xF0:
+			want = 3
+		default:
+			want = 4
+		}
+		if i < want {
+			return i
+		}
+		return 0
+	}
+	return 0
+}
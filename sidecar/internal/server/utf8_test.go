@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestUTF8AssemblerSplitSequences(t *testing.T) {
+	// "héllo 🙂" holds a 2-byte and a 4-byte sequence; feeding it
+	// byte-by-byte splits both across every possible boundary.
+	full := "héllo 🙂"
+	raw := []byte(full)
+	var a utf8Assembler
+	var out string
+	for i := range raw {
+		got := a.add(string(raw[i : i+1]))
+		if !utf8.ValidString(got) {
+			t.Fatalf("emitted invalid UTF-8 %q at byte %d", got, i)
+		}
+		out += got
+	}
+	out += a.flush()
+	if out != full {
+		t.Errorf("reassembled %q, want %q", out, full)
+	}
+}
+
+func TestUTF8AssemblerFlushUnfinished(t *testing.T) {
+	var a utf8Assembler
+	if got := a.add(string([]byte{0xF0, 0x9F})); got != "" {
+		t.Errorf("partial sequence emitted early: %q", got)
+	}
+	if got := a.flush(); got != string([]byte{0xF0, 0x9F}) {
+		t.Errorf("flush = %q, want the buffered bytes back", got)
+	}
+	if got := a.flush(); got != "" {
+		t.Errorf("second flush = %q, want empty", got)
+	}
+}
+
+func TestSplitMultibyteCharacterAcrossChunks(t *testing.T) {
+	emoji := []byte("🙂") // 4 bytes
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		onEvent(copilot.StreamEvent{Type: "text", Content: "ok " + string(emoji[:2])})
+		onEvent(copilot.StreamEvent{Type: "text", Content: string(emoji[2:]) + " done"})
+		return &copilot.MessageResponse{MessageID: "msg-1", Content: "ok 🙂 done"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "smile",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	text := ""
+	for _, f := range drainFrames(t, srv.Manager().Get(created.SessionID), 5*time.Second) {
+		if f["type"] != "text" {
+			continue
+		}
+		chunk := f["content"].(string)
+		if !utf8.ValidString(chunk) {
+			t.Errorf("text frame carries invalid UTF-8: %q", chunk)
+		}
+		text += chunk
+	}
+	if text != "ok 🙂 done" {
+		t.Errorf("reassembled stream = %q, want %q", text, "ok 🙂 done")
+	}
+}
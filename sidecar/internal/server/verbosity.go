@@ -0,0 +1,46 @@
+package server
+
+import "fmt"
+
+// Verbosity: session.send's friendly length knob. A client asking for
+// "concise" or "detailed" should not have to guess good raw token counts,
+// so each level maps to a maxTokens value (configurable via
+// --verbosity-concise-tokens / --verbosity-detailed-tokens) plus a standing
+// instruction appended to the prompt at the SDK boundary — history keeps
+// the user's words, like prompt wrapping. An explicit maxTokens on the send
+// wins over the level's; the instruction applies either way.
+
+const (
+	defaultConciseTokens  = 256
+	defaultDetailedTokens = 4096
+
+	conciseInstruction  = "Be concise: answer in as few words as the question allows."
+	detailedInstruction = "Be thorough: explain your reasoning and cover edge cases."
+)
+
+// applyVerbosity resolves a send's verbosity level into its token cap and
+// instruction, mutating the params in place, and returns the meta-frame
+// message describing the effective setting ("" when no level was asked for).
+func (s *Server) applyVerbosity(p *sessionSendParams) (string, *rpcError) {
+	var tokens int
+	var instruction string
+	switch p.Verbosity {
+	case "":
+		return "", nil
+	case "normal":
+		// Accepted for symmetry; the SDK's defaults already are "normal".
+		return "verbosity normal: no token cap or instruction applied", nil
+	case "concise":
+		tokens, instruction = s.cfg.VerbosityConciseTokens, conciseInstruction
+	case "detailed":
+		tokens, instruction = s.cfg.VerbosityDetailedTokens, detailedInstruction
+	default:
+		return "", errInvalidParams("verbosity %q is not one of concise, normal, detailed", p.Verbosity)
+	}
+	p.verbosityInstruction = instruction
+	if p.MaxTokens > 0 {
+		return fmt.Sprintf("verbosity %s: keeping explicit maxTokens %d, instruction applied", p.Verbosity, p.MaxTokens), nil
+	}
+	p.MaxTokens = tokens
+	return fmt.Sprintf("verbosity %s: maxTokens %d, instruction applied", p.Verbosity, tokens), nil
+}
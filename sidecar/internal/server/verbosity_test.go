@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+func TestVerbosityMapping(t *testing.T) {
+	var gotReq copilot.MessageRequest
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		gotReq = req
+		return &copilot.MessageResponse{Content: "ok", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, nil)
+	sendWith := func(t *testing.T, params map[string]any) (copilot.MessageRequest, string) {
+		t.Helper()
+		id := createSessionID(t, srv)
+		sess := srv.Manager().Get(id)
+		params["sessionId"] = id
+		if _, rpcErr := doRPC(t, srv, "session.send", params); rpcErr != nil {
+			t.Fatalf("session.send: %v", rpcErr)
+		}
+		meta := ""
+		for _, f := range drainFrames(t, sess, 5*time.Second) {
+			if f["type"] == "meta" {
+				meta, _ = f["message"].(string)
+			}
+		}
+		return gotReq, meta
+	}
+
+	req, meta := sendWith(t, map[string]any{"prompt": "explain", "verbosity": "concise"})
+	if req.MaxTokens != defaultConciseTokens {
+		t.Errorf("concise maxTokens = %d, want the default %d", req.MaxTokens, defaultConciseTokens)
+	}
+	if !strings.Contains(req.Prompt, conciseInstruction) {
+		t.Errorf("concise prompt = %q, want the instruction appended", req.Prompt)
+	}
+	if !strings.Contains(meta, "verbosity concise") {
+		t.Errorf("meta = %q, want the effective concise setting", meta)
+	}
+
+	req, _ = sendWith(t, map[string]any{"prompt": "explain", "verbosity": "detailed"})
+	if req.MaxTokens != defaultDetailedTokens || !strings.Contains(req.Prompt, detailedInstruction) {
+		t.Errorf("detailed mapped to maxTokens %d, prompt %q", req.MaxTokens, req.Prompt)
+	}
+
+	// An explicit maxTokens wins over the level's; the instruction stays.
+	req, meta = sendWith(t, map[string]any{"prompt": "explain", "verbosity": "concise", "maxTokens": 512})
+	if req.MaxTokens != 512 {
+		t.Errorf("explicit maxTokens = %d, want 512 to win over the level", req.MaxTokens)
+	}
+	if !strings.Contains(req.Prompt, conciseInstruction) || !strings.Contains(meta, "explicit maxTokens 512") {
+		t.Errorf("explicit-tokens send: prompt %q, meta %q", req.Prompt, meta)
+	}
+
+	// "normal" is a no-op knob position, and history keeps the user's words.
+	req, meta = sendWith(t, map[string]any{"prompt": "explain", "verbosity": "normal"})
+	if req.MaxTokens != 0 || req.Prompt != "explain" {
+		t.Errorf("normal send: maxTokens %d, prompt %q", req.MaxTokens, req.Prompt)
+	}
+	if !strings.Contains(meta, "verbosity normal") {
+		t.Errorf("meta = %q, want the normal setting announced", meta)
+	}
+}
+
+func TestVerbosityConfigurableAndValidated(t *testing.T) {
+	var gotReq copilot.MessageRequest
+	fake := newFakeClient()
+	fake.send = func(ctx context.Context, sessionID string, req copilot.MessageRequest, onEvent copilot.EventHandler) (*copilot.MessageResponse, error) {
+		gotReq = req
+		return &copilot.MessageResponse{Content: "ok", FinishReason: "stop"}, nil
+	}
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.VerbosityConciseTokens = 64
+	})
+	id := createSessionID(t, srv)
+	sess := srv.Manager().Get(id)
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "hi", "verbosity": "concise",
+	}); rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	drainFrames(t, sess, 5*time.Second)
+	if gotReq.MaxTokens != 64 {
+		t.Errorf("configured concise maxTokens = %d, want 64", gotReq.MaxTokens)
+	}
+
+	if _, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": id, "prompt": "hi", "verbosity": "medium",
+	}); rpcErr == nil || rpcErr.Code != codeInvalidParams {
+		t.Errorf("unknown verbosity: got %v, want code %d", rpcErr, codeInvalidParams)
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// maxWarmSessionAge bounds how long a pre-created SDK session sits in the
+// pool before being recycled. The CLI may expire idle sessions on its side;
+// handing out one of those would trade cold-start latency for a confusing
+// first-send failure.
+const maxWarmSessionAge = 10 * time.Minute
+
+// warmPool pre-creates SDK sessions so the first session.create after
+// startup does not pay the CLI's cold-start cost. Only vanilla sessions are
+// pooled — default model, no system prompt, no working directory — anything
+// else falls back to on-demand creation. The pool refills in the background
+// after each take.
+type warmPool struct {
+	client copilot.Client
+	model  string
+	size   int
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	entries []warmEntry
+	closed  bool
+
+	refill chan struct{}
+	stop   chan struct{}
+}
+
+type warmEntry struct {
+	id      string
+	created time.Time
+}
+
+func newWarmPool(client copilot.Client, model string, size int) *warmPool {
+	return &warmPool{
+		client: client,
+		model:  model,
+		size:   size,
+		maxAge: maxWarmSessionAge,
+		refill: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// start launches the background filler and triggers the initial fill.
+func (p *warmPool) start() {
+	go p.run()
+	p.kick()
+}
+
+func (p *warmPool) run() {
+	// The sweep interval tracks the max age so a stale entry never lingers
+	// much past its expiry.
+	ticker := time.NewTicker(p.maxAge / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-p.refill:
+		case <-ticker.C:
+			p.recycleStale()
+		}
+		p.fill()
+	}
+}
+
+// kick nudges the filler without blocking.
+func (p *warmPool) kick() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+// take hands out a warm SDK session ID, or "" when the pool is empty (the
+// caller then creates one on demand). Stale entries encountered on the way
+// are destroyed rather than handed out.
+func (p *warmPool) take() string {
+	p.mu.Lock()
+	var id string
+	now := time.Now()
+	for id == "" && len(p.entries) > 0 {
+		e := p.entries[0]
+		p.entries = p.entries[1:]
+		if now.Sub(e.created) > p.maxAge {
+			go p.destroy(e.id)
+			continue
+		}
+		id = e.id
+	}
+	p.mu.Unlock()
+	p.kick()
+	return id
+}
+
+// fill creates sessions until the pool is at size, stopping early on error;
+// the next kick or sweep retries.
+func (p *warmPool) fill() {
+	for {
+		p.mu.Lock()
+		need := p.size - len(p.entries)
+		closed := p.closed
+		p.mu.Unlock()
+		if closed || need <= 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		id, err := p.client.CreateSession(ctx, copilot.SessionConfig{Model: p.model})
+		cancel()
+		if err != nil {
+			log.Printf("warm pool: creating session: %v", err)
+			return
+		}
+		p.mu.Lock()
+		if p.closed || len(p.entries) >= p.size {
+			p.mu.Unlock()
+			go p.destroy(id)
+			return
+		}
+		p.entries = append(p.entries, warmEntry{id: id, created: time.Now()})
+		p.mu.Unlock()
+	}
+}
+
+// recycleStale destroys pooled sessions past the max age; fill replaces them.
+func (p *warmPool) recycleStale() {
+	cutoff := time.Now().Add(-p.maxAge)
+	p.mu.Lock()
+	kept := p.entries[:0]
+	for _, e := range p.entries {
+		if e.created.Before(cutoff) {
+			go p.destroy(e.id)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	p.entries = kept
+	p.mu.Unlock()
+}
+
+// close stops the filler and destroys every pooled session.
+func (p *warmPool) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	entries := p.entries
+	p.entries = nil
+	p.mu.Unlock()
+	close(p.stop)
+	for _, e := range entries {
+		p.destroy(e.id)
+	}
+}
+
+func (p *warmPool) destroy(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.client.DestroySession(ctx, id); err != nil {
+		log.Printf("warm pool: destroying session %s: %v", id, err)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// waitFor polls until cond holds or the deadline passes.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWarmPoolHandsOutPrecreatedSessions(t *testing.T) {
+	fake := newFakeClient()
+	srv, _ := newFakeServer(t, fake, func(cfg *Config) {
+		cfg.WarmSessions = 2
+		cfg.DefaultModel = "gpt-4o"
+	})
+	t.Cleanup(srv.Close)
+	waitFor(t, 2*time.Second, func() bool { return fake.createCalls.Load() == 2 },
+		"pool never pre-created its sessions")
+
+	result, rpcErr := doRPC(t, srv, "session.create", map[string]any{})
+	if rpcErr != nil {
+		t.Fatalf("session.create: %v", rpcErr)
+	}
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if sdkID := srv.Manager().Get(created.SessionID).SDKID; sdkID != "sdk-1" && sdkID != "sdk-2" {
+		t.Errorf("SDKID = %q, want a pooled session", sdkID)
+	}
+	// The background filler replaces the taken session.
+	waitFor(t, 2*time.Second, func() bool { return fake.createCalls.Load() == 3 },
+		"pool never refilled after take")
+
+	// Custom configuration bypasses the pool.
+	if _, rpcErr := doRPC(t, srv, "session.create", map[string]any{"systemPrompt": "be terse"}); rpcErr != nil {
+		t.Fatalf("session.create with systemPrompt: %v", rpcErr)
+	}
+	if got := fake.createCalls.Load(); got != 4 {
+		t.Errorf("createCalls = %d after custom create, want an on-demand creation", got)
+	}
+}
+
+func TestWarmPoolRecyclesStaleSessions(t *testing.T) {
+	fake := newFakeClient()
+	p := newWarmPool(fake, "gpt-4o", 1)
+	p.maxAge = 10 * time.Millisecond
+	p.start()
+	t.Cleanup(p.close)
+	waitFor(t, 2*time.Second, func() bool { return fake.createCalls.Load() >= 1 },
+		"pool never filled")
+	// Entries age out faster than the sweep interval here, so the pool must
+	// keep destroying stale sessions and creating replacements.
+	waitFor(t, 2*time.Second, func() bool { return fake.destroyCalls.Load() >= 1 },
+		"stale session never destroyed")
+	waitFor(t, 2*time.Second, func() bool { return fake.createCalls.Load() >= 2 },
+		"stale session never replaced")
+}
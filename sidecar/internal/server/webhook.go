@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// webhookPayload is the JSON body POSTed to a send's webhookUrl when the
+// turn ends: the assembled result on success, or error when the turn failed.
+type webhookPayload struct {
+	SessionID    string             `json:"sessionId"`
+	MessageID    string             `json:"messageId,omitempty"`
+	Content      string             `json:"content,omitempty"`
+	FinishReason string             `json:"finishReason,omitempty"`
+	Usage        *copilot.Usage     `json:"usage,omitempty"`
+	Citations    []copilot.Citation `json:"citations,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// webhookAttempts bounds delivery retries; webhookRetryDelay is the backoff
+// before the first retry and doubles after each. A var so tests can shorten
+// it.
+const webhookAttempts = 3
+
+var webhookRetryDelay = 500 * time.Millisecond
+
+// webhookHTTPClient bounds each delivery attempt; a webhook that hangs must
+// not pin the delivery goroutine past its retries.
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// validateWebhookURL rejects anything but an absolute http(s) URL before the
+// turn starts, so a bad webhook fails the send rather than losing the result.
+func validateWebhookURL(raw string) *rpcError {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return errInvalidParams("webhookUrl: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errInvalidParams("webhookUrl must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// deliverWebhook POSTs the payload, retrying non-2xx responses and transport
+// errors up to webhookAttempts with doubling backoff. It runs on its own
+// goroutine after the done frame; exhausted retries are logged, never
+// surfaced to the turn.
+func (s *Server) deliverWebhook(target string, payload webhookPayload) {
+	if s.redactor != nil && payload.Content != "" {
+		// The webhook carries the same redacted form the stream did.
+		payload.Content = s.redactor.apply(payload.Content)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("session %s: encoding webhook payload: %v", payload.SessionID, err)
+		return
+	}
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := webhookHTTPClient.Post(target, "application/json", bytes.NewReader(body))
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return
+			}
+			err = fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		if attempt >= webhookAttempts {
+			log.Printf("session %s: webhook delivery failed after %d attempts: %v", payload.SessionID, attempt, err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
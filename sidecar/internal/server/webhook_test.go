@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliveryOnDone(t *testing.T) {
+	oldDelay := webhookRetryDelay
+	webhookRetryDelay = 10 * time.Millisecond
+	defer func() { webhookRetryDelay = oldDelay }()
+
+	payloads := make(chan webhookPayload, 4)
+	var calls atomic.Int64
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// First attempt fails so delivery has to retry.
+		if calls.Add(1) == 1 {
+			http.Error(w, "not yet", http.StatusBadGateway)
+			return
+		}
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decoding webhook body: %v", err)
+		}
+		payloads <- p
+	}))
+	defer hook.Close()
+
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	sendResult, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+		"sessionId": created.SessionID, "prompt": "hello", "webhookUrl": hook.URL,
+	})
+	if rpcErr != nil {
+		t.Fatalf("session.send: %v", rpcErr)
+	}
+	var sent map[string]any
+	if err := json.Unmarshal(sendResult, &sent); err != nil {
+		t.Fatalf("decoding send result: %v", err)
+	}
+	if sent["webhook"] != true {
+		t.Errorf("send result = %v, want webhook:true", sent)
+	}
+	if _, ok := sent["streamUrl"]; ok {
+		t.Errorf("send result should omit streamUrl: %v", sent)
+	}
+
+	select {
+	case p := <-payloads:
+		if p.SessionID != created.SessionID || p.Content != "ok" {
+			t.Errorf("webhook payload = %+v", p)
+		}
+		if p.Error != "" {
+			t.Errorf("unexpected error in payload: %q", p.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was never delivered")
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("webhook attempts = %d, want 2 (one failure, one success)", got)
+	}
+}
+
+func TestWebhookURLValidation(t *testing.T) {
+	srv, _ := newFakeServer(t, newFakeClient(), nil)
+	result, _ := doRPC(t, srv, "session.create", map[string]any{"model": "gpt-4o"})
+	var created struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &created); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	for _, bad := range []string{"not a url\x7f", "ftp://host/hook", "/relative/path"} {
+		_, rpcErr := doRPC(t, srv, "session.send", map[string]any{
+			"sessionId": created.SessionID, "prompt": "hi", "webhookUrl": bad,
+		})
+		if rpcErr == nil || rpcErr.Code != codeInvalidParams {
+			t.Errorf("webhookUrl %q: got %v, want code %d", bad, rpcErr, codeInvalidParams)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCloseDuringTurnDefersTeardown(t *testing.T) {
+	m := NewManager(0)
+	s, _ := m.Create("gpt-4o", "sdk-1", "")
+	if !s.BeginTurn() {
+		t.Fatal("BeginTurn on a fresh session failed")
+	}
+	s.Close()
+	if !s.Closing() {
+		t.Error("session with a turn in flight should be closing, not closed")
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Error("Close did not signal the done channel")
+	}
+	if s.BeginTurn() {
+		t.Error("BeginTurn succeeded on a closing session")
+	}
+	// EventChan must stay open — and writable-safe — until the producer
+	// releases the session.
+	s.Publish([]byte(`{"type":"text"}`))
+	select {
+	case <-s.EventChan:
+		t.Error("publish on a closing session should be dropped")
+	default:
+	}
+	s.EndTurn()
+	if s.Closing() || !s.Closed() {
+		t.Error("EndTurn on a closing session should complete the close")
+	}
+	if _, ok := <-s.EventChan; ok {
+		t.Error("EventChan not closed after the deferred teardown")
+	}
+	s.Close()   // idempotent after full teardown
+	s.EndTurn() // and a stray second EndTurn must not re-close EventChan
+}
+
+// TestCloseSendRace interleaves turns and Close on the same session; run
+// under -race it proves a producer can never write to a closed EventChan.
+func TestCloseSendRace(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		m := NewManager(0)
+		s, _ := m.Create("gpt-4o", "sdk-1", "")
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if s.BeginTurn() {
+					s.Publish([]byte(`{"type":"text"}`))
+					s.EndTurn()
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.Close()
+		}()
+		go func() {
+			for range s.EventChan {
+			}
+		}()
+		wg.Wait()
+		// A turn that won the race left the session closing; its EndTurn
+		// has run by now, so the state must have settled to closed.
+		if s.Closing() || !s.Closed() {
+			t.Fatalf("iteration %d: session not fully closed after Close and EndTurn", i)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package session
+
+import "log"
+
+// EventListener observes bridge lifecycle events — the extension point for
+// auditing and analytics integrations that would otherwise have to fork.
+// Every method is invoked on its own goroutine, so a slow listener never
+// blocks the serving path; a panicking listener is recovered and logged.
+// Methods may be called concurrently and events carry no cross-session
+// ordering guarantee.
+type EventListener interface {
+	// SessionCreated fires when Create registers a new session. Idempotent
+	// replays of an earlier create do not fire it.
+	SessionCreated(sessionID, model string)
+	// SessionClosed fires when a session leaves the manager: session.close,
+	// idle eviction, or shutdown.
+	SessionClosed(sessionID string)
+	// MessageSent fires when a send claims its turn slot.
+	MessageSent(sessionID, messageID string)
+	// TurnCompleted fires when a turn publishes its done frame.
+	TurnCompleted(sessionID, finishReason string)
+	// ErrorOccurred fires when a turn surfaces an error frame.
+	ErrorOccurred(sessionID string, err error)
+}
+
+// AddListener registers a listener for lifecycle events. Multiple listeners
+// may be registered; each receives every event.
+func (m *Manager) AddListener(l EventListener) {
+	m.mu.Lock()
+	m.listeners = append(m.listeners, l)
+	m.mu.Unlock()
+}
+
+// notify fans one event out to every registered listener, each on its own
+// goroutine with a recover, so listeners can neither block nor crash the
+// caller. Must not be called with m.mu held.
+func (m *Manager) notify(fn func(EventListener)) {
+	m.mu.Lock()
+	listeners := make([]EventListener, len(m.listeners))
+	copy(listeners, m.listeners)
+	m.mu.Unlock()
+	for _, l := range listeners {
+		go func(l EventListener) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("session: event listener panic: %v", r)
+				}
+			}()
+			fn(l)
+		}(l)
+	}
+}
+
+// NotifyMessageSent fires MessageSent. The server layer calls it for events
+// the manager cannot see itself; see also NotifyTurnCompleted and
+// NotifyError.
+func (m *Manager) NotifyMessageSent(sessionID, messageID string) {
+	m.notify(func(l EventListener) { l.MessageSent(sessionID, messageID) })
+}
+
+// NotifyTurnCompleted fires TurnCompleted.
+func (m *Manager) NotifyTurnCompleted(sessionID, finishReason string) {
+	m.notify(func(l EventListener) { l.TurnCompleted(sessionID, finishReason) })
+}
+
+// NotifyError fires ErrorOccurred.
+func (m *Manager) NotifyError(sessionID string, err error) {
+	m.notify(func(l EventListener) { l.ErrorOccurred(sessionID, err) })
+}
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+// chanListener records events on a channel so tests can wait for the
+// asynchronous delivery.
+type chanListener struct {
+	events chan string
+}
+
+func newChanListener() *chanListener {
+	return &chanListener{events: make(chan string, 16)}
+}
+
+func (l *chanListener) SessionCreated(id, model string) { l.events <- "created " + id + " " + model }
+func (l *chanListener) SessionClosed(id string)         { l.events <- "closed " + id }
+func (l *chanListener) MessageSent(id, msgID string)    { l.events <- "sent " + id + " " + msgID }
+func (l *chanListener) TurnCompleted(id, reason string) { l.events <- "turn " + id + " " + reason }
+func (l *chanListener) ErrorOccurred(id string, err error) {
+	l.events <- fmt.Sprintf("error %s %v", id, err)
+}
+
+// waitEvents reads len(want) events and compares them as a set: each
+// listener method runs on its own goroutine, so cross-event order is not
+// guaranteed.
+func waitEvents(t *testing.T, l *chanListener, want ...string) {
+	t.Helper()
+	var got []string
+	for range want {
+		select {
+		case ev := <-l.events:
+			got = append(got, ev)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out; got %v, want %v", got, want)
+		}
+	}
+	sort.Strings(got)
+	sorted := append([]string(nil), want...)
+	sort.Strings(sorted)
+	for i := range sorted {
+		if got[i] != sorted[i] {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+}
+
+// panicListener panics on every event, to prove a bad listener cannot take
+// anything else down.
+type panicListener struct{}
+
+func (panicListener) SessionCreated(string, string) { panic("created") }
+func (panicListener) SessionClosed(string)          { panic("closed") }
+func (panicListener) MessageSent(string, string)    { panic("sent") }
+func (panicListener) TurnCompleted(string, string)  { panic("turn") }
+func (panicListener) ErrorOccurred(string, error)   { panic("error") }
+
+func TestListenersObserveLifecycle(t *testing.T) {
+	m := NewManager(time.Hour)
+	a, b := newChanListener(), newChanListener()
+	m.AddListener(panicListener{}) // must not disturb the others
+	m.AddListener(a)
+	m.AddListener(b)
+
+	s, created := m.Create("gpt-4o", "sdk-1", "")
+	if !created {
+		t.Fatal("Create returned created=false")
+	}
+	m.NotifyMessageSent(s.ID, "msg-1")
+	m.NotifyTurnCompleted(s.ID, "stop")
+	m.Remove(s.ID)
+
+	want := []string{
+		"created " + s.ID + " gpt-4o",
+		"sent " + s.ID + " msg-1",
+		"turn " + s.ID + " stop",
+		"closed " + s.ID,
+	}
+	waitEvents(t, a, want...)
+	waitEvents(t, b, want...)
+
+	// An idempotent replay creates nothing, so only the first keyed create
+	// may fire.
+	s2, created := m.Create("gpt-4o", "sdk-2", "key")
+	if !created {
+		t.Fatal("first keyed create should be new")
+	}
+	if _, created := m.Create("gpt-4o", "sdk-3", "key"); created {
+		t.Fatal("replayed create should not be new")
+	}
+	waitEvents(t, a, "created "+s2.ID+" gpt-4o")
+	select {
+	case ev := <-a.events:
+		t.Fatalf("unexpected extra event %q after idempotent replay", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestListenerSeesEviction(t *testing.T) {
+	m := NewManager(10 * time.Millisecond)
+	l := newChanListener()
+	m.AddListener(l)
+	s, _ := m.Create("gpt-4o", "sdk-1", "")
+	waitEvents(t, l, "created "+s.ID+" gpt-4o")
+	time.Sleep(20 * time.Millisecond)
+	if evicted := m.EvictIdle(); len(evicted) != 1 {
+		t.Fatalf("evicted %d sessions, want 1", len(evicted))
+	}
+	waitEvents(t, l, "closed "+s.ID)
+}
@@ -0,0 +1,258 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDGenerator produces bridge session IDs. The default is random hex;
+// tests inject SequentialIDs so session IDs are deterministic and
+// log-friendly.
+type IDGenerator interface {
+	NewID() string
+}
+
+// randomIDs generates random 128-bit hex IDs.
+type randomIDs struct{}
+
+func (randomIDs) NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("session: reading random ID: %v", err))
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// SequentialIDs generates "prefix-1", "prefix-2", ... for deterministic
+// tests and readable logs.
+type SequentialIDs struct {
+	Prefix string
+	n      atomic.Int64
+}
+
+// NewID implements IDGenerator.
+func (g *SequentialIDs) NewID() string {
+	return fmt.Sprintf("%s-%d", g.Prefix, g.n.Add(1))
+}
+
+// Manager owns all live bridge sessions and evicts the ones that go idle.
+type Manager struct {
+	idleTimeout time.Duration
+	idGen       IDGenerator
+
+	// createdTotal counts sessions ever created; it is monotonic — Remove
+	// and eviction never decrement — so analytics can distinguish lifetime
+	// volume from the current active count (Len).
+	createdTotal atomic.Int64
+
+	// mu guards the maps below. Invariant: nothing is ever called under mu
+	// that can block — no SDK calls, no listener callbacks. The server does
+	// its (slow) SDK work before Create and after Remove, so under heavy
+	// session churn the lock is only ever held for map operations and
+	// unrelated sessions stay responsive.
+	mu       sync.Mutex
+	sessions map[string]*Session
+	// createdByModel counts sessions ever created per model, guarded by mu.
+	createdByModel map[string]int64
+	// idempotency maps a client-supplied idempotency key to the session it
+	// created, so a retried session.create returns the same session.
+	idempotency map[string]string
+
+	onEvict   func(*Session)
+	listeners []EventListener
+}
+
+// NewManager returns a Manager that considers sessions idle after
+// idleTimeout. A zero idleTimeout disables eviction.
+func NewManager(idleTimeout time.Duration) *Manager {
+	return &Manager{
+		idleTimeout:    idleTimeout,
+		idGen:          randomIDs{},
+		sessions:       make(map[string]*Session),
+		idempotency:    make(map[string]string),
+		createdByModel: make(map[string]int64),
+	}
+}
+
+// SetIDGenerator overrides how session IDs are generated. Call before the
+// manager is in use.
+func (m *Manager) SetIDGenerator(gen IDGenerator) {
+	m.idGen = gen
+}
+
+// OnEvict registers a callback invoked (outside the manager lock) for each
+// session removed by idle eviction, so the caller can tear down SDK state.
+func (m *Manager) OnEvict(fn func(*Session)) {
+	m.mu.Lock()
+	m.onEvict = fn
+	m.mu.Unlock()
+}
+
+// Create registers a new session for the given model and SDK session ID.
+// When idempotencyKey is non-empty and was seen before, the original session
+// is returned with created=false.
+func (m *Manager) Create(model, sdkID, idempotencyKey string) (s *Session, created bool) {
+	m.mu.Lock()
+	if idempotencyKey != "" {
+		if id, ok := m.idempotency[idempotencyKey]; ok {
+			if existing, ok := m.sessions[id]; ok {
+				m.mu.Unlock()
+				return existing, false
+			}
+		}
+	}
+	now := time.Now()
+	s = &Session{
+		ID:           m.idGen.NewID(),
+		Model:        model,
+		SDKID:        sdkID,
+		CreatedAt:    now,
+		lastActivity: now,
+		EventChan:    make(chan []byte, eventChanCapacity),
+		done:         make(chan struct{}),
+	}
+	m.sessions[s.ID] = s
+	if idempotencyKey != "" {
+		m.idempotency[idempotencyKey] = s.ID
+	}
+	m.createdTotal.Add(1)
+	m.createdByModel[model]++
+	m.mu.Unlock()
+	m.notify(func(l EventListener) { l.SessionCreated(s.ID, model) })
+	return s, true
+}
+
+// Get returns the session with the given ID, or nil.
+func (m *Manager) Get(id string) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[id]
+}
+
+// Remove closes and deregisters the session with the given ID, returning it,
+// or nil if unknown.
+func (m *Manager) Remove(id string) *Session {
+	m.mu.Lock()
+	s := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	if s != nil {
+		s.Close()
+		m.notify(func(l EventListener) { l.SessionClosed(id) })
+	}
+	return s
+}
+
+// List returns all live sessions ordered by creation time.
+func (m *Manager) List() []*Session {
+	m.mu.Lock()
+	out := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		out = append(out, s)
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Len returns the number of live sessions.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// CloseAll closes and removes every session.
+func (m *Manager) CloseAll() {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.mu.Unlock()
+	for _, s := range sessions {
+		s.Close()
+		id := s.ID
+		m.notify(func(l EventListener) { l.SessionClosed(id) })
+	}
+}
+
+// EvictIdle removes sessions idle for longer than their TTL — the
+// per-session override when one is set, the manager default otherwise — and
+// returns them. It is a no-op when eviction is disabled.
+func (m *Manager) EvictIdle() []*Session {
+	if m.idleTimeout <= 0 {
+		return nil
+	}
+	now := time.Now()
+	m.mu.Lock()
+	var evicted []*Session
+	for id, s := range m.sessions {
+		ttl := s.IdleTTL()
+		if ttl <= 0 {
+			ttl = m.idleTimeout
+		}
+		if s.LastActivity().Before(now.Add(-ttl)) {
+			delete(m.sessions, id)
+			evicted = append(evicted, s)
+		}
+	}
+	onEvict := m.onEvict
+	m.mu.Unlock()
+	for _, s := range evicted {
+		s.Close()
+		if onEvict != nil {
+			onEvict(s)
+		}
+		id := s.ID
+		m.notify(func(l EventListener) { l.SessionClosed(id) })
+	}
+	return evicted
+}
+
+// StartEviction runs EvictIdle periodically until stop is closed.
+func (m *Manager) StartEviction(stop <-chan struct{}) {
+	if m.idleTimeout <= 0 {
+		return
+	}
+	interval := m.idleTimeout / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.EvictIdle()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// CreatedTotal returns how many sessions have ever been created.
+func (m *Manager) CreatedTotal() int64 {
+	return m.createdTotal.Load()
+}
+
+// CreatedByModel returns a copy of the per-model session creation counts.
+func (m *Manager) CreatedByModel() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]int64, len(m.createdByModel))
+	for model, n := range m.createdByModel {
+		out[model] = n
+	}
+	return out
+}
+
+// IdleTimeout returns the configured idle timeout.
+func (m *Manager) IdleTimeout() time.Duration {
+	return m.idleTimeout
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestManager() *Manager {
+	m := NewManager(time.Hour)
+	m.SetIDGenerator(&SequentialIDs{Prefix: "sess"})
+	return m
+}
+
+func TestSequentialIDGenerator(t *testing.T) {
+	m := newTestManager()
+	a, _ := m.Create("gpt-4o", "", "")
+	b, _ := m.Create("gpt-4o", "", "")
+	if a.ID != "sess-1" || b.ID != "sess-2" {
+		t.Errorf("IDs = %q, %q; want sess-1, sess-2", a.ID, b.ID)
+	}
+	if got := m.List(); len(got) != 2 || got[0].ID != "sess-1" || got[1].ID != "sess-2" {
+		t.Errorf("List ordering with sequential IDs: %v", got)
+	}
+}
+
+func TestRandomIDsAreDefaultAndUnique(t *testing.T) {
+	m := NewManager(time.Hour)
+	a, _ := m.Create("gpt-4o", "", "")
+	b, _ := m.Create("gpt-4o", "", "")
+	if a.ID == b.ID {
+		t.Errorf("random IDs collided: %q", a.ID)
+	}
+	if len(a.ID) != 32 {
+		t.Errorf("random ID length = %d, want 32 hex chars", len(a.ID))
+	}
+}
+
+func TestIdempotentCreateReturnsSameSession(t *testing.T) {
+	m := newTestManager()
+	a, created := m.Create("gpt-4o", "sdk-1", "key-1")
+	if !created {
+		t.Fatal("first create reported as replay")
+	}
+	b, created := m.Create("gpt-4o", "sdk-2", "key-1")
+	if created {
+		t.Error("second create with same key reported as new")
+	}
+	if a != b {
+		t.Errorf("idempotent create returned a different session: %q vs %q", a.ID, b.ID)
+	}
+}
+
+func TestEvictIdle(t *testing.T) {
+	m := NewManager(10 * time.Millisecond)
+	m.SetIDGenerator(&SequentialIDs{Prefix: "sess"})
+	stale, _ := m.Create("gpt-4o", "", "")
+	time.Sleep(20 * time.Millisecond)
+	fresh, _ := m.Create("gpt-4o", "", "")
+	evicted := m.EvictIdle()
+	if len(evicted) != 1 || evicted[0] != stale {
+		t.Fatalf("evicted %v, want just %q", evicted, stale.ID)
+	}
+	if !stale.Closed() {
+		t.Error("evicted session not closed")
+	}
+	if m.Get(fresh.ID) == nil {
+		t.Error("fresh session was evicted")
+	}
+}
+
+func TestEvictIdleHonorsPerSessionTTL(t *testing.T) {
+	m := NewManager(10 * time.Millisecond)
+	m.SetIDGenerator(&SequentialIDs{Prefix: "sess"})
+	longLived, _ := m.Create("gpt-4o", "", "")
+	longLived.SetIdleTTL(time.Hour)
+	shortLived, _ := m.Create("gpt-4o", "", "")
+	time.Sleep(20 * time.Millisecond)
+	evicted := m.EvictIdle()
+	if len(evicted) != 1 || evicted[0] != shortLived {
+		t.Fatalf("evicted %v, want just %q", evicted, shortLived.ID)
+	}
+	if m.Get(longLived.ID) == nil {
+		t.Error("session with a long TTL was evicted")
+	}
+}
@@ -0,0 +1,633 @@
+// Package session tracks bridge sessions: the mapping from a bridge session
+// ID handed to the plugin to an SDK session, plus the event channel a
+// streaming client drains.
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// eventChanCapacity bounds how many events can queue between the producer
+// and a slow (or absent) stream consumer before events are dropped.
+const eventChanCapacity = 256
+
+// ringCapacity bounds how many recent events are retained for late pollers.
+const ringCapacity = 512
+
+// maxPauseDuration bounds how long a stream stays paused. A client that
+// pauses and never resumes (crashed mid-render, say) would otherwise pin the
+// session buffering forever; past this the next published event flushes the
+// buffer and delivery resumes as if Resume had been called.
+const maxPauseDuration = 2 * time.Minute
+
+// Message is one entry in a session's conversation history.
+type Message struct {
+	// ID is the bridge message ID handed back from session.send, recorded
+	// for user messages so session.retry can reference them. Assistant
+	// messages carry no ID.
+	ID      string `json:"id,omitempty"`
+	Role    string `json:"role"` // "user" or "assistant"
+	Content string `json:"content"`
+	// Context holds the context items the message was sent with — the
+	// pooled and per-message attachments as they went into the SDK request
+	// — so a retry replays the turn exactly.
+	Context   []copilot.ContextItem `json:"context,omitempty"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// Session lifecycle states. A session is active until Close; a Close that
+// arrives while a turn is streaming moves it to closing — the turn is
+// cancelled via the done channel and EventChan stays open until the producer
+// releases it — and EndTurn completes the teardown. A Close with no turn in
+// flight goes straight to closed.
+const (
+	stateActive = iota
+	stateClosing
+	stateClosed
+)
+
+// Session is one bridge session. The zero value is not usable; use
+// Manager.Create.
+type Session struct {
+	ID        string
+	Model     string
+	SDKID     string
+	CreatedAt time.Time
+
+	// EventChan carries JSON-encoded event frames from the turn producer
+	// to the stream handler. It is closed by Close.
+	EventChan chan []byte
+
+	// done is closed by Close so producers blocked on slow SDK calls can
+	// bail out when the session is torn down.
+	done chan struct{}
+
+	dropped     atomic.Int64
+	subscribers atomic.Int64
+
+	mu             sync.Mutex
+	workingDir     string
+	idleTTL        time.Duration
+	coalesceWindow time.Duration
+	paceCPS        int
+	thinking       bool
+	maxTurn        time.Duration
+	promptPrefix   string
+	promptSuffix   string
+	locale         string
+	lastActivity   time.Time
+	state          int // stateActive, stateClosing or stateClosed
+	activeTurn     bool
+	turnCancelled  bool
+	paused         bool
+	pausedAt       time.Time
+	pauseFrom      int // absolute index of the first event buffered by the pause
+	ring           [][]byte
+	ringStart      int // absolute index of ring[0]
+	history        []Message
+	finishReason   string
+	contextPool    []copilot.ContextItem
+}
+
+// SetWorkingDir records the validated base directory for the session's tool
+// and relative-path resolution. Set once at creation.
+func (s *Session) SetWorkingDir(dir string) {
+	s.mu.Lock()
+	s.workingDir = dir
+	s.mu.Unlock()
+}
+
+// WorkingDir returns the session's working directory, or "" if none was set.
+func (s *Session) WorkingDir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.workingDir
+}
+
+// SetIdleTTL overrides the manager's default idle timeout for this session.
+// Zero means "use the default". Set once at creation.
+func (s *Session) SetIdleTTL(ttl time.Duration) {
+	s.mu.Lock()
+	s.idleTTL = ttl
+	s.mu.Unlock()
+}
+
+// IdleTTL returns the session's idle-timeout override, or zero if the
+// manager default applies.
+func (s *Session) IdleTTL() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.idleTTL
+}
+
+// SetCoalesceWindow enables text-frame batching for this session's turns
+// with the given window. Zero disables batching. Set once at creation.
+func (s *Session) SetCoalesceWindow(w time.Duration) {
+	s.mu.Lock()
+	s.coalesceWindow = w
+	s.mu.Unlock()
+}
+
+// CoalesceWindow returns the session's text-frame batching window, or zero
+// when batching is disabled.
+func (s *Session) CoalesceWindow() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.coalesceWindow
+}
+
+// SetPaceCPS enables paced text delivery for this session's turns at the
+// given characters-per-second rate. Zero disables pacing. Set once at
+// creation.
+func (s *Session) SetPaceCPS(cps int) {
+	s.mu.Lock()
+	s.paceCPS = cps
+	s.mu.Unlock()
+}
+
+// PaceCPS returns the session's paced-delivery rate in characters per
+// second, or zero when pacing is disabled.
+func (s *Session) PaceCPS() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paceCPS
+}
+
+// SetMaxTurnDuration overrides the server's turn-duration ceiling for this
+// session. Zero means the server default applies. Set once at creation.
+func (s *Session) SetMaxTurnDuration(d time.Duration) {
+	s.mu.Lock()
+	s.maxTurn = d
+	s.mu.Unlock()
+}
+
+// MaxTurnDuration returns the session's turn-duration override, or zero if
+// the server default applies.
+func (s *Session) MaxTurnDuration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxTurn
+}
+
+// SetThinking opts this session into synthetic thinking frames while a turn
+// waits for its first content. Set once at creation.
+func (s *Session) SetThinking(v bool) {
+	s.mu.Lock()
+	s.thinking = v
+	s.mu.Unlock()
+}
+
+// Thinking reports whether the session opted into thinking frames.
+func (s *Session) Thinking() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.thinking
+}
+
+// SetPromptWrap records the strings wrapped around every user prompt this
+// session sends. The server resolves per-session overrides against its
+// defaults before calling this, so the stored values are final.
+func (s *Session) SetPromptWrap(prefix, suffix string) {
+	s.mu.Lock()
+	s.promptPrefix = prefix
+	s.promptSuffix = suffix
+	s.mu.Unlock()
+}
+
+// PromptWrap returns the session's effective prompt prefix and suffix.
+func (s *Session) PromptWrap() (prefix, suffix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.promptPrefix, s.promptSuffix
+}
+
+// SetLocale records the session's BCP-47 locale preference. The server
+// validates the tag and derives the response-language instruction; the
+// session only remembers it for session.info. Set once at creation.
+func (s *Session) SetLocale(tag string) {
+	s.mu.Lock()
+	s.locale = tag
+	s.mu.Unlock()
+}
+
+// Locale returns the session's locale preference, or "" if none was set.
+func (s *Session) Locale() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locale
+}
+
+// Touch records activity, deferring idle eviction.
+func (s *Session) Touch() {
+	s.mu.Lock()
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
+}
+
+// LastActivity returns the time of the most recent activity.
+func (s *Session) LastActivity() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastActivity
+}
+
+// Closed reports whether Close has been called. It is true while a closing
+// session's last turn is still draining; use Closing to distinguish that
+// window.
+func (s *Session) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state != stateActive
+}
+
+// Closing reports whether Close has been called while a turn was in flight
+// and that turn has not yet released the session.
+func (s *Session) Closing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state == stateClosing
+}
+
+// BeginTurn claims the session's single producer slot. It returns false if
+// close has begun or another turn is already streaming; exactly one producer
+// may write to EventChan per turn.
+func (s *Session) BeginTurn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != stateActive || s.activeTurn {
+		return false
+	}
+	s.activeTurn = true
+	s.turnCancelled = false
+	return true
+}
+
+// EndTurn releases the producer slot claimed by BeginTurn. If a Close
+// arrived mid-turn the session is in the closing state and EndTurn finishes
+// the teardown; EventChan is only ever closed here or in Close, never while
+// a producer could still write to it.
+func (s *Session) EndTurn() {
+	s.mu.Lock()
+	s.activeTurn = false
+	if s.state == stateClosing {
+		s.state = stateClosed
+		close(s.EventChan)
+	}
+	s.mu.Unlock()
+}
+
+// TurnActive reports whether a turn is currently streaming.
+func (s *Session) TurnActive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeTurn
+}
+
+// Close begins session teardown. With no turn in flight it closes EventChan
+// and the done channel immediately; with a turn streaming it moves the
+// session to closing — the done channel cancels the turn and EndTurn closes
+// EventChan once the producer is gone, so the producer can never write to a
+// closed channel. It is idempotent.
+func (s *Session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != stateActive {
+		return
+	}
+	if s.done != nil {
+		close(s.done)
+	}
+	if s.activeTurn {
+		s.state = stateClosing
+		return
+	}
+	s.state = stateClosed
+	close(s.EventChan)
+}
+
+// Done returns a channel closed when the session is closed. Producers whose
+// work outlives a request (SDK sends, tool round trips) select on it so that
+// Remove/CloseAll does not strand them; this is what makes "zero producer
+// goroutines after CloseAll" hold.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Publish offers an event frame to the live channel without blocking and
+// records it in the ring for pollers. Events that would block are dropped
+// and counted.
+func (s *Session) Publish(frame []byte) {
+	s.mu.Lock()
+	if s.state != stateActive {
+		s.mu.Unlock()
+		return
+	}
+	s.appendRingLocked(frame)
+	s.sendLocked(frame)
+	s.mu.Unlock()
+}
+
+// PublishContent publishes a content frame (text/reasoning) unless the
+// current turn has been cancelled, in which case the frame is discarded and
+// false is returned. This upholds the ordering guarantee that no content
+// follows a cancelled frame.
+func (s *Session) PublishContent(frame []byte) bool {
+	s.mu.Lock()
+	if s.state != stateActive || s.turnCancelled {
+		s.mu.Unlock()
+		return false
+	}
+	s.appendRingLocked(frame)
+	s.sendLocked(frame)
+	s.mu.Unlock()
+	return true
+}
+
+// CancelTurn marks the in-flight turn cancelled and publishes the given
+// cancelled frame, atomically with respect to PublishContent so no content
+// frame can slip in after it. Returns false if there is no turn to cancel or
+// it was already cancelled.
+func (s *Session) CancelTurn(frame []byte) bool {
+	s.mu.Lock()
+	if s.state != stateActive || !s.activeTurn || s.turnCancelled {
+		s.mu.Unlock()
+		return false
+	}
+	s.turnCancelled = true
+	s.appendRingLocked(frame)
+	s.sendLocked(frame)
+	s.mu.Unlock()
+	return true
+}
+
+// TurnCancelled reports whether the in-flight turn has been cancelled.
+func (s *Session) TurnCancelled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.turnCancelled
+}
+
+func (s *Session) appendRingLocked(frame []byte) {
+	s.ring = append(s.ring, frame)
+	if len(s.ring) > ringCapacity {
+		s.ring = s.ring[1:]
+		s.ringStart++
+	}
+}
+
+// Pause stops draining published events into EventChan; they buffer in the
+// ring until Resume (or until maxPauseDuration elapses). It returns false if
+// the session is closed.
+func (s *Session) Pause() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != stateActive {
+		return false
+	}
+	if !s.paused {
+		s.paused = true
+		s.pausedAt = time.Now()
+		s.pauseFrom = s.ringStart + len(s.ring)
+	}
+	return true
+}
+
+// Resume flushes events buffered since Pause into EventChan, in order, and
+// restores live delivery. It returns how many events were flushed.
+func (s *Session) Resume() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resumeLocked()
+}
+
+func (s *Session) resumeLocked() int {
+	if !s.paused {
+		return 0
+	}
+	s.paused = false
+	start := s.pauseFrom - s.ringStart
+	if start < 0 {
+		// The ring wrapped during the pause; the overwritten events are gone.
+		start = 0
+	}
+	n := 0
+	for _, frame := range s.ring[start:] {
+		s.sendLocked(frame)
+		n++
+	}
+	return n
+}
+
+// Paused reports whether event delivery is currently paused.
+func (s *Session) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// sendLocked offers the frame to the live channel without blocking. Called
+// with s.mu held so a concurrent Close cannot close EventChan mid-send.
+// While paused, frames stay in the ring instead; an expired pause flushes
+// the buffer and resumes.
+func (s *Session) sendLocked(frame []byte) {
+	if s.paused {
+		if time.Since(s.pausedAt) < maxPauseDuration {
+			return
+		}
+		// The frame was already appended to the ring, so the flush in
+		// resumeLocked delivers it too.
+		s.resumeLocked()
+		return
+	}
+	select {
+	case s.EventChan <- frame:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many events were dropped because EventChan was full.
+func (s *Session) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// AddSubscriber records a stream consumer attaching to EventChan. The
+// returned func detaches it; callers defer it.
+func (s *Session) AddSubscriber() func() {
+	s.subscribers.Add(1)
+	return func() { s.subscribers.Add(-1) }
+}
+
+// Subscribers returns how many stream consumers are currently attached.
+func (s *Session) Subscribers() int64 {
+	return s.subscribers.Load()
+}
+
+// Stats is a point-in-time snapshot of a session's internals, used by the
+// admin.inspectSession RPC to diagnose stuck streams without a debugger.
+type Stats struct {
+	EventChanLen  int
+	EventChanCap  int
+	Subscribers   int64
+	RingLen       int
+	RingStart     int
+	Dropped       int64
+	TurnActive    bool
+	TurnCancelled bool
+	Paused        bool
+	Closed        bool
+	FinishReason  string
+	Messages      int
+}
+
+// Stats returns a consistent snapshot of the session's internal state.
+func (s *Session) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		EventChanLen:  len(s.EventChan),
+		EventChanCap:  cap(s.EventChan),
+		Subscribers:   s.subscribers.Load(),
+		RingLen:       len(s.ring),
+		RingStart:     s.ringStart,
+		Dropped:       s.dropped.Load(),
+		TurnActive:    s.activeTurn,
+		TurnCancelled: s.turnCancelled,
+		Paused:        s.paused,
+		Closed:        s.state != stateActive,
+		FinishReason:  s.finishReason,
+		Messages:      len(s.history),
+	}
+}
+
+// EventsSince returns buffered events with absolute index >= since, and the
+// next index to poll from.
+func (s *Session) EventsSince(since int) ([][]byte, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.ringStart + len(s.ring)
+	if since < s.ringStart {
+		since = s.ringStart
+	}
+	if since >= next {
+		return nil, next
+	}
+	out := make([][]byte, next-since)
+	copy(out, s.ring[since-s.ringStart:])
+	return out, next
+}
+
+// SetFinishReason records why the most recent turn's generation stopped.
+func (s *Session) SetFinishReason(reason string) {
+	s.mu.Lock()
+	s.finishReason = reason
+	s.mu.Unlock()
+}
+
+// FinishReason returns the most recent turn's finish reason.
+func (s *Session) FinishReason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finishReason
+}
+
+// AddContext appends items to the session's persistent context pool, which
+// every subsequent send carries alongside its per-message context. It
+// returns the new pool size.
+func (s *Session) AddContext(items []copilot.ContextItem) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contextPool = append(s.contextPool, items...)
+	return len(s.contextPool)
+}
+
+// ContextPool returns a copy of the persistent context pool.
+func (s *Session) ContextPool() []copilot.ContextItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]copilot.ContextItem, len(s.contextPool))
+	copy(out, s.contextPool)
+	return out
+}
+
+// ClearContext empties the persistent context pool and returns how many
+// items it held.
+func (s *Session) ClearContext() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.contextPool)
+	s.contextPool = nil
+	return n
+}
+
+// AppendHistory appends one message to the conversation history.
+func (s *Session) AppendHistory(role, content string) {
+	s.mu.Lock()
+	s.history = append(s.history, Message{Role: role, Content: content, Timestamp: time.Now()})
+	s.mu.Unlock()
+}
+
+// AppendUserMessage appends a user message with its message ID and the
+// context items it carried, so session.retry can replay it later.
+func (s *Session) AppendUserMessage(id, content string, items []copilot.ContextItem) {
+	s.mu.Lock()
+	s.history = append(s.history, Message{ID: id, Role: "user", Content: content, Context: items, Timestamp: time.Now()})
+	s.mu.Unlock()
+}
+
+// UserMessage returns the user message with the given ID, or the most recent
+// user message when id is empty. The second return is false when no such
+// message exists.
+func (s *Session) UserMessage(id string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if m := s.history[i]; m.Role == "user" && (id == "" || m.ID == id) {
+			return m, true
+		}
+	}
+	return Message{}, false
+}
+
+// ExtendLastAssistant appends content to the most recent assistant message,
+// so a continued (previously truncated) response reads as one message in
+// history and exports. If the last message is not from the assistant the
+// content becomes a new assistant message instead.
+func (s *Session) ExtendLastAssistant(content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.history); n > 0 && s.history[n-1].Role == "assistant" {
+		s.history[n-1].Content += content
+		s.history[n-1].Timestamp = time.Now()
+		return
+	}
+	s.history = append(s.history, Message{Role: "assistant", Content: content, Timestamp: time.Now()})
+}
+
+// ReplaceHistoryPrefix replaces the first n history messages with the given
+// summary message, leaving everything after them untouched. Callers pass the
+// n they snapshotted via History, so messages appended while the summary was
+// being produced survive. It reports false when history no longer has n
+// messages to replace.
+func (s *Session) ReplaceHistoryPrefix(n int, summary Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n <= 0 || n > len(s.history) {
+		return false
+	}
+	s.history = append([]Message{summary}, s.history[n:]...)
+	return true
+}
+
+// History returns a copy of the conversation history.
+func (s *Session) History() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Message, len(s.history))
+	copy(out, s.history)
+	return out
+}
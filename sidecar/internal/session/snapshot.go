@@ -0,0 +1,108 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/catatafishen/ide-agent-for-copilot/sidecar/internal/copilot"
+)
+
+// Snapshot is the portable serialized form of one session: identity,
+// conversation history and creation-time settings — none of the live
+// machinery (event channel, poll ring, turn slot, subscribers). Durations
+// use plain units (seconds, milliseconds) rather than time.Duration so a
+// snapshot stays readable and stable across hosts.
+type Snapshot struct {
+	ID           string    `json:"id"`
+	Model        string    `json:"model"`
+	SDKID        string    `json:"sdkSessionId,omitempty"`
+	WorkingDir   string    `json:"workingDir,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	TTLSeconds   int       `json:"ttlSeconds,omitempty"`
+	// MaxTurnSeconds, CoalesceWindowMs, PaceCharsPerSecond and Thinking
+	// mirror the session.create options of the same names.
+	MaxTurnSeconds     int                   `json:"maxTurnSeconds,omitempty"`
+	CoalesceWindowMs   int                   `json:"coalesceWindowMs,omitempty"`
+	PaceCharsPerSecond int                   `json:"paceCharsPerSecond,omitempty"`
+	Thinking           bool                  `json:"thinking,omitempty"`
+	PromptPrefix       string                `json:"promptPrefix,omitempty"`
+	PromptSuffix       string                `json:"promptSuffix,omitempty"`
+	Locale             string                `json:"locale,omitempty"`
+	FinishReason       string                `json:"finishReason,omitempty"`
+	ContextPool        []copilot.ContextItem `json:"contextPool,omitempty"`
+	History            []Message             `json:"history,omitempty"`
+}
+
+// Snapshot captures the session's durable state under one lock hold, so the
+// result is internally consistent even while a turn is streaming.
+func (s *Session) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := Snapshot{
+		ID:                 s.ID,
+		Model:              s.Model,
+		SDKID:              s.SDKID,
+		WorkingDir:         s.workingDir,
+		CreatedAt:          s.CreatedAt,
+		LastActivity:       s.lastActivity,
+		TTLSeconds:         int(s.idleTTL / time.Second),
+		MaxTurnSeconds:     int(s.maxTurn / time.Second),
+		CoalesceWindowMs:   int(s.coalesceWindow / time.Millisecond),
+		PaceCharsPerSecond: s.paceCPS,
+		Thinking:           s.thinking,
+		PromptPrefix:       s.promptPrefix,
+		PromptSuffix:       s.promptSuffix,
+		Locale:             s.locale,
+		FinishReason:       s.finishReason,
+	}
+	snap.ContextPool = make([]copilot.ContextItem, len(s.contextPool))
+	copy(snap.ContextPool, s.contextPool)
+	snap.History = make([]Message, len(s.history))
+	copy(snap.History, s.history)
+	return snap
+}
+
+// RestoreSession registers a session rebuilt from a snapshot, keeping its
+// original bridge ID but bound to the given (freshly created) SDK session.
+// It fails when the ID is already live, so a restore never clobbers a
+// session that exists on this host. Restored sessions count as created in
+// the manager's statistics and fire SessionCreated like any other.
+func (m *Manager) RestoreSession(snap Snapshot, sdkID string) (*Session, error) {
+	if snap.ID == "" {
+		return nil, fmt.Errorf("session: snapshot has no session ID")
+	}
+	m.mu.Lock()
+	if _, ok := m.sessions[snap.ID]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("session: %s already exists", snap.ID)
+	}
+	s := &Session{
+		ID:           snap.ID,
+		Model:        snap.Model,
+		SDKID:        sdkID,
+		CreatedAt:    snap.CreatedAt,
+		lastActivity: snap.LastActivity,
+		EventChan:    make(chan []byte, eventChanCapacity),
+		done:         make(chan struct{}),
+
+		workingDir:     snap.WorkingDir,
+		idleTTL:        time.Duration(snap.TTLSeconds) * time.Second,
+		maxTurn:        time.Duration(snap.MaxTurnSeconds) * time.Second,
+		coalesceWindow: time.Duration(snap.CoalesceWindowMs) * time.Millisecond,
+		paceCPS:        snap.PaceCharsPerSecond,
+		thinking:       snap.Thinking,
+		promptPrefix:   snap.PromptPrefix,
+		promptSuffix:   snap.PromptSuffix,
+		locale:         snap.Locale,
+		finishReason:   snap.FinishReason,
+		contextPool:    append([]copilot.ContextItem(nil), snap.ContextPool...),
+		history:        append([]Message(nil), snap.History...),
+	}
+	m.sessions[s.ID] = s
+	m.createdTotal.Add(1)
+	m.createdByModel[s.Model]++
+	m.mu.Unlock()
+	m.notify(func(l EventListener) { l.SessionCreated(s.ID, s.Model) })
+	return s, nil
+}